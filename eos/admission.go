@@ -0,0 +1,140 @@
+package eos
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// ErrSlowDown is returned when a gRPC call is rejected because
+// too many calls to the MGM are in progress.
+var ErrSlowDown = errors.New("too many concurrent calls to the MGM")
+
+// AdmissionConfig bounds the number of concurrent gRPC calls
+// to the MGM, protecting the namespace from bursts of requests.
+type AdmissionConfig struct {
+	// MaxCalls is the maximum number of gRPC calls in progress.
+	// A stream counts as a call until it ends.
+	// If not set, the calls are not limited.
+	MaxCalls int `mapstructure:"max_calls"`
+	// QueueSize is the number of calls waiting for a free slot
+	// when MaxCalls is reached. The calls beyond it are
+	// rejected immediately with ErrSlowDown.
+	QueueSize int `mapstructure:"queue_size"`
+	// QueueTimeout is the maximum time a call waits in the queue
+	// before being rejected with ErrSlowDown. Defaults to 1s.
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"`
+}
+
+// admission is a semaphore with a bounded wait queue.
+// A nil admission admits every call.
+type admission struct {
+	slots   chan struct{}
+	queued  atomic.Int64
+	size    int64
+	timeout time.Duration
+}
+
+func newAdmission(cfg AdmissionConfig) *admission {
+	if cfg.MaxCalls <= 0 {
+		return nil
+	}
+	timeout := cfg.QueueTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &admission{
+		slots:   make(chan struct{}, cfg.MaxCalls),
+		size:    int64(cfg.QueueSize),
+		timeout: timeout,
+	}
+}
+
+// acquire takes a slot, waiting in the queue if none is free.
+func (a *admission) acquire(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if a.queued.Add(1) > a.size {
+		a.queued.Add(-1)
+		return ErrSlowDown
+	}
+	defer a.queued.Add(-1)
+
+	t := time.NewTimer(a.timeout)
+	defer t.Stop()
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	case <-t.C:
+		return ErrSlowDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *admission) release() {
+	if a == nil {
+		return
+	}
+	<-a.slots
+}
+
+func admissionUnaryInterceptor(a *admission) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := a.acquire(ctx); err != nil {
+			return err
+		}
+		defer a.release()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// admissionStreamInterceptor holds the slot of a stream until
+// all its messages are received or its context is done.
+func admissionStreamInterceptor(a *admission) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if a == nil {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		if err := a.acquire(ctx); err != nil {
+			return nil, err
+		}
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			a.release()
+			return nil, err
+		}
+		as := &admittedStream{ClientStream: s}
+		release := sync.OnceFunc(a.release)
+		stop := context.AfterFunc(ctx, release)
+		as.done = func() {
+			stop()
+			release()
+		}
+		return as, nil
+	}
+}
+
+type admittedStream struct {
+	grpc.ClientStream
+	done func()
+}
+
+func (s *admittedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.done()
+	}
+	return err
+}
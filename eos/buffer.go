@@ -0,0 +1,28 @@
+package eos
+
+import (
+	"io"
+	"sync"
+)
+
+// transferBufferSize is the size of the buffers used to relay
+// the data of the HTTP transfers.
+const transferBufferSize = 1 << 20
+
+var transferBuffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, transferBufferSize)
+		return &b
+	},
+}
+
+// Copy copies from src to dst like io.Copy, using a buffer taken
+// from a pool shared by all the transfers, instead of allocating
+// a new one for each of them.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	b := transferBuffers.Get().(*[]byte)
+	defer transferBuffers.Put(b)
+	// Hide the ReadFrom of dst (e.g. of an *os.File), that would
+	// otherwise allocate its own buffer and ignore the pooled one.
+	return io.CopyBuffer(struct{ io.Writer }{dst}, src, *b)
+}
@@ -0,0 +1,224 @@
+package eos
+
+import (
+	"container/list"
+	"hash/maphash"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatCacheConfig configures the cache of the results of Stat.
+type StatCacheConfig struct {
+	// Size is the maximum number of results cached.
+	// If not set, the cache is disabled.
+	Size int `mapstructure:"size"`
+	// TTL is the time a result is cached for.
+	// If not set, the cache is disabled.
+	TTL time.Duration `mapstructure:"ttl"`
+	// NegativeTTL is the time the missing paths are cached for,
+	// usually shorter than TTL. If not set, they are not cached.
+	NegativeTTL time.Duration `mapstructure:"negative_ttl"`
+}
+
+type statKey struct {
+	path     string
+	uid, gid uint64
+}
+
+// statEntry is a cached result. A nil md means that the path is missing.
+type statEntry struct {
+	key     statKey
+	md      *erpc.MDResponse
+	expires time.Time
+}
+
+// statCache is an LRU cache of the results of Stat, by path and
+// identity. The writes done through the client invalidate the
+// results of the paths they modify, for all the identities.
+// A nil statCache caches nothing.
+type statCache struct {
+	size   int
+	ttl    time.Duration
+	negTTL time.Duration
+
+	mu     sync.Mutex
+	ll     *list.List                           // of *statEntry, most recent first
+	byPath map[string]map[statKey]*list.Element // path -> cached results
+}
+
+// Enabled tells if the results of Stat are cached.
+func (c StatCacheConfig) Enabled() bool {
+	return c.Size > 0 && c.TTL > 0
+}
+
+func newStatCache(cfg StatCacheConfig) *statCache {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &statCache{
+		size:   cfg.Size,
+		ttl:    cfg.TTL,
+		negTTL: cfg.NegativeTTL,
+		ll:     list.New(),
+		byPath: make(map[string]map[statKey]*list.Element),
+	}
+}
+
+// get returns the cached result of p, that is nil if p is missing.
+func (c *statCache) get(auth Auth, p string) (*erpc.MDResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := statKey{path: p, uid: auth.Uid, gid: auth.Gid}
+	el, ok := c.byPath[p][key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*statEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.md, true
+}
+
+// put caches the result of p, that is nil if p is missing.
+func (c *statCache) put(auth Auth, p string, md *erpc.MDResponse) {
+	if c == nil {
+		return
+	}
+	ttl := c.ttl
+	if md == nil {
+		ttl = c.negTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := statKey{path: p, uid: auth.Uid, gid: auth.Gid}
+	if el, ok := c.byPath[p][key]; ok {
+		c.remove(el)
+	}
+	el := c.ll.PushFront(&statEntry{key: key, md: md, expires: time.Now().Add(ttl)})
+	if c.byPath[p] == nil {
+		c.byPath[p] = make(map[statKey]*list.Element)
+	}
+	c.byPath[p][key] = el
+
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *statCache) remove(el *list.Element) {
+	key := c.ll.Remove(el).(*statEntry).key
+	delete(c.byPath[key.path], key)
+	if len(c.byPath[key.path]) == 0 {
+		delete(c.byPath, key.path)
+	}
+}
+
+// invalidate drops the results of the paths and of their
+// parents, whose content is modified by a write.
+func (c *statCache) invalidate(paths ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range paths {
+		c.invalidatePath(path.Clean(p))
+		c.invalidatePath(path.Dir(path.Clean(p)))
+	}
+}
+
+// invalidateTree drops the results of p, of its parent
+// and of everything below p.
+func (c *statCache) invalidateTree(p string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p = path.Clean(p)
+	c.invalidatePath(path.Dir(p))
+	for cached := range c.byPath {
+		if cached == p || strings.HasPrefix(cached, p+"/") {
+			c.invalidatePath(cached)
+		}
+	}
+}
+
+func (c *statCache) invalidatePath(p string) {
+	for _, el := range c.byPath[p] {
+		c.remove(el)
+	}
+}
+
+// statGenerationSlots is the number of counters
+// the generations of the paths are spread over.
+const statGenerationSlots = 1024
+
+// statGenerations counts the invalidations of the paths, to tell
+// the Stat started before a write from the ones started after it.
+// The paths share a fixed number of counters: a write to a path may
+// change the generation of unrelated ones, that is only a missed
+// sharing of a call. The invalidations of whole trees change the
+// generation of every path.
+type statGenerations struct {
+	seed  maphash.Seed
+	tree  atomic.Uint64
+	paths [statGenerationSlots]atomic.Uint64
+}
+
+func newStatGenerations() *statGenerations {
+	return &statGenerations{seed: maphash.MakeSeed()}
+}
+
+func (g *statGenerations) slot(p string) *atomic.Uint64 {
+	return &g.paths[maphash.String(g.seed, path.Clean(p))%statGenerationSlots]
+}
+
+// of returns the current generation of p.
+func (g *statGenerations) of(p string) uint64 {
+	return g.tree.Load() + g.slot(p).Load()
+}
+
+// bump changes the generation of the paths and of their parents.
+func (g *statGenerations) bump(paths ...string) {
+	for _, p := range paths {
+		g.slot(p).Add(1)
+		g.slot(path.Dir(path.Clean(p))).Add(1)
+	}
+}
+
+// bumpTree changes the generation of every path.
+func (g *statGenerations) bumpTree() {
+	g.tree.Add(1)
+}
+
+// transient returns whether the failure of a call is due to
+// the connection or to the load of the MGM, rather than to
+// its outcome, so that it must not be cached.
+func transient(err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package eos
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// chunkInterval is the time the sending of a chunk of an upload
+// should last at the measured throughput: the chunks are large
+// enough to amortize the handoffs on the fast links, and small
+// enough not to delay the first bytes on the slow ones.
+const chunkInterval = 50 * time.Millisecond
+
+// chunkSizer relays the bodies of the uploads in chunks, reading
+// the next chunk from the client while the current one is sent to
+// the FST. The size of the chunks adapts to the throughput measured
+// on the previous uploads and to the size of the object.
+type chunkSizer struct {
+	min, max int
+	// sizes are the sizes of the chunks, from min to max
+	// doubling each time, each one with its own pool.
+	sizes []int
+	pools []sync.Pool
+
+	// rate is the moving average of the throughput
+	// of the uploads, in bytes per second.
+	rate atomic.Int64
+}
+
+func newChunkSizer(cfg TransportConfig) *chunkSizer {
+	cfg = cfg.withDefaults()
+	s := &chunkSizer{min: cfg.MinChunkSize, max: cfg.MaxChunkSize}
+	for size := s.min; ; size *= 2 {
+		size = min(size, s.max)
+		s.sizes = append(s.sizes, size)
+		if size == s.max {
+			break
+		}
+	}
+	s.pools = make([]sync.Pool, len(s.sizes))
+	for i, size := range s.sizes {
+		s.pools[i].New = func() any {
+			b := make([]byte, size)
+			return &b
+		}
+	}
+	return s
+}
+
+// class returns the index of the chunk size
+// used for an upload of length bytes.
+func (s *chunkSizer) class(length uint64) int {
+	size := s.max
+	if r := s.rate.Load(); r > 0 {
+		size = int(min(r*int64(chunkInterval)/int64(time.Second), int64(s.max)))
+	}
+	size = int(min(uint64(size), length))
+	for i, c := range s.sizes {
+		if c >= size {
+			return i
+		}
+	}
+	return len(s.sizes) - 1
+}
+
+// observe updates the throughput with an upload
+// of length bytes completed in d.
+func (s *chunkSizer) observe(length uint64, d time.Duration) {
+	if length < uint64(s.min) || d <= 0 {
+		// too small to tell the throughput
+		return
+	}
+	r := int64(float64(length) / d.Seconds())
+	if old := s.rate.Load(); old > 0 {
+		r = old + (r-old)/4
+	}
+	s.rate.Store(r)
+}
+
+// wrap returns the body of an upload of length bytes to send,
+// and the function to call once the upload is over.
+// The objects not larger than the smallest chunk are relayed
+// as they are, not to delay them.
+func (s *chunkSizer) wrap(data io.Reader, length uint64) (io.Reader, func()) {
+	if length <= uint64(s.min) {
+		return data, func() {}
+	}
+	c := &chunkedReader{
+		src:    data,
+		pool:   &s.pools[s.class(length)],
+		chunks: make(chan *chunk),
+		done:   make(chan struct{}),
+	}
+	go c.fill()
+	return c, func() { c.once.Do(func() { close(c.done) }) }
+}
+
+type chunk struct {
+	buf *[]byte
+	n   int
+	err error
+}
+
+type chunkedReader struct {
+	src    io.Reader
+	pool   *sync.Pool
+	chunks chan *chunk
+	done   chan struct{}
+	once   sync.Once
+
+	cur *chunk
+	off int
+}
+
+// fill reads the chunks from the source until its end,
+// an error, or the end of the upload.
+func (c *chunkedReader) fill() {
+	for {
+		buf := c.pool.Get().(*[]byte)
+		n, err := io.ReadFull(c.src, *buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		select {
+		case c.chunks <- &chunk{buf: buf, n: n, err: err}:
+		case <-c.done:
+			c.pool.Put(buf)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.cur == nil || c.off == c.cur.n {
+		if c.cur != nil {
+			if c.cur.err != nil {
+				return 0, c.cur.err
+			}
+			c.pool.Put(c.cur.buf)
+		}
+		select {
+		case c.cur = <-c.chunks:
+			c.off = 0
+		case <-c.done:
+			c.cur = nil
+			return 0, io.ErrClosedPipe
+		}
+	}
+	n := copy(p, (*c.cur.buf)[c.off:c.cur.n])
+	c.off += n
+	return n, nil
+}
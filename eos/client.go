@@ -1,19 +1,29 @@
 package eos
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"net/http"
 	"net/url"
 	"os/user"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	erpc "github.com/cern-eos/go-eosgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
@@ -27,6 +37,12 @@ type Auth struct {
 	Uid uint64
 	// Gid is the group id of the user.
 	Gid uint64
+	// Groups are the secondary group ids of the user. The calls to
+	// EOS carry a single group: the one to use is set as Gid.
+	Groups []uint64
+	// Token, if set, is a scoped token returned by Scoped,
+	// authenticating the calls in place of the gateway key.
+	Token string
 }
 
 // Username returns the username associated with the uid.
@@ -40,12 +56,29 @@ func (a *Auth) Username() string {
 
 // Client represents a client for EOS.
 type Client struct {
-	conn       *grpc.ClientConn
+	conn       *connPool
 	grpcClient erpc.EosClient
 	httpClient *http.Client
+	// largeHTTPClient, if set, does the large transfers
+	// on connections not shared with the small ones.
+	largeHTTPClient *http.Client
 
 	httpUrl string
 	authKey string
+
+	log    *slog.Logger
+	tracer trace.Tracer
+
+	metrics      *instruments
+	slowTransfer time.Duration
+	statCache    *statCache
+	chunks       *chunkSizer
+	stats        singleflight.Group
+	statGens     *statGenerations
+	// invalidating is held by the invalidations, and shared
+	// by the results of Stat checked and cached meanwhile.
+	invalidating sync.RWMutex
+	tokens       *tokens
 }
 
 // Config holds the configuration used by the EOS client.
@@ -58,6 +91,34 @@ type Config struct {
 	AuthKey string
 	// Insecure is set to true if the clients does not want to use TLS.
 	Insecure bool
+	// Logger is where the requests are logged at debug level.
+	// If not set, nothing is logged.
+	Logger *slog.Logger
+	// TracerProvider records the spans of the requests to EOS.
+	// If not set, nothing is recorded.
+	TracerProvider trace.TracerProvider
+	// MeterProvider records the durations and the errors of the requests to EOS.
+	// If not set, nothing is recorded.
+	MeterProvider metric.MeterProvider
+	// StatCache configures the cache of the results of Stat.
+	StatCache StatCacheConfig
+	// Admission bounds the number of concurrent gRPC calls.
+	Admission AdmissionConfig
+	// Transport tunes the HTTP client of the transfers.
+	Transport TransportConfig
+	// GRPC tunes the gRPC connections to the MGM.
+	GRPC GRPCConfig
+	// Tokens configures the scoped tokens.
+	Tokens TokensConfig
+	// SeparateLargeTransfers makes the transfers marked with
+	// WithLargeTransfer use their own HTTP connections.
+	SeparateLargeTransfers bool
+	// SlowRPC is the duration above which a gRPC call to the MGM
+	// is logged as a warning. If not set, nothing is logged.
+	SlowRPC time.Duration
+	// SlowTransfer is the duration above which an HTTP transfer
+	// is logged as a warning. If not set, nothing is logged.
+	SlowTransfer time.Duration
 }
 
 // Validate returns nil if the configuration is valid,
@@ -91,10 +152,42 @@ func NewClient(cfg Config) (*Client, error) {
 		return nil, err
 	}
 
-	httpClient := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	tp := cfg.TracerProvider
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	tracer := tp.Tracer(tracerName)
+
+	mp := cfg.MeterProvider
+	if mp == nil {
+		mp = metricnoop.NewMeterProvider()
+	}
+	metrics, err := newInstruments(mp)
+	if err != nil {
+		return nil, err
+	}
+
+	mgm, _ := url.Parse(cfg.HttpURL)
+	newHTTPClient := func() *http.Client {
+		return &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Transport: &traceTransport{
+				base: &metricsTransport{
+					base:    newTransport(cfg.Transport),
+					metrics: metrics,
+					mgmHost: mgm.Host,
+				},
+				tracer:  tracer,
+				mgmHost: mgm.Host,
+			},
+		}
+	}
+	httpClient := newHTTPClient()
+	var largeHTTPClient *http.Client
+	if cfg.SeparateLargeTransfers {
+		largeHTTPClient = newHTTPClient()
 	}
 
 	var creds credentials.TransportCredentials
@@ -109,7 +202,18 @@ func NewClient(cfg Config) (*Client, error) {
 		creds = credentials.NewClientTLSFromCert(certpool, "")
 	}
 
-	conn, err := grpc.NewClient(cfg.GrpcURL, grpc.WithTransportCredentials(creds))
+	log := cfg.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+
+	adm := newAdmission(cfg.Admission)
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(traceUnaryInterceptor(tracer), admissionUnaryInterceptor(adm), metricsUnaryInterceptor(metrics), logUnaryInterceptor(log, cfg.SlowRPC)),
+		grpc.WithChainStreamInterceptor(traceStreamInterceptor(tracer), admissionStreamInterceptor(adm), metricsStreamInterceptor(metrics), logStreamInterceptor(log, cfg.SlowRPC)),
+	}, cfg.GRPC.dialOptions()...)
+	conn, err := newConnPool(cfg.GrpcURL, cfg.GRPC.Connections, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting grpc client: %w", err)
 	}
@@ -121,23 +225,154 @@ func NewClient(cfg Config) (*Client, error) {
 		httpClient: httpClient,
 		httpUrl:    cfg.HttpURL,
 		authKey:    cfg.AuthKey,
+		log:        log,
+		tracer:     tracer,
+
+		largeHTTPClient: largeHTTPClient,
+
+		metrics:      metrics,
+		slowTransfer: cfg.SlowTransfer,
+		statCache:    newStatCache(cfg.StatCache),
+		statGens:     newStatGenerations(),
+		chunks:       newChunkSizer(cfg.Transport),
+		tokens:       newTokens(cfg.Tokens),
 	}
 
 	return client, nil
 }
 
+// SetXattrs sets the extended attributes in set on path,
+// and removes the ones listed in remove.
+func (c *Client) SetXattrs(ctx context.Context, auth Auth, path string, set map[string]string, remove []string) error {
+	defer c.invalidate(path)
+
+	xattrs := make(map[string][]byte, len(set))
+	for k, v := range set {
+		xattrs[k] = []byte(v)
+	}
+
+	req := c.initNsRequest(auth)
+	req.Command = &erpc.NSRequest_Xattr{
+		Xattr: &erpc.NSRequest_SetXAttrRequest{
+			Id: &erpc.MDId{
+				Path: []byte(path),
+			},
+			Xattrs:       xattrs,
+			Keystodelete: remove,
+		},
+	}
+	res, err := c.grpcClient.Exec(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil && res.Error.Code != 0 {
+		return newError(res.Error.Code, res.Error.Msg)
+	}
+	return nil
+}
+
+// Ping checks the MGM is reachable through the gRPC interface,
+// returning the round trip time.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	msg := []byte("eoss3")
+	start := time.Now()
+	res, err := c.grpcClient.Ping(ctx, &erpc.PingRequest{
+		Authkey: c.authKey,
+		Message: msg,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(res.Message, msg) {
+		return 0, errors.New("unexpected ping reply")
+	}
+	return time.Since(start), nil
+}
+
+// PingHTTP checks the MGM is reachable through the HTTP interface.
+// Any response from the MGM is considered a success.
+func (c *Client) PingHTTP(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.httpUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-gateway-authorization", c.authKey)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	discard(res)
+	return nil
+}
+
+// NsStat returns the status of the namespace of the MGM.
+func (c *Client) NsStat(ctx context.Context) (*erpc.NsStatResponse, error) {
+	res, err := c.grpcClient.NsStat(ctx, &erpc.NsStatRequest{
+		Authkey: c.authKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Code != 0 {
+		return nil, newError(res.Code, res.Emsg)
+	}
+	return res, nil
+}
+
+// sharedStatTimeout bounds the calls to the MGM shared by
+// the concurrent Stat, that are not canceled by their callers.
+const sharedStatTimeout = 30 * time.Second
+
 func (c *Client) Stat(ctx context.Context, auth Auth, path string) (*erpc.MDResponse, error) {
+	if md, ok := c.statCache.get(auth, path); ok {
+		if md == nil {
+			return nil, &ErrNoSuchResource{Path: path}
+		}
+		return md, nil
+	}
+
+	// The concurrent Stat of the same path by the same identity
+	// share a single call to the MGM. The call is not canceled
+	// with the request that started it, as the others wait for it,
+	// but bounded by sharedStatTimeout not to hold the path forever.
+	// The Stat started after a write to the path do not share the
+	// calls started before it, as they might miss the write.
+	key := fmt.Sprintf("%d:%d:%d:%s", auth.Uid, auth.Gid, c.statGens.of(path), path)
+	ch := c.stats.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedStatTimeout)
+		defer cancel()
+		return c.stat(ctx, auth, path)
+	})
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*erpc.MDResponse), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) stat(ctx context.Context, auth Auth, path string) (*erpc.MDResponse, error) {
+	// The stream is abandoned after its only message:
+	// cancel it to release its resources.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	req := &erpc.MDRequest{
 		Type: erpc.TYPE_STAT,
 		Id: &erpc.MDId{
 			Path: []byte(path),
 		},
-		Authkey: c.authKey,
+		Authkey: c.authKeyFor(auth),
 		Role: &erpc.RoleId{
 			Uid: auth.Uid,
 			Gid: auth.Gid,
 		},
 	}
+	gen := c.statGens.of(path)
 	res, err := c.grpcClient.MD(ctx, req)
 	if err != nil {
 		return nil, err
@@ -145,8 +380,13 @@ func (c *Client) Stat(ctx context.Context, auth Auth, path string) (*erpc.MDResp
 
 	r, err := res.Recv()
 	if err != nil {
-		return nil, &ErrNoSuchResource{Path: path}
+		err = statError(path, err)
+		if e := (&ErrNoSuchResource{}); errors.As(err, &e) {
+			c.cacheStat(auth, path, nil, gen)
+		}
+		return nil, err
 	}
+	c.cacheStat(auth, path, r, gen)
 	return r, nil
 }
 
@@ -154,7 +394,21 @@ type ListDirFilters struct {
 	Recursive bool
 }
 
+// ListDir calls f on every entry of dir.
 func (c *Client) ListDir(ctx context.Context, auth Auth, dir string, f func(*erpc.MDResponse), filters *ListDirFilters) error {
+	return c.ListDirUntil(ctx, auth, dir, func(md *erpc.MDResponse) bool {
+		f(md)
+		return true
+	}, filters)
+}
+
+// ListDirUntil calls f on the entries of dir as they are streamed
+// by the MGM, until f returns false. The stream is then closed,
+// without receiving the remaining entries.
+func (c *Client) ListDirUntil(ctx context.Context, auth Auth, dir string, f func(*erpc.MDResponse) bool, filters *ListDirFilters) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	req := &erpc.FindRequest{
 		Type: erpc.TYPE_LISTING,
 		Id: &erpc.MDId{
@@ -164,7 +418,7 @@ func (c *Client) ListDir(ctx context.Context, auth Auth, dir string, f func(*erp
 			Uid: auth.Uid,
 			Gid: auth.Gid,
 		},
-		Authkey:  c.authKey,
+		Authkey:  c.authKeyFor(auth),
 		Maxdepth: 1,
 	}
 
@@ -184,10 +438,12 @@ func (c *Client) ListDir(ctx context.Context, auth Auth, dir string, f func(*erp
 	for {
 		r, err := res.Recv()
 		if err != nil {
-			if err == io.EOF {
+			// the stream of an existing directory
+			// starts with the directory itself
+			if err == io.EOF && i > 0 {
 				return nil
 			}
-			return &ErrNoSuchResource{Path: dir}
+			return recvError("listing", dir, err)
 		}
 		i++
 		if i == 1 {
@@ -196,11 +452,15 @@ func (c *Client) ListDir(ctx context.Context, auth Auth, dir string, f func(*erp
 			continue
 		}
 
-		f(r)
+		if !f(r) {
+			return nil
+		}
 	}
 }
 
 func (c *Client) Mkdir(ctx context.Context, auth Auth, path string, mode int64) error {
+	defer c.invalidate(path)
+
 	req := c.initNsRequest(auth)
 	req.Command = &erpc.NSRequest_Mkdir{
 		Mkdir: &erpc.NSRequest_MkdirRequest{
@@ -218,7 +478,7 @@ func (c *Client) Mkdir(ctx context.Context, auth Auth, path string, mode int64)
 	}
 
 	if res.Error != nil && res.Error.Code != 0 {
-		return errors.New(res.Error.Msg)
+		return newError(res.Error.Code, res.Error.Msg)
 	}
 
 	return nil
@@ -230,11 +490,13 @@ func (c *Client) initNsRequest(auth Auth) *erpc.NSRequest {
 			Uid: auth.Uid,
 			Gid: auth.Gid,
 		},
-		Authkey: c.authKey,
+		Authkey: c.authKeyFor(auth),
 	}
 }
 
 func (c *Client) Rmdir(ctx context.Context, auth Auth, path string) error {
+	defer c.invalidate(path)
+
 	req := c.initNsRequest(auth)
 	req.Command = &erpc.NSRequest_Rmdir{
 		Rmdir: &erpc.NSRequest_RmdirRequest{
@@ -250,13 +512,25 @@ func (c *Client) Rmdir(ctx context.Context, auth Auth, path string) error {
 	}
 
 	if res.Error != nil && res.Error.Code != 0 {
-		return errors.New(res.Error.Msg)
+		return newError(res.Error.Code, res.Error.Msg)
 	}
 
 	return nil
 }
 
 func (c *Client) Remove(ctx context.Context, auth Auth, path string, recursive bool) error {
+	return c.remove(ctx, auth, path, recursive, false)
+}
+
+// RemovePermanently removes path bypassing the recycle bin,
+// so that it cannot be recovered.
+func (c *Client) RemovePermanently(ctx context.Context, auth Auth, path string, recursive bool) error {
+	return c.remove(ctx, auth, path, recursive, true)
+}
+
+func (c *Client) remove(ctx context.Context, auth Auth, path string, recursive, noRecycle bool) error {
+	defer c.invalidateTree(path)
+
 	req := c.initNsRequest(auth)
 	req.Command = &erpc.NSRequest_Rm{
 		Rm: &erpc.NSRequest_RmRequest{
@@ -264,6 +538,7 @@ func (c *Client) Remove(ctx context.Context, auth Auth, path string, recursive b
 				Path: []byte(path),
 			},
 			Recursive: recursive,
+			Norecycle: noRecycle,
 		},
 	}
 	res, err := c.grpcClient.Exec(ctx, req)
@@ -272,13 +547,16 @@ func (c *Client) Remove(ctx context.Context, auth Auth, path string, recursive b
 	}
 
 	if res.Error.Code != 0 {
-		return errors.New(res.Error.Msg)
+		return newError(res.Error.Code, res.Error.Msg)
 	}
 
 	return nil
 }
 
 func (c *Client) Rename(ctx context.Context, auth Auth, source, destination string) error {
+	defer c.invalidateTree(source)
+	defer c.invalidateTree(destination)
+
 	req := c.initNsRequest(auth)
 	req.Command = &erpc.NSRequest_Rename{
 		Rename: &erpc.NSRequest_RenameRequest{
@@ -294,33 +572,186 @@ func (c *Client) Rename(ctx context.Context, auth Auth, source, destination stri
 	}
 
 	if res.Error.Code != 0 {
-		return errors.New(res.Error.Msg)
+		return newError(res.Error.Code, res.Error.Msg)
+	}
+
+	return nil
+}
+
+// GetQuota returns the quota nodes of the user applying to the path.
+func (c *Client) GetQuota(ctx context.Context, auth Auth, path string) ([]*erpc.QuotaProto, error) {
+	req := c.initNsRequest(auth)
+	req.Command = &erpc.NSRequest_Quota{
+		Quota: &erpc.NSRequest_QuotaRequest{
+			Path: []byte(path),
+			Id: &erpc.RoleId{
+				Uid: auth.Uid,
+				Gid: auth.Gid,
+			},
+			Op: erpc.QUOTAOP_GET,
+		},
+	}
+	res, err := c.grpcClient.Exec(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil && res.Error.Code != 0 {
+		return nil, newError(res.Error.Code, res.Error.Msg)
+	}
+	if res.Quota == nil {
+		return nil, nil
+	}
+	if res.Quota.Code != 0 {
+		return nil, newError(res.Quota.Code, res.Quota.Msg)
+	}
+
+	return res.Quota.Quotanode, nil
+}
+
+// SetQuota sets on the quota node at path the limits for the user id.
+func (c *Client) SetQuota(ctx context.Context, auth Auth, path string, id Auth, maxBytes, maxFiles uint64) error {
+	req := c.initNsRequest(auth)
+	req.Command = &erpc.NSRequest_Quota{
+		Quota: &erpc.NSRequest_QuotaRequest{
+			Path: []byte(path),
+			Id: &erpc.RoleId{
+				Uid: id.Uid,
+				Gid: id.Gid,
+			},
+			Op:       erpc.QUOTAOP_SET,
+			Maxbytes: maxBytes,
+			Maxfiles: maxFiles,
+		},
+	}
+	res, err := c.grpcClient.Exec(ctx, req)
+	if err != nil {
+		return err
 	}
 
+	if res.Error != nil && res.Error.Code != 0 {
+		return newError(res.Error.Code, res.Error.Msg)
+	}
+	if res.Quota != nil && res.Quota.Code != 0 {
+		return newError(res.Quota.Code, res.Quota.Msg)
+	}
 	return nil
 }
 
 func (c *Client) buildFullHttpUrl(auth Auth, path string) string {
 	fullurl := strings.TrimRight(c.httpUrl, "/")
 	fullurl += "/"
-	fullurl += strings.TrimLeft(path, "/")
+	fullurl += escapePath(strings.TrimLeft(path, "/"))
 
 	fullurl += fmt.Sprintf("?eos.ruid=%d&eos.rgid=%d", auth.Uid, auth.Gid)
+	if auth.Token != "" {
+		fullurl += "&authz=" + url.QueryEscape(auth.Token)
+	}
+	return fullurl
+}
 
-	final := strings.ReplaceAll(fullurl, "#", "%23")
-	return final
+// escapePath escapes the segments of path for an URL, so that the
+// characters like space, ?, #, % or the non-ASCII ones are kept in
+// the name of the file. + is escaped too, not to be read as a space.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(s), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
 }
 
 func (c *Client) Download(ctx context.Context, auth Auth, path string, rangeHeader *string) (io.ReadCloser, int64, error) {
+	obj, err := c.DownloadObject(ctx, auth, path, rangeHeader)
+	if err != nil {
+		return nil, 0, err
+	}
+	return obj.Body, obj.Size, nil
+}
+
+// Object is a file being downloaded, with the metadata
+// sent along with its content.
+type Object struct {
+	// Body is the content of the file.
+	Body io.ReadCloser
+	// Size is the size of the body, or -1 if unknown.
+	Size int64
+	// ETag is the entity tag of the file, without quotes.
+	ETag string
+	// LastModified is the modification time of the file,
+	// or the zero time if unknown.
+	LastModified time.Time
+	// FromFST is true if the content is served by an FST,
+	// meaning that path is a file. The directories are
+	// served by the MGM.
+	FromFST bool
+}
+
+// DownloadObject downloads path, returning its content along
+// with the metadata in the headers of the response, so that
+// no Stat is needed to serve it.
+func (c *Client) DownloadObject(ctx context.Context, auth Auth, path string, rangeHeader *string) (*Object, error) {
+	start := time.Now()
+	ctx, span := c.tracer.Start(withOperation(ctx, "Download"), "eos.Download", trace.WithAttributes(attribute.String("eos.path", path)))
+	obj, err := c.download(ctx, auth, path, rangeHeader)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	// the span lasts until the content has been read
+	obj.Body = &spanReadCloser{ReadCloser: obj.Body, span: span, done: func() {
+		logSlow(ctx, c.log, c.slowTransfer, "slow transfer", start, "method", http.MethodGet, "path", path, "size", obj.Size)
+	}}
+	return obj, nil
+}
+
+// DownloadURL returns the URL of the FST where the MGM redirects
+// the download of path. The URL carries a capability granting the
+// access to the file for a limited time, so it can be handed to
+// the clients to download the file directly from the FST.
+func (c *Client) DownloadURL(ctx context.Context, auth Auth, path string) (string, error) {
+	req, err := http.NewRequestWithContext(withOperation(ctx, "DownloadURL"), http.MethodGet, c.buildFullHttpUrl(auth, path), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth.Token == "" {
+		req.Header.Set("x-gateway-authorization", c.authKey)
+	}
+	req.Header.Set("x-forwarded-for", "dummy")
+	req.Header.Set("remote-user", auth.Username())
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error doing request: %w", err)
+	}
+	discard(res)
+
+	if res.StatusCode != http.StatusFound && res.StatusCode != http.StatusTemporaryRedirect {
+		return "", &Error{
+			Errno: httpErrno[res.StatusCode],
+			Msg:   fmt.Sprintf("expected redirection from %s, got status code %d", c.httpUrl, res.StatusCode),
+		}
+	}
+	loc, err := res.Location()
+	if err != nil {
+		return "", fmt.Errorf("error getting redirection location: %w", err)
+	}
+	return loc.String(), nil
+}
+
+func (c *Client) download(ctx context.Context, auth Auth, path string, rangeHeader *string) (*Object, error) {
 	url := c.buildFullHttpUrl(auth, path)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
+	var fromFST bool
 	for {
-		req.Header.Set("x-gateway-authorization", c.authKey)
+		if auth.Token == "" {
+			req.Header.Set("x-gateway-authorization", c.authKey)
+		}
 		req.Header.Set("x-forwarded-for", "dummy") // TODO: is this really neaded??
 		req.Header.Set("remote-user", auth.Username())
 
@@ -328,64 +759,109 @@ func (c *Client) Download(ctx context.Context, auth Auth, path string, rangeHead
 			req.Header.Set("Range", *rangeHeader)
 		}
 
-		res, err := c.httpClient.Do(req)
+		res, err := c.transferClient(ctx).Do(req)
 		if err != nil {
-			return nil, 0, fmt.Errorf("error doing request: %w", err)
+			return nil, fmt.Errorf("error doing request: %w", err)
 		}
 
 		if res.StatusCode == http.StatusFound || res.StatusCode == http.StatusTemporaryRedirect {
 			// we got redirected
+			discard(res)
 
 			loc, err := res.Location()
 			if err != nil {
-				return nil, 0, fmt.Errorf("error getting redirection location: %w", err)
+				return nil, fmt.Errorf("error getting redirection location: %w", err)
 			}
+			c.log.DebugContext(ctx, "http redirect", "method", http.MethodGet, "path", path, "location", loc.Host)
 
 			req, err = http.NewRequestWithContext(ctx, http.MethodGet, loc.String(), nil)
 			if err != nil {
-				return nil, 0, fmt.Errorf("error creating new request: %w", err)
+				return nil, fmt.Errorf("error creating new request: %w", err)
 			}
+			fromFST = true
 			continue
 		}
 
+		if res.StatusCode == http.StatusNotFound {
+			discard(res)
+			return nil, &ErrNoSuchResource{Path: path}
+		}
 		if res.StatusCode >= 300 {
-			return nil, 0, fmt.Errorf("got non OK status code from %s: %d", req.URL.String(), res.StatusCode)
+			discard(res)
+			return nil, httpError(req.URL.String(), res.StatusCode)
 		}
 
-		return res.Body, res.ContentLength, nil
+		obj := &Object{
+			Body:    res.Body,
+			Size:    res.ContentLength,
+			ETag:    strings.Trim(res.Header.Get("ETag"), `"`),
+			FromFST: fromFST,
+		}
+		if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+			obj.LastModified = t
+		}
+		return obj, nil
 	}
 }
 
-func (c *Client) UploadChunk(ctx context.Context, auth Auth, path string, chunk io.Reader, length, offset, total uint64) error {
+func (c *Client) UploadChunk(ctx context.Context, auth Auth, path string, chunk io.Reader, length, offset, total uint64) (err error) {
+	start := time.Now()
+	ctx, span := c.tracer.Start(withOperation(ctx, "UploadChunk"), "eos.UploadChunk", trace.WithAttributes(attribute.String("eos.path", path), attribute.Int64("eos.offset", int64(offset))))
+	defer func() {
+		endSpan(span, err)
+		logSlow(ctx, c.log, c.slowTransfer, "slow transfer", start, "method", http.MethodPut, "path", path, "size", length)
+	}()
+	err = c.uploadChunk(ctx, auth, path, chunk, length, offset, total)
+	if err == nil {
+		c.chunks.observe(length, time.Since(start))
+	}
+	return err
+}
+
+func (c *Client) uploadChunk(ctx context.Context, auth Auth, path string, chunk io.Reader, length, offset, total uint64) error {
+	defer c.invalidate(path)
+
+	chunk, done := c.chunks.wrap(chunk, length)
+	defer done()
+
 	url := c.buildFullHttpUrl(auth, path)
 
-	req, err := http.NewRequestWithContext(context.TODO(), http.MethodPut, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, nil)
 	if err != nil {
 		return err
 	}
 
 	for {
-		req.Header["x-gateway-authorization"] = []string{c.authKey}
+		if auth.Token == "" {
+			req.Header["x-gateway-authorization"] = []string{c.authKey}
+		}
 		req.Header["x-forwarded-for"] = []string{"dummy"} // TODO: is this really neaded??
 		req.Header["remote-user"] = []string{auth.Username()}
 
 		req.Header["x-upload-totalsize"] = []string{strconv.FormatUint(total, 10)}
 		req.Header["x-upload-range"] = []string{fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}
 
-		res, err := c.httpClient.Do(req)
+		res, err := c.transferClient(ctx).Do(req)
 		if err != nil {
 			return err
 		}
 
 		if res.StatusCode == http.StatusTemporaryRedirect {
 			// we got redirected to an FST
+			discard(res)
+			if req.Body != nil {
+				// The body has been consumed and is not buffered,
+				// so it cannot be sent again.
+				return fmt.Errorf("redirected by %s after sending the body", req.URL.Host)
+			}
 
 			loc, err := res.Location()
 			if err != nil {
 				return err
 			}
+			c.log.DebugContext(ctx, "http redirect", "method", http.MethodPut, "path", path, "location", loc.Host)
 
-			req, err = http.NewRequestWithContext(context.TODO(), http.MethodPut, loc.String(), chunk)
+			req, err = http.NewRequestWithContext(ctx, http.MethodPut, loc.String(), chunk)
 			if err != nil {
 				return err
 			}
@@ -396,16 +872,39 @@ func (c *Client) UploadChunk(ctx context.Context, auth Auth, path string, chunk
 			continue
 		}
 
+		discard(res)
 		if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
-			return fmt.Errorf("got non OK status code from %s: %d", req.URL.String(), res.StatusCode)
+			return httpError(req.URL.String(), res.StatusCode)
 		}
 
 		return nil
 	}
 }
 
-func (c *Client) Upload(ctx context.Context, auth Auth, path string, data io.Reader, length uint64) error {
-	url := c.buildFullHttpUrl(auth, path)
+func (c *Client) Upload(ctx context.Context, auth Auth, path string, data io.Reader, length uint64) (err error) {
+	start := time.Now()
+	ctx, span := c.tracer.Start(withOperation(ctx, "Upload"), "eos.Upload", trace.WithAttributes(attribute.String("eos.path", path), attribute.Int64("eos.size", int64(length))))
+	defer func() {
+		endSpan(span, err)
+		logSlow(ctx, c.log, c.slowTransfer, "slow transfer", start, "method", http.MethodPut, "path", path, "size", length)
+	}()
+	err = c.upload(ctx, auth, path, data, length)
+	if err == nil {
+		c.chunks.observe(length, time.Since(start))
+	}
+	return err
+}
+
+func (c *Client) upload(ctx context.Context, auth Auth, path string, data io.Reader, length uint64) error {
+	defer c.invalidate(path)
+
+	data, done := c.chunks.wrap(data, length)
+	defer done()
+
+	// The file is written by EOS under a hidden name and renamed
+	// once complete: the readers never see it partially written,
+	// and a failed upload does not replace the previous content.
+	url := c.buildFullHttpUrl(auth, path) + "&eos.atomic=1"
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, nil)
 	if err != nil {
@@ -413,22 +912,31 @@ func (c *Client) Upload(ctx context.Context, auth Auth, path string, data io.Rea
 	}
 
 	for {
-		req.Header.Set("x-gateway-authorization", c.authKey)
+		if auth.Token == "" {
+			req.Header.Set("x-gateway-authorization", c.authKey)
+		}
 		req.Header.Set("x-forwarded-for", "dummy") // TODO: is this really neaded??
 		req.Header.Set("remote-user", auth.Username())
 
-		res, err := c.httpClient.Do(req)
+		res, err := c.transferClient(ctx).Do(req)
 		if err != nil {
 			return err
 		}
 
 		if res.StatusCode == http.StatusTemporaryRedirect {
 			// we got redirected to an FST
+			discard(res)
+			if req.Body != nil {
+				// The body has been consumed and is not buffered,
+				// so it cannot be sent again.
+				return fmt.Errorf("redirected by %s after sending the body", req.URL.Host)
+			}
 
 			loc, err := res.Location()
 			if err != nil {
 				return err
 			}
+			c.log.DebugContext(ctx, "http redirect", "method", http.MethodPut, "path", path, "location", loc.Host)
 
 			req, err = http.NewRequestWithContext(ctx, http.MethodPut, loc.String(), data)
 			if err != nil {
@@ -438,14 +946,49 @@ func (c *Client) Upload(ctx context.Context, auth Auth, path string, data io.Rea
 			continue
 		}
 
+		discard(res)
 		if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
-			return fmt.Errorf("got non OK status code from %s: %d", req.URL.String(), res.StatusCode)
+			return httpError(req.URL.String(), res.StatusCode)
 		}
 
 		return nil
 	}
 }
 
+// InvalidateTree drops the cached results of path and of everything
+// below it, for changes done outside of the client.
+func (c *Client) InvalidateTree(path string) {
+	c.invalidateTree(path)
+}
+
+// invalidate drops the cached results of the paths modified by a write,
+// and makes the Stat started after it not share the calls started before.
+func (c *Client) invalidate(paths ...string) {
+	c.invalidating.Lock()
+	defer c.invalidating.Unlock()
+	c.statGens.bump(paths...)
+	c.statCache.invalidate(paths...)
+}
+
+// invalidateTree is invalidate for path and everything below it.
+func (c *Client) invalidateTree(path string) {
+	c.invalidating.Lock()
+	defer c.invalidating.Unlock()
+	c.statGens.bumpTree()
+	c.statCache.invalidateTree(path)
+}
+
+// cacheStat caches the result of the Stat of p started at generation
+// gen, unless p was invalidated since: the result might then miss
+// a write done meanwhile.
+func (c *Client) cacheStat(auth Auth, p string, md *erpc.MDResponse, gen uint64) {
+	c.invalidating.RLock()
+	defer c.invalidating.RUnlock()
+	if c.statGens.of(p) == gen {
+		c.statCache.put(auth, p, md)
+	}
+}
+
 func (c *Client) Close() error {
 	return c.conn.Close()
 }
@@ -0,0 +1,62 @@
+package eos
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "plain", path: "eos/bucket/key", want: "eos/bucket/key"},
+		{name: "space", path: "bucket/a b", want: "bucket/a%20b"},
+		{name: "hash", path: "bucket/a#b", want: "bucket/a%23b"},
+		{name: "percent", path: "bucket/100%", want: "bucket/100%25"},
+		{name: "escaped percent", path: "bucket/a%20b", want: "bucket/a%2520b"},
+		{name: "question mark", path: "bucket/a?b=c", want: "bucket/a%3Fb=c"},
+		{name: "plus", path: "bucket/a+b", want: "bucket/a%2Bb"},
+		{name: "ampersand", path: "bucket/a&eos.ruid=0", want: "bucket/a&eos.ruid=0"},
+		{name: "non-ASCII", path: "bucket/città", want: "bucket/citt%C3%A0"},
+		{name: "control characters", path: "bucket/a\nb\tc\x7f", want: "bucket/a%0Ab%09c%7F"},
+		{name: "sequential slashes", path: "bucket//a", want: "bucket//a"},
+		{name: "trailing slash", path: "bucket/dir/", want: "bucket/dir/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapePath(tt.path); got != tt.want {
+				t.Errorf("escapePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFullHttpUrl(t *testing.T) {
+	c := &Client{httpUrl: "https://eos.example.org:8443/"}
+	auth := Auth{Uid: 1000, Gid: 100, Token: "zteos64:a+b/c="}
+
+	paths := []string{
+		"/eos/bucket/key",
+		"/eos/bucket/a b#c?d=e&eos.ruid=0",
+		"/eos/bucket/100%/a+b",
+		"/eos/bucket/città/ファイル",
+		"/eos/bucket/a\nb\x01",
+		"/eos/bucket/" + strings.Repeat("k", 1024),
+	}
+	for _, p := range paths {
+		u, err := url.Parse(c.buildFullHttpUrl(auth, p))
+		if err != nil {
+			t.Fatalf("error parsing the URL of %q: %v", p, err)
+		}
+		if u.Path != p {
+			t.Errorf("URL path of %q = %q", p, u.Path)
+		}
+		q := u.Query()
+		if q.Get("eos.ruid") != "1000" || q.Get("eos.rgid") != "100" || q.Get("authz") != auth.Token || len(q) != 3 {
+			t.Errorf("URL query of %q = %v", p, q)
+		}
+	}
+}
@@ -1,6 +1,18 @@
 package eos
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
 
 type ErrNoSuchResource struct {
 	Path string
@@ -9,3 +21,116 @@ type ErrNoSuchResource struct {
 func (e *ErrNoSuchResource) Error() string {
 	return fmt.Sprintf("no such resource: %s", e.Path)
 }
+
+// Is makes the missing resources match syscall.ENOENT.
+func (e *ErrNoSuchResource) Is(target error) bool {
+	return target == syscall.ENOENT
+}
+
+// Error is an error returned by EOS, with the errno of the failure,
+// 0 if unknown. It matches its errno with errors.Is, e.g.
+// errors.Is(err, syscall.EACCES).
+type Error struct {
+	Errno syscall.Errno
+	Msg   string
+}
+
+// newError returns the error of the code and message of a
+// response of the MGM. The code is the errno, possibly negated.
+func newError(code int64, msg string) *Error {
+	if code < 0 {
+		code = -code
+	}
+	return &Error{Errno: syscall.Errno(code), Msg: msg}
+}
+
+func (e *Error) Error() string {
+	if e.Msg == "" && e.Errno != 0 {
+		return e.Errno.Error()
+	}
+	return e.Msg
+}
+
+func (e *Error) Is(target error) bool {
+	errno, ok := target.(syscall.Errno)
+	return ok && e.Errno != 0 && e.Errno == errno
+}
+
+// httpErrno maps the status codes of the HTTP
+// responses of EOS to their errno, 0 if unknown.
+var httpErrno = map[int]syscall.Errno{
+	http.StatusUnauthorized:          syscall.EACCES,
+	http.StatusForbidden:             syscall.EACCES,
+	http.StatusNotFound:              syscall.ENOENT,
+	http.StatusConflict:              syscall.EEXIST,
+	http.StatusRequestURITooLong:     syscall.ENAMETOOLONG,
+	http.StatusInsufficientStorage:   syscall.EDQUOT,
+	http.StatusRequestEntityTooLarge: syscall.EFBIG,
+}
+
+// httpError returns the error of a non OK response to the request to url.
+func httpError(url string, status int) *Error {
+	return &Error{
+		Errno: httpErrno[status],
+		Msg:   fmt.Sprintf("got non OK status code from %s: %d", url, status),
+	}
+}
+
+// statError returns the error of the failed Stat of path.
+func statError(path string, err error) error {
+	return recvError("stating", path, err)
+}
+
+// recvError returns the error of the failed stream of the metadata
+// of path, received by op. The MGM ends the stream without a response
+// for the missing paths. The gRPC status code of the other failures
+// is not an errno: the errno, if any, is read from the message of the
+// status. The other failures, like the transient ones, are returned.
+func recvError(op, path string, err error) error {
+	if errors.Is(err, io.EOF) {
+		return &ErrNoSuchResource{Path: path}
+	}
+	if transient(err) {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("error %s %s: %w", op, path, err)
+	}
+	errno := messageErrno(st.Message())
+	switch {
+	case st.Code() == codes.NotFound, errno == syscall.ENOENT:
+		return &ErrNoSuchResource{Path: path}
+	case st.Code() == codes.PermissionDenied, st.Code() == codes.Unauthenticated:
+		errno = syscall.EACCES
+	}
+	if errno != 0 {
+		return &Error{Errno: errno, Msg: fmt.Sprintf("error %s %s: %s", op, path, st.Message())}
+	}
+	return fmt.Errorf("error %s %s: %w", op, path, err)
+}
+
+// errnoRegex matches the errno reported in the messages of
+// the MGM, e.g. "errno=2" or "retc=13".
+var errnoRegex = regexp.MustCompile(`\b(?:errno|errc|retc)\s*[=:]\s*(\d+)\b`)
+
+// messageErrnos are the errnos recognized by their description
+// in the messages of the MGM, when not reported as a number.
+var messageErrnos = []syscall.Errno{syscall.ENOENT, syscall.EACCES, syscall.EPERM}
+
+// messageErrno returns the errno reported in the
+// message of a failure of the MGM, 0 if unknown.
+func messageErrno(msg string) syscall.Errno {
+	if m := errnoRegex.FindStringSubmatch(msg); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			return syscall.Errno(n)
+		}
+	}
+	lower := strings.ToLower(msg)
+	for _, errno := range messageErrnos {
+		if strings.Contains(lower, strings.ToLower(errno.Error())) {
+			return errno
+		}
+	}
+	return 0
+}
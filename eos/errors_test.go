@@ -0,0 +1,49 @@
+package eos
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecvError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		missing  bool
+		errno    syscall.Errno
+		noErrnos []syscall.Errno
+	}{
+		{name: "end of stream", err: io.EOF, missing: true},
+		{name: "not found", err: status.Error(codes.NotFound, "not found"), missing: true},
+		{name: "errno in message", err: status.Error(codes.Unknown, "stat failed errno=2"), missing: true},
+		{name: "errno description", err: status.Error(codes.Unknown, "No such file or directory"), missing: true},
+		{name: "permission denied", err: status.Error(codes.PermissionDenied, "denied"), errno: syscall.EACCES},
+		{name: "unauthenticated", err: status.Error(codes.Unauthenticated, "who are you"), errno: syscall.EACCES},
+		{name: "access errno in message", err: status.Error(codes.Unknown, "retc=13"), errno: syscall.EACCES},
+		{name: "unknown", err: status.Error(codes.Unknown, "something failed"), noErrnos: []syscall.Errno{syscall.ENOENT, syscall.EACCES}},
+		{name: "internal", err: status.Error(codes.Internal, "MGM failure"), noErrnos: []syscall.Errno{syscall.ENOENT, syscall.EACCES}},
+		{name: "plain error", err: errors.New("broken"), noErrnos: []syscall.Errno{syscall.ENOENT, syscall.EACCES}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := recvError("stating", "/eos/a", tt.err)
+			var missing *ErrNoSuchResource
+			if got := errors.As(err, &missing); got != tt.missing {
+				t.Fatalf("recvError(%v) = %v, missing %t, want %t", tt.err, err, got, tt.missing)
+			}
+			if tt.errno != 0 && !errors.Is(err, tt.errno) {
+				t.Errorf("recvError(%v) = %v, want errno %v", tt.err, err, tt.errno)
+			}
+			for _, errno := range tt.noErrnos {
+				if errors.Is(err, errno) {
+					t.Errorf("recvError(%v) = %v, must not match errno %v", tt.err, err, errno)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+package eos
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+)
+
+// FakeClient is an in-memory EOS namespace with the methods of Client,
+// to run the gateway without an EOS instance, e.g. for the benchmarks.
+// Every identity has full access, and there are no quotas, versions
+// or recycle bin. The files are owned by the identity creating them.
+type FakeClient struct {
+	mu      sync.RWMutex
+	entries map[string]*fakeEntry
+	nextId  uint64
+}
+
+type fakeEntry struct {
+	id       uint64
+	dir      bool
+	uid, gid uint64
+	mode     int64
+	data     []byte
+	xattrs   map[string][]byte
+	mtime    time.Time
+}
+
+// NewFakeClient returns a FakeClient with only the root directory.
+func NewFakeClient() *FakeClient {
+	c := &FakeClient{entries: make(map[string]*fakeEntry)}
+	c.entries["/"] = c.newEntry(Auth{}, true)
+	return c
+}
+
+func (c *FakeClient) newEntry(auth Auth, dir bool) *fakeEntry {
+	c.nextId++
+	return &fakeEntry{
+		id:     c.nextId,
+		dir:    dir,
+		uid:    auth.Uid,
+		gid:    auth.Gid,
+		mode:   0755,
+		xattrs: make(map[string][]byte),
+		mtime:  time.Now(),
+	}
+}
+
+// md returns the metadata of the entry at p, as returned by the MGM.
+func (e *fakeEntry) md(p string) *erpc.MDResponse {
+	mtime := &erpc.Time{Sec: uint64(e.mtime.Unix()), NSec: uint64(e.mtime.Nanosecond())}
+	xattrs := make(map[string][]byte, len(e.xattrs))
+	for k, v := range e.xattrs {
+		xattrs[k] = slices.Clone(v)
+	}
+	if e.dir {
+		return &erpc.MDResponse{
+			Type: erpc.TYPE_CONTAINER,
+			Cmd: &erpc.ContainerMdProto{
+				Id:     e.id,
+				Name:   []byte(path.Base(p)),
+				Path:   []byte(strings.TrimSuffix(p, "/") + "/"),
+				Uid:    e.uid,
+				Gid:    e.gid,
+				Mode:   uint32(e.mode),
+				Mtime:  mtime,
+				Ctime:  mtime,
+				Xattrs: xattrs,
+			},
+		}
+	}
+	sum := md5.Sum(e.data)
+	return &erpc.MDResponse{
+		Type: erpc.TYPE_FILE,
+		Fmd: &erpc.FileMdProto{
+			Id:        e.id,
+			Name:      []byte(path.Base(p)),
+			Path:      []byte(p),
+			Uid:       e.uid,
+			Gid:       e.gid,
+			Size:      uint64(len(e.data)),
+			Flags:     uint32(e.mode),
+			Mtime:     mtime,
+			Ctime:     mtime,
+			Xattrs:    xattrs,
+			Checksums: []*erpc.Checksum{{Type: "md5", Value: []byte(hex.EncodeToString(sum[:]))}},
+		},
+	}
+}
+
+// lookup returns the entry at p, with c.mu held.
+func (c *FakeClient) lookup(p string) (*fakeEntry, error) {
+	e, ok := c.entries[path.Clean(p)]
+	if !ok {
+		return nil, &ErrNoSuchResource{Path: p}
+	}
+	return e, nil
+}
+
+// parent returns the directory containing p, with c.mu held.
+func (c *FakeClient) parent(p string) (*fakeEntry, error) {
+	e, err := c.lookup(path.Dir(path.Clean(p)))
+	if err != nil {
+		return nil, err
+	}
+	if !e.dir {
+		return nil, &Error{Errno: syscall.ENOTDIR, Msg: fmt.Sprintf("%s is not a directory", path.Dir(p))}
+	}
+	return e, nil
+}
+
+// children returns the paths of the entries in dir, sorted by name,
+// including the ones in its subdirectories if recursive.
+func (c *FakeClient) children(dir string, recursive bool) []string {
+	prefix := strings.TrimSuffix(path.Clean(dir), "/") + "/"
+	var paths []string
+	for p := range c.entries {
+		if p == "/" || !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		if !recursive && strings.Contains(p[len(prefix):], "/") {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func (c *FakeClient) Stat(ctx context.Context, auth Auth, p string) (*erpc.MDResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, err := c.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	return e.md(path.Clean(p)), nil
+}
+
+// ListDir calls f on every entry of dir.
+func (c *FakeClient) ListDir(ctx context.Context, auth Auth, dir string, f func(*erpc.MDResponse), filters *ListDirFilters) error {
+	return c.ListDirUntil(ctx, auth, dir, func(md *erpc.MDResponse) bool {
+		f(md)
+		return true
+	}, filters)
+}
+
+// ListDirUntil calls f on the entries of dir, until f returns false.
+// The entries are collected before the first call of f, so that f
+// can call the client.
+func (c *FakeClient) ListDirUntil(ctx context.Context, auth Auth, dir string, f func(*erpc.MDResponse) bool, filters *ListDirFilters) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.RLock()
+	e, err := c.lookup(dir)
+	if err != nil {
+		c.mu.RUnlock()
+		return err
+	}
+	if !e.dir {
+		c.mu.RUnlock()
+		return &Error{Errno: syscall.ENOTDIR, Msg: fmt.Sprintf("%s is not a directory", dir)}
+	}
+	paths := c.children(dir, filters != nil && filters.Recursive)
+	mds := make([]*erpc.MDResponse, 0, len(paths))
+	for _, p := range paths {
+		mds = append(mds, c.entries[p].md(p))
+	}
+	c.mu.RUnlock()
+
+	for _, md := range mds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !f(md) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Mkdir creates path and its missing parents.
+func (c *FakeClient) Mkdir(ctx context.Context, auth Auth, p string, mode int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p = path.Clean(p)
+	var missing []string
+	for q := p; ; q = path.Dir(q) {
+		e, ok := c.entries[q]
+		if ok {
+			if !e.dir {
+				return &Error{Errno: syscall.ENOTDIR, Msg: fmt.Sprintf("%s is not a directory", q)}
+			}
+			break
+		}
+		missing = append(missing, q)
+	}
+	for _, q := range missing {
+		e := c.newEntry(auth, true)
+		if mode != 0 {
+			e.mode = mode
+		}
+		c.entries[q] = e
+	}
+	return nil
+}
+
+func (c *FakeClient) Rmdir(ctx context.Context, auth Auth, p string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.lookup(p)
+	if err != nil {
+		return err
+	}
+	if !e.dir {
+		return &Error{Errno: syscall.ENOTDIR, Msg: fmt.Sprintf("%s is not a directory", p)}
+	}
+	if len(c.children(p, false)) > 0 {
+		return &Error{Errno: syscall.ENOTEMPTY, Msg: fmt.Sprintf("%s is not empty", p)}
+	}
+	delete(c.entries, path.Clean(p))
+	return nil
+}
+
+func (c *FakeClient) Remove(ctx context.Context, auth Auth, p string, recursive bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.lookup(p)
+	if err != nil {
+		return err
+	}
+	children := c.children(p, true)
+	if e.dir && len(children) > 0 && !recursive {
+		return &Error{Errno: syscall.ENOTEMPTY, Msg: fmt.Sprintf("%s is not empty", p)}
+	}
+	for _, q := range children {
+		delete(c.entries, q)
+	}
+	delete(c.entries, path.Clean(p))
+	return nil
+}
+
+// Rename moves source to destination, replacing
+// the file at destination if existing.
+func (c *FakeClient) Rename(ctx context.Context, auth Auth, source, destination string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	source, destination = path.Clean(source), path.Clean(destination)
+	e, err := c.lookup(source)
+	if err != nil {
+		return err
+	}
+	if _, err := c.parent(destination); err != nil {
+		return err
+	}
+	if dst, ok := c.entries[destination]; ok && (dst.dir || e.dir) {
+		return &Error{Errno: syscall.EEXIST, Msg: fmt.Sprintf("%s already exists", destination)}
+	}
+	for _, p := range c.children(source, true) {
+		c.entries[destination+strings.TrimPrefix(p, source)] = c.entries[p]
+		delete(c.entries, p)
+	}
+	delete(c.entries, source)
+	c.entries[destination] = e
+	return nil
+}
+
+func (c *FakeClient) SetXattrs(ctx context.Context, auth Auth, p string, set map[string]string, remove []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, err := c.lookup(p)
+	if err != nil {
+		return err
+	}
+	for k, v := range set {
+		e.xattrs[k] = []byte(v)
+	}
+	for _, k := range remove {
+		delete(e.xattrs, k)
+	}
+	return nil
+}
+
+// GetQuota returns no quota node, the fake namespace having no quotas.
+func (c *FakeClient) GetQuota(ctx context.Context, auth Auth, p string) ([]*erpc.QuotaProto, error) {
+	return nil, ctx.Err()
+}
+
+func (c *FakeClient) Download(ctx context.Context, auth Auth, p string, rangeHeader *string) (io.ReadCloser, int64, error) {
+	obj, err := c.DownloadObject(ctx, auth, p, rangeHeader)
+	if err != nil {
+		return nil, 0, err
+	}
+	return obj.Body, obj.Size, nil
+}
+
+// DownloadObject returns the content of the file at p, or the
+// part of it in a single range bytes=first-last of rangeHeader.
+func (c *FakeClient) DownloadObject(ctx context.Context, auth Auth, p string, rangeHeader *string) (*Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, err := c.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if e.dir {
+		return nil, &Error{Errno: syscall.EISDIR, Msg: fmt.Sprintf("%s is a directory", p)}
+	}
+	data := e.data
+	if rangeHeader != nil && *rangeHeader != "" {
+		if data, err = fakeRange(data, *rangeHeader); err != nil {
+			return nil, err
+		}
+	}
+	sum := md5.Sum(e.data)
+	return &Object{
+		Body:         io.NopCloser(bytes.NewReader(data)),
+		Size:         int64(len(data)),
+		ETag:         hex.EncodeToString(sum[:]),
+		LastModified: e.mtime.Truncate(time.Second),
+		FromFST:      true,
+	}, nil
+}
+
+// fakeRange returns the part of data in the range bytes=first-last,
+// with last or first possibly omitted, as the HTTP servers of EOS.
+func fakeRange(data []byte, rangeHeader string) ([]byte, error) {
+	invalid := &Error{Errno: syscall.EINVAL, Msg: fmt.Sprintf("invalid range %q", rangeHeader)}
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, invalid
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, invalid
+	}
+	size := int64(len(data))
+	first, last := int64(0), size-1
+	switch {
+	case from == "":
+		n, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		first = max(size-n, 0)
+	default:
+		n, err := strconv.ParseInt(from, 10, 64)
+		if err != nil || n >= size {
+			return nil, invalid
+		}
+		first = n
+		if to != "" {
+			if n, err = strconv.ParseInt(to, 10, 64); err != nil || n < first {
+				return nil, invalid
+			}
+			last = min(n, size-1)
+		}
+	}
+	return data[first : last+1], nil
+}
+
+// DownloadURL is not supported, the fake having no HTTP server.
+func (c *FakeClient) DownloadURL(ctx context.Context, auth Auth, p string) (string, error) {
+	return "", &Error{Errno: syscall.ENOTSUP, Msg: "the fake client does not serve the downloads over HTTP"}
+}
+
+// Upload writes the file at p, creating its missing parents.
+func (c *FakeClient) Upload(ctx context.Context, auth Auth, p string, data io.Reader, length uint64) error {
+	b, err := io.ReadAll(io.LimitReader(data, int64(length)))
+	if err != nil {
+		return err
+	}
+	if uint64(len(b)) != length {
+		return fmt.Errorf("short upload of %s: %d of %d bytes", p, len(b), length)
+	}
+	if err := c.Mkdir(ctx, auth, path.Dir(p), 0); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[path.Clean(p)]; ok && e.dir {
+		return &Error{Errno: syscall.EISDIR, Msg: fmt.Sprintf("%s is a directory", p)}
+	}
+	e := c.newEntry(auth, false)
+	e.data = b
+	c.entries[path.Clean(p)] = e
+	return nil
+}
+
+// UploadChunk writes the chunk at offset in the file at p, of total
+// size, creating the file and its missing parents if needed.
+func (c *FakeClient) UploadChunk(ctx context.Context, auth Auth, p string, chunk io.Reader, length, offset, total uint64) error {
+	b, err := io.ReadAll(io.LimitReader(chunk, int64(length)))
+	if err != nil {
+		return err
+	}
+	if uint64(len(b)) != length || offset+length > total {
+		return fmt.Errorf("invalid chunk of %s: %d bytes at %d of %d", p, len(b), offset, total)
+	}
+	if err := c.Mkdir(ctx, auth, path.Dir(p), 0); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[path.Clean(p)]
+	if ok && e.dir {
+		return &Error{Errno: syscall.EISDIR, Msg: fmt.Sprintf("%s is a directory", p)}
+	}
+	if !ok || uint64(len(e.data)) != total {
+		e = c.newEntry(auth, false)
+		e.data = make([]byte, total)
+		c.entries[path.Clean(p)] = e
+	}
+	copy(e.data[offset:], b)
+	e.mtime = time.Now()
+	return nil
+}
+
+// Scoped returns auth, the fake client not minting tokens.
+func (c *FakeClient) Scoped(ctx context.Context, auth Auth, p string, write bool) (Auth, error) {
+	return auth, nil
+}
+
+func (c *FakeClient) Ping(ctx context.Context) (time.Duration, error) {
+	return 0, ctx.Err()
+}
+
+func (c *FakeClient) PingHTTP(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// InvalidateTree does nothing, the fake client caching nothing.
+func (c *FakeClient) InvalidateTree(p string) {}
+
+func (c *FakeClient) TakeErrorCounts() map[string]int64 {
+	return nil
+}
+
+func (c *FakeClient) Close() error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package eos
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// GRPCConfig tunes the gRPC connections to the MGM.
+//
+// The metadata lookups open a server stream per call, that cannot
+// be reused nor shared by several lookups, so their latency is
+// dominated by the stream setup. Spreading the streams on more
+// connections, with larger flow-control windows, keeps it low
+// when many small objects are served concurrently.
+type GRPCConfig struct {
+	// Connections is the number of connections to the MGM,
+	// used in round robin. Defaults to 1.
+	Connections int `mapstructure:"connections"`
+	// InitialWindowSize is the flow-control window of each
+	// stream, in bytes. If not set, the gRPC default is used.
+	InitialWindowSize int32 `mapstructure:"initial_window_size"`
+	// InitialConnWindowSize is the flow-control window of each
+	// connection, in bytes. If not set, the gRPC default is used.
+	InitialConnWindowSize int32 `mapstructure:"initial_conn_window_size"`
+	// KeepaliveTime is the idle time after which a connection
+	// is pinged, so that it is kept open and ready.
+	// If not set, the connections are not pinged.
+	KeepaliveTime time.Duration `mapstructure:"keepalive_time"`
+	// KeepaliveTimeout is the time waited for the answer of a
+	// ping before closing the connection. Defaults to 20s.
+	KeepaliveTimeout time.Duration `mapstructure:"keepalive_timeout"`
+}
+
+// dialOptions returns the options applying the configuration.
+func (c GRPCConfig) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if c.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(c.InitialWindowSize))
+	}
+	if c.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(c.InitialConnWindowSize))
+	}
+	if c.KeepaliveTime > 0 {
+		timeout := c.KeepaliveTimeout
+		if timeout <= 0 {
+			timeout = 20 * time.Second
+		}
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.KeepaliveTime,
+			Timeout:             timeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts
+}
+
+// connPool spreads the calls over several connections in round robin.
+type connPool struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+}
+
+func newConnPool(target string, n int, opts ...grpc.DialOption) (*connPool, error) {
+	p := &connPool{}
+	for range max(n, 1) {
+		conn, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	return p, nil
+}
+
+func (p *connPool) pick() *grpc.ClientConn {
+	return p.conns[p.next.Add(1)%uint64(len(p.conns))]
+}
+
+func (p *connPool) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	return p.pick().Invoke(ctx, method, args, reply, opts...)
+}
+
+func (p *connPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return p.pick().NewStream(ctx, desc, method, opts...)
+}
+
+func (p *connPool) Close() error {
+	var errs []error
+	for _, c := range p.conns {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
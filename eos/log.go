@@ -0,0 +1,47 @@
+package eos
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// logUnaryInterceptor logs at debug level every gRPC call,
+// with its duration and outcome. The calls taking longer
+// than slow, if set, are logged as warnings.
+func logUnaryInterceptor(log *slog.Logger, slow time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		log.DebugContext(ctx, "grpc call", "method", method, "duration", time.Since(start), "error", err)
+		logSlow(ctx, log, slow, "slow grpc call", start, "method", method)
+		return err
+	}
+}
+
+// logStreamInterceptor logs at debug level the opening of every
+// gRPC stream, with the time taken to establish it. The streams
+// taking longer than slow to open, if set, are logged as warnings.
+func logStreamInterceptor(log *slog.Logger, slow time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		log.DebugContext(ctx, "grpc stream", "method", method, "duration", time.Since(start), "error", err)
+		logSlow(ctx, log, slow, "slow grpc stream", start, "method", method)
+		return s, err
+	}
+}
+
+// logSlow logs a warning if the call started at start took longer
+// than slow, reporting both the time spent by the request before
+// the call (queued) and the duration of the call.
+func logSlow(ctx context.Context, log *slog.Logger, slow time.Duration, msg string, start time.Time, args ...any) {
+	d := time.Since(start)
+	if slow <= 0 || d < slow {
+		return
+	}
+	args = append(args, "duration", d, "queued", queued(ctx, start), "threshold", slow)
+	log.WarnContext(ctx, msg, args...)
+}
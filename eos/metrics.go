@@ -0,0 +1,192 @@
+package eos
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const meterName = "github.com/gmgigi96/eoss3/eos"
+
+// requestDurationBuckets are the boundaries, in seconds, of the
+// histogram of the durations of the requests to EOS.
+var requestDurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// instruments records the durations and the errors
+// of the requests to EOS.
+type instruments struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+
+	mu     sync.Mutex
+	counts map[string]int64 // error -> count since the last take
+}
+
+func newInstruments(mp metric.MeterProvider) (*instruments, error) {
+	meter := mp.Meter(meterName)
+	duration, err := meter.Float64Histogram("eos.request.duration",
+		metric.WithDescription("Duration of the requests to EOS, by hop (mgm or fst), protocol and operation."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(requestDurationBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	errors, err := meter.Int64Counter("eos.errors",
+		metric.WithDescription("Errors returned by EOS, by operation and error: the errno for the MGM, the gRPC or HTTP status otherwise."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &instruments{duration: duration, errors: errors, counts: make(map[string]int64)}, nil
+}
+
+// record records the outcome of the request started at start.
+// class, if not empty, is the class of the error returned by EOS.
+func (m *instruments) record(ctx context.Context, start time.Time, hop, protocol, op, class string) {
+	m.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("eos.hop", hop),
+		attribute.String("eos.protocol", protocol),
+		attribute.String("eos.operation", op),
+		attribute.Bool("error", class != ""),
+	))
+	if class == "" {
+		return
+	}
+	m.errors.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("eos.operation", op),
+		attribute.String("eos.error", class),
+	))
+	m.mu.Lock()
+	m.counts[class]++
+	m.mu.Unlock()
+}
+
+// take returns the number of errors by class since the last call.
+func (m *instruments) take() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := maps.Clone(m.counts)
+	clear(m.counts)
+	return counts
+}
+
+// grpcErrorClass returns the class of the error of a gRPC call:
+// the gRPC status if the call failed, the errno if the MGM
+// returned an error, or an empty string on success.
+func grpcErrorClass(reply any, err error) string {
+	if err != nil {
+		return "grpc " + status.Code(err).String()
+	}
+	var code int64
+	switch r := reply.(type) {
+	case *erpc.NSResponse:
+		code = r.GetError().GetCode()
+	case *erpc.NsStatResponse:
+		code = r.GetCode()
+	}
+	if code != 0 {
+		return "errno " + strconv.FormatInt(code, 10)
+	}
+	return ""
+}
+
+// httpErrorClass returns the class of the error of an HTTP request:
+// the failure or the HTTP status, or an empty string on success.
+func httpErrorClass(res *http.Response, err error) string {
+	if err != nil {
+		return "http error"
+	}
+	if res.StatusCode >= 400 {
+		return "http " + strconv.Itoa(res.StatusCode)
+	}
+	return ""
+}
+
+type operationKey struct{}
+
+// withOperation labels the HTTP requests done with
+// the returned context with the operation op.
+func withOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+func operation(ctx context.Context) string {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return op
+}
+
+// grpcOperation returns the operation of a gRPC call: the
+// command for the namespace requests, the method otherwise.
+func grpcOperation(method string, req any) string {
+	if ns, ok := req.(*erpc.NSRequest); ok && ns.Command != nil {
+		return strings.TrimPrefix(reflect.TypeOf(ns.Command).Elem().Name(), "NSRequest_")
+	}
+	return path.Base(method)
+}
+
+// metricsUnaryInterceptor records the duration and
+// the outcome of every gRPC call to the MGM.
+func metricsUnaryInterceptor(m *instruments) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		m.record(ctx, start, "mgm", "grpc", grpcOperation(method, req), grpcErrorClass(reply, err))
+		return err
+	}
+}
+
+// metricsStreamInterceptor records the time taken to open
+// every gRPC stream to the MGM, and the failures.
+func metricsStreamInterceptor(m *instruments) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		m.record(ctx, start, "mgm", "grpc", path.Base(method), grpcErrorClass(nil, err))
+		return s, err
+	}
+}
+
+// metricsTransport records the duration of every HTTP request,
+// until the response headers are received, and its outcome.
+// The requests to the MGM account for the redirect overhead,
+// the ones to the FSTs for the data transfer.
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics *instruments
+	mgmHost string
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	t.metrics.record(req.Context(), start, hop(req, t.mgmHost), "http", operation(req.Context()), httpErrorClass(res, err))
+	return res, err
+}
+
+// hop returns whether the request is sent to the MGM or to an FST.
+func hop(req *http.Request, mgmHost string) string {
+	if req.URL.Host == mgmHost {
+		return "mgm"
+	}
+	return "fst"
+}
+
+// TakeErrorCounts returns the number of errors returned by EOS since
+// the previous call, by class: "errno N" for the errors of the MGM,
+// "grpc STATUS" and "http STATUS" for the failed requests.
+func (c *Client) TakeErrorCounts() map[string]int64 {
+	return c.metrics.take()
+}
@@ -0,0 +1,45 @@
+package eos
+
+import (
+	"context"
+	"time"
+)
+
+// RequestIDHeader is the gRPC metadata key and the HTTP header
+// used to forward to EOS the ID of the originating request.
+const RequestIDHeader = "x-request-id"
+
+type requestKey struct{}
+
+type request struct {
+	id    string
+	start time.Time
+}
+
+// WithRequestID returns a copy of ctx carrying the given request ID,
+// forwarded to EOS in every call done with the returned context.
+// The request is considered started at the time of the call.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, request{id: id, start: time.Now()})
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	r, _ := ctx.Value(requestKey{}).(request)
+	return r.id
+}
+
+// RequestStart returns when the request carried by ctx started.
+func RequestStart(ctx context.Context) (time.Time, bool) {
+	r, ok := ctx.Value(requestKey{}).(request)
+	return r.start, ok
+}
+
+// queued returns the time spent by the request carried by ctx
+// before the call started at start, or 0 if ctx carries none.
+func queued(ctx context.Context, start time.Time) time.Duration {
+	if t, ok := RequestStart(ctx); ok {
+		return start.Sub(t)
+	}
+	return 0
+}
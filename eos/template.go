@@ -0,0 +1,55 @@
+package eos
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// bucketPlaceholder is the placeholder replaced with the bucket name.
+const bucketPlaceholder = "{bucket}"
+
+// ExpandBucketPath resolves the placeholders in the path template
+// of a bucket. The supported placeholders are:
+//   - {username}: the username of the user creating the bucket
+//   - {initial}: the first letter of the username
+//   - {uid}, {gid}: the user and group id of the user creating the bucket
+//   - {bucket}: the name of the bucket
+//
+// If the template does not contain {bucket}, the bucket name
+// is appended to the resolved path.
+func ExpandBucketPath(tmpl string, auth Auth, bucket string) (string, error) {
+	if strings.Contains(tmpl, "{username}") || strings.Contains(tmpl, "{initial}") {
+		username := auth.Username()
+		if username == "<unknown>" {
+			return "", errors.New("cannot resolve username of uid " + strconv.FormatUint(auth.Uid, 10))
+		}
+		tmpl = strings.ReplaceAll(tmpl, "{username}", username)
+		tmpl = strings.ReplaceAll(tmpl, "{initial}", username[:1])
+	}
+
+	tmpl = strings.ReplaceAll(tmpl, "{uid}", strconv.FormatUint(auth.Uid, 10))
+	tmpl = strings.ReplaceAll(tmpl, "{gid}", strconv.FormatUint(auth.Gid, 10))
+
+	if !strings.Contains(tmpl, bucketPlaceholder) {
+		return filepath.Join(tmpl, bucket), nil
+	}
+	return filepath.Clean(strings.ReplaceAll(tmpl, bucketPlaceholder, bucket)), nil
+}
+
+// BucketParentPath returns the directory containing the buckets created
+// from the path template. It fails if {bucket} is not the last element
+// of the template, as the buckets would not share a parent directory.
+func BucketParentPath(tmpl string, auth Auth) (string, error) {
+	if i := strings.Index(tmpl, bucketPlaceholder); i >= 0 {
+		if !strings.HasSuffix(tmpl[:i], "/") || strings.TrimRight(tmpl[i+len(bucketPlaceholder):], "/") != "" {
+			return "", errors.New("bucket placeholder is not the last element of " + tmpl)
+		}
+	}
+	p, err := ExpandBucketPath(tmpl, auth, "")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(p), nil
+}
@@ -0,0 +1,141 @@
+package eos
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+)
+
+// TokensConfig configures the scoped tokens used in place of the
+// gateway key: the calls done on a path authenticate with a token
+// granting only the access to the tree of the path, so that the
+// credentials used on the requests cannot act on the rest of the
+// namespace.
+type TokensConfig struct {
+	// TTL is the validity of a token. The tokens are reused for
+	// half of it. If not set, the gateway key is used.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+type tokenKey struct {
+	uid, gid uint64
+	path     string
+	write    bool
+}
+
+type cachedToken struct {
+	token   string
+	renewAt time.Time
+}
+
+// tokens mints and caches the scoped tokens.
+// A nil tokens mints none.
+type tokens struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	tokens map[tokenKey]cachedToken
+}
+
+func newTokens(cfg TokensConfig) *tokens {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	return &tokens{ttl: cfg.TTL, tokens: make(map[tokenKey]cachedToken)}
+}
+
+// Scoped returns auth authenticating with a token granting the read
+// access, or the write one if write is set, to the tree of path.
+// Without scoped tokens configured, auth is returned as it is.
+func (c *Client) Scoped(ctx context.Context, auth Auth, path string, write bool) (Auth, error) {
+	t := c.tokens
+	if t == nil {
+		return auth, nil
+	}
+	key := tokenKey{uid: auth.Uid, gid: auth.Gid, path: path, write: write}
+	now := time.Now()
+
+	t.mu.Lock()
+	cached, ok := t.tokens[key]
+	t.mu.Unlock()
+	if ok && now.Before(cached.renewAt) {
+		auth.Token = cached.token
+		return auth, nil
+	}
+
+	perm := "rx"
+	if write {
+		perm = "rwx"
+	}
+	token, err := c.MintToken(ctx, auth, path, perm, now.Add(t.ttl))
+	if err != nil {
+		return Auth{}, err
+	}
+
+	t.mu.Lock()
+	for k, v := range t.tokens {
+		if now.After(v.renewAt) {
+			delete(t.tokens, k)
+		}
+	}
+	t.tokens[key] = cachedToken{token: token, renewAt: now.Add(t.ttl / 2)}
+	t.mu.Unlock()
+
+	auth.Token = token
+	return auth, nil
+}
+
+// MintToken returns a token granting to auth the permission perm
+// (e.g. rx or rwx) on the tree of path until expires.
+func (c *Client) MintToken(ctx context.Context, auth Auth, path, perm string, expires time.Time) (string, error) {
+	auth.Token = ""
+	req := c.initNsRequest(auth)
+	req.Command = &erpc.NSRequest_Token{
+		Token: &erpc.NSRequest_TokenRequest{
+			Token: &erpc.ShareToken{
+				Token: &erpc.ShareProto{
+					Permission: perm,
+					Expires:    uint64(expires.Unix()),
+					Owner:      auth.Username(),
+					Group:      groupName(auth.Gid),
+					Path:       path,
+					Allowtree:  true,
+				},
+			},
+		},
+	}
+	res, err := c.grpcClient.Exec(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	// the token is returned in place of the error message
+	if res.Error == nil {
+		return "", errors.New("no token returned")
+	}
+	if res.Error.Code != 0 {
+		return "", newError(res.Error.Code, res.Error.Msg)
+	}
+	return res.Error.Msg, nil
+}
+
+func groupName(gid uint64) string {
+	g, err := user.LookupGroupId(strconv.FormatUint(gid, 10))
+	if err != nil {
+		return ""
+	}
+	return g.Name
+}
+
+// authKeyFor returns the key authenticating the calls
+// done as auth: its token if any, the gateway key otherwise.
+func (c *Client) authKeyFor(auth Auth) string {
+	if auth.Token != "" {
+		return auth.Token
+	}
+	return c.authKey
+}
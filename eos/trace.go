@@ -0,0 +1,134 @@
+package eos
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const tracerName = "github.com/gmgigi96/eoss3/eos"
+
+// propagator forwards the trace context to EOS, in the
+// gRPC metadata and in the HTTP headers, together with the
+// request ID.
+var propagator = propagation.TraceContext{}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// metadataCarrier adapts the gRPC metadata to a TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func injectMetadata(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	propagator.Inject(ctx, metadataCarrier(md))
+	if id := RequestID(ctx); id != "" {
+		md.Set(RequestIDHeader, id)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// traceUnaryInterceptor records a span for every gRPC call to the MGM.
+func traceUnaryInterceptor(tracer trace.Tracer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		ctx, span := tracer.Start(ctx, "eos.grpc "+method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("rpc.method", method), attribute.String("eos.hop", "mgm")))
+		defer func() { endSpan(span, err) }()
+		return invoker(injectMetadata(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// traceStreamInterceptor records a span for the opening of every
+// gRPC stream to the MGM. The messages received are not traced.
+func traceStreamInterceptor(tracer trace.Tracer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (_ grpc.ClientStream, err error) {
+		ctx, span := tracer.Start(ctx, "eos.grpc "+method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("rpc.method", method), attribute.String("eos.hop", "mgm")))
+		defer func() { endSpan(span, err) }()
+		return streamer(injectMetadata(ctx), desc, cc, method, opts...)
+	}
+}
+
+// traceTransport records a span for every HTTP request, telling
+// apart the ones to the MGM from the ones redirected to the FSTs.
+type traceTransport struct {
+	base    http.RoundTripper
+	tracer  trace.Tracer
+	mgmHost string
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (_ *http.Response, err error) {
+	hop := hop(req, t.mgmHost)
+
+	ctx, span := t.tracer.Start(req.Context(), "eos.http "+req.Method+" "+hop, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("eos.hop", hop),
+		))
+	defer func() { endSpan(span, err) }()
+
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+	return res, nil
+}
+
+// spanReadCloser ends the span when closed,
+// calling done if set.
+type spanReadCloser struct {
+	io.ReadCloser
+	span trace.Span
+	done func()
+}
+
+func (r *spanReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.span.End()
+	if r.done != nil {
+		r.done()
+	}
+	return err
+}
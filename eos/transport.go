@@ -0,0 +1,130 @@
+package eos
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the HTTP client used for the
+// transfers with the MGM and the FSTs.
+type TransportConfig struct {
+	// MaxIdleConnsPerHost is the number of idle connections
+	// kept open to each FST for reuse. Defaults to 64.
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+	// IdleConnTimeout is the time an idle connection is kept
+	// open. Defaults to 90s.
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+	// DialTimeout is the maximum time to establish a connection.
+	// Defaults to 30s.
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	// TLSHandshakeTimeout is the maximum time of the TLS handshake.
+	// Defaults to 10s.
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout"`
+	// HTTP2 enables HTTP/2 with the servers supporting it.
+	// By default only HTTP/1.1 is used, spreading the concurrent
+	// transfers over distinct connections.
+	HTTP2 bool `mapstructure:"http2"`
+	// BufferSize is the size in bytes of the read and write
+	// buffers of each connection. Defaults to 256 KiB.
+	BufferSize int `mapstructure:"buffer_size"`
+	// MinChunkSize is the size in bytes of the smallest chunk
+	// the uploads are relayed in. The smaller uploads are relayed
+	// directly. Defaults to 64 KiB.
+	MinChunkSize int `mapstructure:"min_chunk_size"`
+	// MaxChunkSize is the size in bytes of the largest chunk
+	// the uploads are relayed in. Defaults to 1 MiB.
+	MaxChunkSize int `mapstructure:"max_chunk_size"`
+}
+
+func (c TransportConfig) withDefaults() TransportConfig {
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = 64
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = 90 * time.Second
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 30 * time.Second
+	}
+	if c.TLSHandshakeTimeout <= 0 {
+		c.TLSHandshakeTimeout = 10 * time.Second
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 256 << 10
+	}
+	if c.MinChunkSize <= 0 {
+		c.MinChunkSize = 64 << 10
+	}
+	if c.MaxChunkSize <= 0 {
+		c.MaxChunkSize = 1 << 20
+	}
+	c.MaxChunkSize = max(c.MaxChunkSize, c.MinChunkSize)
+	return c
+}
+
+// TransferMemory returns the memory in bytes of the buffers
+// relaying the data of a transfer: the read and write buffers
+// of its connection, a pooled copy buffer and the two largest
+// chunks of an upload.
+func (c TransportConfig) TransferMemory() int64 {
+	c = c.withDefaults()
+	return int64(2*c.BufferSize + transferBufferSize + 2*c.MaxChunkSize)
+}
+
+// newTransport returns the transport used for the HTTP transfers.
+// The connection buffers are larger than the default ones, so that
+// the request and response bodies are relayed in large chunks
+// instead of in 4 KiB writes.
+func newTransport(cfg TransportConfig) *http.Transport {
+	cfg = cfg.withDefaults()
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	t.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	t.MaxIdleConns = 0
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.IdleConnTimeout = cfg.IdleConnTimeout
+	t.WriteBufferSize = cfg.BufferSize
+	t.ReadBufferSize = cfg.BufferSize
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.HTTP2)
+	t.Protocols = &protocols
+	t.ForceAttemptHTTP2 = cfg.HTTP2
+	return t
+}
+
+// maxDrain is the maximum number of bytes read from a body
+// that is not used, to reuse its connection.
+const maxDrain = 64 << 10
+
+// discard drains and closes the body of a response that is not
+// used, like the one of a redirection, so that its connection
+// goes back to the idle pool instead of being closed.
+func discard(res *http.Response) {
+	_, _ = io.CopyN(io.Discard, res.Body, maxDrain)
+	_ = res.Body.Close()
+}
+
+type largeTransferKey struct{}
+
+// WithLargeTransfer marks the transfer done with ctx as large, sending
+// it on the connections reserved to the large transfers, if configured.
+func WithLargeTransfer(ctx context.Context) context.Context {
+	return context.WithValue(ctx, largeTransferKey{}, true)
+}
+
+// transferClient returns the HTTP client of the transfer done with ctx.
+func (c *Client) transferClient(ctx context.Context) *http.Client {
+	if large, _ := ctx.Value(largeTransferKey{}).(bool); large && c.largeHTTPClient != nil {
+		return c.largeHTTPClient
+	}
+	return c.httpClient
+}
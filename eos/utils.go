@@ -1,6 +1,9 @@
 package eos
 
-import "strings"
+import (
+	"path"
+	"strings"
+)
 
 // IsVersionFolder returns true if the resource is a version folder.
 func IsVersionFolder(path string) bool {
@@ -11,3 +14,15 @@ func IsVersionFolder(path string) bool {
 func IsAtomicFile(path string) bool {
 	return strings.Contains(path, ".sys.a#")
 }
+
+// MultipartFolder returns the folder staging the parts
+// of the multipart upload of a bucket at bucketPath.
+func MultipartFolder(bucketPath, uploadId string) string {
+	return path.Join(bucketPath, ".multipart."+uploadId)
+}
+
+// IsMultipartFolder returns true if the resource is, or is
+// inside, the staging folder of a multipart upload.
+func IsMultipartFolder(path string) bool {
+	return strings.Contains(path, "/.multipart.")
+}
@@ -0,0 +1,138 @@
+package eoss3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/gmgigi96/eoss3/meta"
+)
+
+// AdminConfig configures the endpoint managing the assignments of the
+// buckets to the users, to share the buckets without accessing the
+// meta store from the gateway host.
+type AdminConfig struct {
+	// Address is where the endpoint is served, e.g. "localhost:7070".
+	// If not set, it is disabled.
+	Address string `mapstructure:"address"`
+	// Token, if set, must be given in the Authorization header
+	// as a bearer token. If not set, only the requests coming
+	// from the loopback interface are accepted.
+	Token string `mapstructure:"token"`
+}
+
+// serveAdmin serves on the configured address:
+//   - GET /admin/buckets/{bucket}/users: the uids the bucket is assigned to
+//   - PUT /admin/buckets/{bucket}/users/{user}: assigns the bucket to the user
+//   - DELETE /admin/buckets/{bucket}/users/{user}: unassigns it
+//
+// The user is given by name or uid. The tenant query parameter
+// selects the buckets of a tenant.
+func (b *EosBackend) serveAdmin() error {
+	l, err := net.Listen("tcp", b.cfg.Admin.Address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/buckets/{bucket}/users", b.adminListUsers)
+	mux.HandleFunc("PUT /admin/buckets/{bucket}/users/{user}", b.adminAssign)
+	mux.HandleFunc("DELETE /admin/buckets/{bucket}/users/{user}", b.adminUnassign)
+
+	b.admin = &http.Server{Handler: protect(b.cfg.Admin.Token, mux), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := b.admin.Serve(l); err != nil && err != http.ErrServerClosed {
+			b.log.Error("error serving admin endpoint", "address", b.cfg.Admin.Address, "error", err)
+		}
+	}()
+	return nil
+}
+
+// adminBucket returns the store and the bucket of the request,
+// writing the error if not found.
+func (b *EosBackend) adminBucket(w http.ResponseWriter, r *http.Request) (meta.BucketStorer, meta.Bucket, bool) {
+	store := b.meta
+	if name := r.URL.Query().Get("tenant"); name != "" {
+		t := b.tenants.byName(name)
+		if t == nil {
+			http.Error(w, "no such tenant", http.StatusNotFound)
+			return nil, meta.Bucket{}, false
+		}
+		store = t.meta
+	}
+	bucket, err := store.GetBucket(r.Context(), r.PathValue("bucket"))
+	if err != nil {
+		if errors.Is(err, meta.ErrNoSuchBucket) {
+			http.Error(w, "no such bucket", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, meta.Bucket{}, false
+	}
+	return store, bucket, true
+}
+
+func (b *EosBackend) adminListUsers(w http.ResponseWriter, r *http.Request) {
+	store, bucket, ok := b.adminBucket(w, r)
+	if !ok {
+		return
+	}
+	uids, err := store.ListUsers(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	assigned := []int{}
+	for _, uid := range uids {
+		if store.IsAssigned(r.Context(), bucket.Name, uid) {
+			assigned = append(assigned, uid)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"bucket": bucket.Name, "uids": assigned})
+}
+
+func (b *EosBackend) adminAssign(w http.ResponseWriter, r *http.Request) {
+	b.adminUpdate(w, r, meta.BucketStorer.AssignBucket)
+}
+
+func (b *EosBackend) adminUnassign(w http.ResponseWriter, r *http.Request) {
+	b.adminUpdate(w, r, meta.BucketStorer.UnassignBucket)
+}
+
+func (b *EosBackend) adminUpdate(w http.ResponseWriter, r *http.Request, update func(meta.BucketStorer, context.Context, string, int) error) {
+	store, bucket, ok := b.adminBucket(w, r)
+	if !ok {
+		return
+	}
+	uid, err := lookupUid(r.PathValue("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := meta.WithActor(r.Context(), "admin-api")
+	if err := update(store, ctx, bucket.Name, uid); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b.policies.invalidate(bucket.Name)
+	b.log.InfoContext(ctx, "bucket assignment changed", "method", r.Method, "bucket", bucket.Name, "uid", uid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupUid returns the uid of the user given by name or uid.
+func lookupUid(s string) (int, error) {
+	if uid, err := strconv.Atoi(s); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(s)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
@@ -0,0 +1,52 @@
+package eoss3
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+)
+
+// The attributes of the objects derived from their extended
+// attributes are read from the metadata returned with each entry
+// by the Find of a listing, extended attributes included. A listing
+// thus costs a call per directory, never one per object.
+
+// checksumAlgorithms maps the checksum types of
+// EOS to the S3 checksum algorithms.
+var checksumAlgorithms = map[string]types.ChecksumAlgorithm{
+	"crc32":  types.ChecksumAlgorithmCrc32,
+	"crc32c": types.ChecksumAlgorithmCrc32c,
+	"sha1":   types.ChecksumAlgorithmSha1,
+	"sha256": types.ChecksumAlgorithmSha256,
+}
+
+// getChecksumAlgorithms returns the S3 algorithms
+// of the checksums stored by EOS for the file.
+func getChecksumAlgorithms(md *erpc.MDResponse) []types.ChecksumAlgorithm {
+	var algs []types.ChecksumAlgorithm
+	for _, xs := range md.Fmd.Checksums {
+		if alg, ok := checksumAlgorithms[xs.Type]; ok && !slices.Contains(algs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// forcedChecksumXattr is the attribute of a directory setting the
+// checksum computed by the FSTs for the files created in it.
+const forcedChecksumXattr = "sys.forced.checksum"
+
+// fstComputesMD5 returns whether the FSTs compute the MD5 of the
+// files written at path, from the layout of its directory: the
+// gateway can then take it from EOS instead of computing it.
+func (b *EosBackend) fstComputesMD5(ctx context.Context, auth eos.Auth, path string) bool {
+	md, err := b.eos.Stat(ctx, auth, filepath.Dir(path))
+	if err != nil || md.Cmd == nil {
+		return false
+	}
+	return string(md.Cmd.Xattrs[forcedChecksumXattr]) == "md5"
+}
@@ -0,0 +1,126 @@
+package eoss3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gmgigi96/eoss3/meta"
+)
+
+// AuthCacheConfig configures the cache of the bucket policies
+// returned for the authorization of the requests, sparing the
+// lookups in the meta store on every request.
+type AuthCacheConfig struct {
+	// TTL is the time a policy is cached for. The changes of the
+	// buckets notified by the meta store, including the ones done
+	// with eoss3-cli, invalidate it, as do the changes of the
+	// assignments done through the gateway, while the ones done
+	// with eoss3-cli may take this long to be honored.
+	// If not set, the policies are not cached.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+type policyKey struct {
+	tenant *tenant
+	bucket string
+	uid    uint64
+}
+
+type cachedPolicy struct {
+	// name is the real name of the bucket,
+	// the key one being possibly an alias
+	name    string
+	policy  []byte
+	expires time.Time
+}
+
+// policyCache caches the policies by tenant, bucket and user.
+// The expired policies are dropped when looked up, the ones
+// never looked up again by a sweep done at most once per TTL.
+// A nil policyCache caches nothing.
+type policyCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[policyKey]cachedPolicy
+	swept   time.Time
+}
+
+func newPolicyCache(cfg AuthCacheConfig) *policyCache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	return &policyCache{ttl: cfg.TTL, entries: make(map[policyKey]cachedPolicy)}
+}
+
+func (c *policyCache) get(ctx context.Context, bucket string, uid uint64) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := policyKey{tenantFrom(ctx), bucket, uid}
+	e, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, k)
+		return nil, false
+	}
+	return e.policy, true
+}
+
+func (c *policyCache) put(ctx context.Context, bucket, name string, uid uint64, policy []byte) {
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.swept) >= c.ttl {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	c.entries[policyKey{tenantFrom(ctx), bucket, uid}] = cachedPolicy{name: name, policy: policy, expires: now.Add(c.ttl)}
+}
+
+// invalidate drops the policies of the bucket name,
+// including the ones cached by its aliases.
+func (c *policyCache) invalidate(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if e.name == name || k.bucket == name {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// watchBuckets drops the cached policies and stats of the buckets
+// changed in store, as notified by its watcher, until ctx is done.
+func (b *EosBackend) watchBuckets(ctx context.Context, store meta.BucketStorer) {
+	events, err := store.Watch(ctx)
+	if err != nil {
+		b.log.Warn("error watching the buckets, changes are honored after the cache TTL", "error", err)
+		return
+	}
+	for ev := range events {
+		b.log.Debug("bucket changed", "bucket", ev.Bucket.Name, "event", ev.Type)
+		b.policies.invalidate(ev.Bucket.Name)
+		for _, alias := range ev.Bucket.Aliases {
+			b.policies.invalidate(alias)
+		}
+		if ev.Bucket.Path != "" {
+			b.eos.InvalidateTree(ev.Bucket.Path)
+		}
+	}
+}
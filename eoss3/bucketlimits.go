@@ -0,0 +1,72 @@
+package eoss3
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/versity/versitygw/auth"
+	"github.com/versity/versitygw/s3err"
+)
+
+// BucketLimitsConfig limits the buckets created by the users,
+// to keep the shared EOS namespace tidy.
+type BucketLimitsConfig struct {
+	// MaxBuckets is the maximum number of buckets owned by a user.
+	// Zero means unlimited.
+	MaxBuckets int `mapstructure:"max_buckets"`
+	// NamePrefixes are the prefixes the names of the buckets created
+	// must start with, one of them, e.g. {username}- or atlas-. The
+	// {username}, {uid}, {gid} and {access} placeholders are replaced
+	// with the ones of the user. If empty, any name is allowed.
+	NamePrefixes []string `mapstructure:"name_prefixes"`
+}
+
+var errTooManyBuckets = s3err.APIError{
+	Code:           "TooManyBuckets",
+	Description:    "You have attempted to create more buckets than allowed.",
+	HTTPStatusCode: http.StatusBadRequest,
+}
+
+// checkBucketLimits refuses the creation of the bucket name by the
+// account, as owner, when exceeding the limits of the config.
+func (b *EosBackend) checkBucketLimits(ctx context.Context, acct auth.Account, owner eos.Auth, name string) error {
+	cfg := b.cfg.BucketLimits
+	if len(cfg.NamePrefixes) > 0 {
+		r := strings.NewReplacer(
+			"{uid}", strconv.FormatUint(owner.Uid, 10),
+			"{gid}", strconv.FormatUint(owner.Gid, 10),
+			"{access}", acct.Access,
+		)
+		allowed := slices.ContainsFunc(cfg.NamePrefixes, func(p string) bool {
+			if strings.Contains(p, "{username}") {
+				p = strings.ReplaceAll(p, "{username}", owner.Username())
+			}
+			return strings.HasPrefix(name, r.Replace(p))
+		})
+		if !allowed {
+			b.log.InfoContext(ctx, "bucket name not allowed", "bucket", name, "prefixes", cfg.NamePrefixes)
+			return s3err.GetAPIError(s3err.ErrInvalidBucketName)
+		}
+	}
+
+	if cfg.MaxBuckets > 0 {
+		buckets, err := b.store(ctx).ListBuckets(ctx)
+		if err != nil {
+			return err
+		}
+		var owned int
+		for _, bucket := range buckets {
+			if bucket.Owner != nil && bucket.Owner.Uid == owner.Uid {
+				owned++
+			}
+		}
+		if owned >= cfg.MaxBuckets {
+			return errTooManyBuckets
+		}
+	}
+	return nil
+}
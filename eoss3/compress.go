@@ -0,0 +1,115 @@
+package eoss3
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionConfig configures the compression on the fly of the
+// downloads, for the clients accepting it, reducing the egress
+// bandwidth of the compressible data, like logs or text datasets.
+type CompressionConfig struct {
+	// ContentTypes are the content types compressed, guessed from the
+	// extension of the keys. A type ending with "/", like "text/",
+	// matches all the types of the family.
+	// If not set, nothing is compressed.
+	ContentTypes []string `mapstructure:"content_types"`
+	// Buckets are the buckets whose objects are compressed.
+	// If not set, the objects of all the buckets are.
+	Buckets []string `mapstructure:"buckets"`
+	// MinSize is the size in bytes from which the objects
+	// are compressed. Defaults to 1 KiB.
+	MinSize int64 `mapstructure:"min_size"`
+}
+
+const defaultCompressionMinSize = 1 << 10
+
+// encodings are the supported content codings, by preference.
+var encodings = []string{"zstd", "gzip"}
+
+// compressible returns whether the object key of bucket,
+// of size bytes, is to be compressed.
+func (c *CompressionConfig) compressible(bucket, key string, size int64) bool {
+	if c == nil || len(c.ContentTypes) == 0 {
+		return false
+	}
+	minSize := c.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	if size >= 0 && size < minSize {
+		return false
+	}
+	if len(c.Buckets) > 0 && !slices.Contains(c.Buckets, bucket) {
+		return false
+	}
+	ct, _, _ := strings.Cut(mime.TypeByExtension(path.Ext(key)), ";")
+	if ct == "" {
+		return false
+	}
+	return slices.ContainsFunc(c.ContentTypes, func(t string) bool {
+		if strings.HasSuffix(t, "/") {
+			return strings.HasPrefix(ct, t)
+		}
+		return ct == t
+	})
+}
+
+// acceptedEncoding returns the preferred supported encoding
+// accepted by the Accept-Encoding header, if any.
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(coding))] = q > 0
+	}
+	for _, e := range encodings {
+		if accepted[e] {
+			return e
+		}
+	}
+	return ""
+}
+
+// compress returns body compressed with encoding, on the fly.
+func compress(body io.ReadCloser, encoding string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		var enc io.WriteCloser
+		switch encoding {
+		case "zstd":
+			enc, _ = zstd.NewWriter(pw)
+		default:
+			enc = gzip.NewWriter(pw)
+		}
+		_, err := io.Copy(enc, body)
+		if cerr := enc.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+	return &compressedBody{PipeReader: pr, body: body}
+}
+
+type compressedBody struct {
+	*io.PipeReader
+	body io.Closer
+}
+
+func (c *compressedBody) Close() error {
+	_ = c.PipeReader.Close()
+	return c.body.Close()
+}
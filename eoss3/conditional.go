@@ -0,0 +1,37 @@
+package eoss3
+
+import (
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/versity/versitygw/backend"
+)
+
+// notModifiedCode is the S3 error code answering the conditional
+// requests on objects not modified. It is not an error.
+const notModifiedCode = "NotModified"
+
+// conditions are the conditional headers of a request.
+type conditions struct {
+	ifMatch, ifNoneMatch      *string
+	ifModSince, ifUnmodeSince *time.Time
+}
+
+// set returns whether any of the conditions is set.
+func (c conditions) set() bool {
+	return c.ifMatch != nil || c.ifNoneMatch != nil || c.ifModSince != nil || c.ifUnmodeSince != nil
+}
+
+// check evaluates the conditions on the metadata of the object,
+// returning NotModified or PreconditionFailed when not met.
+// The metadata comes from the stat cache if enabled, so that the
+// clients polling an object with If-None-Match are answered without
+// a round trip to the MGM for as long as the result is cached.
+func (c conditions) check(info *erpc.MDResponse) error {
+	return backend.EvaluatePreconditions(getMD5(info), mtime(info), backend.PreConditions{
+		IfMatch:       c.ifMatch,
+		IfNoneMatch:   c.ifNoneMatch,
+		IfModSince:    c.ifModSince,
+		IfUnmodeSince: c.ifUnmodeSince,
+	})
+}
@@ -0,0 +1,100 @@
+package eoss3
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// DebugConfig configures the endpoint exposing the runtime
+// diagnostics: the pprof profiles and the expvar variables.
+type DebugConfig struct {
+	// Address is where the diagnostics are served, e.g. "localhost:6060".
+	// If not set, they are disabled.
+	Address string `mapstructure:"address"`
+	// Token, if set, must be given in the Authorization header
+	// as a bearer token. If not set, only the requests coming
+	// from the loopback interface are accepted.
+	Token string `mapstructure:"token"`
+}
+
+// transfers counts the data moved to and from EOS,
+// published in expvar together with the goroutines.
+var transfers = expvar.NewMap("transfers")
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+}
+
+func countUpload(bytes int64) {
+	transfers.Add("uploads", 1)
+	transfers.Add("bytes_uploaded", bytes)
+}
+
+func countDownload(bytes int64) {
+	transfers.Add("downloads", 1)
+	transfers.Add("bytes_downloaded", bytes)
+}
+
+// serveDebug serves on the configured address the pprof
+// profiles under /debug/pprof/ and the expvar variables
+// under /debug/vars.
+func (b *EosBackend) serveDebug() error {
+	l, err := net.Listen("tcp", b.cfg.Debug.Address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	b.debug = &http.Server{Handler: b.protectDebug(mux), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := b.debug.Serve(l); err != nil && err != http.ErrServerClosed {
+			b.log.Error("error serving diagnostics", "address", b.cfg.Debug.Address, "error", err)
+		}
+	}()
+	return nil
+}
+
+// protectDebug rejects the requests without the configured token
+// or, if none is configured, the ones not coming from the loopback.
+func (b *EosBackend) protectDebug(h http.Handler) http.Handler {
+	return protect(b.cfg.Debug.Token, h)
+}
+
+// protect rejects the requests without token or, if
+// empty, the ones not coming from the loopback.
+func protect(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		} else if !isLoopback(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,76 @@
+package eoss3
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+// defaultDeleteWorkers is the number of concurrent
+// deletions done by DeleteObjects when not configured.
+const defaultDeleteWorkers = 8
+
+// DeleteObjects deletes the objects concurrently, with at most
+// the configured number of deletions in flight, collecting the
+// outcome of every key.
+func (b *EosBackend) DeleteObjects(ctx context.Context, req *s3.DeleteObjectsInput) (_ s3response.DeleteResult, err error) {
+	ctx, op := b.startOperation(ctx, "DeleteObjects", "bucket", aws.ToString(req.Bucket), "count", len(req.Delete.Objects))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.DeleteResult{}, err
+	}
+
+	if _, err := b.getBucket(ctx, aws.ToString(req.Bucket)); err != nil {
+		return s3response.DeleteResult{}, err
+	}
+
+	workers := b.cfg.DeleteWorkers
+	if workers <= 0 {
+		workers = defaultDeleteWorkers
+	}
+
+	objects := req.Delete.Objects
+	errs := make([]error, len(objects))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, obj := range objects {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			_, errs[i] = b.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket:    req.Bucket,
+				Key:       obj.Key,
+				VersionId: obj.VersionId,
+			})
+		}()
+	}
+	wg.Wait()
+
+	res := s3response.DeleteResult{
+		Deleted: []types.DeletedObject{},
+		Error:   []types.Error{},
+	}
+	for i, obj := range objects {
+		if errs[i] == nil {
+			res.Deleted = append(res.Deleted, types.DeletedObject{Key: obj.Key, VersionId: obj.VersionId})
+			continue
+		}
+		e := types.Error{Key: obj.Key, Code: Ptr(errorCode(errs[i]))}
+		var apiErr s3err.APIError
+		if errors.As(errs[i], &apiErr) {
+			e.Message = &apiErr.Description
+		} else {
+			e.Message = Ptr(errs[i].Error())
+		}
+		res.Error = append(res.Error, e)
+	}
+	return res, nil
+}
@@ -3,25 +3,35 @@ package eoss3
 import (
 	"bufio"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"path"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
 	"path/filepath"
 	"slices"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	erpc "github.com/cern-eos/go-eosgrpc"
 	"github.com/gmgigi96/eoss3/eos"
 	"github.com/gmgigi96/eoss3/meta"
+	"github.com/gmgigi96/eoss3/oplog"
 	"github.com/versity/versitygw/auth"
 	"github.com/versity/versitygw/backend"
 	"github.com/versity/versitygw/s3err"
 	"github.com/versity/versitygw/s3response"
 	"github.com/versity/versitygw/s3select"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Config struct {
@@ -33,6 +43,89 @@ type Config struct {
 	Authkey string `mapstructure:"authkey"`
 	// Insecure is set to true if the client does not want to use TLS.
 	Insecure bool `mapstructure:"insecure"`
+	// DefaultBucketPath is the template of the path where the buckets
+	// are created for the users without a default path set.
+	// E.g. /eos/user/{initial}/{username}/s3/{bucket}
+	DefaultBucketPath string `mapstructure:"default_bucket_path"`
+	// ComputeMD5 makes the gateway compute the MD5 of the uploaded
+	// objects, stored on EOS and returned as their ETag.
+	ComputeMD5 bool `mapstructure:"compute_md5"`
+	// UserMetadata makes the gateway store the user metadata of the
+	// uploaded objects, returned by HeadObject and GetObject.
+	UserMetadata bool `mapstructure:"user_metadata"`
+	// DeleteWorkers is the number of concurrent deletions
+	// done by DeleteObjects. Defaults to 8.
+	DeleteWorkers int `mapstructure:"delete_workers"`
+	// ListWorkers is the number of subdirectories listed
+	// concurrently by a recursive listing. Defaults to 8.
+	ListWorkers int `mapstructure:"list_workers"`
+	// RedirectGet configures the redirection of the downloads to the FSTs.
+	RedirectGet *RedirectGetConfig `mapstructure:"redirect_get"`
+	// Import configures the import of existing EOS directories as buckets.
+	Import *ImportConfig `mapstructure:"import"`
+	// Log configures the level and the format of the logs.
+	Log LogConfig `mapstructure:"log"`
+	// Tracing configures the export of the traces of the operations.
+	Tracing TracingConfig `mapstructure:"tracing"`
+	// Metrics configures the export of the metrics.
+	Metrics MetricsConfig `mapstructure:"metrics"`
+	// StatCache configures the cache of the metadata of the files.
+	StatCache eos.StatCacheConfig `mapstructure:"stat_cache"`
+	// Admission bounds the number of concurrent calls to the MGM.
+	Admission eos.AdmissionConfig `mapstructure:"admission"`
+	// Transport tunes the HTTP client of the transfers with EOS.
+	Transport eos.TransportConfig `mapstructure:"transport"`
+	// GRPC tunes the gRPC connections to the MGM.
+	GRPC eos.GRPCConfig `mapstructure:"grpc"`
+	// ScopedTokens configures the tokens, limited to the bucket and to the
+	// access needed, authenticating the calls in place of the authkey.
+	ScopedTokens eos.TokensConfig `mapstructure:"scoped_tokens"`
+	// OpLog are the sinks where the mutating operations are recorded.
+	OpLog []oplog.SinkConfig `mapstructure:"oplog"`
+	// Health configures the health and readiness endpoints.
+	Health HealthConfig `mapstructure:"health"`
+	// Debug configures the runtime diagnostics endpoint.
+	Debug DebugConfig `mapstructure:"debug"`
+	// Admin configures the endpoint managing the bucket assignments.
+	Admin AdminConfig `mapstructure:"admin"`
+	// AuthCache configures the cache of the bucket policies.
+	AuthCache AuthCacheConfig `mapstructure:"auth_cache"`
+	// Owners configures the resolution of the names
+	// of the owners of the objects in the listings.
+	Owners OwnersConfig `mapstructure:"owners"`
+	// Hidden configures the entries hidden from the listings.
+	Hidden HiddenConfig `mapstructure:"hidden"`
+	// RemoveSystemEntries makes DeleteBucket remove the entries of EOS
+	// left in the directory of the bucket, like the version folders and
+	// the leftovers of the atomic uploads. Otherwise, the buckets holding
+	// them are not empty.
+	RemoveSystemEntries bool `mapstructure:"remove_system_entries"`
+	// VOs are the virtual organizations the buckets can be
+	// restricted to, by name.
+	VOs map[string]VOConfig `mapstructure:"vos"`
+	// TrustedProxies are the CIDRs of the proxies in front of the
+	// gateway, whose X-Forwarded-For header gives the address of the
+	// clients the buckets restricted to some networks are checked with.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// RateLimit configures the limits applied to each user.
+	RateLimit *RateLimitConfig `mapstructure:"rate_limit"`
+	// Memory bounds the memory used to relay the transfers.
+	Memory MemoryConfig `mapstructure:"memory"`
+	// ReadAhead configures the read-ahead of the downloads.
+	ReadAhead ReadAheadConfig `mapstructure:"read_ahead"`
+	// Compression configures the compression of the downloads.
+	Compression *CompressionConfig `mapstructure:"compression"`
+	// Scheduling segregates the large transfers from the small ones.
+	Scheduling SchedulingConfig `mapstructure:"scheduling"`
+	// Identity configures the mapping of the S3 accounts
+	// to the identities operating on EOS.
+	Identity IdentityConfig `mapstructure:"identity"`
+	// Tenants are the tenants served by the gateway, each one with
+	// its own buckets and identities. The requests outside of any
+	// tenant are served with the buckets and identities above.
+	Tenants []TenantConfig `mapstructure:"tenants"`
+	// BucketLimits limits the buckets created by the users.
+	BucketLimits BucketLimitsConfig `mapstructure:"bucket_limits"`
 }
 
 func (c *Config) Validate() error {
@@ -51,108 +144,404 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// EosClient is the client of EOS used by the backend, implemented
+// by eos.Client and by eos.FakeClient, e.g. for the benchmarks.
+type EosClient interface {
+	Stat(ctx context.Context, auth eos.Auth, path string) (*erpc.MDResponse, error)
+	ListDir(ctx context.Context, auth eos.Auth, dir string, f func(*erpc.MDResponse), filters *eos.ListDirFilters) error
+	ListDirUntil(ctx context.Context, auth eos.Auth, dir string, f func(*erpc.MDResponse) bool, filters *eos.ListDirFilters) error
+	Mkdir(ctx context.Context, auth eos.Auth, path string, mode int64) error
+	Rmdir(ctx context.Context, auth eos.Auth, path string) error
+	Remove(ctx context.Context, auth eos.Auth, path string, recursive bool) error
+	Rename(ctx context.Context, auth eos.Auth, source, destination string) error
+	SetXattrs(ctx context.Context, auth eos.Auth, path string, set map[string]string, remove []string) error
+	GetQuota(ctx context.Context, auth eos.Auth, path string) ([]*erpc.QuotaProto, error)
+	Download(ctx context.Context, auth eos.Auth, path string, rangeHeader *string) (io.ReadCloser, int64, error)
+	DownloadObject(ctx context.Context, auth eos.Auth, path string, rangeHeader *string) (*eos.Object, error)
+	DownloadURL(ctx context.Context, auth eos.Auth, path string) (string, error)
+	Upload(ctx context.Context, auth eos.Auth, path string, data io.Reader, length uint64) error
+	UploadChunk(ctx context.Context, auth eos.Auth, path string, chunk io.Reader, length, offset, total uint64) error
+	Scoped(ctx context.Context, auth eos.Auth, path string, write bool) (eos.Auth, error)
+	Ping(ctx context.Context) (time.Duration, error)
+	PingHTTP(ctx context.Context) error
+	InvalidateTree(path string)
+	TakeErrorCounts() map[string]int64
+	Close() error
+}
+
+var (
+	_ EosClient = (*eos.Client)(nil)
+	_ EosClient = (*eos.FakeClient)(nil)
+)
+
 type EosBackend struct {
 	cfg *Config
 
-	eos  *eos.Client
+	eos  EosClient
 	meta meta.BucketStorer
+	log  *slog.Logger
 	backend.BackendUnsupported
+
+	logOutput io.Closer
+
+	limits    *limiters
+	memory    *memoryBudget
+	readAhead *readAheader
+	sched     *scheduler
+
+	identities IdentityMapper
+	guard      *identityGuard
+	tenants    *tenants
+	policies   *policyCache
+	proxies    []netip.Prefix
+	owners     *ownerNames
+	hidden     *hiddenFilter
+
+	tracer        trace.Tracer
+	traceShutdown func(context.Context) error
+
+	metricsShutdown func(context.Context) error
+	errors          *errorCounter
+
+	oplog  *oplog.Logger
+	health *http.Server
+	debug  *http.Server
+	admin  *http.Server
+
+	hooksMu sync.RWMutex
+	hooks   []Hooks
+
+	cancel context.CancelFunc
 }
 
-func New(cfg *Config, meta meta.BucketStorer) (*EosBackend, error) {
+func New(cfg *Config, store meta.BucketStorer) (*EosBackend, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
+	return newBackend(cfg, store, nil)
+}
 
-	eosCl, err := eos.NewClient(eos.Config{
-		GrpcURL:  cfg.GrpcURL,
-		HttpURL:  cfg.HttpURL,
-		AuthKey:  cfg.Authkey,
-		Insecure: cfg.Insecure,
-	})
+// NewWithClient returns a backend calling client in place of the EOS
+// instance of the config, whose URLs and authkey are then not needed.
+func NewWithClient(cfg *Config, store meta.BucketStorer, client EosClient) (*EosBackend, error) {
+	return newBackend(cfg, store, client)
+}
+
+// newBackend returns the backend of the config,
+// connecting to EOS if client is nil.
+func newBackend(cfg *Config, store meta.BucketStorer, client EosClient) (*EosBackend, error) {
+	memory, err := newMemoryBudget(cfg.Memory, cfg.Transport.TransferMemory())
+	if err != nil {
+		return nil, err
+	}
+	identities, err := NewIdentityMapper(cfg.Identity)
+	if err != nil {
+		return nil, err
+	}
+	guard, err := newIdentityGuard(cfg.Identity.Guard)
 	if err != nil {
 		return nil, err
 	}
+	proxies, err := parsePrefixes(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the trusted proxies: %w", err)
+	}
+	owners, err := newOwnerNames(cfg.Owners)
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := newHiddenFilter(cfg.Hidden)
+	if err != nil {
+		return nil, err
+	}
+
+	log, logOutput, err := NewLogger(cfg.Log, cfg.Authkey)
+	if err != nil {
+		return nil, err
+	}
+	tp, traceShutdown, err := newTracerProvider(cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	mp, metricsShutdown, err := newMeterProvider(cfg.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	errCounter, err := newErrorCounter(mp)
+	if err != nil {
+		return nil, err
+	}
+	wrapStore := func(s meta.BucketStorer) meta.BucketStorer {
+		if l, ok := s.(meta.LoggerSetter); ok {
+			l.SetLogger(log.With("component", "meta"))
+		}
+		s = meta.NewTracedStorer(s, tp, meta.SlowLog{
+			Threshold:    cfg.Log.Slow.Meta,
+			Logger:       log.With("component", "meta"),
+			RequestStart: eos.RequestStart,
+		})
+		return meta.NewDedupStorer(s)
+	}
+	store = wrapStore(store)
+	var ts *tenants
+	if len(cfg.Tenants) > 0 {
+		if ts, err = newTenants(cfg.Tenants, wrapStore); err != nil {
+			return nil, err
+		}
+	}
+
+	sinks := make([]oplog.Sink, 0, len(cfg.OpLog))
+	for _, c := range cfg.OpLog {
+		sink, err := oplog.NewSink(c)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if client == nil {
+		if client, err = newEosClient(cfg, log, tp, mp); err != nil {
+			return nil, err
+		}
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	be := &EosBackend{
-		cfg:  cfg,
-		eos:  eosCl,
-		meta: meta,
+		cfg:    cfg,
+		eos:    client,
+		meta:   store,
+		log:    log,
+		cancel: cancel,
+
+		logOutput: logOutput,
+		memory:    memory,
+		readAhead: newReadAheader(cfg.ReadAhead),
+		sched:     newScheduler(cfg.Scheduling),
+
+		identities: identities,
+		guard:      guard,
+		tenants:    ts,
+		policies:   newPolicyCache(cfg.AuthCache),
+		proxies:    proxies,
+		owners:     owners,
+		hidden:     hidden,
+
+		tracer:        tp.Tracer(tracerName),
+		traceShutdown: traceShutdown,
+
+		metricsShutdown: metricsShutdown,
+		errors:          errCounter,
+
+		oplog: oplog.New(sinks, log.With("component", "oplog")),
+	}
+
+	if cfg.RateLimit != nil {
+		be.limits = newLimiters(*cfg.RateLimit)
+	}
+
+	if cfg.Import != nil && cfg.Import.Interval > 0 {
+		go be.runImportJob(ctx, cfg.Import.Interval)
+	}
+	if cfg.Log.ErrorSummary > 0 {
+		go be.runErrorSummary(ctx, cfg.Log.ErrorSummary)
+	}
+	// the changes of the buckets are only watched
+	// to invalidate the cached policies and stats
+	if be.policies != nil || cfg.StatCache.Enabled() {
+		go be.watchBuckets(ctx, store)
+		if ts != nil {
+			for _, t := range ts.all {
+				go be.watchBuckets(ctx, t.meta)
+			}
+		}
+	}
+	if cfg.Health.Address != "" {
+		if err := be.serveHealth(); err != nil {
+			be.Shutdown()
+			return nil, err
+		}
+	}
+	if cfg.Debug.Address != "" {
+		if err := be.serveDebug(); err != nil {
+			be.Shutdown()
+			return nil, err
+		}
+	}
+	if cfg.Admin.Address != "" {
+		if err := be.serveAdmin(); err != nil {
+			be.Shutdown()
+			return nil, err
+		}
 	}
 	return be, nil
 }
 
-func (b *EosBackend) Shutdown() { _ = b.eos.Close() }
+// newEosClient returns the client of the EOS instance of the config.
+func newEosClient(cfg *Config, log *slog.Logger, tp trace.TracerProvider, mp metric.MeterProvider) (*eos.Client, error) {
+	return eos.NewClient(eos.Config{
+		GrpcURL:        cfg.GrpcURL,
+		HttpURL:        cfg.HttpURL,
+		AuthKey:        cfg.Authkey,
+		Insecure:       cfg.Insecure,
+		Logger:         log.With("component", "eos"),
+		TracerProvider: tp,
+		MeterProvider:  mp,
+		StatCache:      cfg.StatCache,
+		Admission:      cfg.Admission,
+		Transport:      cfg.Transport,
+		GRPC:           cfg.GRPC,
+		SlowRPC:        cfg.Log.Slow.EOS,
+		SlowTransfer:   cfg.Log.Slow.Transfer,
+		Tokens:         cfg.ScopedTokens,
+
+		SeparateLargeTransfers: cfg.Scheduling.SeparateClients,
+	})
+}
+
+func (b *EosBackend) Shutdown() {
+	b.cancel()
+	if b.health != nil {
+		_ = b.health.Shutdown(context.Background())
+	}
+	if b.debug != nil {
+		_ = b.debug.Shutdown(context.Background())
+	}
+	if b.admin != nil {
+		_ = b.admin.Shutdown(context.Background())
+	}
+	_ = b.traceShutdown(context.Background())
+	_ = b.metricsShutdown(context.Background())
+	_ = b.oplog.Close()
+	_ = b.eos.Close()
+	_ = b.logOutput.Close()
+}
 
 func (b *EosBackend) String() string { return "EOS" }
 
+// isHiddenResource tells if the resource is an internal one of EOS.
 func isHiddenResource(path string) bool {
 	return eos.IsVersionFolder(path) || eos.IsAtomicFile(path)
 }
 
-func prepareListBucketResult(buckets []meta.Bucket, prefix string, tkn string, max int32) (entries []s3response.ListAllMyBucketsEntry, ctoken string) {
-	// TODO: prefix, continuation token and max entries can be moved later to the registry
+// WithAccount returns ctx carrying acct as the logged account, as set by
+// the gateway, to call the backend outside of the requests.
+func WithAccount(ctx context.Context, acct auth.Account) context.Context {
+	return context.WithValue(ctx, "account", acct)
+}
 
-	i := slices.IndexFunc(buckets, func(bucket meta.Bucket) bool {
-		return bucket.Name == tkn
-	})
-	if i >= 0 {
-		buckets = buckets[i:]
-	}
+func getLoggedAccount(ctx context.Context) (auth.Account, bool) {
+	acct, ok := ctx.Value("account").(auth.Account)
+	return acct, ok
+}
 
-	entries = make([]s3response.ListAllMyBucketsEntry, 0, max)
-	for i, b := range buckets {
-		if i == int(max-1) {
-			return entries, b.Name
+// eosAuth returns the identity used to operate on the bucket on EOS.
+// This is the run-as identity of the bucket if configured, otherwise
+// the one of the logged user.
+func (b *EosBackend) eosAuth(ctx context.Context, bucket *meta.Bucket) (eos.Auth, error) {
+	var id eos.Auth
+	if bucket.RunAs != nil {
+		// The operations are done as the service identity of the
+		// bucket: the requester does not need an identity on EOS.
+		acct, ok := getLoggedAccount(ctx)
+		if !ok {
+			return eos.Auth{}, s3err.GetAPIError(s3err.ErrAccessDenied)
 		}
-		if !strings.HasPrefix(b.Name, prefix) {
-			continue
+		if err := b.checkRestrictions(ctx, bucket, acct, nil); err != nil {
+			return eos.Auth{}, err
 		}
-		entries = append(entries, s3response.ListAllMyBucketsEntry{
-			Name:         b.Name,
-			CreationDate: b.CreatedAt,
-		})
+		id = eos.Auth{
+			Uid: bucket.RunAs.Uid,
+			Gid: bucket.RunAs.Gid,
+		}
+	} else {
+		acct, logged, err := b.loggedIdentity(ctx)
+		if err != nil {
+			return eos.Auth{}, err
+		}
+		if err := b.checkRestrictions(ctx, bucket, acct, &logged); err != nil {
+			return eos.Auth{}, err
+		}
+		id = b.groupFor(ctx, logged, bucket.Path)
 	}
-
-	return entries, ""
+	// the run-as identities and the groups of the
+	// directories are subject to the guard as well
+	if err := b.checkIdentity(ctx, id); err != nil {
+		return eos.Auth{}, err
+	}
+	if err := b.checkTenantRoot(ctx, bucket.Path); err != nil {
+		return eos.Auth{}, err
+	}
+	// the credentials of the calls are limited to the bucket
+	return b.eos.Scoped(ctx, id, bucket.Path, !readOnlyOperation(ctx))
 }
 
-func getLoggedAccount(ctx context.Context) (auth.Account, bool) {
-	acct, ok := ctx.Value("account").(auth.Account)
-	return acct, ok
+// groupFor returns id operating with the group of the directory
+// at path when it is one of its secondary groups, so that the
+// permissions granted to the group on EOS are honored.
+func (b *EosBackend) groupFor(ctx context.Context, id eos.Auth, path string) eos.Auth {
+	if len(id.Groups) == 0 {
+		return id
+	}
+	md, err := b.eos.Stat(ctx, id, path)
+	if err != nil || md.Cmd == nil || md.Cmd.Gid == id.Gid {
+		return id
+	}
+	if slices.Contains(id.Groups, md.Cmd.Gid) {
+		id.Gid = md.Cmd.Gid
+	}
+	return id
 }
 
-func (b *EosBackend) ListBuckets(ctx context.Context, input s3response.ListBucketsInput) (s3response.ListAllMyBucketsResult, error) {
-	fmt.Println("ListBuckets")
-	fmt.Println(input.IsAdmin)
+func (b *EosBackend) ListBuckets(ctx context.Context, input s3response.ListBucketsInput) (_ s3response.ListAllMyBucketsResult, err error) {
+	ctx, op := b.startOperation(ctx, "ListBuckets", "admin", input.IsAdmin)
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.ListAllMyBucketsResult{}, err
+	}
 
-	var buckets []s3response.ListAllMyBucketsEntry
-	var ctoken string
+	q := meta.BucketsQuery{
+		Prefix:     input.Prefix,
+		StartAfter: input.ContinuationToken,
+		Max:        int(input.MaxBuckets),
+	}
+	var page meta.BucketsPage
 	if input.IsAdmin {
 		// returns all the buckets for admin user
-		m, err := b.meta.ListBuckets()
+		page, err = b.store(ctx).ListBucketsPage(ctx, q)
 		if err != nil {
 			return s3response.ListAllMyBucketsResult{}, err
 		}
-		buckets, ctoken = prepareListBucketResult(m, input.Prefix, input.ContinuationToken, input.MaxBuckets)
 	} else {
-		acct, ok := getLoggedAccount(ctx)
-		if !ok {
-			// TODO: can this happen??
-			return s3response.ListAllMyBucketsResult{}, errors.New("no user in request")
+		_, id, err := b.loggedIdentity(ctx)
+		if err != nil {
+			return s3response.ListAllMyBucketsResult{}, err
 		}
-		bs, err := b.meta.ListBucketsByUser(acct.UserID)
+		bs, err := b.store(ctx).ListBucketsByUser(ctx, int(id.Uid))
 		if err != nil {
 			return s3response.ListAllMyBucketsResult{}, err
 		}
-		lst := make([]meta.Bucket, 0, len(bs))
-		for _, name := range bs {
-			m, err := b.meta.GetBucket(name)
+		slices.Sort(bs)
+		var names []string
+		names, page.Truncated = q.SelectPage(bs)
+		for _, name := range names {
+			m, err := b.store(ctx).GetBucket(ctx, name)
 			if err == nil {
-				lst = append(lst, m)
+				page.Buckets = append(page.Buckets, m)
 			}
 		}
-		buckets, ctoken = prepareListBucketResult(lst, input.Prefix, input.ContinuationToken, input.MaxBuckets)
+	}
+
+	// the continuation token is the name of the last bucket returned
+	buckets := make([]s3response.ListAllMyBucketsEntry, 0, len(page.Buckets))
+	for _, m := range page.Buckets {
+		buckets = append(buckets, s3response.ListAllMyBucketsEntry{
+			Name:         m.Name,
+			CreationDate: s3Time(m.CreatedAt),
+		})
+	}
+	var ctoken string
+	if page.Truncated && len(buckets) > 0 {
+		ctoken = buckets[len(buckets)-1].Name
 	}
 
 	return s3response.ListAllMyBucketsResult{
@@ -167,77 +556,147 @@ func (b *EosBackend) ListBuckets(ctx context.Context, input s3response.ListBucke
 	}, nil
 }
 
-func (b *EosBackend) GetBucketAcl(ctx context.Context, req *s3.GetBucketAclInput) ([]byte, error) {
-	fmt.Println("GetBucketAcl func")
+func (b *EosBackend) GetBucketAcl(ctx context.Context, req *s3.GetBucketAclInput) (_ []byte, err error) {
+	ctx, op := b.startOperation(ctx, "GetBucketAcl", "bucket", aws.ToString(req.Bucket))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := b.getBucket(ctx, aws.ToString(req.Bucket)); err != nil {
+		return nil, err
+	}
 
 	// The result is a json of the struct auth.ACL
 	return nil, nil
 }
 
-func (b *EosBackend) CreateBucket(ctx context.Context, req *s3.CreateBucketInput, acl []byte) error {
-	fmt.Println("CreateBucket")
+func (b *EosBackend) CreateBucket(ctx context.Context, req *s3.CreateBucketInput, acl []byte) (err error) {
+	ctx, op := b.startOperation(ctx, "CreateBucket", "bucket", aws.ToString(req.Bucket))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return err
+	}
+	defer func() { b.logOperation(ctx, "CreateBucket", aws.ToString(req.Bucket), "", 0, err) }()
 
 	name := *req.Bucket
 
-	if _, err := b.meta.GetBucket(name); err == nil {
+	if _, err := b.store(ctx).GetBucket(ctx, name); err == nil {
 		return s3err.GetAPIError(s3err.ErrBucketAlreadyExists)
 	}
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return s3err.GetAPIError(s3err.ErrAccessDenied)
+	acct, owner, err := b.loggedIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = meta.WithActor(ctx, acct.Access)
+	if err := b.checkBucketLimits(ctx, acct, owner, name); err != nil {
+		return err
 	}
 
-	defaultPath, err := b.meta.GetDefaultBucketPath(acct.UserID)
+	defaultPath, err := b.defaultBucketPath(ctx, int(owner.Uid), req)
 	if err != nil {
 		return err
 	}
+	if t := tenantFrom(ctx); defaultPath == "" && t != nil {
+		defaultPath = t.defaultBucketPath
+	}
+	if defaultPath == "" {
+		// fallback to the site wide template
+		defaultPath = b.cfg.DefaultBucketPath
+	}
 	if defaultPath == "" {
 		return s3err.GetAPIError(s3err.ErrInvalidArgument)
 	}
 
-	bucketPath := filepath.Join(defaultPath, name)
+	bucketPath, err := eos.ExpandBucketPath(defaultPath, owner, name)
+	if err != nil {
+		return err
+	}
+	if err := b.checkTenantRoot(ctx, bucketPath); err != nil {
+		return err
+	}
 
 	bucket := meta.Bucket{
 		Name:      name,
 		Path:      bucketPath,
 		CreatedAt: time.Now(),
+		Owner:     &meta.Identity{Uid: owner.Uid, Gid: owner.Gid},
+	}
+	if req.CreateBucketConfiguration != nil && len(req.CreateBucketConfiguration.Tags) > 0 {
+		bucket.Tags = make(map[string]string, len(req.CreateBucketConfiguration.Tags))
+		for _, t := range req.CreateBucketConfiguration.Tags {
+			bucket.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
 	}
-	if err := b.meta.CreateBucket(bucket); err != nil {
+	if err := b.store(ctx).CreateBucket(ctx, bucket); err != nil {
 		return err
 	}
+	b.policies.invalidate(name)
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
-	}
-	if err := b.eos.Mkdir(ctx, auth, bucketPath, 0755); err != nil {
-		return err
+	if err := b.eos.Mkdir(ctx, owner, bucketPath, 0755); err != nil {
+		return bucketError(err)
 	}
 
+	e := newBucketEvent(ctx, name, bucketPath)
+	b.notify(ctx, func(h Hooks) { h.OnBucketCreated(ctx, e) })
 	return nil
 }
 
-func (b *EosBackend) DeleteBucket(ctx context.Context, name string) error {
-	fmt.Println("DeleteBucket")
+// pathTagKey is the tag set at bucket creation
+// to select a named default path of the user.
+const pathTagKey = "eoss3:path"
+
+// defaultBucketPath returns the default path of the user where to
+// create the bucket. A named path is used if selected with a tag.
+func (b *EosBackend) defaultBucketPath(ctx context.Context, uid int, req *s3.CreateBucketInput) (string, error) {
+	var name string
+	if req.CreateBucketConfiguration != nil {
+		for _, t := range req.CreateBucketConfiguration.Tags {
+			if t.Key != nil && *t.Key == pathTagKey && t.Value != nil {
+				name = *t.Value
+			}
+		}
+	}
+	if name == "" {
+		return b.store(ctx).GetDefaultBucketPath(ctx, uid)
+	}
 
-	acct, ok := getLoggedAccount(ctx)
+	paths, err := b.store(ctx).ListDefaultBucketPaths(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	path, ok := paths[name]
 	if !ok {
-		return s3err.GetAPIError(s3err.ErrAccessDenied)
+		return "", s3err.GetAPIError(s3err.ErrInvalidArgument)
+	}
+	return path, nil
+}
+
+func (b *EosBackend) DeleteBucket(ctx context.Context, name string) (err error) {
+	ctx, op := b.startOperation(ctx, "DeleteBucket", "bucket", name)
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return err
+	}
+	defer func() { b.logOperation(ctx, "DeleteBucket", name, "", 0, err) }()
+
+	if acct, ok := getLoggedAccount(ctx); ok {
+		ctx = meta.WithActor(ctx, acct.Access)
 	}
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return err
 	}
 	info, err := b.eos.Stat(ctx, auth, bucket.Path)
 	if err != nil {
-		return err
+		return bucketError(err)
 	}
 
 	if info.Type != erpc.TYPE_CONTAINER {
@@ -245,16 +704,63 @@ func (b *EosBackend) DeleteBucket(ctx context.Context, name string) error {
 	}
 
 	if info.Cmd.Containers+info.Cmd.Files != 0 {
-		// There are still data inside the folder
-		// Remove the bucket is then not possible.
-		return s3err.GetAPIError(s3err.ErrBucketNotEmpty)
+		// The bucket can only be removed if its directory
+		// holds no objects: the system entries of EOS, like
+		// the old versions, are removed along with it.
+		if err := b.removeSystemEntries(ctx, auth, bucket.Path); err != nil {
+			return err
+		}
 	}
 
 	if err := b.eos.Rmdir(ctx, auth, bucket.Path); err != nil {
+		return bucketError(err)
+	}
+
+	if err := b.store(ctx).DeleteBucket(ctx, bucket.Name); err != nil {
 		return err
 	}
+	b.policies.invalidate(bucket.Name)
 
-	return b.meta.DeleteBucket(name)
+	e := newBucketEvent(ctx, bucket.Name, bucket.Path)
+	b.notify(ctx, func(h Hooks) { h.OnBucketDeleted(ctx, e) })
+	return nil
+}
+
+// removeSystemEntries removes the entries of EOS in the directory of
+// a bucket, like the version folders and the leftovers of the atomic
+// uploads, when enabled. It returns ErrBucketNotEmpty if the directory
+// holds any other entry, hidden from the listings or not, or if the
+// removal is disabled.
+func (b *EosBackend) removeSystemEntries(ctx context.Context, auth eos.Auth, dir string) error {
+	var system []string
+	empty := true
+	if err := b.eos.ListDirUntil(ctx, auth, dir, func(md *erpc.MDResponse) bool {
+		name, p := md.GetFmd().GetName(), md.GetFmd().GetPath()
+		if md.Type == erpc.TYPE_CONTAINER {
+			name, p = md.GetCmd().GetName(), md.GetCmd().GetPath()
+		}
+		if !isHiddenResource(string(name)) {
+			empty = false
+			return false
+		}
+		system = append(system, string(p))
+		return true
+	}, nil); err != nil {
+		return bucketError(err)
+	}
+	if !empty {
+		return s3err.GetAPIError(s3err.ErrBucketNotEmpty)
+	}
+	if !b.cfg.RemoveSystemEntries {
+		b.log.WarnContext(ctx, "bucket directory holding EOS system entries only, not removed", "path", dir, "entries", len(system))
+		return s3err.GetAPIError(s3err.ErrBucketNotEmpty)
+	}
+	for _, p := range system {
+		if err := b.eos.Remove(ctx, auth, p, true); err != nil {
+			return bucketError(fmt.Errorf("error removing %s: %w", p, err))
+		}
+	}
+	return nil
 }
 
 func generateBucketPolicy(sid, username, effect, bucket string) string {
@@ -279,80 +785,231 @@ func generateBucketPolicy(sid, username, effect, bucket string) string {
 	return s
 }
 
-func (b *EosBackend) GetBucketPolicy(ctx context.Context, bucket string) ([]byte, error) {
-	fmt.Println("GetBucketPolicy func")
+func (b *EosBackend) GetBucketPolicy(ctx context.Context, bucket string) (_ []byte, err error) {
+	ctx, op := b.startOperation(ctx, "GetBucketPolicy", "bucket", bucket)
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return nil, s3err.GetAPIError(s3err.ErrAccessDenied)
+	_, auth, err := b.loggedIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the expected owner is checked before serving a cached policy
+	if requestHeader(ctx, "X-Amz-Expected-Bucket-Owner") != "" {
+		if _, err := b.getBucket(ctx, bucket); err != nil && !errors.Is(err, meta.ErrNoSuchBucket) {
+			return nil, err
+		}
+	}
+	if policy, ok := b.policies.get(ctx, bucket, auth.Uid); ok {
+		return policy, nil
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	// the bucket might be accessed through an alias,
+	// while the assignments refer to the real name
+	name := bucket
+	m, err := b.getBucket(ctx, bucket)
+	if err != nil && !errors.Is(err, meta.ErrNoSuchBucket) {
+		return nil, err
+	}
+	if err == nil {
+		if len(m.Policy) > 0 {
+			b.policies.put(ctx, bucket, m.Name, auth.Uid, m.Policy)
+			return m.Policy, nil
+		}
+		name = m.Name
 	}
 
 	var policy string
-	if b.meta.IsAssigned(bucket, acct.UserID) {
-		policy = generateBucketPolicy("AllowAllActionsToUser", auth.Username(), "Allow", bucket)
+	if b.store(ctx).IsAssigned(ctx, name, int(auth.Uid)) {
+		policy = generateBucketPolicy("AllowAllActionsToUser", auth.Username(), "Allow", name)
 	} else {
-		policy = generateBucketPolicy("DenyAllActionsToUser", auth.Username(), "Deny", bucket)
+		policy = generateBucketPolicy("DenyAllActionsToUser", auth.Username(), "Deny", name)
 	}
+	b.policies.put(ctx, bucket, name, auth.Uid, []byte(policy))
 	return []byte(policy), nil
 }
 
-func (b *EosBackend) PutObject(ctx context.Context, po s3response.PutObjectInput) (s3response.PutObjectOutput, error) {
-	fmt.Println("PutObject func")
+func (b *EosBackend) PutObject(ctx context.Context, po s3response.PutObjectInput) (_ s3response.PutObjectOutput, err error) {
+	ctx, op := b.startOperation(ctx, "PutObject", "bucket", aws.ToString(po.Bucket), "key", aws.ToString(po.Key))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.PutObjectOutput{}, err
+	}
+	defer func() {
+		b.logOperation(ctx, "PutObject", aws.ToString(po.Bucket), aws.ToString(po.Key), aws.ToInt64(po.ContentLength), err)
+	}()
 
+	if po.ContentLength == nil {
+		return s3response.PutObjectOutput{}, s3err.GetAPIError(s3err.ErrMissingContentLength)
+	}
+	if err := checkPutSize(*po.ContentLength); err != nil {
+		return s3response.PutObjectOutput{}, err
+	}
 	name := *po.Bucket
 	key := *po.Key
 	length := *po.ContentLength
 
-	bucket, err := b.meta.GetBucket(name)
+	release, err := b.memory.reserve(length, 0)
+	if err != nil {
+		return s3response.PutObjectOutput{}, err
+	}
+	defer release()
+	ctx = b.sched.route(ctx, length)
+	done, err := b.sched.acquire(ctx, length)
 	if err != nil {
 		return s3response.PutObjectOutput{}, err
 	}
+	defer done()
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return s3response.PutObjectOutput{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	bucket, err := b.getBucket(ctx, name)
+	if err != nil {
+		return s3response.PutObjectOutput{}, err
+	}
+
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return s3response.PutObjectOutput{}, err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	if err := b.checkQuota(ctx, auth, &bucket, uint64(length)); err != nil {
+		return s3response.PutObjectOutput{}, err
 	}
 
-	path := filepath.Join(bucket.Path, key)
+	path, err := b.objectPath(&bucket, key)
+	if err != nil {
+		return s3response.PutObjectOutput{}, err
+	}
 
 	// Create recursively all the directories
 	if strings.ContainsRune(key, '/') {
 		dir := filepath.Dir(path)
 		if err := b.eos.Mkdir(ctx, auth, dir, 0755); err != nil {
-			return s3response.PutObjectOutput{}, err
+			return s3response.PutObjectOutput{}, bucketError(err)
 		}
 	}
 
-	if err := b.eos.Upload(ctx, auth, path, po.Body, uint64(length)); err != nil {
+	t, err := b.limits.startTransfer(ctx)
+	if err != nil {
 		return s3response.PutObjectOutput{}, err
 	}
+	defer t.done()
+
+	body := t.reader(po.Body)
+	var digest hash.Hash
+	// The MD5 computed by the FSTs, if any, spares
+	// a pass of the gateway over all the bytes.
+	offloaded := b.cfg.ComputeMD5 && b.fstComputesMD5(ctx, auth, path)
+	if b.cfg.ComputeMD5 && !offloaded {
+		digest = md5.New()
+		body = io.TeeReader(body, digest)
+	}
+
+	// the folders of the key exist: only the directory
+	// of the bucket can be missing
+	if err := b.eos.Upload(ctx, auth, path, body, uint64(length)); err != nil {
+		return s3response.PutObjectOutput{}, bucketError(err)
+	}
+	countUpload(length)
+
+	if digest != nil {
+		sum := hex.EncodeToString(digest.Sum(nil))
+		if err := b.eos.SetXattrs(ctx, auth, path, map[string]string{md5Xattr: sum}, nil); err != nil {
+			b.log.WarnContext(ctx, "error storing the md5 of the object", "path", path, "error", err)
+		}
+	}
+	if b.cfg.UserMetadata {
+		if err := b.setUserMetadata(ctx, auth, bucket.Name, key, path, po.Metadata); err != nil {
+			return s3response.PutObjectOutput{}, err
+		}
+	}
 
 	md, err := b.eos.Stat(ctx, auth, path)
 	if err != nil {
-		return s3response.PutObjectOutput{}, err
+		return s3response.PutObjectOutput{}, objectError(err)
+	}
+	if _, ok := md.Fmd.Xattrs[md5Xattr]; ok && offloaded {
+		// drop the MD5 of the overwritten object,
+		// that would shadow the one of EOS
+		if err := b.eos.SetXattrs(ctx, auth, path, nil, []string{md5Xattr}); err != nil {
+			return s3response.PutObjectOutput{}, objectError(err)
+		}
+		if md, err = b.eos.Stat(ctx, auth, path); err != nil {
+			return s3response.PutObjectOutput{}, objectError(err)
+		}
 	}
 
+	e := newObjectEvent(ctx, name, key, path)
+	e.Size, e.ETag = int64(md.Fmd.Size), getMD5(md)
+	b.notify(ctx, func(h Hooks) { h.OnObjectCreated(ctx, e) })
+
 	return s3response.PutObjectOutput{
 		Size: Ptr(int64(md.Fmd.Size)),
 		ETag: getMD5(md),
 	}, nil
 }
 
-func (b *EosBackend) HeadBucket(ctx context.Context, req *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
-	fmt.Println("HeadBucket")
+func (b *EosBackend) GetBucketTagging(ctx context.Context, name string) (_ map[string]string, err error) {
+	ctx, op := b.startOperation(ctx, "GetBucketTagging", "bucket", name)
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
+
+	bucket, err := b.getBucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(bucket.Tags) == 0 {
+		return nil, s3err.GetAPIError(s3err.ErrBucketTaggingNotFound)
+	}
+	return bucket.Tags, nil
+}
+
+func (b *EosBackend) PutBucketTagging(ctx context.Context, name string, tags map[string]string) (err error) {
+	ctx, op := b.startOperation(ctx, "PutBucketTagging", "bucket", name)
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return err
+	}
+	defer func() { b.logOperation(ctx, "PutBucketTagging", name, "", 0, err) }()
+	return b.putBucketTagging(ctx, name, tags)
+}
+
+func (b *EosBackend) putBucketTagging(ctx context.Context, name string, tags map[string]string) error {
+	if acct, ok := getLoggedAccount(ctx); ok {
+		ctx = meta.WithActor(ctx, acct.Access)
+	}
+
+	bucket, err := b.getBucket(ctx, name)
+	if err != nil {
+		return err
+	}
+	bucket.Tags = tags
+	_, err = b.store(ctx).UpdateBucket(ctx, bucket)
+	return err
+}
+
+func (b *EosBackend) DeleteBucketTagging(ctx context.Context, name string) (err error) {
+	ctx, op := b.startOperation(ctx, "DeleteBucketTagging", "bucket", name)
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return err
+	}
+	defer func() { b.logOperation(ctx, "DeleteBucketTagging", name, "", 0, err) }()
+	return b.putBucketTagging(ctx, name, nil)
+}
+
+func (b *EosBackend) HeadBucket(ctx context.Context, req *s3.HeadBucketInput) (_ *s3.HeadBucketOutput, err error) {
+	ctx, op := b.startOperation(ctx, "HeadBucket", "bucket", aws.ToString(req.Bucket))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
 
 	name := *req.Bucket
-	_, err := b.meta.GetBucket(name)
+	_, err = b.getBucket(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -362,89 +1019,274 @@ func (b *EosBackend) HeadBucket(ctx context.Context, req *s3.HeadBucketInput) (*
 	}, nil
 }
 
-func (b *EosBackend) HeadObject(ctx context.Context, req *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
-	fmt.Println("HeadObject")
+func (b *EosBackend) HeadObject(ctx context.Context, req *s3.HeadObjectInput) (_ *s3.HeadObjectOutput, err error) {
+	ctx, op := b.startOperation(ctx, "HeadObject", "bucket", aws.ToString(req.Bucket), "key", aws.ToString(req.Key))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
 
 	name := *req.Bucket
 	key := *req.Key
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return nil, s3err.GetAPIError(s3err.ErrAccessDenied)
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return nil, err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	objpath, err := b.objectPath(&bucket, key)
+	if err != nil {
+		return nil, err
 	}
-
-	objpath := filepath.Join(bucket.Path, key)
-	info, err := b.eos.Stat(ctx, auth, objpath)
+	info, err := b.statObject(ctx, auth, key, objpath)
 	if err != nil {
-		e := &eos.ErrNoSuchResource{}
-		if errors.As(err, &e) {
-			return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
-		}
 		return nil, err
 	}
 
-	if info.Type != erpc.TYPE_FILE || info.Fmd == nil {
-		return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+	if err := (conditions{
+		ifMatch:       req.IfMatch,
+		ifNoneMatch:   req.IfNoneMatch,
+		ifModSince:    req.IfModifiedSince,
+		ifUnmodeSince: req.IfUnmodifiedSince,
+	}).check(info); err != nil {
+		return nil, err
 	}
 
-	return &s3.HeadObjectOutput{
-		ContentLength: Ptr(int64(info.Fmd.Size)),
+	out := &s3.HeadObjectOutput{
+		ContentLength: Ptr(objectSize(info)),
 		ETag:          Ptr(getMD5(info)),
-		LastModified:  Ptr(time.Unix(int64(info.Fmd.Mtime.Sec), int64(info.Fmd.Mtime.NSec))),
-	}, nil
+		LastModified:  Ptr(mtime(info)),
+	}
+	if b.cfg.UserMetadata {
+		if out.Metadata, err = b.userMetadata(ctx, bucket.Name, key, info); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
 }
 
-func (b *EosBackend) GetObject(ctx context.Context, req *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
-	fmt.Println("GetObject")
+func (b *EosBackend) GetObject(ctx context.Context, req *s3.GetObjectInput) (_ *s3.GetObjectOutput, err error) {
+	ctx, op := b.startOperation(ctx, "GetObject", "bucket", aws.ToString(req.Bucket), "key", aws.ToString(req.Key))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
 
 	name := *req.Bucket
 	key := *req.Key
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return nil, s3err.GetAPIError(s3err.ErrAccessDenied)
+	bucket, err := b.getBucket(ctx, name)
+	if err != nil {
+		return nil, err
 	}
 
-	bucket, err := b.meta.GetBucket(name)
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return nil, err
+	}
+	path, err := b.objectPath(&bucket, key)
 	if err != nil {
 		return nil, err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	// The metadata is taken from the response of the FST
+	// when possible, sparing a Stat to the MGM.
+	// The folders have no content to download.
+	var info *erpc.MDResponse
+	if b.needsStat(req) || strings.HasSuffix(key, "/") {
+		if info, err = b.statObject(ctx, auth, key, path); err != nil {
+			return nil, err
+		}
+		if err := getConditions(req).check(info); err != nil {
+			return nil, err
+		}
+		if info.Type == erpc.TYPE_CONTAINER {
+			return &s3.GetObjectOutput{
+				Body:          io.NopCloser(strings.NewReader("")),
+				ContentLength: Ptr(int64(0)),
+				ETag:          Ptr(getMD5(info)),
+				LastModified:  Ptr(mtime(info)),
+			}, nil
+		}
+		if b.shouldRedirect(info) {
+			return nil, b.redirectDownload(ctx, auth, path)
+		}
 	}
-	path := filepath.Join(bucket.Path, key)
 
-	file, size, err := b.eos.Download(ctx, auth, path, req.Range)
+	if info != nil && aws.ToString(req.Range) == "" {
+		ctx = b.sched.route(ctx, int64(info.Fmd.Size))
+	}
+
+	t, err := b.limits.startTransfer(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	info, err := b.eos.Stat(ctx, auth, path)
+	obj, err := b.eos.DownloadObject(ctx, auth, path, req.Range)
 	if err != nil {
+		t.done()
+		// the download of a directory fails
+		// with an error that is not meaningful
+		if e := (&eos.ErrNoSuchResource{}); errors.As(err, &e) || b.isDirectory(ctx, auth, path) {
+			return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+		}
+		return nil, objectError(err)
+	}
+	// The directories are not redirected to an FST:
+	// only then a Stat tells whether the key is a file.
+	if info == nil && (!obj.FromFST || obj.Size < 0) {
+		if info, err = b.statFile(ctx, auth, path); err != nil {
+			obj.Body.Close()
+			t.done()
+			return nil, err
+		}
+	}
+	if info != nil {
+		if obj.Size < 0 {
+			obj.Size = int64(info.Fmd.Size)
+		}
+		obj.ETag = getMD5(info)
+		obj.LastModified = mtime(info)
+	}
+
+	done, err := b.sched.acquire(ctx, obj.Size)
+	if err != nil {
+		obj.Body.Close()
+		t.done()
+		return nil, err
+	}
+	reserved, err := b.memory.reserve(obj.Size, b.readAhead.memory(obj.Size))
+	if err != nil {
+		obj.Body.Close()
+		done()
+		t.done()
 		return nil, err
 	}
+	release := func() {
+		reserved()
+		done()
+	}
+	countDownload(obj.Size)
+
+	body := b.readAhead.wrap(obj.Body, obj.Size)
+	out := &s3.GetObjectOutput{
+		ContentLength: &obj.Size,
+		ETag:          Ptr(obj.ETag),
+	}
+	if b.cfg.UserMetadata && info != nil {
+		if out.Metadata, err = b.userMetadata(ctx, bucket.Name, key, info); err != nil {
+			obj.Body.Close()
+			release()
+			t.done()
+			return nil, err
+		}
+	}
+	// The ranges are not compressed, as they
+	// refer to the bytes of the original object.
+	if aws.ToString(req.Range) == "" && b.cfg.Compression.compressible(name, key, obj.Size) {
+		setResponseHeader(ctx, "Vary", "Accept-Encoding")
+		if enc := acceptedEncoding(requestHeader(ctx, "Accept-Encoding")); enc != "" {
+			body = compress(body, enc)
+			out.ContentEncoding = &enc
+			// the length is known once compressed
+			out.ContentLength = nil
+		}
+	}
+	out.Body = t.readCloser(&releaseCloser{ReadCloser: body, release: release})
+	if !obj.LastModified.IsZero() {
+		out.LastModified = Ptr(s3Time(obj.LastModified))
+	}
+	return out, nil
+}
+
+// needsStat returns whether GetObject needs the metadata
+// of the object before downloading it: to evaluate the
+// conditional headers, to know whether the download is
+// redirected, or to return the MD5 or the user metadata
+// stored by the gateway, that the FSTs do not know about.
+func (b *EosBackend) needsStat(req *s3.GetObjectInput) bool {
+	return getConditions(req).set() || b.cfg.RedirectGet != nil || b.cfg.ComputeMD5 || b.cfg.UserMetadata
+}
+
+func getConditions(req *s3.GetObjectInput) conditions {
+	return conditions{
+		ifMatch:       req.IfMatch,
+		ifNoneMatch:   req.IfNoneMatch,
+		ifModSince:    req.IfModifiedSince,
+		ifUnmodeSince: req.IfUnmodifiedSince,
+	}
+}
+
+// statFile returns the metadata of path,
+// or ErrNoSuchKey if it is not a file.
+func (b *EosBackend) statFile(ctx context.Context, auth eos.Auth, path string) (*erpc.MDResponse, error) {
+	info, err := b.eos.Stat(ctx, auth, path)
+	if err != nil {
+		return nil, objectError(err)
+	}
 	if info.Type != erpc.TYPE_FILE {
 		return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
 	}
+	return info, nil
+}
 
-	return &s3.GetObjectOutput{
-		Body:          file,
-		ContentLength: &size,
-		LastModified:  Ptr(time.Unix(int64(info.Fmd.Mtime.Sec), int64(info.Fmd.Mtime.NSec))),
-		ETag:          Ptr(getMD5(info)),
-	}, nil
+// statObject returns the metadata of the object with the key at path:
+// a file, or a directory for the keys of the folders, ending with a
+// slash as in the listings. The other directories are not objects.
+func (b *EosBackend) statObject(ctx context.Context, auth eos.Auth, key, path string) (*erpc.MDResponse, error) {
+	info, err := b.eos.Stat(ctx, auth, path)
+	if err != nil {
+		return nil, objectError(err)
+	}
+	switch {
+	case info.Type == erpc.TYPE_FILE && info.Fmd != nil:
+		return info, nil
+	case info.Type == erpc.TYPE_CONTAINER && info.Cmd != nil && strings.HasSuffix(key, "/"):
+		return info, nil
+	}
+	return nil, s3err.GetAPIError(s3err.ErrNoSuchKey)
+}
+
+// isDirectory tells if path is a directory.
+func (b *EosBackend) isDirectory(ctx context.Context, auth eos.Auth, path string) bool {
+	info, err := b.eos.Stat(ctx, auth, path)
+	return err == nil && info.Type == erpc.TYPE_CONTAINER
+}
+
+// mtime returns the modification time of the file or the directory,
+// the last modification time of their objects in all the responses.
+func mtime(info *erpc.MDResponse) time.Time {
+	if info.Type == erpc.TYPE_CONTAINER {
+		return eosTime(info.Cmd.Mtime)
+	}
+	return eosTime(info.Fmd.Mtime)
+}
+
+// eosTime returns the time of EOS as returned by S3.
+func eosTime(t *erpc.Time) time.Time {
+	return s3Time(time.Unix(int64(t.GetSec()), int64(t.GetNSec())))
+}
+
+// s3Time returns t in UTC and to the second, as the Last-Modified
+// header of the objects: the times of the listings and of the
+// object requests are the same, and not seen as modifications
+// by the sync tools.
+func s3Time(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// objectSize returns the size of the object of the file
+// or the directory, the folders being empty.
+func objectSize(info *erpc.MDResponse) int64 {
+	if info.Type == erpc.TYPE_CONTAINER {
+		return 0
+	}
+	return int64(info.Fmd.Size)
 }
 
 // gets the deepest directory by concatenating the bucket path with the prefix, considering
@@ -463,6 +1305,8 @@ func retrieveObjectDirectory(bucketPath, prefix string) (objdir, newprefix strin
 	return filepath.Join(bucketPath, objrel), newprefix
 }
 
+// mdResponseToS3Object returns the object of a listing entry.
+// All its fields are derived from the entry itself.
 func (b *EosBackend) mdResponseToS3Object(bucketDir string, md *erpc.MDResponse) s3response.Object {
 	var path string
 	if md.Type == erpc.TYPE_CONTAINER {
@@ -476,158 +1320,204 @@ func (b *EosBackend) mdResponseToS3Object(bucketDir string, md *erpc.MDResponse)
 	var obj s3response.Object
 	if md.Type == erpc.TYPE_CONTAINER {
 		obj.Key = Ptr(key + "/")
-		obj.LastModified = Ptr(time.Unix(int64(md.Cmd.Mtime.Sec), int64(md.Cmd.Mtime.NSec)))
+		obj.LastModified = Ptr(mtime(md))
 		obj.Size = Ptr(int64(0))
 		obj.StorageClass = types.ObjectStorageClassStandard
 	} else {
 		obj.ETag = Ptr(getMD5(md))
+		if algs := getChecksumAlgorithms(md); len(algs) > 0 {
+			obj.ChecksumAlgorithm = algs
+			obj.ChecksumType = types.ChecksumTypeFullObject
+		}
 		obj.StorageClass = types.ObjectStorageClassStandard
-		obj.LastModified = Ptr(time.Unix(int64(md.Fmd.Mtime.Sec), int64(md.Fmd.Mtime.NSec)))
+		obj.LastModified = Ptr(mtime(md))
 		obj.Key = &key
 		obj.Size = Ptr(int64(md.Fmd.Size))
-		obj.Owner = &types.Owner{
-			// TODO: check this
-			ID: Ptr(strconv.FormatUint(uint64(md.Fmd.Uid), 10)),
-		}
 	}
 	return obj
 }
 
-func (b *EosBackend) ListObjects(ctx context.Context, req *s3.ListObjectsInput) (s3response.ListObjectsResult, error) {
-	fmt.Println("ListObjects")
+// setOwner sets the owner of the file of the listing entry on its object.
+func (b *EosBackend) setOwner(obj *s3response.Object, md *erpc.MDResponse) {
+	if md.Type == erpc.TYPE_FILE && md.Fmd != nil {
+		obj.Owner = b.owners.owner(md.Fmd.Uid)
+	}
+}
+
+func (b *EosBackend) ListObjects(ctx context.Context, req *s3.ListObjectsInput) (_ s3response.ListObjectsResult, err error) {
+	ctx, op := b.startOperation(ctx, "ListObjects", "bucket", aws.ToString(req.Bucket), "prefix", aws.ToString(req.Prefix))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.ListObjectsResult{}, err
+	}
 	name := *req.Bucket
 	prefix := *req.Prefix
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return s3response.ListObjectsResult{}, err
 	}
 
-	objdir, fileprefix := retrieveObjectDirectory(bucket.Path, prefix)
-
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return s3response.ListObjectsResult{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	if err := checkPrefix(prefix); err != nil {
+		return s3response.ListObjectsResult{}, err
 	}
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	// The keys are listed from the deepest folder of the prefix,
+	// the rest of the prefix filtering the names in it.
+	objdir, _ := retrieveObjectDirectory(bucket.Path, prefix)
+
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return s3response.ListObjectsResult{}, err
 	}
 
+	limit := maxKeys(req.MaxKeys)
+	page := newListPage(aws.ToString(req.Marker), limit)
 	var objects []s3response.Object
-	appendObjects := func(md *erpc.MDResponse) {
+	appendObjects := func(md *erpc.MDResponse) bool {
 		obj := b.mdResponseToS3Object(bucket.Path, md)
-		if isHiddenResource(*obj.Key) {
-			return
+		if !strings.HasPrefix(*obj.Key, prefix) || b.hidden.hidden(ctx, *obj.Key) {
+			return true
+		}
+		if !page.add(*obj.Key) {
+			return !page.full()
 		}
+		b.setOwner(&obj, md)
 		objects = append(objects, obj)
+		return true
 	}
 
-	var filters eos.ListDirFilters
-	if fileprefix != "" {
-		// filters.Prefix = &fileprefix
+	keep := func(key string) bool {
+		return strings.HasPrefix(key, prefix) && !b.hidden.hidden(ctx, key)
 	}
-
-	if err := b.eos.ListDir(ctx, auth, objdir, appendObjects, &filters); err != nil {
-		return s3response.ListObjectsResult{}, err
+	// one more key than the page, to tell if it is truncated
+	if err := b.listDir(ctx, auth, bucket.Path, objdir, aws.ToString(req.Marker), int(limit)+1, keep, appendObjects); err != nil && !missingFolder(err, bucket.Path, objdir) {
+		return s3response.ListObjectsResult{}, bucketError(err)
 	}
 	return s3response.ListObjectsResult{
-		Name:      &name,
-		Prefix:    &prefix,
-		Delimiter: req.Delimiter,
-		Contents:  objects,
+		Name:        &name,
+		Prefix:      &prefix,
+		Marker:      req.Marker,
+		NextMarker:  page.next(),
+		MaxKeys:     &limit,
+		Delimiter:   req.Delimiter,
+		IsTruncated: &page.truncated,
+		Contents:    objects,
 	}, nil
 }
 
-func eosAuthFromLoggedUser(ctx context.Context) eos.Auth {
-	acct, _ := getLoggedAccount(ctx)
-	return eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+func (b *EosBackend) ListObjectsV2(ctx context.Context, req *s3.ListObjectsV2Input) (_ s3response.ListObjectsV2Result, err error) {
+	ctx, op := b.startOperation(ctx, "ListObjectsV2", "bucket", aws.ToString(req.Bucket), "prefix", aws.ToString(req.Prefix))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.ListObjectsV2Result{}, err
 	}
-}
-
-func (b *EosBackend) ListObjectsV2(ctx context.Context, req *s3.ListObjectsV2Input) (s3response.ListObjectsV2Result, error) {
-	fmt.Println("ListObjectsV2")
 
 	name := *req.Bucket
 	prefix := *req.Prefix
 	delimiter := *req.Delimiter
 
-	// According to the S3 specs, for directory buckets the
-	// only delimiter allowed is "/". So, without a delimiter
-	// we interpret the request as being "recursive".
-	if delimiter != "" && delimiter != "/" {
-		return s3response.ListObjectsV2Result{}, s3err.GetAPIError(s3err.ErrInvalidRequest)
-	}
-
-	// For directory buckets only prefixes ending with "/" are supported
-	if prefix != "" && prefix[len(prefix)-1] != '/' {
-		return s3response.ListObjectsV2Result{}, s3err.GetAPIError(s3err.ErrInvalidRequest)
+	bucket, err := b.getBucket(ctx, name)
+	if err != nil {
+		return s3response.ListObjectsV2Result{}, err
 	}
 
-	recursive := false
-	if delimiter == "" {
-		recursive = true
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return s3response.ListObjectsV2Result{}, err
 	}
 
-	bucket, err := b.meta.GetBucket(name)
-	if err != nil {
-		// TODO: improve this error
+	if err := checkPrefix(prefix); err != nil {
 		return s3response.ListObjectsV2Result{}, err
 	}
+	// The keys are listed from the deepest folder of the prefix,
+	// the rest of the prefix filtering the names in it.
+	folder, _ := retrieveObjectDirectory(bucket.Path, prefix)
 
-	folder := path.Join(bucket.Path, prefix)
+	// The folders are the common prefixes of the delimiter "/":
+	// a listing of the folder is enough. Otherwise all the keys
+	// under it are listed, in order, to compute the common prefixes.
+	recursive := delimiter != "/"
+
+	limit := maxKeys(req.MaxKeys)
+	// the continuation token is the last key returned, as the start after
+	start := aws.ToString(req.StartAfter)
+	if req.ContinuationToken != nil {
+		start = *req.ContinuationToken
+	}
+	page := newListPage(start, limit)
 
 	var objects []s3response.Object
 	var prefixes []types.CommonPrefix
 	prefixesSet := map[string]struct{}{}
 
-	appendObjects := func(md *erpc.MDResponse) {
+	appendObjects := func(md *erpc.MDResponse) bool {
 		obj := b.mdResponseToS3Object(bucket.Path, md)
-		if isHiddenResource(*obj.Key) {
-			return
-		}
-		if delimiter == "/" && md.Type == erpc.TYPE_CONTAINER {
-			// we should group by prefix and not add this obj
-			// in the list of objects
-			if _, ok := prefixesSet[*obj.Key]; ok {
-				return
+		key := *obj.Key
+		if !strings.HasPrefix(key, prefix) || b.hidden.hidden(ctx, key) {
+			return true
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			// the keys up to the delimiter are grouped
+			// in a common prefix, counted once
+			common := key[:len(prefix)+i+len(delimiter)]
+			if _, ok := prefixesSet[common]; ok {
+				return true
 			}
-
-			p := types.CommonPrefix{
-				Prefix: obj.Key,
+			if !page.add(common) {
+				return !page.full()
 			}
-			prefixes = append(prefixes, p)
-			prefixesSet[*obj.Key] = struct{}{}
-			return
+			prefixes = append(prefixes, types.CommonPrefix{Prefix: &common})
+			prefixesSet[common] = struct{}{}
+			return true
 		}
 
 		if md.Type != erpc.TYPE_CONTAINER {
+			if !page.add(key) {
+				return !page.full()
+			}
+			// the owners are only returned when asked
+			if aws.ToBool(req.FetchOwner) {
+				b.setOwner(&obj, md)
+			}
 			objects = append(objects, obj)
 		}
+		return true
 	}
 
-	filters := &eos.ListDirFilters{
-		Recursive: recursive,
+	list := func() error {
+		// the keys of the folder are all distinct common
+		// prefixes or keys: one more than the page is enough
+		// to tell if it is truncated
+		keep := func(key string) bool {
+			return strings.HasPrefix(key, prefix) && !b.hidden.hidden(ctx, key)
+		}
+		return b.listDir(ctx, auth, bucket.Path, folder, start, int(limit)+1, keep, appendObjects)
+	}
+	if recursive {
+		list = func() error {
+			return b.listTree(ctx, auth, bucket.Path, folder, prefix, start, int(limit)+1, appendObjects)
+		}
 	}
 
-	if err := b.eos.ListDir(ctx, eosAuthFromLoggedUser(ctx), folder, appendObjects, filters); err != nil {
-		e := &eos.ErrNoSuchResource{}
-		if errors.As(err, &e) {
-			objects = []s3response.Object{}
-		} else {
-			// TODO: improve this error
-			return s3response.ListObjectsV2Result{}, err
+	if err := list(); err != nil {
+		if !missingFolder(err, bucket.Path, folder) {
+			return s3response.ListObjectsV2Result{}, bucketError(err)
 		}
+		objects = []s3response.Object{}
 	}
 
 	return s3response.ListObjectsV2Result{
-		Name:           &name,
-		Prefix:         &prefix,
-		Delimiter:      &delimiter,
-		Contents:       objects,
-		CommonPrefixes: prefixes,
+		Name:                  &name,
+		Prefix:                &prefix,
+		StartAfter:            req.StartAfter,
+		ContinuationToken:     req.ContinuationToken,
+		NextContinuationToken: page.next(),
+		KeyCount:              Ptr(int32(page.count)),
+		MaxKeys:               &limit,
+		Delimiter:             &delimiter,
+		IsTruncated:           &page.truncated,
+		Contents:              objects,
+		CommonPrefixes:        prefixes,
 	}, nil
 }
 
@@ -635,30 +1525,40 @@ func Ptr[T any](v T) *T {
 	return &v
 }
 
-func (b *EosBackend) DeleteObject(ctx context.Context, req *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
-	fmt.Println("DeleteObject")
+func (b *EosBackend) DeleteObject(ctx context.Context, req *s3.DeleteObjectInput) (_ *s3.DeleteObjectOutput, err error) {
+	ctx, op := b.startOperation(ctx, "DeleteObject", "bucket", aws.ToString(req.Bucket), "key", aws.ToString(req.Key))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
+	defer func() { b.logOperation(ctx, "DeleteObject", aws.ToString(req.Bucket), aws.ToString(req.Key), 0, err) }()
 
 	name := *req.Bucket
 	key := *req.Key
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return nil, s3err.GetAPIError(s3err.ErrAccessDenied)
-	}
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return nil, err
 	}
 
-	objpath := filepath.Join(bucket.Path, key)
-	if err := b.eos.Remove(ctx, auth, objpath, false); err != nil {
+	objpath, err := b.objectPath(&bucket, key)
+	if err != nil {
 		return nil, err
 	}
+	if err := b.eos.Remove(ctx, auth, objpath, false); err != nil {
+		return nil, objectError(err)
+	}
+
+	// drop the metadata eventually stored outside EOS
+	_ = b.store(ctx).DeleteObjectMetadata(ctx, bucket.Name, key, "")
+
+	e := newObjectEvent(ctx, name, key, objpath)
+	b.notify(ctx, func(h Hooks) { h.OnObjectDeleted(ctx, e) })
 
 	return &s3.DeleteObjectOutput{}, nil
 }
@@ -678,7 +1578,11 @@ func (b *EosBackend) SelectObjectContent(ctx context.Context, input *s3.SelectOb
 	}
 }
 
-func (b *EosBackend) GetObjectLockConfiguration(_ context.Context, bucket string) ([]byte, error) {
-	fmt.Println("GetObjectLockConfiguration")
+func (b *EosBackend) GetObjectLockConfiguration(ctx context.Context, bucket string) (_ []byte, err error) {
+	_, op := b.startOperation(ctx, "GetObjectLockConfiguration", "bucket", bucket)
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
 	return []byte("{}"), nil
 }
@@ -0,0 +1,124 @@
+package eoss3
+
+import (
+	"errors"
+	"net/http"
+	"syscall"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/versity/versitygw/s3err"
+)
+
+// errAlreadyExists is returned when EOS refuses to
+// create a file or a directory already existing.
+var errAlreadyExists = s3err.APIError{
+	Code:           "OperationAborted",
+	Description:    "The object conflicts with an existing one.",
+	HTTPStatusCode: http.StatusConflict,
+}
+
+// errnoAPIError maps the errno of the failures of EOS to their
+// S3 errors, regardless of the operation.
+var errnoAPIError = map[syscall.Errno]s3err.ErrorCode{
+	syscall.EACCES:       s3err.ErrAccessDenied,
+	syscall.EPERM:        s3err.ErrAccessDenied,
+	syscall.EDQUOT:       s3err.ErrQuotaExceeded,
+	syscall.ENOSPC:       s3err.ErrQuotaExceeded,
+	syscall.ENAMETOOLONG: s3err.ErrKeyTooLong,
+	syscall.EFBIG:        s3err.ErrEntityTooLarge,
+}
+
+// s3Resource is the S3 resource addressed by a call to EOS,
+// telling the S3 error of its missing or non empty path.
+type s3Resource int
+
+const (
+	bucketResource s3Resource = iota + 1
+	objectResource
+	uploadResource
+)
+
+// resourceError is the error of a call to EOS on a resource.
+type resourceError struct {
+	resource s3Resource
+	err      error
+}
+
+func (e *resourceError) Error() string { return e.err.Error() }
+
+func (e *resourceError) Unwrap() error { return e.err }
+
+// onResource marks err, the error of a call to EOS, with the
+// resource addressed by the call. It returns nil if err is nil.
+func onResource(r s3Resource, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &resourceError{resource: r, err: err}
+}
+
+// bucketError marks the error of a call to EOS on the directory of a bucket.
+func bucketError(err error) error { return onResource(bucketResource, err) }
+
+// objectError marks the error of a call to EOS on the path of an object.
+func objectError(err error) error { return onResource(objectResource, err) }
+
+// uploadError marks the error of a call to EOS on the staging
+// folder of a multipart upload, or on its parts.
+func uploadError(err error) error { return onResource(uploadResource, err) }
+
+// notFound maps the resources to the S3 errors of their missing path.
+var notFound = map[s3Resource]s3err.ErrorCode{
+	bucketResource: s3err.ErrNoSuchBucket,
+	objectResource: s3err.ErrNoSuchKey,
+	uploadResource: s3err.ErrNoSuchUpload,
+}
+
+// s3Error translates the errors of the EOS client that have an S3
+// counterpart. The errors of a missing or non empty path depend on
+// the resource the call was marked with. The errors without an S3
+// counterpart are returned as they are, as InternalError.
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, eos.ErrSlowDown) {
+		return errSlowDown
+	}
+	if errors.As(err, new(s3err.APIError)) {
+		return err
+	}
+
+	var errno syscall.Errno
+	var e *eos.Error
+	switch {
+	case errors.As(err, &e):
+		errno = e.Errno
+	case errors.Is(err, syscall.ENOENT):
+		errno = syscall.ENOENT
+	}
+	var res s3Resource
+	if r := (&resourceError{}); errors.As(err, &r) {
+		res = r.resource
+	}
+	switch errno {
+	case 0:
+		return err
+	case syscall.ENOENT:
+		if code, ok := notFound[res]; ok {
+			return s3err.GetAPIError(code)
+		}
+		return err
+	case syscall.ENOTEMPTY:
+		if res == bucketResource {
+			return s3err.GetAPIError(s3err.ErrBucketNotEmpty)
+		}
+		return s3err.GetAPIError(s3err.ErrDirectoryNotEmpty)
+	case syscall.EEXIST:
+		return errAlreadyExists
+	}
+	if code, ok := errnoAPIError[errno]; ok {
+		return s3err.GetAPIError(code)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package eoss3
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+)
+
+// GuardConfig restricts the identities the gateway operates as on EOS,
+// whatever the mapping of the accounts and the run-as identities of
+// the buckets. The requests that would be done as any other identity
+// are denied.
+type GuardConfig struct {
+	// Uids and Gids are the ranges of the uids and gids allowed, e.g.
+	// 1000-, 1000-65535 or 1234. If not set, all are allowed.
+	Uids []string `mapstructure:"uids"`
+	Gids []string `mapstructure:"gids"`
+	// DenyUids and DenyGids are the uids and gids never allowed.
+	DenyUids []uint64 `mapstructure:"deny_uids"`
+	DenyGids []uint64 `mapstructure:"deny_gids"`
+	// DenyRoot denies the root uid, allowed by default
+	// unless excluded by Uids.
+	DenyRoot bool `mapstructure:"deny_root"`
+}
+
+// idRange is an inclusive range of ids.
+type idRange struct{ min, max uint64 }
+
+// parseIDRange parses a range in the form min-max, min- or id.
+func parseIDRange(s string) (idRange, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	min, err := strconv.ParseUint(lo, 10, 64)
+	if err != nil {
+		return idRange{}, fmt.Errorf("invalid range %q", s)
+	}
+	if !isRange {
+		return idRange{min, min}, nil
+	}
+	if hi == "" {
+		return idRange{min, ^uint64(0)}, nil
+	}
+	max, err := strconv.ParseUint(hi, 10, 64)
+	if err != nil || max < min {
+		return idRange{}, fmt.Errorf("invalid range %q", s)
+	}
+	return idRange{min, max}, nil
+}
+
+// idSet is a set of allowed ids.
+type idSet struct {
+	ranges []idRange // all if empty
+	deny   []uint64
+}
+
+func newIDSet(ranges []string, deny []uint64, denyRoot bool) (idSet, error) {
+	s := idSet{deny: slices.Clone(deny)}
+	for _, r := range ranges {
+		ir, err := parseIDRange(r)
+		if err != nil {
+			return idSet{}, err
+		}
+		s.ranges = append(s.ranges, ir)
+	}
+	if denyRoot {
+		s.deny = append(s.deny, 0)
+	}
+	return s, nil
+}
+
+func (s idSet) allows(id uint64) bool {
+	if slices.Contains(s.deny, id) {
+		return false
+	}
+	if len(s.ranges) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.ranges, func(r idRange) bool {
+		return id >= r.min && id <= r.max
+	})
+}
+
+// identityGuard checks the identities against the GuardConfig.
+type identityGuard struct {
+	uids, gids idSet
+}
+
+func newIdentityGuard(cfg GuardConfig) (*identityGuard, error) {
+	uids, err := newIDSet(cfg.Uids, cfg.DenyUids, cfg.DenyRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the allowed uids: %w", err)
+	}
+	gids, err := newIDSet(cfg.Gids, cfg.DenyGids, false)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the allowed gids: %w", err)
+	}
+	return &identityGuard{uids: uids, gids: gids}, nil
+}
+
+// allows tells if the gateway can operate as id.
+func (g *identityGuard) allows(id eos.Auth) bool {
+	return g.uids.allows(id.Uid) && g.gids.allows(id.Gid)
+}
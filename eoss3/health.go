@@ -0,0 +1,108 @@
+package eoss3
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gmgigi96/eoss3/meta"
+)
+
+// HealthConfig configures the endpoints used by the
+// probes and the load balancers to check the backend.
+type HealthConfig struct {
+	// Address is where the /healthz and /readyz endpoints
+	// are served, e.g. ":8081". If not set, they are disabled.
+	Address string `mapstructure:"address"`
+	// Timeout is the maximum time given to each check.
+	// Defaults to 5 seconds.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+const defaultHealthTimeout = 5 * time.Second
+
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// checkHealth checks the EOS gRPC and HTTP interfaces and
+// the meta store are reachable, returning the outcome of
+// each check and whether all of them succeeded.
+func (b *EosBackend) checkHealth(ctx context.Context) (healthStatus, bool) {
+	timeout := b.cfg.Health.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	checks := map[string]func(context.Context) error{
+		"eos_grpc": func(ctx context.Context) error {
+			_, err := b.eos.Ping(ctx)
+			return err
+		},
+		"eos_http": b.eos.PingHTTP,
+		"meta": func(ctx context.Context) error {
+			if p, ok := b.meta.(meta.Pinger); ok {
+				return p.Ping(ctx)
+			}
+			return nil
+		},
+	}
+
+	status := healthStatus{Status: "ok", Checks: make(map[string]string, len(checks))}
+	healthy := true
+	for name, check := range checks {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		err := check(ctx)
+		cancel()
+		if err != nil {
+			status.Checks[name] = err.Error()
+			healthy = false
+			continue
+		}
+		status.Checks[name] = "ok"
+	}
+	if !healthy {
+		status.Status = "unavailable"
+	}
+	return status, healthy
+}
+
+// serveHealth serves on the configured address the /healthz
+// endpoint, always answering while the process is up, and the
+// /readyz one, failing when EOS or the meta store are unreachable.
+// Both report the outcome of the checks in the body.
+func (b *EosBackend) serveHealth() error {
+	l, err := net.Listen("tcp", b.cfg.Health.Address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		status, _ := b.checkHealth(r.Context())
+		writeHealth(w, status, true)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		status, healthy := b.checkHealth(r.Context())
+		writeHealth(w, status, healthy)
+	})
+
+	b.health = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := b.health.Serve(l); err != nil && err != http.ErrServerClosed {
+			b.log.Error("error serving health endpoints", "address", b.cfg.Health.Address, "error", err)
+		}
+	}()
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, status healthStatus, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
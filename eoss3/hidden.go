@@ -0,0 +1,65 @@
+package eoss3
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+)
+
+// HiddenConfig configures the entries of the bucket directories
+// hidden from the listings, in addition to the version folders
+// and the atomic uploads in progress of EOS, always hidden.
+type HiddenConfig struct {
+	// Patterns are the patterns of the names of the entries
+	// hidden, in the syntax of path.Match, e.g. .sys.*, .Trash
+	// or *.xsmap. The entries in a hidden directory are hidden too.
+	Patterns []string `mapstructure:"patterns"`
+	// VersionsAccessKeys are the access keys of the accounts,
+	// e.g. of the admins, the version folders are listed to.
+	VersionsAccessKeys []string `mapstructure:"versions_access_keys"`
+}
+
+// hiddenFilter tells the entries hidden from the listings.
+type hiddenFilter struct {
+	patterns []string
+	versions []string
+}
+
+func newHiddenFilter(cfg HiddenConfig) (*hiddenFilter, error) {
+	for _, p := range cfg.Patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid hidden pattern %q: %w", p, err)
+		}
+	}
+	return &hiddenFilter{patterns: cfg.Patterns, versions: cfg.VersionsAccessKeys}, nil
+}
+
+// hidden tells if the entry with the key, or with the path,
+// is hidden from the listings of the logged account.
+func (f *hiddenFilter) hidden(ctx context.Context, key string) bool {
+	if eos.IsVersionFolder(key) {
+		acct, _ := getLoggedAccount(ctx)
+		return !slices.Contains(f.versions, acct.Access)
+	}
+	return isHiddenResource(key) || f.matches(key)
+}
+
+// matches tells if any segment of the key matches the patterns of the
+// config. The objects cannot be written with such keys, never listed.
+func (f *hiddenFilter) matches(key string) bool {
+	if len(f.patterns) == 0 {
+		return false
+	}
+	for _, name := range strings.Split(key, "/") {
+		for _, p := range f.patterns {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package eoss3
+
+import (
+	"context"
+	"time"
+)
+
+// BucketEvent describes the creation or the deletion of a bucket.
+type BucketEvent struct {
+	Time time.Time
+	// AccessKey is the access key of the user who did the change.
+	AccessKey string
+	Bucket    string
+	// Path is the path of the bucket on EOS.
+	Path string
+}
+
+// ObjectEvent describes the creation or the deletion of an object.
+type ObjectEvent struct {
+	Time time.Time
+	// AccessKey is the access key of the user who did the change.
+	AccessKey string
+	Bucket    string
+	Key       string
+	// Path is the path of the object on EOS.
+	Path string
+	// Size and ETag are set only for the created objects.
+	Size int64
+	ETag string
+}
+
+// Hooks are notified of the changes done through the backend,
+// after they succeed. The methods are called synchronously on
+// the request path: the ones doing slow work must hand it off.
+// Embed NopHooks to implement only the methods of interest.
+type Hooks interface {
+	OnBucketCreated(ctx context.Context, e BucketEvent)
+	OnBucketDeleted(ctx context.Context, e BucketEvent)
+	OnObjectCreated(ctx context.Context, e ObjectEvent)
+	OnObjectDeleted(ctx context.Context, e ObjectEvent)
+}
+
+// NopHooks implements Hooks doing nothing.
+type NopHooks struct{}
+
+func (NopHooks) OnBucketCreated(context.Context, BucketEvent) {}
+func (NopHooks) OnBucketDeleted(context.Context, BucketEvent) {}
+func (NopHooks) OnObjectCreated(context.Context, ObjectEvent) {}
+func (NopHooks) OnObjectDeleted(context.Context, ObjectEvent) {}
+
+// RegisterHooks registers h to be notified of the changes
+// done through the backend. It is meant to be called by the
+// code embedding the backend, before serving the requests.
+func (b *EosBackend) RegisterHooks(h Hooks) {
+	b.hooksMu.Lock()
+	defer b.hooksMu.Unlock()
+	b.hooks = append(b.hooks, h)
+}
+
+// notify calls f on every registered hook, recovering
+// from the panics so that a hook cannot fail a request.
+func (b *EosBackend) notify(ctx context.Context, f func(Hooks)) {
+	b.hooksMu.RLock()
+	hooks := b.hooks
+	b.hooksMu.RUnlock()
+
+	for _, h := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					b.log.ErrorContext(ctx, "panic in hook", "panic", r)
+				}
+			}()
+			f(h)
+		}()
+	}
+}
+
+func newBucketEvent(ctx context.Context, bucket, path string) BucketEvent {
+	acct, _ := getLoggedAccount(ctx)
+	return BucketEvent{Time: time.Now(), AccessKey: acct.Access, Bucket: bucket, Path: path}
+}
+
+func newObjectEvent(ctx context.Context, bucket, key, path string) ObjectEvent {
+	acct, _ := getLoggedAccount(ctx)
+	return ObjectEvent{Time: time.Now(), AccessKey: acct.Access, Bucket: bucket, Key: key, Path: path}
+}
@@ -0,0 +1,315 @@
+package eoss3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/versity/versitygw/auth"
+	"github.com/versity/versitygw/s3err"
+)
+
+// IdentityConfig configures how the S3 accounts are mapped
+// to the identities operating on EOS.
+type IdentityConfig struct {
+	// Driver is the mapper used:
+	//  - account (default): the uid and gid of the account
+	//  - static: the identities listed in Static
+	//  - passwd: the local user, looked up through NSS, named as the access key
+	//  - http: the identity returned by the service at URL
+	//  - oidc: the identity in the claims of the token of the account
+	Driver string `mapstructure:"driver"`
+	// Static maps the access keys to their identities.
+	Static map[string]StaticIdentity `mapstructure:"static"`
+	// URL is the endpoint of the http driver. It is called with the
+	// access key in the access query parameter, and must return a JSON
+	// object with the uid and gid fields, or 404 for unknown accounts.
+	URL string `mapstructure:"url"`
+	// OIDC configures the oidc driver.
+	OIDC OIDCConfig `mapstructure:"oidc"`
+	// LDAP, if set, completes the identities resolved by
+	// the driver with the groups of the user in LDAP.
+	LDAP *LDAPConfig `mapstructure:"ldap"`
+	// Guard restricts the identities the gateway operates as.
+	Guard GuardConfig `mapstructure:"guard"`
+	// Timeout is the timeout of the calls of the http and oidc
+	// drivers, and of LDAP. Defaults to 5s.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// CacheTTL is the time the identities resolved by the passwd,
+	// http and oidc drivers, or from LDAP, are cached for.
+	// Defaults to 5m.
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// StaticIdentity is an identity of the static driver, given either
+// by its uid and gid or by the name of a local user.
+type StaticIdentity struct {
+	Uid  uint64 `mapstructure:"uid"`
+	Gid  uint64 `mapstructure:"gid"`
+	User string `mapstructure:"user"`
+}
+
+// IdentityMapper resolves an authenticated S3 account
+// to the identity used for its operations on EOS.
+type IdentityMapper interface {
+	MapIdentity(ctx context.Context, acct auth.Account) (eos.Auth, error)
+}
+
+// ErrNoSuchIdentity is returned by an IdentityMapper
+// for the accounts without an identity on EOS.
+var ErrNoSuchIdentity = errors.New("no identity for the account")
+
+const (
+	defaultIdentityTimeout  = 5 * time.Second
+	defaultIdentityCacheTTL = 5 * time.Minute
+)
+
+// NewIdentityMapper returns the mapper configured by cfg, for
+// the tools resolving the accounts as the gateway does.
+func NewIdentityMapper(cfg IdentityConfig) (IdentityMapper, error) {
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultIdentityCacheTTL
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultIdentityTimeout
+	}
+
+	// the results of the remote lookups are cached
+	var m IdentityMapper
+	cached := true
+	switch cfg.Driver {
+	case "", "account":
+		m, cached = accountMapper{}, false
+	case "static":
+		static, err := newStaticMapper(cfg.Static)
+		if err != nil {
+			return nil, err
+		}
+		m, cached = static, false
+	case "passwd":
+		m = passwdMapper{}
+	case "http":
+		if cfg.URL == "" {
+			return nil, errors.New("missing url of the identity service")
+		}
+		if _, err := url.Parse(cfg.URL); err != nil {
+			return nil, fmt.Errorf("error parsing the url of the identity service: %w", err)
+		}
+		m = &httpMapper{url: cfg.URL, client: &http.Client{Timeout: timeout}}
+	case "oidc":
+		oidc, err := newOIDCMapper(cfg.OIDC, &http.Client{Timeout: timeout})
+		if err != nil {
+			return nil, err
+		}
+		m = oidc
+	default:
+		return nil, fmt.Errorf("unknown identity driver %q", cfg.Driver)
+	}
+
+	if cfg.LDAP != nil {
+		l, err := newLDAPMapper(m, *cfg.LDAP, timeout)
+		if err != nil {
+			return nil, err
+		}
+		m, cached = l, true
+	}
+	if cached {
+		m = newCachedMapper(m, ttl)
+	}
+	return m, nil
+}
+
+// SetIdentityMapper replaces the mapper of the S3 accounts to the EOS
+// identities with m. It is meant to be called by the code embedding
+// the backend, before serving the requests.
+func (b *EosBackend) SetIdentityMapper(m IdentityMapper) {
+	b.identities = m
+}
+
+// loggedIdentity returns the logged account and its identity on EOS.
+func (b *EosBackend) loggedIdentity(ctx context.Context) (auth.Account, eos.Auth, error) {
+	acct, ok := getLoggedAccount(ctx)
+	if !ok {
+		return auth.Account{}, eos.Auth{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+	id, err := b.mapper(ctx).MapIdentity(ctx, acct)
+	if errors.Is(err, ErrNoSuchIdentity) {
+		b.log.WarnContext(ctx, "no identity for the account", "access_key", acct.Access)
+		return auth.Account{}, eos.Auth{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+	if err != nil {
+		return auth.Account{}, eos.Auth{}, err
+	}
+	if err := b.checkIdentity(ctx, id); err != nil {
+		return auth.Account{}, eos.Auth{}, err
+	}
+	return acct, id, nil
+}
+
+// checkIdentity denies the operations as the identities
+// not allowed by the guard of the config.
+func (b *EosBackend) checkIdentity(ctx context.Context, id eos.Auth) error {
+	if b.guard.allows(id) {
+		return nil
+	}
+	b.log.WarnContext(ctx, "identity not allowed", "uid", id.Uid, "gid", id.Gid)
+	return s3err.GetAPIError(s3err.ErrAccessDenied)
+}
+
+// accountMapper takes the uid and gid set on the account.
+type accountMapper struct{}
+
+func (accountMapper) MapIdentity(_ context.Context, acct auth.Account) (eos.Auth, error) {
+	return eos.Auth{Uid: uint64(acct.UserID), Gid: uint64(acct.GroupID)}, nil
+}
+
+// staticMapper maps the access keys to the identities of the config.
+type staticMapper map[string]eos.Auth
+
+func newStaticMapper(ids map[string]StaticIdentity) (staticMapper, error) {
+	m := make(staticMapper, len(ids))
+	for access, id := range ids {
+		if id.User == "" {
+			m[access] = eos.Auth{Uid: id.Uid, Gid: id.Gid}
+			continue
+		}
+		a, err := lookupUser(id.User)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving the identity of %s: %w", access, err)
+		}
+		m[access] = a
+	}
+	return m, nil
+}
+
+func (m staticMapper) MapIdentity(_ context.Context, acct auth.Account) (eos.Auth, error) {
+	id, ok := m[acct.Access]
+	if !ok {
+		return eos.Auth{}, ErrNoSuchIdentity
+	}
+	return id, nil
+}
+
+// passwdMapper maps the access keys to the local users of the same name.
+type passwdMapper struct{}
+
+func (passwdMapper) MapIdentity(_ context.Context, acct auth.Account) (eos.Auth, error) {
+	return lookupUser(acct.Access)
+}
+
+func lookupUser(name string) (eos.Auth, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if errors.As(err, new(user.UnknownUserError)) {
+			return eos.Auth{}, ErrNoSuchIdentity
+		}
+		return eos.Auth{}, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 64)
+	if err != nil {
+		return eos.Auth{}, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 64)
+	if err != nil {
+		return eos.Auth{}, err
+	}
+	return eos.Auth{Uid: uid, Gid: gid}, nil
+}
+
+// httpMapper asks the identities to an external service.
+type httpMapper struct {
+	url    string
+	client *http.Client
+}
+
+func (m *httpMapper) MapIdentity(ctx context.Context, acct auth.Account) (eos.Auth, error) {
+	u, _ := url.Parse(m.url)
+	q := u.Query()
+	q.Set("access", acct.Access)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return eos.Auth{}, err
+	}
+	res, err := m.client.Do(req)
+	if err != nil {
+		return eos.Auth{}, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return eos.Auth{}, ErrNoSuchIdentity
+	case res.StatusCode != http.StatusOK:
+		return eos.Auth{}, fmt.Errorf("got non OK status code from the identity service: %d", res.StatusCode)
+	}
+
+	var id struct {
+		Uid uint64 `json:"uid"`
+		Gid uint64 `json:"gid"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&id); err != nil {
+		return eos.Auth{}, fmt.Errorf("error decoding the identity: %w", err)
+	}
+	return eos.Auth{Uid: id.Uid, Gid: id.Gid}, nil
+}
+
+// cachedMapper caches the identities resolved by a mapper,
+// including the accounts without an identity.
+type cachedMapper struct {
+	m   IdentityMapper
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedIdentity
+}
+
+type cachedIdentity struct {
+	id      eos.Auth
+	err     error
+	expires time.Time
+}
+
+func newCachedMapper(m IdentityMapper, ttl time.Duration) *cachedMapper {
+	return &cachedMapper{m: m, ttl: ttl, entries: make(map[string]cachedIdentity)}
+}
+
+func (c *cachedMapper) MapIdentity(ctx context.Context, acct auth.Account) (eos.Auth, error) {
+	// The secret is part of the key, as the identity
+	// of the oidc driver depends on the token.
+	key := acct.Access + "\x00" + acct.Secret
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.id, e.err
+	}
+
+	id, err := c.m.MapIdentity(ctx, acct)
+	if err != nil && !errors.Is(err, ErrNoSuchIdentity) {
+		// the failures of the lookup are not cached
+		return eos.Auth{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedIdentity{id: id, err: err, expires: now.Add(c.ttl)}
+	return id, err
+}
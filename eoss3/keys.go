@@ -0,0 +1,77 @@
+package eoss3
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/versity/versitygw/s3err"
+)
+
+// errInvalidKey is returned for the keys that cannot be
+// stored as a path on EOS without changing their name.
+var errInvalidKey = s3err.APIError{
+	Code:           "InvalidArgument",
+	Description:    "The key cannot be empty, contain empty, . or .. segments or null characters, or address the internal files of the gateway or the entries hidden from the listings.",
+	HTTPStatusCode: http.StatusBadRequest,
+}
+
+// maxKeyLength is the maximum length in bytes of the keys, as in S3.
+const maxKeyLength = 1024
+
+// checkKey validates the key before using it as a path in the
+// bucket: the keys with a leading slash, sequential slashes or
+// . and .. segments would be cleaned by the joins into another
+// path, possibly outside of the bucket. A trailing slash is
+// allowed, for the folders. The keys of the internal files, like
+// the staging folders of the multipart uploads, are rejected too.
+// All the other characters are kept as they are, the keys longer
+// than maxKeyLength being rejected.
+func checkKey(key string) error {
+	if len(key) > maxKeyLength {
+		return s3err.GetAPIError(s3err.ErrKeyTooLong)
+	}
+	if strings.ContainsRune(key, 0) {
+		return errInvalidKey
+	}
+	segments := strings.Split(strings.TrimSuffix(key, "/"), "/")
+	for i, s := range segments {
+		if s == "." || s == ".." || (s == "" && (i > 0 || key != "")) {
+			return errInvalidKey
+		}
+	}
+	// the internal files of the gateway and of EOS
+	if eos.IsMultipartFolder("/"+key) || isHiddenResource(key) {
+		return errInvalidKey
+	}
+	return nil
+}
+
+// checkPrefix validates the prefix of the keys of a listing: only
+// its folders are checked, its last segment being the beginning
+// of a name, e.g. . for the keys starting with a dot.
+func checkPrefix(prefix string) error {
+	return checkKey(prefix[:strings.LastIndexByte(prefix, '/')+1])
+}
+
+// objectPath returns the path on EOS of the object of the bucket with
+// the key, once validated. The keys of the entries hidden from the
+// listings are rejected too, their objects being never listed.
+func (b *EosBackend) objectPath(bucket *meta.Bucket, key string) (string, error) {
+	if key == "" {
+		return "", errInvalidKey
+	}
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if b.hidden.matches(key) {
+		return "", errInvalidKey
+	}
+	p := filepath.Join(bucket.Path, key)
+	if !strings.HasPrefix(p, filepath.Clean(bucket.Path)+"/") {
+		return "", errInvalidKey
+	}
+	return p, nil
+}
@@ -0,0 +1,157 @@
+package eoss3
+
+import (
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/versity/versitygw/s3err"
+)
+
+func TestCheckKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{name: "plain", key: "a/b/c.txt"},
+		{name: "folder", key: "a/b/"},
+		{name: "space", key: "a b/c d"},
+		{name: "hash", key: "a#b"},
+		{name: "percent", key: "100%/a%20b"},
+		{name: "question mark", key: "a?b=c"},
+		{name: "plus", key: "a+b"},
+		{name: "non-ASCII", key: "città/ファイル"},
+		{name: "control characters", key: "a\nb\tc\x01"},
+		{name: "dots in names", key: "a/.b/..c/d."},
+		{name: "max length", key: strings.Repeat("k", maxKeyLength)},
+		{name: "overlong", key: strings.Repeat("k", maxKeyLength+1), err: s3err.GetAPIError(s3err.ErrKeyTooLong)},
+		{name: "null character", key: "a\x00b", err: errInvalidKey},
+		{name: "leading slash", key: "/a", err: errInvalidKey},
+		{name: "sequential slashes", key: "a//b", err: errInvalidKey},
+		{name: "only slash", key: "/", err: errInvalidKey},
+		{name: "dot", key: "a/./b", err: errInvalidKey},
+		{name: "dot dot", key: "a/../../b", err: errInvalidKey},
+		{name: "trailing dot dot", key: "a/..", err: errInvalidKey},
+		{name: "version folder", key: "a/.sys.v#.b", err: errInvalidKey},
+		{name: "atomic file", key: ".sys.a#.b.1234", err: errInvalidKey},
+		{name: "multipart folder", key: ".multipart.1234", err: errInvalidKey},
+		{name: "nested multipart folder", key: "a/.multipart.1234/1", err: errInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkKey(tt.key); !errors.Is(err, tt.err) && err != tt.err {
+				t.Errorf("checkKey(%q) = %v, want %v", tt.key, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		valid  bool
+	}{
+		{prefix: "", valid: true},
+		{prefix: ".", valid: true},
+		{prefix: "a/", valid: true},
+		{prefix: "a/b", valid: true},
+		{prefix: "a/.sys", valid: true},
+		{prefix: "a//", valid: false},
+		{prefix: "../", valid: false},
+		{prefix: "/a", valid: false},
+		{prefix: ".multipart.1/", valid: false},
+	}
+	for _, tt := range tests {
+		if err := checkPrefix(tt.prefix); (err == nil) != tt.valid {
+			t.Errorf("checkPrefix(%q) = %v, want valid %t", tt.prefix, err, tt.valid)
+		}
+	}
+}
+
+func TestObjectPath(t *testing.T) {
+	b := &EosBackend{hidden: &hiddenFilter{patterns: []string{".Trash", "*.xsmap"}}}
+	bucket := &meta.Bucket{Name: "bucket", Path: "/eos/buckets/bucket/"}
+
+	tests := []struct {
+		key  string
+		path string
+	}{
+		{key: "a", path: "/eos/buckets/bucket/a"},
+		{key: "a/b/", path: "/eos/buckets/bucket/a/b"},
+		{key: "a b#c?d%e+f", path: "/eos/buckets/bucket/a b#c?d%e+f"},
+		{key: "città", path: "/eos/buckets/bucket/città"},
+		{key: "a.Trash", path: "/eos/buckets/bucket/a.Trash"},
+		{key: ""},
+		{key: "../bucket2/a"},
+		{key: ".Trash"},
+		{key: "a/.Trash/b"},
+		{key: "a/b.xsmap"},
+		{key: "a/.sys.v#.b"},
+	}
+	for _, tt := range tests {
+		p, err := b.objectPath(bucket, tt.key)
+		switch {
+		case tt.path == "" && err == nil:
+			t.Errorf("objectPath(%q) = %q, want an error", tt.key, p)
+		case tt.path != "" && (err != nil || p != tt.path):
+			t.Errorf("objectPath(%q) = %q, %v, want %q", tt.key, p, err, tt.path)
+		}
+	}
+}
+
+func TestUserMetaXattrs(t *testing.T) {
+	md := map[string]string{
+		"Plain":       "a",
+		"with-dash_1": "b",
+		"dot.ted":     "c",
+		"percent%2E":  "d",
+		"sym!#$&'*+^": "e",
+	}
+	set, ok := userMetaXattrs(md)
+	if !ok {
+		t.Fatal("userMetaXattrs rejected the metadata")
+	}
+	for name := range set {
+		suffix := strings.TrimPrefix(name, userMetaXattrPrefix)
+		if strings.Trim(suffix, "abcdefghijklmnopqrstuvwxyz0123456789-_%ABCDEF") != "" {
+			t.Errorf("unsafe xattr name %q", name)
+		}
+	}
+	if _, ok := set[userMetaXattrPrefix+"dot%2Eted"]; !ok {
+		t.Errorf("xattr of dot.ted not escaped: %v", set)
+	}
+
+	got := make(map[string]string, len(set))
+	for name, v := range set {
+		k, ok := userMetaName(name)
+		if !ok {
+			t.Fatalf("userMetaName(%q) not recognized", name)
+		}
+		got[k] = v
+	}
+	want := make(map[string]string, len(md))
+	for k, v := range md {
+		want[strings.ToLower(k)] = v
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("metadata read back = %v, want %v", got, want)
+	}
+
+	if _, ok := userMetaName("user.s3.other"); ok {
+		t.Error("userMetaName recognized an xattr not storing user metadata")
+	}
+
+	many := make(map[string]string, maxUserMetaXattrs+1)
+	for i := range maxUserMetaXattrs + 1 {
+		many[strings.Repeat("k", i+1)] = "v"
+	}
+	if _, ok := userMetaXattrs(many); ok {
+		t.Error("userMetaXattrs accepted too many entries")
+	}
+	if _, ok := userMetaXattrs(map[string]string{"k": strings.Repeat("v", maxUserMetaXattrSize)}); ok {
+		t.Error("userMetaXattrs accepted an oversized entry")
+	}
+}
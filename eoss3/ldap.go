@@ -0,0 +1,118 @@
+package eoss3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/versity/versitygw/auth"
+)
+
+// LDAPConfig configures the resolution of the groups of the users
+// from a directory service, like the CERN e-groups, so that the
+// permissions granted to the groups on EOS are honored.
+type LDAPConfig struct {
+	// URL is the URL of the server, e.g. ldaps://xldap.cern.ch.
+	URL string `mapstructure:"url"`
+	// BindDN and BindPassword authenticate the gateway.
+	// If not set, the searches are anonymous.
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword string `mapstructure:"bind_password"`
+	// UserBase is the base DN of the users.
+	UserBase string `mapstructure:"user_base"`
+	// UserFilter selects the user, {uid} being replaced by its uid.
+	// Defaults to (uidNumber={uid}).
+	UserFilter string `mapstructure:"user_filter"`
+	// GroupBase is the base DN of the groups.
+	GroupBase string `mapstructure:"group_base"`
+	// GroupFilter selects the groups of the user, {username} and {dn}
+	// being replaced by its name and DN.
+	// Defaults to (|(memberUid={username})(member={dn})).
+	GroupFilter string `mapstructure:"group_filter"`
+}
+
+func (c LDAPConfig) withDefaults() LDAPConfig {
+	if c.UserFilter == "" {
+		c.UserFilter = "(uidNumber={uid})"
+	}
+	if c.GroupFilter == "" {
+		c.GroupFilter = "(|(memberUid={username})(member={dn}))"
+	}
+	return c
+}
+
+// ldapMapper completes the identities resolved by a mapper
+// with the primary and secondary groups of the user in LDAP.
+type ldapMapper struct {
+	m       IdentityMapper
+	cfg     LDAPConfig
+	timeout time.Duration
+}
+
+func newLDAPMapper(m IdentityMapper, cfg LDAPConfig, timeout time.Duration) (*ldapMapper, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("missing url of the ldap server")
+	}
+	return &ldapMapper{m: m, cfg: cfg.withDefaults(), timeout: timeout}, nil
+}
+
+func (l *ldapMapper) MapIdentity(ctx context.Context, acct auth.Account) (eos.Auth, error) {
+	id, err := l.m.MapIdentity(ctx, acct)
+	if err != nil {
+		return eos.Auth{}, err
+	}
+
+	conn, err := ldap.DialURL(l.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: l.timeout}))
+	if err != nil {
+		return eos.Auth{}, fmt.Errorf("error connecting to the ldap server: %w", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(l.timeout)
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return eos.Auth{}, fmt.Errorf("error binding to the ldap server: %w", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(l.cfg.UserFilter, "{uid}", strconv.FormatUint(id.Uid, 10))
+	res, err := conn.Search(l.search(l.cfg.UserBase, filter, "uid", "gidNumber"))
+	if err != nil {
+		return eos.Auth{}, fmt.Errorf("error searching the user %d: %w", id.Uid, err)
+	}
+	if len(res.Entries) == 0 {
+		// not in the directory: no groups to add
+		return id, nil
+	}
+	user := res.Entries[0]
+	if gid, err := strconv.ParseUint(user.GetAttributeValue("gidNumber"), 10, 64); err == nil {
+		id.Gid = gid
+	}
+
+	filter = strings.NewReplacer(
+		"{username}", ldap.EscapeFilter(user.GetAttributeValue("uid")),
+		"{dn}", ldap.EscapeFilter(user.DN),
+	).Replace(l.cfg.GroupFilter)
+	res, err = conn.SearchWithPaging(l.search(l.cfg.GroupBase, filter, "gidNumber"), 500)
+	if err != nil {
+		return eos.Auth{}, fmt.Errorf("error searching the groups of %d: %w", id.Uid, err)
+	}
+	id.Groups = nil
+	for _, g := range res.Entries {
+		gid, err := strconv.ParseUint(g.GetAttributeValue("gidNumber"), 10, 64)
+		if err == nil && gid != id.Gid && !slices.Contains(id.Groups, gid) {
+			id.Groups = append(id.Groups, gid)
+		}
+	}
+	return id, nil
+}
+
+func (l *ldapMapper) search(base, filter string, attrs ...string) *ldap.SearchRequest {
+	return ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(l.timeout.Seconds()), false, filter, attrs, nil)
+}
@@ -0,0 +1,319 @@
+package eoss3
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+)
+
+// defaultMaxKeys is the number of keys returned by
+// a listing when not specified, as done by S3.
+const defaultMaxKeys = 1000
+
+func maxKeys(n *int32) int32 {
+	if n == nil || *n < 0 {
+		return defaultMaxKeys
+	}
+	return *n
+}
+
+// listPage selects the keys of a page of a listing, whose entries
+// are sorted by key: a page starts after the first key greater than
+// the last key of the previous one, even if that key was removed
+// in the meantime.
+type listPage struct {
+	start string
+	limit int32
+
+	count     int32
+	last      string
+	truncated bool
+}
+
+func newListPage(start string, limit int32) *listPage {
+	return &listPage{start: start, limit: limit}
+}
+
+// add returns whether key is part of the page. Once the page is full,
+// the next key marks the listing as truncated.
+func (p *listPage) add(key string) bool {
+	if key <= p.start {
+		return false
+	}
+	if p.full() {
+		p.truncated = p.count > 0
+		return false
+	}
+	p.count++
+	p.last = key
+	return true
+}
+
+// full returns whether the page is full,
+// so that the stream of the entries can be closed.
+func (p *listPage) full() bool {
+	return p.count >= p.limit
+}
+
+// next returns the key the next page starts after,
+// or nil if the listing is complete.
+func (p *listPage) next() *string {
+	if !p.truncated {
+		return nil
+	}
+	return &p.last
+}
+
+// missingFolder tells if err is the one of the listing of the folder
+// of a prefix, missing from the bucket: the listing is then empty.
+func missingFolder(err error, bucketPath, folder string) bool {
+	return errors.Is(err, syscall.ENOENT) && filepath.Clean(folder) != filepath.Clean(bucketPath)
+}
+
+// keyedEntry is an entry of a listing with its S3 key.
+type keyedEntry struct {
+	key string
+	md  *erpc.MDResponse
+}
+
+// keyHeap is a max-heap of entries by key.
+type keyHeap []keyedEntry
+
+func (h keyHeap) Len() int           { return len(h) }
+func (h keyHeap) Less(i, j int) bool { return h[i].key > h[j].key }
+func (h keyHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x any)        { *h = append(*h, x.(keyedEntry)) }
+func (h *keyHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// listSmallest returns, sorted by key, the n entries of dir with the
+// smallest keys greater than after, among the ones kept by keep. EOS
+// does not stream the entries in key order: the whole directory is
+// streamed, holding at most n entries. more tells if other entries
+// were kept but dropped, to be listed after the returned ones.
+func (b *EosBackend) listSmallest(ctx context.Context, auth eos.Auth, bucketPath, dir, after string, n int, keep func(md *erpc.MDResponse, key string) bool) (entries []keyedEntry, more bool, err error) {
+	h := make(keyHeap, 0, n)
+	err = b.eos.ListDir(ctx, auth, dir, func(md *erpc.MDResponse) {
+		key := *b.mdResponseToS3Object(bucketPath, md).Key
+		if key <= after || !keep(md, key) {
+			return
+		}
+		switch {
+		case h.Len() < n:
+			heap.Push(&h, keyedEntry{key: key, md: md})
+		case n > 0 && key < h[0].key:
+			h[0] = keyedEntry{key: key, md: md}
+			heap.Fix(&h, 0)
+			more = true
+		default:
+			more = true
+		}
+	}, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	slices.SortFunc(h, func(x, y keyedEntry) int {
+		return strings.Compare(x.key, y.key)
+	})
+	return h, more, nil
+}
+
+// listDir calls f on the entries of dir kept by keep, sorted by key and
+// starting after the key after, until f returns false. At most n entries
+// are held, so that f must accept every entry kept and n must be one
+// more than the keys of the page, to tell if it is truncated.
+func (b *EosBackend) listDir(ctx context.Context, auth eos.Auth, bucketPath, dir, after string, n int, keep func(key string) bool, f func(*erpc.MDResponse) bool) error {
+	entries, _, err := b.listSmallest(ctx, auth, bucketPath, dir, after, n, func(_ *erpc.MDResponse, key string) bool {
+		return keep(key)
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !f(e.md) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// defaultListWorkers is the number of directories listed
+// ahead by a recursive listing when not configured.
+const defaultListWorkers = 8
+
+// treeWalker lists a tree incrementally, one directory at a time
+// and in key order, with a Find of depth 1 for each directory: a
+// listing never makes the MGM scan more of the tree than the
+// directories it goes through. At most batch entries of a directory
+// are held at a time: the directories holding more are listed again
+// after the last entry walked. The subdirectories are listed ahead
+// by at most workers concurrent calls, while the entries of the
+// previous ones are consumed.
+type treeWalker struct {
+	b          *EosBackend
+	auth       eos.Auth
+	bucketPath string
+	prefix     string
+	start      string
+	batch      int
+	sem        chan struct{}
+}
+
+// dirListing is a batch of the listing of a directory, sorted by key,
+// of the entries after the key after. It is either fetched ahead,
+// when done is set, or on demand.
+type dirListing struct {
+	path    string
+	after   string
+	entries []keyedEntry
+	more    bool
+	err     error
+	done    chan struct{}
+}
+
+// listTree calls f on the files under dir, recursively and sorted
+// by key, until f returns false. The directories whose keys all
+// sort before start, or do not start with prefix, are not listed.
+// At most batch entries of each directory are held at a time.
+func (b *EosBackend) listTree(ctx context.Context, auth eos.Auth, bucketPath, dir, prefix, start string, batch int, f func(*erpc.MDResponse) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := b.cfg.ListWorkers
+	if workers <= 0 {
+		workers = defaultListWorkers
+	}
+	w := &treeWalker{
+		b:          b,
+		auth:       auth,
+		bucketPath: bucketPath,
+		prefix:     prefix,
+		start:      start,
+		batch:      max(batch, 1),
+		sem:        make(chan struct{}, workers),
+	}
+
+	root := &dirListing{path: dir}
+	if err := w.list(ctx, root); err != nil {
+		return err
+	}
+	_, err := w.walk(ctx, root, f)
+	return err
+}
+
+// wanted tells if the entry with key is part of the listing:
+// a file after start and with the prefix, or a directory that
+// may hold some of them.
+func (w *treeWalker) wanted(ctx context.Context, md *erpc.MDResponse, key string) bool {
+	if w.b.hidden.hidden(ctx, key) {
+		return false
+	}
+	if md.Type != erpc.TYPE_CONTAINER {
+		return key > w.start && strings.HasPrefix(key, w.prefix)
+	}
+	// all the keys of the subtree start with its key
+	if key <= w.start && !strings.HasPrefix(w.start, key) {
+		return false
+	}
+	return strings.HasPrefix(key, w.prefix) || strings.HasPrefix(w.prefix, key)
+}
+
+// walk calls f on the files of l and of its subdirectories,
+// returning false if f asked to stop.
+func (w *treeWalker) walk(ctx context.Context, l *dirListing, f func(*erpc.MDResponse) bool) (bool, error) {
+	for {
+		subdirs := make(map[*erpc.MDResponse]*dirListing)
+		for _, e := range l.entries {
+			if e.md.Type == erpc.TYPE_CONTAINER {
+				subdirs[e.md] = w.fetch(ctx, string(e.md.Cmd.Path))
+			}
+		}
+
+		for _, e := range l.entries {
+			if e.md.Type != erpc.TYPE_CONTAINER {
+				if !f(e.md) {
+					return false, nil
+				}
+				continue
+			}
+			sub := subdirs[e.md]
+			err := w.wait(ctx, sub)
+			if errors.Is(err, syscall.ENOENT) {
+				// removed in the meantime
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			if cont, err := w.walk(ctx, sub, f); !cont || err != nil {
+				return false, err
+			}
+		}
+
+		if !l.more {
+			return true, nil
+		}
+		// the next batch, after the entries walked
+		l.after = l.entries[len(l.entries)-1].key
+		err := w.list(ctx, l)
+		if errors.Is(err, syscall.ENOENT) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// fetch starts listing dir in the background if a worker is free,
+// otherwise it is listed when waited for.
+func (w *treeWalker) fetch(ctx context.Context, dir string) *dirListing {
+	l := &dirListing{path: dir}
+	select {
+	case w.sem <- struct{}{}:
+		l.done = make(chan struct{})
+		go func() {
+			defer func() { <-w.sem }()
+			l.err = w.list(ctx, l)
+			close(l.done)
+		}()
+	default:
+	}
+	return l
+}
+
+// wait returns once l is listed.
+func (w *treeWalker) wait(ctx context.Context, l *dirListing) error {
+	if l.done == nil {
+		return w.list(ctx, l)
+	}
+	select {
+	case <-l.done:
+		return l.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// list lists the next batch of the entries of l, sorted by key.
+func (w *treeWalker) list(ctx context.Context, l *dirListing) error {
+	entries, more, err := w.b.listSmallest(ctx, w.auth, w.bucketPath, l.path, l.after, w.batch, func(md *erpc.MDResponse, key string) bool {
+		return w.wanted(ctx, md, key)
+	})
+	if err != nil {
+		return err
+	}
+	l.entries, l.more = entries, more
+	return nil
+}
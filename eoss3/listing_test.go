@@ -0,0 +1,275 @@
+package eoss3
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/versity/versitygw/auth"
+)
+
+const testBucketPath = "/eos/buckets/bucket"
+
+var testListingKeys = []string{
+	"a-b/x",
+	"a.txt",
+	"a/b.txt",
+	"a/c/d.txt",
+	"a/c/e.txt",
+	"ab.txt",
+	"photos/2024/jan.jpg",
+	"photos/2024/feb.jpg",
+	"photos/2025/mar.jpg",
+	"z.txt",
+}
+
+// newListingBackend returns a backend on a fake EOS, with a bucket
+// holding testListingKeys, and the context of its owner.
+func newListingBackend(t *testing.T) (*EosBackend, *eos.FakeClient, context.Context) {
+	t.Helper()
+	ctx := context.Background()
+	owner := eos.Auth{Uid: 1000, Gid: 1000}
+
+	client := eos.NewFakeClient()
+	if err := client.Mkdir(ctx, owner, testBucketPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range testListingKeys {
+		if err := client.Upload(ctx, owner, testBucketPath+"/"+key, strings.NewReader(key), uint64(len(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := meta.NewInMemoryBucketStorer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateBucket(ctx, meta.Bucket{
+		Name:      "bucket",
+		Path:      testBucketPath,
+		CreatedAt: time.Now(),
+		Owner:     &meta.Identity{Uid: owner.Uid, Gid: owner.Gid},
+		RunAs:     &meta.Identity{Uid: owner.Uid, Gid: owner.Gid},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	be, err := NewWithClient(&Config{}, store, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(be.Shutdown)
+	return be, client, WithAccount(ctx, auth.Account{Access: "owner", UserID: int(owner.Uid), GroupID: int(owner.Gid)})
+}
+
+// listV2 returns the keys and the common prefixes of all the pages
+// of the listing, in order, with maxKeys keys per page.
+func listV2(t *testing.T, be *EosBackend, ctx context.Context, prefix, delimiter string, maxKeys int32) ([]string, []string) {
+	t.Helper()
+	var keys, prefixes []string
+	var token *string
+	for range 100 {
+		res, err := be.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String("bucket"),
+			Prefix:            aws.String(prefix),
+			Delimiter:         aws.String(delimiter),
+			MaxKeys:           aws.Int32(maxKeys),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			t.Fatalf("ListObjectsV2(prefix %q, delimiter %q) failed: %v", prefix, delimiter, err)
+		}
+		for _, o := range res.Contents {
+			keys = append(keys, *o.Key)
+		}
+		for _, p := range res.CommonPrefixes {
+			prefixes = append(prefixes, *p.Prefix)
+		}
+		if !aws.ToBool(res.IsTruncated) {
+			return keys, prefixes
+		}
+		token = res.NextContinuationToken
+	}
+	t.Fatalf("ListObjectsV2(prefix %q, delimiter %q) never ends", prefix, delimiter)
+	return nil, nil
+}
+
+func TestListObjectsV2(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    string
+		delimiter string
+		keys      []string
+		prefixes  []string
+	}{
+		{
+			name:      "slash delimiter",
+			delimiter: "/",
+			keys:      []string{"a.txt", "ab.txt", "z.txt"},
+			prefixes:  []string{"a-b/", "a/", "photos/"},
+		},
+		{
+			name: "empty delimiter",
+			keys: slices.Sorted(slices.Values(testListingKeys)),
+		},
+		{
+			name:      "dash delimiter",
+			delimiter: "-",
+			keys:      []string{"a.txt", "a/b.txt", "a/c/d.txt", "a/c/e.txt", "ab.txt", "photos/2024/feb.jpg", "photos/2024/jan.jpg", "photos/2025/mar.jpg", "z.txt"},
+			prefixes:  []string{"a-"},
+		},
+		{
+			name:      "multi-character delimiter",
+			prefix:    "photos/",
+			delimiter: "4/",
+			keys:      []string{"photos/2025/mar.jpg"},
+			prefixes:  []string{"photos/2024/"},
+		},
+		{
+			name:      "prefix of folders",
+			prefix:    "a/",
+			delimiter: "/",
+			keys:      []string{"a/b.txt"},
+			prefixes:  []string{"a/c/"},
+		},
+		{
+			name:      "prefix splitting a file name",
+			prefix:    "a/c/d",
+			delimiter: "/",
+			keys:      []string{"a/c/d.txt"},
+		},
+		{
+			name:      "prefix splitting a folder name",
+			prefix:    "photos/202",
+			delimiter: "/",
+			prefixes:  []string{"photos/2024/", "photos/2025/"},
+		},
+		{
+			name:     "prefix splitting a name without delimiter",
+			prefix:   "a",
+			keys:     []string{"a-b/x", "a.txt", "a/b.txt", "a/c/d.txt", "a/c/e.txt", "ab.txt"},
+			prefixes: nil,
+		},
+		{
+			name:      "missing prefix",
+			prefix:    "missing/",
+			delimiter: "/",
+		},
+	}
+	be, _, ctx := newListingBackend(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the pages of a single key must give the same listing
+			for _, maxKeys := range []int32{1000, 1} {
+				keys, prefixes := listV2(t, be, ctx, tt.prefix, tt.delimiter, maxKeys)
+				if !slices.Equal(keys, tt.keys) {
+					t.Errorf("max keys %d: got keys %q, want %q", maxKeys, keys, tt.keys)
+				}
+				if !slices.Equal(prefixes, tt.prefixes) {
+					t.Errorf("max keys %d: got common prefixes %q, want %q", maxKeys, prefixes, tt.prefixes)
+				}
+			}
+		})
+	}
+}
+
+func TestListObjectsV2ContinuationAcrossCommonPrefix(t *testing.T) {
+	be, _, ctx := newListingBackend(t)
+
+	res, err := be.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String("bucket"),
+		Prefix:    aws.String(""),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a-b/, a.txt, a/
+	if got := aws.ToString(res.NextContinuationToken); got != "a/" {
+		t.Fatalf("got continuation token %q, want %q", got, "a/")
+	}
+
+	res, err = be.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:            aws.String("bucket"),
+		Prefix:            aws.String(""),
+		Delimiter:         aws.String("/"),
+		MaxKeys:           aws.Int32(3),
+		ContinuationToken: res.NextContinuationToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the keys under the common prefix are not returned again
+	var keys []string
+	for _, o := range res.Contents {
+		keys = append(keys, *o.Key)
+	}
+	if want := []string{"ab.txt", "z.txt"}; !slices.Equal(keys, want) {
+		t.Errorf("got keys %q, want %q", keys, want)
+	}
+	if len(res.CommonPrefixes) != 1 || *res.CommonPrefixes[0].Prefix != "photos/" {
+		t.Errorf("got common prefixes %v, want [photos/]", res.CommonPrefixes)
+	}
+}
+
+func TestListObjectsV2DeletedContinuationKey(t *testing.T) {
+	for _, delimiter := range []string{"/", ""} {
+		t.Run("delimiter "+delimiter, func(t *testing.T) {
+			be, client, ctx := newListingBackend(t)
+
+			input := &s3.ListObjectsV2Input{
+				Bucket:    aws.String("bucket"),
+				Prefix:    aws.String(""),
+				Delimiter: aws.String(delimiter),
+				MaxKeys:   aws.Int32(2),
+			}
+			res, err := be.ListObjectsV2(ctx, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token := aws.ToString(res.NextContinuationToken)
+			if token != "a.txt" {
+				t.Fatalf("got continuation token %q, want %q", token, "a.txt")
+			}
+
+			// the page is deleted before listing the next one
+			if err := client.Remove(ctx, eos.Auth{Uid: 1000, Gid: 1000}, testBucketPath+"/"+token, false); err != nil {
+				t.Fatal(err)
+			}
+			input.ContinuationToken = &token
+			res, err = be.ListObjectsV2(ctx, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aws.ToInt32(res.KeyCount) != 2 || !aws.ToBool(res.IsTruncated) {
+				t.Errorf("got %d keys, truncated %t, want the next page", aws.ToInt32(res.KeyCount), aws.ToBool(res.IsTruncated))
+			}
+		})
+	}
+}
+
+func TestListObjectsPrefix(t *testing.T) {
+	be, _, ctx := newListingBackend(t)
+
+	res, err := be.ListObjects(ctx, &s3.ListObjectsInput{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("a/c/d"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, o := range res.Contents {
+		keys = append(keys, *o.Key)
+	}
+	if want := []string{"a/c/d.txt"}; !slices.Equal(keys, want) {
+		t.Errorf("got keys %q, want %q", keys, want)
+	}
+}
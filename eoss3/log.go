@@ -0,0 +1,132 @@
+package eoss3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogConfig configures the logger of the backend.
+type LogConfig struct {
+	// Level is the minimum level of the logged messages:
+	// debug, info, warn or error. Defaults to info.
+	Level string `mapstructure:"level"`
+	// Format is the format of the log lines: json or console.
+	// Defaults to console.
+	Format string `mapstructure:"format"`
+	// Slow are the thresholds above which the calls
+	// are logged as warnings.
+	Slow SlowConfig `mapstructure:"slow"`
+	// Output is where the logs are written: stderr, stdout
+	// or the path of a file. Defaults to stderr.
+	Output string `mapstructure:"output"`
+	// Rotate configures the rotation of the log file.
+	Rotate RotateConfig `mapstructure:"rotate"`
+	// SampleDebug, if greater than 1, logs only one every
+	// SampleDebug debug messages with the same text.
+	SampleDebug int `mapstructure:"sample_debug"`
+	// Redact are the keys of the attributes redacted from the
+	// logs, in addition to the ones known to hold secrets.
+	Redact []string `mapstructure:"redact"`
+	// ErrorSummary is the interval at which the number of errors,
+	// by S3 error code and by EOS error, is logged. If not set,
+	// no summary is logged.
+	ErrorSummary time.Duration `mapstructure:"error_summary"`
+}
+
+// SlowConfig holds the thresholds above which the calls are logged
+// as warnings. A threshold not set disables the logging of the calls.
+type SlowConfig struct {
+	// EOS is the threshold of the gRPC calls to the MGM.
+	EOS time.Duration `mapstructure:"eos"`
+	// Transfer is the threshold of the HTTP transfers to and from EOS.
+	Transfer time.Duration `mapstructure:"transfer"`
+	// Meta is the threshold of the calls to the meta store.
+	Meta time.Duration `mapstructure:"meta"`
+}
+
+// NewLogger returns a logger configured as in cfg, and the
+// closer of its output. The secrets are redacted from the logs.
+func NewLogger(cfg LogConfig, secrets ...string) (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+		}
+	}
+
+	w, err := openLogOutput(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: newRedactor(cfg.Redact, secrets)}
+	var h slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "console", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		_ = w.Close()
+		return nil, nil, fmt.Errorf("invalid log format %q: must be json or console", cfg.Format)
+	}
+
+	h = requestIDHandler{h}
+	if cfg.SampleDebug > 1 {
+		h = &samplingHandler{Handler: h, every: uint64(cfg.SampleDebug), counts: &sync.Map{}}
+	}
+	return slog.New(h), w, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// openLogOutput opens the output of the logs:
+// stderr, stdout or a file rotated as configured.
+func openLogOutput(cfg LogConfig) (io.WriteCloser, error) {
+	switch cfg.Output {
+	case "", "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	}
+	f, err := openRotatingFile(cfg.Output, cfg.Rotate)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file: %w", err)
+	}
+	return f, nil
+}
+
+// samplingHandler logs only one every n debug records
+// with the same message. The other levels are not sampled.
+type samplingHandler struct {
+	slog.Handler
+	every  uint64
+	counts *sync.Map // message -> *atomic.Uint64
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level <= slog.LevelDebug {
+		c, _ := h.counts.LoadOrStore(r.Message, new(atomic.Uint64))
+		if (c.(*atomic.Uint64).Add(1)-1)%h.every != 0 {
+			return nil
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), every: h.every, counts: h.counts}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), every: h.every, counts: h.counts}
+}
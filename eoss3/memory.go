@@ -0,0 +1,76 @@
+package eoss3
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MemoryConfig bounds the memory used by the gateway to relay
+// the data of the uploads and downloads. The objects are never
+// held in memory as a whole, but streamed through fixed buffers.
+type MemoryConfig struct {
+	// PerRequest is the maximum memory in bytes a transfer can use.
+	// The buffers of the transport must fit in it.
+	// If not set, it is not checked.
+	PerRequest int64 `mapstructure:"per_request"`
+	// Global is the maximum memory in bytes used by all the transfers
+	// in progress. The transfers beyond it are rejected with SlowDown
+	// before any data is read. If not set, it is not limited.
+	Global int64 `mapstructure:"global"`
+}
+
+// memoryBudget accounts the memory of the transfers in progress.
+// A nil memoryBudget has no limit.
+type memoryBudget struct {
+	perTransfer int64
+	limit       int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+func newMemoryBudget(cfg MemoryConfig, perTransfer int64) (*memoryBudget, error) {
+	if cfg.PerRequest > 0 && perTransfer > cfg.PerRequest {
+		return nil, fmt.Errorf("the transfer buffers need %d bytes, more than memory.per_request", perTransfer)
+	}
+	if cfg.Global <= 0 {
+		return nil, nil
+	}
+	return &memoryBudget{perTransfer: perTransfer, limit: cfg.Global}, nil
+}
+
+// reserve accounts the memory of a transfer of size bytes,
+// plus extra bytes of buffers used only by it, returning
+// errSlowDown if the budget is exhausted.
+// The memory must be given back calling the returned function.
+func (m *memoryBudget) reserve(size, extra int64) (func(), error) {
+	if m == nil {
+		return func() {}, nil
+	}
+	n := max(min(size, m.perTransfer), 0) + extra
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.used+n > m.limit {
+		return nil, errSlowDown
+	}
+	m.used += n
+	return sync.OnceFunc(func() {
+		m.mu.Lock()
+		m.used -= n
+		m.mu.Unlock()
+	}), nil
+}
+
+// releaseCloser gives back the memory of a download
+// when its body is closed.
+type releaseCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseCloser) Close() error {
+	r.release()
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,137 @@
+package eoss3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/versity/versitygw/s3err"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+const meterName = "github.com/gmgigi96/eoss3/eoss3"
+
+// MetricsConfig configures the export of the metrics.
+type MetricsConfig struct {
+	// Endpoint is the address of the OTLP gRPC collector, e.g. localhost:4317.
+	// If not set, the metrics are not exported.
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure disables the transport security with the collector.
+	Insecure bool `mapstructure:"insecure"`
+	// ServiceName is the name of the service in the metrics. Defaults to eoss3.
+	ServiceName string `mapstructure:"service_name"`
+	// Interval is the interval between two exports. Defaults to 1 minute.
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// newMeterProvider returns the meter provider exporting the
+// metrics as configured in cfg, and the function flushing and
+// stopping it.
+func newMeterProvider(cfg MetricsConfig) (metric.MeterProvider, func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return noop.NewMeterProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	exp, err := otlpmetricgrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating metric exporter: %w", err)
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = "eoss3"
+	}
+	var readerOpts []sdkmetric.PeriodicReaderOption
+	if cfg.Interval > 0 {
+		readerOpts = append(readerOpts, sdkmetric.WithInterval(cfg.Interval))
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp, readerOpts...)),
+		sdkmetric.WithResource(resource.NewSchemaless(semconv.ServiceName(name))),
+	)
+	return mp, mp.Shutdown, nil
+}
+
+// errorCode returns the S3 error code of err,
+// InternalError if err is not an S3 error.
+func errorCode(err error) string {
+	var apiErr s3err.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return "InternalError"
+}
+
+// errorCounter counts the failed S3 operations by error code.
+type errorCounter struct {
+	counter metric.Int64Counter
+
+	mu     sync.Mutex
+	counts map[string]int64 // code -> count since the last take
+}
+
+func newErrorCounter(mp metric.MeterProvider) (*errorCounter, error) {
+	counter, err := mp.Meter(meterName).Int64Counter("s3.errors",
+		metric.WithDescription("Failed S3 operations, by operation and S3 error code."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &errorCounter{counter: counter, counts: make(map[string]int64)}, nil
+}
+
+func (c *errorCounter) add(ctx context.Context, op, code string) {
+	c.counter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("s3.operation", op),
+		attribute.String("s3.error_code", code),
+	))
+	c.mu.Lock()
+	c.counts[code]++
+	c.mu.Unlock()
+}
+
+// take returns the number of errors by code since the last call.
+func (c *errorCounter) take() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := maps.Clone(c.counts)
+	clear(c.counts)
+	return counts
+}
+
+func (b *EosBackend) countError(ctx context.Context, op, code string) {
+	b.errors.add(ctx, op, code)
+}
+
+// runErrorSummary logs every interval the number of errors by
+// S3 error code and by EOS error, until ctx is done.
+func (b *EosBackend) runErrorSummary(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s3Errors, eosErrors := b.errors.take(), b.eos.TakeErrorCounts()
+			if len(s3Errors) == 0 && len(eosErrors) == 0 {
+				continue
+			}
+			b.log.InfoContext(ctx, "error summary", "interval", interval, "s3", s3Errors, "eos", eosErrors)
+		}
+	}
+}
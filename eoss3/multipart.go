@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	go_eosgrpc "github.com/cern-eos/go-eosgrpc"
 	"github.com/gmgigi96/eoss3/eos"
@@ -17,39 +18,61 @@ import (
 	"github.com/versity/versitygw/s3response"
 )
 
-func multipartFolder(bucket *meta.Bucket, uploadId string) string {
-	return filepath.Join(bucket.Path, fmt.Sprintf(".multipart.%s", uploadId))
+// multipartFolder returns the folder staging the parts of the upload.
+// The upload ids are generated by the gateway: any other one, that
+// could address a path outside of the bucket, is not an upload.
+func multipartFolder(bucket *meta.Bucket, uploadId string) (string, error) {
+	if _, err := uuid.Parse(uploadId); err != nil {
+		return "", s3err.GetAPIError(s3err.ErrNoSuchUpload)
+	}
+	return eos.MultipartFolder(bucket.Path, uploadId), nil
 }
 
-func (b *EosBackend) CreateMultipartUpload(ctx context.Context, req s3response.CreateMultipartUploadInput) (s3response.InitiateMultipartUploadResult, error) {
-	fmt.Println("CreateMultipartUpload")
+func (b *EosBackend) CreateMultipartUpload(ctx context.Context, req s3response.CreateMultipartUploadInput) (_ s3response.InitiateMultipartUploadResult, err error) {
+	ctx, op := b.startOperation(ctx, "CreateMultipartUpload", "bucket", aws.ToString(req.Bucket), "key", aws.ToString(req.Key))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.InitiateMultipartUploadResult{}, err
+	}
+	defer func() {
+		b.logOperation(ctx, "CreateMultipartUpload", aws.ToString(req.Bucket), aws.ToString(req.Key), 0, err)
+	}()
 	name := *req.Bucket
 	key := *req.Key
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return s3response.InitiateMultipartUploadResult{}, s3err.GetAPIError(s3err.ErrAccessDenied)
-	}
-
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return s3response.InitiateMultipartUploadResult{}, err
 	}
+	if _, err := b.objectPath(&bucket, aws.ToString(req.Key)); err != nil {
+		return s3response.InitiateMultipartUploadResult{}, err
+	}
 
 	// generate an upload id
 	uploadId := uuid.NewString()
 
-	folder := multipartFolder(&bucket, uploadId)
+	folder, _ := multipartFolder(&bucket, uploadId)
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return s3response.InitiateMultipartUploadResult{}, err
 	}
-	if err := b.eos.Mkdir(ctx, auth, folder, 0755); err != nil {
+	if err := b.checkQuota(ctx, auth, &bucket, 0); err != nil {
 		return s3response.InitiateMultipartUploadResult{}, err
 	}
+	if err := b.eos.Mkdir(ctx, auth, folder, 0755); err != nil {
+		return s3response.InitiateMultipartUploadResult{}, bucketError(err)
+	}
+	// the user metadata is staged with the parts
+	if b.cfg.UserMetadata && len(req.Metadata) > 0 {
+		if err := b.setUserMetadata(ctx, auth, bucket.Name, meta.UploadMetadataKey(uploadId), folder, req.Metadata); err != nil {
+			return s3response.InitiateMultipartUploadResult{}, uploadError(err)
+		}
+	}
 
-	if err := b.meta.StoreMultipartUpload(bucket.Name, acct.UserID, uploadId, time.Now()); err != nil {
+	// the initiator is the identity operating on EOS,
+	// the run-as one on the service buckets
+	if err := b.store(ctx).StoreMultipartUpload(ctx, bucket.Name, int(auth.Uid), uploadId, time.Now()); err != nil {
 		// TODO: cleanup directory on EOS
 		return s3response.InitiateMultipartUploadResult{}, err
 	}
@@ -61,84 +84,124 @@ func (b *EosBackend) CreateMultipartUpload(ctx context.Context, req s3response.C
 	}, nil
 }
 
-func (b *EosBackend) CompleteMultipartUpload(ctx context.Context, req *s3.CompleteMultipartUploadInput) (_ s3response.CompleteMultipartUploadResult, versionId string, _ error) {
-	fmt.Println("CompleteMultipartUpload")
+func (b *EosBackend) CompleteMultipartUpload(ctx context.Context, req *s3.CompleteMultipartUploadInput) (_ s3response.CompleteMultipartUploadResult, versionId string, err error) {
+	ctx, op := b.startOperation(ctx, "CompleteMultipartUpload", "bucket", aws.ToString(req.Bucket), "key", aws.ToString(req.Key), "upload_id", aws.ToString(req.UploadId))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.CompleteMultipartUploadResult{}, "", err
+	}
+	defer func() {
+		b.logOperation(ctx, "CompleteMultipartUpload", aws.ToString(req.Bucket), aws.ToString(req.Key), 0, err)
+	}()
 	name := *req.Bucket
 
-	// TODO: check that all parts have been provided
 	// This implementation is very inefficient. We could use in the future
 	// the clone mechanism to not actually copy the parts.
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return s3response.CompleteMultipartUploadResult{}, "", err
 	}
 
-	folder := multipartFolder(&bucket, *req.UploadId)
-
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return s3response.CompleteMultipartUploadResult{}, "", s3err.GetAPIError(s3err.ErrAccessDenied)
+	dst, err := b.objectPath(&bucket, aws.ToString(req.Key))
+	if err != nil {
+		return s3response.CompleteMultipartUploadResult{}, "", err
+	}
+	folder, err := multipartFolder(&bucket, *req.UploadId)
+	if err != nil {
+		return s3response.CompleteMultipartUploadResult{}, "", err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return s3response.CompleteMultipartUploadResult{}, "", err
 	}
 
 	tmpFile := filepath.Join(folder, "tmp")
 
-	// compute total size
-	var total uint64
-	var count int
+	uploaded := make(map[int32]*go_eosgrpc.MDResponse)
 	if err := b.eos.ListDir(ctx, auth, folder, func(m *go_eosgrpc.MDResponse) {
-		if m.Type != go_eosgrpc.TYPE_FILE || !bytes.HasPrefix(m.Fmd.Name, []byte(".part.")) {
-			return
+		if n, ok := partNumber(m); ok {
+			uploaded[n] = m
 		}
-		total += m.Fmd.Size
-		count++
 	}, nil); err != nil {
+		return s3response.CompleteMultipartUploadResult{}, "", uploadError(err)
+	}
+	parts, total, err := completedParts(req.MultipartUpload, uploaded)
+	if err != nil {
 		return s3response.CompleteMultipartUploadResult{}, "", err
 	}
+	var md map[string]string
+	if b.cfg.UserMetadata {
+		info, err := b.eos.Stat(ctx, auth, folder)
+		if err != nil {
+			return s3response.CompleteMultipartUploadResult{}, "", uploadError(err)
+		}
+		if md, err = b.userMetadata(ctx, bucket.Name, meta.UploadMetadataKey(*req.UploadId), info); err != nil {
+			return s3response.CompleteMultipartUploadResult{}, "", err
+		}
+	}
+
+	release, err := b.memory.reserve(int64(total), 0)
+	if err != nil {
+		return s3response.CompleteMultipartUploadResult{}, "", err
+	}
+	defer release()
+	ctx = b.sched.route(ctx, int64(total))
+	done, err := b.sched.acquire(ctx, int64(total))
+	if err != nil {
+		return s3response.CompleteMultipartUploadResult{}, "", err
+	}
+	defer done()
 
-	// We assume that all the parts have been provided
 	var offset uint64
-	for p := range count {
-		part := filepath.Join(folder, fmt.Sprintf(".part.%05d", p+1))
+	for _, p := range parts {
+		part := filepath.Join(folder, string(p.Fmd.Name))
 
 		data, length, err := b.eos.Download(ctx, auth, part, nil)
 		if err != nil {
-			panic(err)
+			return s3response.CompleteMultipartUploadResult{}, "", uploadError(fmt.Errorf("error reading part %s: %w", part, err))
 		}
 
-		if err := b.eos.UploadChunk(ctx, auth, tmpFile, data, uint64(length), offset, total); err != nil {
-			panic(err)
+		err = b.eos.UploadChunk(ctx, auth, tmpFile, data, uint64(length), offset, total)
+		data.Close()
+		if err != nil {
+			return s3response.CompleteMultipartUploadResult{}, "", uploadError(fmt.Errorf("error writing part %s: %w", part, err))
 		}
 		offset += uint64(length)
 	}
 
-	dst := filepath.Join(bucket.Path, *req.Key)
 	dir := filepath.Dir(dst)
 	if err := b.eos.Mkdir(ctx, auth, dir, 0755); err != nil {
-		return s3response.CompleteMultipartUploadResult{}, "", fmt.Errorf("error creating dir %s: %w", dir, err)
+		return s3response.CompleteMultipartUploadResult{}, "", bucketError(fmt.Errorf("error creating dir %s: %w", dir, err))
 	}
 	if err := b.eos.Rename(ctx, auth, tmpFile, dst); err != nil {
-		return s3response.CompleteMultipartUploadResult{}, "", fmt.Errorf("error renaming %s to %s: %w", tmpFile, dst, err)
+		return s3response.CompleteMultipartUploadResult{}, "", uploadError(fmt.Errorf("error renaming %s to %s: %w", tmpFile, dst, err))
+	}
+	if b.cfg.UserMetadata {
+		if err := b.setUserMetadata(ctx, auth, bucket.Name, *req.Key, dst, md); err != nil {
+			return s3response.CompleteMultipartUploadResult{}, "", err
+		}
 	}
 
 	if err := b.eos.Remove(ctx, auth, folder, true); err != nil {
-		return s3response.CompleteMultipartUploadResult{}, "", err
+		return s3response.CompleteMultipartUploadResult{}, "", uploadError(err)
 	}
-	if err := b.meta.DeleteMultipartUpload(bucket.Name, *req.UploadId); err != nil {
+	if err := b.store(ctx).DeleteMultipartUpload(ctx, bucket.Name, *req.UploadId); err != nil {
 		return s3response.CompleteMultipartUploadResult{}, "", err
 	}
+	_ = b.store(ctx).DeleteObjectMetadata(ctx, bucket.Name, meta.UploadMetadataKey(*req.UploadId), "")
 
 	// get the etag, which is the MD5 of the part
 	res, err := b.eos.Stat(ctx, auth, dst)
 	if err != nil {
-		return s3response.CompleteMultipartUploadResult{}, "", err
+		return s3response.CompleteMultipartUploadResult{}, "", objectError(err)
 	}
 
+	e := newObjectEvent(ctx, bucket.Name, *req.Key, dst)
+	e.Size, e.ETag = int64(res.Fmd.Size), getMD5(res)
+	b.notify(ctx, func(h Hooks) { h.OnObjectCreated(ctx, e) })
+
 	return s3response.CompleteMultipartUploadResult{
 		Bucket: req.Bucket,
 		Key:    req.Key,
@@ -146,51 +209,59 @@ func (b *EosBackend) CompleteMultipartUpload(ctx context.Context, req *s3.Comple
 	}, "", nil
 }
 
-func (b *EosBackend) AbortMultipartUpload(ctx context.Context, req *s3.AbortMultipartUploadInput) error {
-	fmt.Println("AbortMultipartUpload")
+func (b *EosBackend) AbortMultipartUpload(ctx context.Context, req *s3.AbortMultipartUploadInput) (err error) {
+	ctx, op := b.startOperation(ctx, "AbortMultipartUpload", "bucket", aws.ToString(req.Bucket), "key", aws.ToString(req.Key), "upload_id", aws.ToString(req.UploadId))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		b.logOperation(ctx, "AbortMultipartUpload", aws.ToString(req.Bucket), aws.ToString(req.Key), 0, err)
+	}()
 	name := *req.Bucket
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return err
 	}
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return s3err.GetAPIError(s3err.ErrAccessDenied)
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	folder, err := multipartFolder(&bucket, *req.UploadId)
+	if err != nil {
+		return err
 	}
-
-	folder := multipartFolder(&bucket, *req.UploadId)
 	b.eos.Remove(ctx, auth, folder, true)
-	b.meta.DeleteMultipartUpload(bucket.Name, *req.UploadId)
+	b.store(ctx).DeleteMultipartUpload(ctx, bucket.Name, *req.UploadId)
+	_ = b.store(ctx).DeleteObjectMetadata(ctx, bucket.Name, meta.UploadMetadataKey(*req.UploadId), "")
 	return nil
 }
 
-func (b *EosBackend) ListParts(ctx context.Context, req *s3.ListPartsInput) (s3response.ListPartsResult, error) {
-	fmt.Println("ListParts")
+func (b *EosBackend) ListParts(ctx context.Context, req *s3.ListPartsInput) (_ s3response.ListPartsResult, err error) {
+	ctx, op := b.startOperation(ctx, "ListParts", "bucket", aws.ToString(req.Bucket), "upload_id", aws.ToString(req.UploadId))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.ListPartsResult{}, err
+	}
 	name := *req.Bucket
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return s3response.ListPartsResult{}, err
 	}
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return s3response.ListPartsResult{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return s3response.ListPartsResult{}, err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	folder, err := multipartFolder(&bucket, *req.UploadId)
+	if err != nil {
+		return s3response.ListPartsResult{}, err
 	}
-
-	folder := multipartFolder(&bucket, *req.UploadId)
 	var parts []s3response.Part
 	if err := b.eos.ListDir(ctx, auth, folder, func(m *go_eosgrpc.MDResponse) {
 		if m.Type != go_eosgrpc.TYPE_FILE || !bytes.HasPrefix(m.Fmd.Name, []byte(".part.")) {
@@ -205,12 +276,12 @@ func (b *EosBackend) ListParts(ctx context.Context, req *s3.ListPartsInput) (s3r
 		}
 		parts = append(parts, s3response.Part{
 			PartNumber:   int(partNumber),
-			LastModified: time.Unix(int64(m.Fmd.Mtime.Sec), int64(m.Fmd.Mtime.NSec)),
+			LastModified: mtime(m),
 			Size:         int64(m.Fmd.Size),
 			ETag:         getMD5(m),
 		})
 	}, nil); err != nil {
-		return s3response.ListPartsResult{}, err
+		return s3response.ListPartsResult{}, uploadError(err)
 	}
 
 	return s3response.ListPartsResult{
@@ -222,7 +293,23 @@ func (b *EosBackend) ListParts(ctx context.Context, req *s3.ListPartsInput) (s3r
 	}, nil
 }
 
+// md5Xattr is the extended attribute where the MD5
+// computed by the gateway at upload is stored.
+const md5Xattr = "user.s3.md5"
+
+// emptyMD5 is the MD5 of the empty content.
+const emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+
+// getMD5 returns the MD5 of the file: the one computed by the
+// gateway if stored, otherwise the checksum computed by EOS.
 func getMD5(r *go_eosgrpc.MDResponse) string {
+	if r.Type == go_eosgrpc.TYPE_CONTAINER {
+		// the folders are empty objects
+		return emptyMD5
+	}
+	if sum, ok := r.Fmd.Xattrs[md5Xattr]; ok {
+		return string(sum)
+	}
 	for _, xs := range r.Fmd.Checksums {
 		if xs.Type == "md5" {
 			return string(xs.Value)
@@ -231,36 +318,69 @@ func getMD5(r *go_eosgrpc.MDResponse) string {
 	return "<unknown>"
 }
 
-func (b *EosBackend) UploadPart(ctx context.Context, req *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
-	fmt.Println("UploadPart")
+func (b *EosBackend) UploadPart(ctx context.Context, req *s3.UploadPartInput) (_ *s3.UploadPartOutput, err error) {
+	ctx, op := b.startOperation(ctx, "UploadPart", "bucket", aws.ToString(req.Bucket), "upload_id", aws.ToString(req.UploadId), "part", aws.ToInt32(req.PartNumber))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return nil, err
+	}
+	defer func() {
+		b.logOperation(ctx, "UploadPart", aws.ToString(req.Bucket), aws.ToString(req.Key), aws.ToInt64(req.ContentLength), err)
+	}()
 	name := *req.Bucket
 
-	bucket, err := b.meta.GetBucket(name)
+	bucket, err := b.getBucket(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
-	acct, ok := getLoggedAccount(ctx)
-	if !ok {
-		return nil, s3err.GetAPIError(s3err.ErrAccessDenied)
+	auth, err := b.eosAuth(ctx, &bucket)
+	if err != nil {
+		return nil, err
 	}
 
-	auth := eos.Auth{
-		Uid: uint64(acct.UserID),
-		Gid: uint64(acct.GroupID),
+	folder, err := multipartFolder(&bucket, *req.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPartNumber(aws.ToInt32(req.PartNumber)); err != nil {
+		return nil, err
 	}
+	partFile := filepath.Join(folder, fmt.Sprintf(".part.%05d", *req.PartNumber))
 
-	// TODO: we should check if the upload id is correct
-	partFile := filepath.Join(multipartFolder(&bucket, *req.UploadId), fmt.Sprintf(".part.%05d", *req.PartNumber))
+	if req.ContentLength == nil {
+		return nil, s3err.GetAPIError(s3err.ErrMissingContentLength)
+	}
+	if err := checkPutSize(*req.ContentLength); err != nil {
+		return nil, err
+	}
+	release, err := b.memory.reserve(*req.ContentLength, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx = b.sched.route(ctx, *req.ContentLength)
+	done, err := b.sched.acquire(ctx, *req.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
 
-	if err := b.eos.Upload(ctx, auth, partFile, req.Body, uint64(*req.ContentLength)); err != nil {
+	t, err := b.limits.startTransfer(ctx)
+	if err != nil {
 		return nil, err
 	}
+	defer t.done()
+
+	if err := b.eos.Upload(ctx, auth, partFile, t.reader(req.Body), uint64(*req.ContentLength)); err != nil {
+		return nil, uploadError(err)
+	}
+	countUpload(*req.ContentLength)
 
 	// get the etag, which is the MD5 of the part
 	res, err := b.eos.Stat(ctx, auth, partFile)
 	if err != nil {
-		return nil, err
+		return nil, uploadError(err)
 	}
 
 	return &s3.UploadPartOutput{
@@ -268,11 +388,20 @@ func (b *EosBackend) UploadPart(ctx context.Context, req *s3.UploadPartInput) (*
 	}, err
 }
 
-func (b *EosBackend) ListMultipartUploads(ctx context.Context, req *s3.ListMultipartUploadsInput) (s3response.ListMultipartUploadsResult, error) {
-	fmt.Println("ListMultipartUploads")
+func (b *EosBackend) ListMultipartUploads(ctx context.Context, req *s3.ListMultipartUploadsInput) (_ s3response.ListMultipartUploadsResult, err error) {
+	ctx, op := b.startOperation(ctx, "ListMultipartUploads", "bucket", aws.ToString(req.Bucket))
+	defer func() { err = op.end(err) }()
+	if err = b.limits.admit(ctx); err != nil {
+		return s3response.ListMultipartUploadsResult{}, err
+	}
 	name := *req.Bucket
 
-	uploads, err := b.meta.ListMultipartUploads(name)
+	bucket, err := b.getBucket(ctx, name)
+	if err != nil {
+		return s3response.ListMultipartUploadsResult{}, err
+	}
+
+	uploads, err := b.store(ctx).ListMultipartUploads(ctx, bucket.Name)
 	if err != nil {
 		return s3response.ListMultipartUploadsResult{}, err
 	}
@@ -287,7 +416,7 @@ func (b *EosBackend) ListMultipartUploads(ctx context.Context, req *s3.ListMulti
 			Initiator: s3response.Initiator{
 				ID: strconv.FormatInt(int64(up.Initiator), 10),
 			},
-			Initiated: up.Initiated,
+			Initiated: s3Time(up.Initiated),
 		})
 	}
 	return res, nil
@@ -0,0 +1,155 @@
+package eoss3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/versity/versitygw/auth"
+)
+
+// OIDCConfig configures the oidc identity driver, resolving the
+// accounts through the identity provider of the site (e.g. Keycloak).
+// The secret key of the accounts is an access token issued by the
+// provider, as for the credentials derived from the site SSO.
+type OIDCConfig struct {
+	// IntrospectionURL is the token introspection endpoint (RFC 7662).
+	// If set, it is used in place of UserinfoURL.
+	IntrospectionURL string `mapstructure:"introspection_url"`
+	// ClientID and ClientSecret authenticate the gateway
+	// to the introspection endpoint.
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// UserinfoURL is the userinfo endpoint, called with the token.
+	UserinfoURL string `mapstructure:"userinfo_url"`
+	// UidClaim and GidClaim are the claims holding the uid and
+	// the gid. Default to uid and gid.
+	UidClaim string `mapstructure:"uid_claim"`
+	GidClaim string `mapstructure:"gid_claim"`
+	// UsernameClaim is the claim holding the name of the local
+	// user looked up through NSS when the uid claim is missing.
+	// Defaults to preferred_username.
+	UsernameClaim string `mapstructure:"username_claim"`
+}
+
+func (c OIDCConfig) withDefaults() OIDCConfig {
+	if c.UidClaim == "" {
+		c.UidClaim = "uid"
+	}
+	if c.GidClaim == "" {
+		c.GidClaim = "gid"
+	}
+	if c.UsernameClaim == "" {
+		c.UsernameClaim = "preferred_username"
+	}
+	return c
+}
+
+// oidcMapper resolves the accounts from the claims
+// of their token, returned by the identity provider.
+type oidcMapper struct {
+	cfg    OIDCConfig
+	client *http.Client
+}
+
+func newOIDCMapper(cfg OIDCConfig, client *http.Client) (*oidcMapper, error) {
+	endpoint := cfg.IntrospectionURL
+	if endpoint == "" {
+		endpoint = cfg.UserinfoURL
+	}
+	if endpoint == "" {
+		return nil, errors.New("missing introspection or userinfo url of the identity provider")
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("error parsing the url of the identity provider: %w", err)
+	}
+	return &oidcMapper{cfg: cfg.withDefaults(), client: client}, nil
+}
+
+func (m *oidcMapper) MapIdentity(ctx context.Context, acct auth.Account) (eos.Auth, error) {
+	claims, err := m.claims(ctx, acct.Secret)
+	if err != nil {
+		return eos.Auth{}, err
+	}
+
+	uid, ok := claimUint(claims, m.cfg.UidClaim)
+	if !ok {
+		name, _ := claims[m.cfg.UsernameClaim].(string)
+		if name == "" {
+			return eos.Auth{}, ErrNoSuchIdentity
+		}
+		return lookupUser(name)
+	}
+	gid, ok := claimUint(claims, m.cfg.GidClaim)
+	if !ok {
+		return eos.Auth{}, ErrNoSuchIdentity
+	}
+	return eos.Auth{Uid: uid, Gid: gid}, nil
+}
+
+// claims returns the claims of the token, from the introspection
+// endpoint if configured, otherwise from the userinfo one.
+// The inactive or rejected tokens have no identity.
+func (m *oidcMapper) claims(ctx context.Context, token string) (map[string]any, error) {
+	var req *http.Request
+	var err error
+	if m.cfg.IntrospectionURL != "" {
+		form := url.Values{"token": {token}}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.IntrospectionURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(m.cfg.ClientID, m.cfg.ClientSecret)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, m.cfg.UserinfoURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return nil, ErrNoSuchIdentity
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("got non OK status code from the identity provider: %d", res.StatusCode)
+	}
+
+	var claims map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("error decoding the claims: %w", err)
+	}
+	if active, ok := claims["active"].(bool); m.cfg.IntrospectionURL != "" && (!ok || !active) {
+		return nil, ErrNoSuchIdentity
+	}
+	return claims, nil
+}
+
+// claimUint returns the claim as an unsigned integer,
+// that can be encoded as a number or as a string.
+func claimUint(claims map[string]any, name string) (uint64, bool) {
+	switch v := claims[name].(type) {
+	case float64:
+		if v < 0 {
+			return 0, false
+		}
+		return uint64(v), true
+	case string:
+		n, err := strconv.ParseUint(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,36 @@
+package eoss3
+
+import (
+	"context"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/oplog"
+)
+
+// logOperation records in the operations log the outcome
+// of a mutating operation done by the logged user.
+func (b *EosBackend) logOperation(ctx context.Context, op, bucket, key string, bytes int64, err error) {
+	acct, _ := getLoggedAccount(ctx)
+	uid := acct.UserID
+	if id, err := b.mapper(ctx).MapIdentity(ctx, acct); err == nil {
+		uid = int(id.Uid)
+	}
+
+	result := "OK"
+	if err != nil {
+		result = errorCode(err)
+	}
+
+	b.oplog.Log(oplog.Record{
+		Time:      time.Now().UTC(),
+		RequestID: eos.RequestID(ctx),
+		AccessKey: acct.Access,
+		Uid:       uid,
+		Operation: op,
+		Bucket:    bucket,
+		Key:       key,
+		Bytes:     bytes,
+		Result:    result,
+	})
+}
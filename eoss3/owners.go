@@ -0,0 +1,119 @@
+package eoss3
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/versity/versitygw/s3err"
+)
+
+// OwnersConfig configures the resolution of the names of the
+// owners of the objects, returned in the listings along with
+// their uid.
+type OwnersConfig struct {
+	// Names maps the uids to the names of their owners. The other
+	// uids are resolved to the name of the local user, looked up
+	// through NSS, or left as they are if unknown.
+	Names map[string]string `mapstructure:"names"`
+	// CacheTTL is the time the names looked up through NSS are
+	// cached for. Defaults to 10m.
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+const defaultOwnersCacheTTL = 10 * time.Minute
+
+// ownerNames resolves the names of the owners by uid.
+type ownerNames struct {
+	static map[uint64]string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[uint64]cachedName
+}
+
+type cachedName struct {
+	name    string
+	expires time.Time
+}
+
+func newOwnerNames(cfg OwnersConfig) (*ownerNames, error) {
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultOwnersCacheTTL
+	}
+	static := make(map[uint64]string, len(cfg.Names))
+	for uid, name := range cfg.Names {
+		n, err := strconv.ParseUint(uid, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %q of the owner %s", uid, name)
+		}
+		static[n] = name
+	}
+	return &ownerNames{static: static, ttl: ttl, entries: make(map[uint64]cachedName)}, nil
+}
+
+// owner returns the owner with the uid, its ID being the
+// uid and its display name the name of the user if known.
+func (o *ownerNames) owner(uid uint64) *types.Owner {
+	id := strconv.FormatUint(uid, 10)
+	name := o.name(uid)
+	if name == "" {
+		name = id
+	}
+	return &types.Owner{ID: &id, DisplayName: &name}
+}
+
+// name returns the name of the user with the uid,
+// or an empty string if unknown.
+func (o *ownerNames) name(uid uint64) string {
+	if name, ok := o.static[uid]; ok {
+		return name
+	}
+	now := time.Now()
+	o.mu.Lock()
+	e, ok := o.entries[uid]
+	o.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.name
+	}
+
+	// the unknown users are cached too
+	var name string
+	if u, err := user.LookupId(strconv.FormatUint(uid, 10)); err == nil {
+		name = u.Username
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for k, e := range o.entries {
+		if now.After(e.expires) {
+			delete(o.entries, k)
+		}
+	}
+	o.entries[uid] = cachedName{name: name, expires: now.Add(o.ttl)}
+	return name
+}
+
+// getBucket returns the bucket of the operation from the meta store of
+// its tenant. The bucket must be owned by the expected owner of the
+// request, if any, given by its uid or its name as in the listings.
+func (b *EosBackend) getBucket(ctx context.Context, name string) (meta.Bucket, error) {
+	bucket, err := b.store(ctx).GetBucket(ctx, name)
+	if err != nil {
+		return meta.Bucket{}, err
+	}
+	expected := requestHeader(ctx, "X-Amz-Expected-Bucket-Owner")
+	if expected == "" {
+		return bucket, nil
+	}
+	if o := bucket.Owner; o != nil && (expected == strconv.FormatUint(o.Uid, 10) || expected == b.owners.name(o.Uid)) {
+		return bucket, nil
+	}
+	b.log.WarnContext(ctx, "bucket not owned by the expected owner", "bucket", name, "expected_owner", expected)
+	return meta.Bucket{}, s3err.GetAPIError(s3err.ErrAccessDenied)
+}
@@ -0,0 +1,66 @@
+package eoss3
+
+import (
+	"context"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/versity/versitygw/s3err"
+)
+
+// checkQuota returns ErrQuotaExceeded if writing size more bytes
+// in the bucket would exceed its quota.
+// The usage is taken from the EOS quota node of the bucket path,
+// if any, otherwise from the tree size of the bucket directory.
+// The limit on the number of objects is only enforced when
+// a quota node exists, as EOS does not track the number of
+// files of a directory tree.
+func (b *EosBackend) checkQuota(ctx context.Context, auth eos.Auth, bucket *meta.Bucket, size uint64) error {
+	q := bucket.Quota
+	if q == nil || (q.MaxBytes == 0 && q.MaxObjects == 0) {
+		return nil
+	}
+
+	usedBytes, usedObjects, ok := b.quotaNodeUsage(ctx, auth, bucket.Path)
+	if !ok {
+		info, err := b.eos.Stat(ctx, auth, bucket.Path)
+		if err != nil {
+			return bucketError(err)
+		}
+		if info.Type != erpc.TYPE_CONTAINER || info.Cmd == nil {
+			return s3err.GetAPIError(s3err.ErrInternalError)
+		}
+		usedBytes = uint64(info.Cmd.TreeSize)
+	}
+
+	if q.MaxBytes != 0 && usedBytes+size > q.MaxBytes {
+		return s3err.GetAPIError(s3err.ErrQuotaExceeded)
+	}
+	if ok && q.MaxObjects != 0 && usedObjects+1 > q.MaxObjects {
+		return s3err.GetAPIError(s3err.ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// quotaNodeUsage returns the usage of the quota node
+// rooted exactly at path, if existing.
+func (b *EosBackend) quotaNodeUsage(ctx context.Context, auth eos.Auth, path string) (bytes, files uint64, ok bool) {
+	nodes, err := b.eos.GetQuota(ctx, auth, path)
+	if err != nil {
+		return 0, 0, false
+	}
+	for _, n := range nodes {
+		if trimSlash(string(n.Path)) == trimSlash(path) {
+			return n.Usedlogicalbytes, n.Usedfiles, true
+		}
+	}
+	return 0, 0, false
+}
+
+func trimSlash(p string) string {
+	for len(p) > 1 && p[len(p)-1] == '/' {
+		p = p[:len(p)-1]
+	}
+	return p
+}
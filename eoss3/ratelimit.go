@@ -0,0 +1,208 @@
+package eoss3
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+
+	"github.com/versity/versitygw/s3err"
+	"golang.org/x/time/rate"
+)
+
+// LimitsConfig are the limits applied to the requests of a user.
+// A zero value means no limit.
+type LimitsConfig struct {
+	// Requests is the number of requests per second allowed.
+	Requests float64 `mapstructure:"requests"`
+	// Burst is the number of requests that can be made at once
+	// above the rate. Defaults to Requests, rounded up.
+	Burst int `mapstructure:"burst"`
+	// Transfers is the maximum number of concurrent uploads
+	// and downloads going through the gateway.
+	Transfers int `mapstructure:"transfers"`
+	// Bandwidth is the maximum number of bytes per second
+	// uploaded and downloaded through the gateway.
+	Bandwidth int64 `mapstructure:"bandwidth"`
+}
+
+// RateLimitConfig configures the limits applied to each user,
+// identified by its access key.
+type RateLimitConfig struct {
+	LimitsConfig `mapstructure:",squash"`
+	// Users replaces the limits of the given access keys.
+	Users map[string]LimitsConfig `mapstructure:"users"`
+}
+
+// errSlowDown is returned when a user exceeds its limits
+// or when the MGM is saturated.
+var errSlowDown = s3err.APIError{
+	Code:           "SlowDown",
+	Description:    "Please reduce your request rate.",
+	HTTPStatusCode: http.StatusServiceUnavailable,
+}
+
+// limiters holds the state of the limits of each user,
+// created at its first request.
+type limiters struct {
+	cfg RateLimitConfig
+
+	mu    sync.Mutex
+	users map[string]*userLimiter
+}
+
+type userLimiter struct {
+	requests  *rate.Limiter
+	transfers chan struct{}
+	bandwidth *rate.Limiter
+}
+
+func newLimiters(cfg RateLimitConfig) *limiters {
+	return &limiters{
+		cfg:   cfg,
+		users: make(map[string]*userLimiter),
+	}
+}
+
+func newUserLimiter(cfg LimitsConfig) *userLimiter {
+	var u userLimiter
+	if cfg.Requests > 0 {
+		burst := cfg.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(cfg.Requests))
+		}
+		u.requests = rate.NewLimiter(rate.Limit(cfg.Requests), burst)
+	}
+	if cfg.Transfers > 0 {
+		u.transfers = make(chan struct{}, cfg.Transfers)
+	}
+	if cfg.Bandwidth > 0 {
+		burst := max(cfg.Bandwidth, transferChunk)
+		u.bandwidth = rate.NewLimiter(rate.Limit(cfg.Bandwidth), int(burst))
+	}
+	return &u
+}
+
+// user returns the limiter of the logged user, or nil
+// if the requests are anonymous or the limits are disabled.
+func (l *limiters) user(ctx context.Context) *userLimiter {
+	if l == nil {
+		return nil
+	}
+	acct, ok := getLoggedAccount(ctx)
+	if !ok {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u, ok := l.users[acct.Access]
+	if !ok {
+		cfg, ok := l.cfg.Users[acct.Access]
+		if !ok {
+			cfg = l.cfg.LimitsConfig
+		}
+		u = newUserLimiter(cfg)
+		l.users[acct.Access] = u
+	}
+	return u
+}
+
+// admit returns errSlowDown if the logged user
+// exceeded its rate of requests.
+func (l *limiters) admit(ctx context.Context) error {
+	u := l.user(ctx)
+	if u == nil || u.requests == nil {
+		return nil
+	}
+	if !u.requests.Allow() {
+		return errSlowDown
+	}
+	return nil
+}
+
+// startTransfer takes a transfer slot of the logged user,
+// returning errSlowDown if all are in use.
+// The slot must be released calling done on the returned transfer.
+func (l *limiters) startTransfer(ctx context.Context) (*transfer, error) {
+	u := l.user(ctx)
+	if u == nil {
+		return nil, nil
+	}
+	if u.transfers != nil {
+		select {
+		case u.transfers <- struct{}{}:
+		default:
+			return nil, errSlowDown
+		}
+	}
+	return &transfer{ctx: ctx, u: u}, nil
+}
+
+// transfer is an upload or a download of a user
+// with limited concurrency and bandwidth.
+// A nil transfer has no limits.
+type transfer struct {
+	ctx  context.Context
+	u    *userLimiter
+	once sync.Once
+}
+
+// done releases the transfer slot.
+func (t *transfer) done() {
+	if t == nil || t.u.transfers == nil {
+		return
+	}
+	t.once.Do(func() { <-t.u.transfers })
+}
+
+// reader returns r limited to the bandwidth of the user.
+func (t *transfer) reader(r io.Reader) io.Reader {
+	if t == nil || t.u.bandwidth == nil {
+		return r
+	}
+	return &limitedReader{r: r, t: t}
+}
+
+// readCloser returns r limited to the bandwidth of the user,
+// releasing the transfer slot when closed.
+func (t *transfer) readCloser(r io.ReadCloser) io.ReadCloser {
+	if t == nil {
+		return r
+	}
+	return &transferReadCloser{Reader: t.reader(r), c: r, t: t}
+}
+
+type transferReadCloser struct {
+	io.Reader
+	c io.Closer
+	t *transfer
+}
+
+func (r *transferReadCloser) Close() error {
+	r.t.done()
+	return r.c.Close()
+}
+
+// transferChunk is the maximum number of bytes read at once
+// by a transfer with limited bandwidth.
+const transferChunk = 256 << 10
+
+type limitedReader struct {
+	r io.Reader
+	t *transfer
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > transferChunk {
+		p = p[:transferChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.t.u.bandwidth.WaitN(r.t.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
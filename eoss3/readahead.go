@@ -0,0 +1,132 @@
+package eoss3
+
+import (
+	"io"
+	"sync"
+)
+
+// ReadAheadConfig configures the read-ahead of the downloads:
+// the next chunks of an object are read from the FST while the
+// client consumes the current one, hiding the latency of the
+// links between distant sites.
+type ReadAheadConfig struct {
+	// Chunks is the number of chunks read ahead.
+	// If not set, the read-ahead is disabled.
+	Chunks int `mapstructure:"chunks"`
+	// ChunkSize is the size of a chunk in bytes. Defaults to 1 MiB.
+	ChunkSize int `mapstructure:"chunk_size"`
+}
+
+const defaultReadAheadChunkSize = 1 << 20
+
+// readAheader wraps the bodies of the downloads with a read-ahead.
+// A nil readAheader leaves them as they are.
+type readAheader struct {
+	chunks int
+	size   int
+	pool   sync.Pool
+}
+
+func newReadAheader(cfg ReadAheadConfig) *readAheader {
+	if cfg.Chunks <= 0 {
+		return nil
+	}
+	size := cfg.ChunkSize
+	if size <= 0 {
+		size = defaultReadAheadChunkSize
+	}
+	r := &readAheader{chunks: cfg.Chunks, size: size}
+	r.pool.New = func() any {
+		b := make([]byte, size)
+		return &b
+	}
+	return r
+}
+
+// enabled returns whether the download of size bytes is read ahead.
+// The objects fitting in a chunk are not.
+func (r *readAheader) enabled(size int64) bool {
+	return r != nil && (size < 0 || size > int64(r.size))
+}
+
+// memory returns the memory in bytes used by
+// the read-ahead of a download of size bytes.
+func (r *readAheader) memory(size int64) int64 {
+	if !r.enabled(size) {
+		return 0
+	}
+	return int64(r.chunks+1) * int64(r.size)
+}
+
+// wrap returns body, of size bytes, reading ahead of the consumer.
+func (r *readAheader) wrap(body io.ReadCloser, size int64) io.ReadCloser {
+	if !r.enabled(size) {
+		return body
+	}
+	ra := &readAhead{
+		src:    body,
+		pool:   &r.pool,
+		chunks: make(chan *chunk, r.chunks),
+		done:   make(chan struct{}),
+	}
+	go ra.fill()
+	return ra
+}
+
+type chunk struct {
+	buf *[]byte
+	n   int
+	err error
+}
+
+type readAhead struct {
+	src    io.ReadCloser
+	pool   *sync.Pool
+	chunks chan *chunk
+	done   chan struct{}
+	once   sync.Once
+
+	cur *chunk
+	off int
+}
+
+// fill reads the chunks from the source until its end,
+// an error, or the closing of the reader.
+func (r *readAhead) fill() {
+	for {
+		buf := r.pool.Get().(*[]byte)
+		n, err := io.ReadFull(r.src, *buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		select {
+		case r.chunks <- &chunk{buf: buf, n: n, err: err}:
+		case <-r.done:
+			r.pool.Put(buf)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *readAhead) Read(p []byte) (int, error) {
+	for r.cur == nil || r.off == r.cur.n {
+		if r.cur != nil {
+			if r.cur.err != nil {
+				return 0, r.cur.err
+			}
+			r.pool.Put(r.cur.buf)
+		}
+		r.cur, r.off = <-r.chunks, 0
+	}
+	n := copy(p, (*r.cur.buf)[r.off:r.cur.n])
+	r.off += n
+	return n, nil
+}
+
+func (r *readAhead) Close() error {
+	r.once.Do(func() { close(r.done) })
+	return r.src.Close()
+}
@@ -0,0 +1,112 @@
+package eoss3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+)
+
+// ImportConfig configures the job registering as buckets
+// the directories already existing on EOS.
+type ImportConfig struct {
+	// Root is the EOS directory scanned for buckets.
+	Root string `mapstructure:"root"`
+	// Pattern is a glob matched against the name of the directories
+	// under root. Only the matching ones are imported.
+	Pattern string `mapstructure:"pattern"`
+	// Interval is how often the root is scanned.
+	// If zero, the import is only done on demand.
+	Interval time.Duration `mapstructure:"interval"`
+	// Uid is the user id used to list the root.
+	Uid uint64 `mapstructure:"uid"`
+	// Gid is the group id used to list the root.
+	Gid uint64 `mapstructure:"gid"`
+}
+
+// ImportDirectories scans the configured root on EOS, registering as buckets
+// all the directories matching the pattern and not yet known. Each bucket is
+// assigned to the owner of the directory. It returns the imported buckets.
+func (b *EosBackend) ImportDirectories(ctx context.Context) ([]meta.Bucket, error) {
+	cfg := b.cfg.Import
+	if cfg == nil || cfg.Root == "" {
+		return nil, errors.New("import root not configured")
+	}
+
+	pattern := cfg.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid import pattern %q: %w", pattern, err)
+	}
+
+	ctx = meta.WithActor(ctx, "import")
+
+	var dirs []*erpc.ContainerMdProto
+	auth := eos.Auth{Uid: cfg.Uid, Gid: cfg.Gid}
+	if err := b.eos.ListDir(ctx, auth, cfg.Root, func(md *erpc.MDResponse) {
+		if md.Type != erpc.TYPE_CONTAINER || md.Cmd == nil {
+			return
+		}
+		dirs = append(dirs, md.Cmd)
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	var imported []meta.Bucket
+	for _, d := range dirs {
+		name := string(d.Name)
+		if ok, _ := path.Match(pattern, name); !ok || !meta.IsValidBucketName(name) {
+			continue
+		}
+		if _, err := b.meta.GetBucket(ctx, name); err == nil {
+			continue
+		}
+
+		bucket := meta.Bucket{
+			Name:      name,
+			Path:      string(d.Path),
+			CreatedAt: time.Unix(int64(d.Ctime.GetSec()), int64(d.Ctime.GetNSec())),
+			Owner:     &meta.Identity{Uid: d.Uid, Gid: d.Gid},
+		}
+		if err := b.meta.CreateBucket(ctx, bucket); err != nil {
+			if errors.Is(err, meta.ErrBucketAlreadyExisting) {
+				continue
+			}
+			return imported, err
+		}
+		if err := b.meta.AssignBucket(ctx, name, int(d.Uid)); err != nil {
+			_ = b.meta.DeleteBucket(ctx, name)
+			return imported, err
+		}
+		imported = append(imported, bucket)
+	}
+	return imported, nil
+}
+
+// runImportJob periodically imports the directories on EOS
+// until the context is cancelled.
+func (b *EosBackend) runImportJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if imported, err := b.ImportDirectories(ctx); err != nil {
+			b.log.ErrorContext(ctx, "error importing directories", "root", b.cfg.Import.Root, "error", err)
+		} else if len(imported) > 0 {
+			b.log.InfoContext(ctx, "imported buckets", "root", b.cfg.Import.Root, "count", len(imported))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
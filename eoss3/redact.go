@@ -0,0 +1,53 @@
+package eoss3
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are the keys of the attributes always redacted.
+var sensitiveKeys = []string{
+	"authkey", "auth_key", "authorization", "x-gateway-authorization",
+	"secret", "secret_key", "secretkey", "secret_access_key",
+	"password", "token",
+}
+
+// newRedactor returns the function replacing with a placeholder
+// the values of the attributes with a sensitive key, and any
+// occurrence of the secrets in the logged values.
+func newRedactor(keys, secrets []string) func([]string, slog.Attr) slog.Attr {
+	sensitive := make(map[string]struct{}, len(sensitiveKeys)+len(keys))
+	for _, k := range append(sensitiveKeys, keys...) {
+		sensitive[strings.ToLower(k)] = struct{}{}
+	}
+	var pairs []string
+	for _, s := range secrets {
+		if s != "" {
+			pairs = append(pairs, s, redacted)
+		}
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	return func(_ []string, a slog.Attr) slog.Attr {
+		if _, ok := sensitive[strings.ToLower(a.Key)]; ok {
+			return slog.String(a.Key, redacted)
+		}
+		if len(pairs) == 0 {
+			return a
+		}
+		switch a.Value.Kind() {
+		case slog.KindString:
+			if s := a.Value.String(); replacer.Replace(s) != s {
+				return slog.String(a.Key, replacer.Replace(s))
+			}
+		case slog.KindAny:
+			if s := fmt.Sprint(a.Value.Any()); replacer.Replace(s) != s {
+				return slog.String(a.Key, replacer.Replace(s))
+			}
+		}
+		return a
+	}
+}
@@ -0,0 +1,42 @@
+package eoss3
+
+import (
+	"context"
+	"net/http"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/versity/versitygw/s3err"
+)
+
+// RedirectGetConfig configures the redirection of the downloads
+// to the FSTs, removing the gateway from the data path.
+type RedirectGetConfig struct {
+	// MinSize is the size in bytes from which the downloads are
+	// redirected. The smaller objects are served by the gateway.
+	MinSize uint64 `mapstructure:"min_size"`
+}
+
+// redirectCode is the S3 error code of the redirections.
+const redirectCode = "TemporaryRedirect"
+
+func (b *EosBackend) shouldRedirect(info *erpc.MDResponse) bool {
+	return b.cfg.RedirectGet != nil && info.Fmd.Size >= b.cfg.RedirectGet.MinSize
+}
+
+// redirectDownload returns the error redirecting the client to the
+// FST serving path, through the signed URL returned by the MGM.
+func (b *EosBackend) redirectDownload(ctx context.Context, auth eos.Auth, path string) error {
+	url, err := b.eos.DownloadURL(ctx, auth, path)
+	if err != nil {
+		return objectError(err)
+	}
+	if !setResponseHeader(ctx, "Location", url) {
+		return s3err.GetAPIError(s3err.ErrInternalError)
+	}
+	return s3err.APIError{
+		Code:           redirectCode,
+		Description:    "Please re-send this request to the specified temporary endpoint.",
+		HTTPStatusCode: http.StatusTemporaryRedirect,
+	}
+}
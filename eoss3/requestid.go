@@ -0,0 +1,84 @@
+package eoss3
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/valyala/fasthttp"
+)
+
+// requestIDHeader is the response header carrying the request ID,
+// as returned by AWS S3.
+const requestIDHeader = "x-amz-request-id"
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return strings.ToUpper(hex.EncodeToString(b[:]))
+}
+
+// withRequestID assigns an ID to the request, unless it has one
+// already. The ID is returned to the client in the response headers,
+// both on success and on error, and forwarded to EOS.
+func withRequestID(ctx context.Context) (context.Context, string) {
+	if id := eos.RequestID(ctx); id != "" {
+		return ctx, id
+	}
+	id := newRequestID()
+	if rc, ok := ctx.(*fasthttp.RequestCtx); ok {
+		rc.Response.Header.Set(requestIDHeader, id)
+		ctx = context.WithValue(ctx, responseHeaderKey{}, &rc.Response.Header)
+		ctx = context.WithValue(ctx, requestHeaderKey{}, &rc.Request.Header)
+	}
+	return eos.WithRequestID(ctx, id), id
+}
+
+type responseHeaderKey struct{}
+
+// setResponseHeader sets a header of the HTTP response to the request
+// carried by ctx, returning false if ctx carries no HTTP request.
+func setResponseHeader(ctx context.Context, key, value string) bool {
+	h, ok := ctx.Value(responseHeaderKey{}).(*fasthttp.ResponseHeader)
+	if !ok {
+		return false
+	}
+	h.Set(key, value)
+	return true
+}
+
+type requestHeaderKey struct{}
+
+// requestHeader returns a header of the HTTP request carried by ctx,
+// or an empty string if missing or if ctx carries no HTTP request.
+func requestHeader(ctx context.Context, key string) string {
+	h, ok := ctx.Value(requestHeaderKey{}).(*fasthttp.RequestHeader)
+	if !ok {
+		return ""
+	}
+	return string(h.Peek(key))
+}
+
+// requestIDHandler adds to every record the ID of the request
+// the record has been logged for.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := eos.RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,142 @@
+package eoss3
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/valyala/fasthttp"
+	"github.com/versity/versitygw/auth"
+	"github.com/versity/versitygw/s3err"
+)
+
+// VOConfig defines the members of a virtual organization,
+// the buckets being restricted to the accounts of some of them.
+type VOConfig struct {
+	// AccessKeys are the access keys of the accounts of the VO.
+	AccessKeys []string `mapstructure:"access_keys"`
+	// Gids are the groups of the VO: the accounts whose identity
+	// has one of them, as primary or secondary group, are members.
+	Gids []uint64 `mapstructure:"gids"`
+}
+
+type clientIPKey struct{}
+
+// withClientIP records in ctx the address of the client of the
+// request rc. When the request comes from one of the proxies, it
+// is the address of the client the proxy forwarded the request for.
+func withClientIP(ctx context.Context, rc *fasthttp.RequestCtx, proxies []netip.Prefix) context.Context {
+	ip, ok := netip.AddrFromSlice(rc.RemoteIP())
+	if !ok {
+		return ctx
+	}
+	ip = ip.Unmap()
+	if containsAddr(proxies, ip) {
+		// X-Forwarded-For: client, proxy1, proxy2
+		fwd := strings.Split(string(rc.Request.Header.Peek("X-Forwarded-For")), ",")
+		for i := len(fwd) - 1; i >= 0; i-- {
+			a, err := netip.ParseAddr(strings.TrimSpace(fwd[i]))
+			if err != nil {
+				break
+			}
+			ip = a.Unmap()
+			if !containsAddr(proxies, ip) {
+				break
+			}
+		}
+	}
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func clientIP(ctx context.Context) (netip.Addr, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(netip.Addr)
+	return ip, ok
+}
+
+// parsePrefixes parses a list of CIDRs, or single addresses.
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			a, err := netip.ParseAddr(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", c)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", c)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, ip netip.Addr) bool {
+	return slices.ContainsFunc(prefixes, func(p netip.Prefix) bool { return p.Contains(ip) })
+}
+
+// allowedNetwork tells if the client of the request is in the
+// networks. The requests without a known client are allowed
+// only if there are no networks.
+func allowedNetwork(ctx context.Context, cidrs []string) (bool, error) {
+	if len(cidrs) == 0 {
+		return true, nil
+	}
+	prefixes, err := parsePrefixes(cidrs)
+	if err != nil {
+		return false, err
+	}
+	ip, ok := clientIP(ctx)
+	return ok && containsAddr(prefixes, ip), nil
+}
+
+// checkRestrictions denies the requests on the bucket from the
+// clients outside of its networks, the writes from the ones outside
+// of its write networks, and the ones of the accounts not member of
+// its VOs. id is the identity of the account, if mapped.
+func (b *EosBackend) checkRestrictions(ctx context.Context, bucket *meta.Bucket, acct auth.Account, id *eos.Auth) error {
+	ok, err := allowedNetwork(ctx, bucket.Networks)
+	if err == nil && ok && !readOnlyOperation(ctx) {
+		ok, err = allowedNetwork(ctx, bucket.WriteNetworks)
+	}
+	if err != nil {
+		b.log.ErrorContext(ctx, "invalid network restriction of the bucket", "bucket", bucket.Name, "error", err)
+		return s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+	if !ok {
+		ip, _ := clientIP(ctx)
+		b.log.InfoContext(ctx, "client not allowed on the bucket", "bucket", bucket.Name, "client", ip.String())
+		return s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+
+	if len(bucket.VOs) > 0 && !slices.ContainsFunc(bucket.VOs, func(vo string) bool { return b.memberOf(vo, acct, id) }) {
+		b.log.InfoContext(ctx, "account not in the vos of the bucket", "bucket", bucket.Name, "access_key", acct.Access)
+		return s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+	return nil
+}
+
+// memberOf tells if the account, with the identity id if
+// mapped, is a member of the virtual organization vo.
+func (b *EosBackend) memberOf(vo string, acct auth.Account, id *eos.Auth) bool {
+	cfg, ok := b.cfg.VOs[vo]
+	if !ok {
+		return false
+	}
+	if slices.Contains(cfg.AccessKeys, acct.Access) {
+		return true
+	}
+	if id == nil {
+		return false
+	}
+	return slices.ContainsFunc(cfg.Gids, func(gid uint64) bool {
+		return gid == id.Gid || slices.Contains(id.Groups, gid)
+	})
+}
@@ -0,0 +1,122 @@
+package eoss3
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RotateConfig configures the rotation of the log file.
+type RotateConfig struct {
+	// MaxSize is the size in megabytes above which
+	// the file is rotated. If not set, the size is unlimited.
+	MaxSize int64 `mapstructure:"max_size"`
+	// Interval is the age above which the file is rotated,
+	// e.g. 24h. If not set, the age is unlimited.
+	Interval time.Duration `mapstructure:"interval"`
+	// MaxBackups is the number of rotated files kept.
+	// If not set, all of them are kept.
+	MaxBackups int `mapstructure:"max_backups"`
+}
+
+// rotatingFile is a log file rotated by size and by age.
+// The rotated files are renamed appending the rotation time.
+type rotatingFile struct {
+	path string
+	cfg  RotateConfig
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, cfg RotateConfig) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, cfg: cfg}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.shouldRotate(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) shouldRotate(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.cfg.MaxSize > 0 && r.size+int64(n) > r.cfg.MaxSize<<20 {
+		return true
+	}
+	return r.cfg.Interval > 0 && time.Since(r.opened) >= r.cfg.Interval
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	backup := r.path + "." + time.Now().Format("20060102T150405.000")
+	if err := os.Rename(r.path, backup); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// prune removes the oldest rotated files exceeding MaxBackups.
+func (r *rotatingFile) prune() error {
+	if r.cfg.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+	if len(backups) <= r.cfg.MaxBackups {
+		return nil
+	}
+	// the rotation time in the name sorts them from the oldest
+	slices.Sort(backups)
+	for _, b := range backups[:len(backups)-r.cfg.MaxBackups] {
+		if err := os.Remove(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -0,0 +1,114 @@
+package eoss3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+)
+
+// SchedulingConfig segregates the large transfers from the small
+// ones, so that the bulk uploads and downloads cannot take all the
+// resources of the gateway, and of its connections to the FSTs,
+// from the interactive requests.
+type SchedulingConfig struct {
+	// LargeSize is the size in bytes from which a transfer is large.
+	// Defaults to 16 MiB.
+	LargeSize int64 `mapstructure:"large_size"`
+	// LargeTransfers is the maximum number of concurrent large
+	// transfers. If not set, they are not limited.
+	LargeTransfers int `mapstructure:"large_transfers"`
+	// SmallTransfers is the maximum number of concurrent small
+	// transfers. If not set, they are not limited.
+	SmallTransfers int `mapstructure:"small_transfers"`
+	// QueueTimeout is the maximum time a transfer waits for
+	// a free slot before being rejected with SlowDown.
+	// Defaults to 10s.
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"`
+	// SeparateClients makes the large transfers use their own
+	// connections to the FSTs, not shared with the small ones.
+	SeparateClients bool `mapstructure:"separate_clients"`
+}
+
+const (
+	defaultLargeTransferSize = 16 << 20
+	defaultSchedulingTimeout = 10 * time.Second
+)
+
+// scheduler bounds the concurrent transfers, with a pool of slots
+// for the large ones and another for the small ones.
+// A nil scheduler does not limit them.
+type scheduler struct {
+	largeSize  int64
+	largeSlots chan struct{} // nil if not limited
+	smallSlots chan struct{} // nil if not limited
+	timeout    time.Duration
+	separate   bool
+}
+
+func newScheduler(cfg SchedulingConfig) *scheduler {
+	if cfg.LargeTransfers <= 0 && cfg.SmallTransfers <= 0 && !cfg.SeparateClients {
+		return nil
+	}
+	s := &scheduler{
+		largeSize: cfg.LargeSize,
+		timeout:   cfg.QueueTimeout,
+		separate:  cfg.SeparateClients,
+	}
+	if s.largeSize <= 0 {
+		s.largeSize = defaultLargeTransferSize
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultSchedulingTimeout
+	}
+	if cfg.LargeTransfers > 0 {
+		s.largeSlots = make(chan struct{}, cfg.LargeTransfers)
+	}
+	if cfg.SmallTransfers > 0 {
+		s.smallSlots = make(chan struct{}, cfg.SmallTransfers)
+	}
+	return s
+}
+
+// large returns whether a transfer of size bytes is large.
+// The transfers of unknown size are not.
+func (s *scheduler) large(size int64) bool {
+	return s != nil && size >= s.largeSize
+}
+
+// route returns the context sending a transfer of size bytes
+// on the connections reserved to the large ones, if configured.
+func (s *scheduler) route(ctx context.Context, size int64) context.Context {
+	if s.large(size) && s.separate {
+		return eos.WithLargeTransfer(ctx)
+	}
+	return ctx
+}
+
+// acquire waits for a slot for a transfer of size bytes, returning
+// errSlowDown if none frees up in time. The slot must be given back
+// calling the returned function.
+func (s *scheduler) acquire(ctx context.Context, size int64) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	slots := s.smallSlots
+	if s.large(size) {
+		slots = s.largeSlots
+	}
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return sync.OnceFunc(func() { <-slots }), nil
+	case <-timer.C:
+		return nil, errSlowDown
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,109 @@
+package eoss3
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/versity/versitygw/s3err"
+)
+
+// The size limits of the objects and of the parts of S3.
+const (
+	// maxPutSize is the maximum size of an object
+	// uploaded at once, and of a part.
+	maxPutSize = 5 << 30
+	// minPartSize is the minimum size of the parts
+	// of a multipart upload, except the last one.
+	minPartSize = 5 << 20
+	// maxParts is the maximum number of parts of a multipart upload.
+	maxParts = 10000
+	// maxObjectSize is the maximum size of an object.
+	maxObjectSize = 5 << 40
+)
+
+// checkPutSize checks the size of an object or a part uploaded at once.
+func checkPutSize(length int64) error {
+	if length > maxPutSize {
+		return s3err.GetAPIError(s3err.ErrEntityTooLarge)
+	}
+	return nil
+}
+
+// checkPartNumber checks the number of a part of a multipart upload.
+func checkPartNumber(n int32) error {
+	if n < 1 || n > maxParts {
+		return s3err.GetAPIError(s3err.ErrInvalidPartNumber)
+	}
+	return nil
+}
+
+// partNumber returns the number of the part file
+// of a multipart upload, false if it is not one.
+func partNumber(md *erpc.MDResponse) (int32, bool) {
+	if md.Type != erpc.TYPE_FILE || md.Fmd == nil || !bytes.HasPrefix(md.Fmd.Name, []byte(".part.")) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(bytes.TrimPrefix(md.Fmd.Name, []byte(".part."))), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(n), true
+}
+
+// completedParts returns the part files of the parts completing the
+// upload, in order, and the size of the object. The parts must be
+// listed in ascending order and have been uploaded, with the listed
+// ETag if any. All but the last one must be at least of minPartSize.
+// Without a list, all the parts uploaded complete the upload.
+func completedParts(list *types.CompletedMultipartUpload, uploaded map[int32]*erpc.MDResponse) ([]*erpc.MDResponse, uint64, error) {
+	var numbers []int32
+	if list != nil && len(list.Parts) > 0 {
+		if len(list.Parts) > maxParts {
+			return nil, 0, s3err.GetAPIError(s3err.ErrInvalidPart)
+		}
+		for i, p := range list.Parts {
+			n := aws.ToInt32(p.PartNumber)
+			if err := checkPartNumber(n); err != nil {
+				return nil, 0, err
+			}
+			if i > 0 && n <= numbers[i-1] {
+				return nil, 0, s3err.GetAPIError(s3err.ErrInvalidPartOrder)
+			}
+			md, ok := uploaded[n]
+			if !ok {
+				return nil, 0, s3err.GetAPIError(s3err.ErrInvalidPart)
+			}
+			etag := strings.Trim(aws.ToString(p.ETag), `"`)
+			if sum := getMD5(md); etag != "" && sum != "<unknown>" && etag != sum {
+				return nil, 0, s3err.GetAPIError(s3err.ErrInvalidPart)
+			}
+			numbers = append(numbers, n)
+		}
+	} else {
+		for n := int32(1); n <= maxParts; n++ {
+			if _, ok := uploaded[n]; !ok {
+				break
+			}
+			numbers = append(numbers, n)
+		}
+	}
+
+	parts := make([]*erpc.MDResponse, 0, len(numbers))
+	var total uint64
+	for i, n := range numbers {
+		md := uploaded[n]
+		if i < len(numbers)-1 && md.Fmd.Size < minPartSize {
+			return nil, 0, s3err.GetAPIError(s3err.ErrEntityTooSmall)
+		}
+		total += md.Fmd.Size
+		parts = append(parts, md)
+	}
+	if total > maxObjectSize {
+		return nil, 0, s3err.GetAPIError(s3err.ErrEntityTooLarge)
+	}
+	return parts, total, nil
+}
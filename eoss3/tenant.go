@@ -0,0 +1,199 @@
+package eoss3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/versity/versitygw/s3err"
+)
+
+// TenantConfig configures a tenant of the gateway, e.g. an experiment
+// or a department, with its own buckets and identities, isolated from
+// the other tenants.
+type TenantConfig struct {
+	// Name identifies the tenant in the logs.
+	Name string `mapstructure:"name"`
+	// AccessKeys are the access keys of the accounts of the tenant.
+	AccessKeys []string `mapstructure:"access_keys"`
+	// BucketPrefix selects the tenant for the requests on the buckets
+	// named with it, made by the accounts not in any tenant.
+	BucketPrefix string `mapstructure:"bucket_prefix"`
+	// Root is the EOS directory the buckets of the tenant are in.
+	// The operations on the buckets outside of it are denied.
+	Root string `mapstructure:"root"`
+	// DefaultBucketPath is the template of the path where the buckets
+	// of the tenant are created for the users without a default path
+	// set. Defaults to the one of the gateway.
+	DefaultBucketPath string `mapstructure:"default_bucket_path"`
+	// Buckets configures the meta store of the tenant, in the
+	// same form as the one of the gateway.
+	Buckets map[string]any `mapstructure:"buckets"`
+	// Identity configures the mapping of the accounts of the
+	// tenant. If not set, the one of the gateway is used.
+	// The guard of the gateway applies to all the tenants.
+	Identity *IdentityConfig `mapstructure:"identity"`
+}
+
+// tenant is a tenant of the gateway. The requests
+// outside of any tenant are served by the gateway ones.
+type tenant struct {
+	name              string
+	root              string
+	defaultBucketPath string
+	meta              meta.BucketStorer
+	identities        IdentityMapper
+}
+
+// tenants selects the tenant of the requests.
+type tenants struct {
+	all      []*tenant
+	byAccess map[string]*tenant
+	// byPrefix is sorted from the longest prefix
+	byPrefix []*tenantPrefix
+}
+
+type tenantPrefix struct {
+	prefix string
+	t      *tenant
+}
+
+// newTenants builds the tenants of the config, wrapping
+// their meta stores with wrap.
+func newTenants(cfgs []TenantConfig, wrap func(meta.BucketStorer) meta.BucketStorer) (*tenants, error) {
+	ts := &tenants{byAccess: make(map[string]*tenant)}
+	for _, c := range cfgs {
+		if c.Name == "" {
+			return nil, errors.New("missing name of a tenant")
+		}
+		if len(c.AccessKeys) == 0 && c.BucketPrefix == "" {
+			return nil, fmt.Errorf("tenant %s: access_keys or bucket_prefix required", c.Name)
+		}
+		store, err := meta.New(c.Buckets)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: error creating the meta store: %w", c.Name, err)
+		}
+		t := &tenant{
+			name:              c.Name,
+			defaultBucketPath: c.DefaultBucketPath,
+			meta:              wrap(store),
+		}
+		if c.Root != "" {
+			t.root = filepath.Clean(c.Root)
+		}
+		if c.Identity != nil {
+			if t.identities, err = NewIdentityMapper(*c.Identity); err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", c.Name, err)
+			}
+		}
+
+		ts.all = append(ts.all, t)
+		for _, k := range c.AccessKeys {
+			if other, ok := ts.byAccess[k]; ok {
+				return nil, fmt.Errorf("access key %s in the tenants %s and %s", k, other.name, c.Name)
+			}
+			ts.byAccess[k] = t
+		}
+		if c.BucketPrefix != "" {
+			ts.byPrefix = append(ts.byPrefix, &tenantPrefix{prefix: c.BucketPrefix, t: t})
+		}
+	}
+	sort.SliceStable(ts.byPrefix, func(i, j int) bool {
+		return len(ts.byPrefix[i].prefix) > len(ts.byPrefix[j].prefix)
+	})
+	return ts, nil
+}
+
+// selectTenant returns the tenant of the account with the access key,
+// otherwise the one of the bucket, nil for the gateway one.
+func (ts *tenants) selectTenant(access, bucket string) *tenant {
+	if ts == nil {
+		return nil
+	}
+	if t, ok := ts.byAccess[access]; ok {
+		return t
+	}
+	if bucket == "" {
+		return nil
+	}
+	for _, p := range ts.byPrefix {
+		if strings.HasPrefix(bucket, p.prefix) {
+			return p.t
+		}
+	}
+	return nil
+}
+
+// byName returns the tenant named name, if any.
+func (ts *tenants) byName(name string) *tenant {
+	if ts == nil {
+		return nil
+	}
+	for _, t := range ts.all {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+// withTenant selects the tenant of the operation, from the logged
+// account and the bucket in its logged args, if any.
+func (b *EosBackend) withTenant(ctx context.Context, args []any) context.Context {
+	if b.tenants == nil {
+		return ctx
+	}
+	var bucket string
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "bucket" {
+			bucket, _ = args[i+1].(string)
+		}
+	}
+	acct, _ := getLoggedAccount(ctx)
+	t := b.tenants.selectTenant(acct.Access, bucket)
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+func tenantFrom(ctx context.Context) *tenant {
+	t, _ := ctx.Value(tenantKey{}).(*tenant)
+	return t
+}
+
+// store returns the meta store of the tenant of the operation.
+func (b *EosBackend) store(ctx context.Context) meta.BucketStorer {
+	if t := tenantFrom(ctx); t != nil {
+		return t.meta
+	}
+	return b.meta
+}
+
+// mapper returns the identity mapper of the tenant of the operation.
+func (b *EosBackend) mapper(ctx context.Context) IdentityMapper {
+	if t := tenantFrom(ctx); t != nil && t.identities != nil {
+		return t.identities
+	}
+	return b.identities
+}
+
+// checkTenantRoot denies the operations of a tenant
+// on the buckets outside of its root.
+func (b *EosBackend) checkTenantRoot(ctx context.Context, path string) error {
+	t := tenantFrom(ctx)
+	if t == nil || t.root == "" {
+		return nil
+	}
+	if p := filepath.Clean(path); p != t.root && !strings.HasPrefix(p, t.root+"/") {
+		b.log.WarnContext(ctx, "bucket outside of the root of the tenant", "tenant", t.name, "path", path)
+		return s3err.GetAPIError(s3err.ErrAccessDenied)
+	}
+	return nil
+}
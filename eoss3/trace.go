@@ -0,0 +1,136 @@
+package eoss3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/gmgigi96/eoss3/eoss3"
+
+// TracingConfig configures the export of the traces.
+type TracingConfig struct {
+	// Endpoint is the address of the OTLP gRPC collector, e.g. localhost:4317.
+	// If not set, tracing is disabled.
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure disables the transport security with the collector.
+	Insecure bool `mapstructure:"insecure"`
+	// ServiceName is the name of the service in the traces. Defaults to eoss3.
+	ServiceName string `mapstructure:"service_name"`
+	// SampleRatio is the fraction of the traces recorded, between 0 and 1.
+	// Defaults to 1.
+	SampleRatio *float64 `mapstructure:"sample_ratio"`
+}
+
+// newTracerProvider returns the tracer provider exporting the
+// spans as configured in cfg, and the function flushing and
+// stopping it.
+func newTracerProvider(cfg TracingConfig) (trace.TracerProvider, func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exp, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = "eoss3"
+	}
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(name))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	return tp, tp.Shutdown, nil
+}
+
+// operation is an S3 operation being served.
+type operation struct {
+	trace.Span
+	ctx  context.Context
+	name string
+	b    *EosBackend
+}
+
+type operationKey struct{}
+
+// readOnlyOperation tells if the S3 operation served
+// with ctx only reads (e.g. GetObject, ListObjects).
+func readOnlyOperation(ctx context.Context) bool {
+	op, _ := ctx.Value(operationKey{}).(string)
+	return strings.HasPrefix(op, "Get") || strings.HasPrefix(op, "Head") || strings.HasPrefix(op, "List")
+}
+
+// startOperation assigns an ID to the request, logs at debug level
+// the S3 operation op and starts its span. args are the key-value
+// pairs logged, recorded also as attributes of the span.
+// The operation must be ended with its outcome.
+func (b *EosBackend) startOperation(ctx context.Context, op string, args ...any) (context.Context, *operation) {
+	rc, isRequest := ctx.(*fasthttp.RequestCtx)
+	ctx, id := withRequestID(ctx)
+	if isRequest {
+		ctx = withClientIP(ctx, rc, b.proxies)
+	}
+	ctx = context.WithValue(ctx, operationKey{}, op)
+	ctx = b.withTenant(ctx, args)
+	b.log.DebugContext(ctx, op, args...)
+
+	attrs := make([]attribute.KeyValue, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		key := "s3." + fmt.Sprint(args[i])
+		switch v := args[i+1].(type) {
+		case string:
+			attrs = append(attrs, attribute.String(key, v))
+		case bool:
+			attrs = append(attrs, attribute.Bool(key, v))
+		case int:
+			attrs = append(attrs, attribute.Int(key, v))
+		case int32:
+			attrs = append(attrs, attribute.Int(key, int(v)))
+		case int64:
+			attrs = append(attrs, attribute.Int64(key, v))
+		default:
+			attrs = append(attrs, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	attrs = append(attrs, attribute.String("s3.request_id", id))
+	ctx, span := b.tracer.Start(ctx, "s3."+op, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	return ctx, &operation{Span: span, ctx: ctx, name: op, b: b}
+}
+
+// end ends the operation, recording its error if any,
+// and returns the error to send to the client.
+// The redirections and the answers to the conditional
+// requests on objects not modified are not errors.
+func (o *operation) end(err error) error {
+	err = s3Error(err)
+	if code := errorCode(err); err != nil && code != redirectCode && code != notModifiedCode {
+		o.RecordError(err)
+		o.SetStatus(codes.Error, code)
+		o.b.countError(o.ctx, o.name, code)
+	}
+	o.End()
+	return err
+}
@@ -0,0 +1,136 @@
+package eoss3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+)
+
+// The user metadata of the objects, the x-amz-meta-* headers, is
+// stored in the extended attributes of their file, one per entry,
+// unless it exceeds the limits of the xattrs: it is then stored in
+// the meta store, the file being marked with metaStoreXattr.
+const (
+	// userMetaXattrPrefix prefixes the xattrs of the entries.
+	userMetaXattrPrefix = "user.s3.meta."
+	// metaStoreXattr marks the files whose user
+	// metadata is stored in the meta store.
+	metaStoreXattr = "user.s3.metastore"
+	// maxUserMetaXattrs is the maximum number of
+	// entries of the metadata stored as xattrs.
+	maxUserMetaXattrs = 16
+	// maxUserMetaXattrSize is the maximum size of the name
+	// and the value of an entry of the metadata stored as xattr.
+	maxUserMetaXattrSize = 1024
+)
+
+// userMetaXattrName returns the name of the xattr storing the entry
+// of the user metadata with the name k, case insensitive as the HTTP
+// headers. The characters other than the lowercase letters, digits,
+// - and _ are escaped as %XX, keeping the names of the xattrs to the
+// characters safe for EOS and its CLI, and the mapping reversible.
+func userMetaXattrName(k string) string {
+	var sb strings.Builder
+	sb.WriteString(userMetaXattrPrefix)
+	for _, c := range []byte(strings.ToLower(k)) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// userMetaName returns the name of the entry of the user metadata
+// stored in the xattr name, false if it does not store one.
+func userMetaName(name string) (string, bool) {
+	k, ok := strings.CutPrefix(name, userMetaXattrPrefix)
+	if !ok {
+		return "", false
+	}
+	k, err := url.PathUnescape(k)
+	if err != nil {
+		return "", false
+	}
+	return k, true
+}
+
+// userMetaXattrs returns the xattrs storing the user metadata,
+// false if it exceeds the limits of the xattrs.
+func userMetaXattrs(md map[string]string) (map[string]string, bool) {
+	if len(md) > maxUserMetaXattrs {
+		return nil, false
+	}
+	set := make(map[string]string, len(md))
+	for k, v := range md {
+		name := userMetaXattrName(k)
+		if len(name)+len(v) > maxUserMetaXattrSize {
+			return nil, false
+		}
+		set[name] = v
+	}
+	return set, true
+}
+
+// storeUserMetadata returns the xattrs to set on the file, or on the
+// staging folder, of the object with the key to store its user
+// metadata, stored in the meta store if it exceeds the limits of the
+// xattrs. The metadata stored there for the key is dropped otherwise.
+func (b *EosBackend) storeUserMetadata(ctx context.Context, bucket, key string, md map[string]string) (map[string]string, error) {
+	if set, ok := userMetaXattrs(md); ok {
+		_ = b.store(ctx).DeleteObjectMetadata(ctx, bucket, key, "")
+		return set, nil
+	}
+	if err := b.store(ctx).StoreObjectMetadata(ctx, meta.ObjectMetadata{Bucket: bucket, Key: key, UserMetadata: md}); err != nil {
+		return nil, err
+	}
+	return map[string]string{metaStoreXattr: "1"}, nil
+}
+
+// setUserMetadata stores the user metadata of the object with the key,
+// or of the upload staged in the folder with the key, at path. Without
+// metadata, the one stored in the meta store for the key is dropped.
+func (b *EosBackend) setUserMetadata(ctx context.Context, auth eos.Auth, bucket, key, path string, md map[string]string) error {
+	if len(md) == 0 {
+		_ = b.store(ctx).DeleteObjectMetadata(ctx, bucket, key, "")
+		return nil
+	}
+	set, err := b.storeUserMetadata(ctx, bucket, key, md)
+	if err != nil {
+		return err
+	}
+	return objectError(b.eos.SetXattrs(ctx, auth, path, set, nil))
+}
+
+// userMetadata returns the user metadata of the object with the key,
+// or of the upload staged in the folder with the key, from its info.
+func (b *EosBackend) userMetadata(ctx context.Context, bucket, key string, info *erpc.MDResponse) (map[string]string, error) {
+	xattrs := info.GetFmd().GetXattrs()
+	if info.Type == erpc.TYPE_CONTAINER {
+		xattrs = info.GetCmd().GetXattrs()
+	}
+	if _, ok := xattrs[metaStoreXattr]; ok {
+		md, err := b.store(ctx).GetObjectMetadata(ctx, bucket, key, "")
+		if errors.Is(err, meta.ErrNoSuchObjectMetadata) {
+			return nil, nil
+		}
+		return md.UserMetadata, err
+	}
+	var md map[string]string
+	for k, v := range xattrs {
+		if name, ok := userMetaName(k); ok {
+			if md == nil {
+				md = make(map[string]string)
+			}
+			md[name] = string(v)
+		}
+	}
+	return md, nil
+}
@@ -0,0 +1,413 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/eoss3"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+	"github.com/versity/versitygw/auth"
+)
+
+const (
+	// aclXattr holds the ACL of a directory on EOS.
+	aclXattr = "sys.acl"
+	// managedACLXattr holds the entries of the ACL materialized
+	// from the S3 grants, replaced at every sync, so that the
+	// entries set by other means are kept.
+	managedACLXattr = "sys.eoss3.acl"
+)
+
+var syncACLCmd = &cobra.Command{
+	Use:   "sync-acl [<bucket>...]",
+	Short: "Materialize the grants of the buckets as EOS ACLs on their directories. Without buckets, all are synced",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		ctx := cmd.Context()
+		var list []meta.Bucket
+		if len(args) == 0 {
+			if list, err = buckets.ListBuckets(ctx); err != nil {
+				return err
+			}
+		}
+		for _, name := range args {
+			b, err := buckets.GetBucket(ctx, strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			list = append(list, b)
+		}
+
+		changes := []applyChange{}
+		for _, b := range list {
+			entries, err := syncBucketACL(ctx, cfg, buckets, client, b, globalFlags.DryRun)
+			if err != nil {
+				_ = printChanges(changes)
+				return fmt.Errorf("error syncing the acl of %s: %w", b.Name, err)
+			}
+			changes = append(changes, applyChange{Action: "sync-acl", Bucket: b.Name, Detail: strings.Join(entries, ",")})
+		}
+		return printChanges(changes)
+	},
+}
+
+// syncBucketACL replaces the entries of the ACL of the bucket directory
+// materialized by the previous sync with the ones of its current grants,
+// returned. Without a policy, the grants are the assignments of the bucket.
+func syncBucketACL(ctx context.Context, cfg *Config, buckets meta.BucketStorer, client *eos.Client, b meta.Bucket, dryRun bool) ([]string, error) {
+	var entries []string
+	if len(b.Policy) > 0 {
+		principals, err := newPrincipalResolver(cfg, buckets)
+		if err != nil {
+			return nil, err
+		}
+		var warnings []string
+		entries, warnings, err = policyACL(ctx, b.Name, b.Policy, principals)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: bucket %s: %s\n", b.Name, w)
+		}
+	} else {
+		uids, err := buckets.ListUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, uid := range uids {
+			if buckets.IsAssigned(ctx, b.Name, uid) {
+				entries = append(entries, fmt.Sprintf("u:%d:rwx", uid))
+			}
+		}
+	}
+	if dryRun {
+		return entries, nil
+	}
+
+	// sys.* attributes can only be changed by root
+	root := eos.Auth{Uid: 0, Gid: 0}
+	md, err := client.Stat(ctx, root, b.Path)
+	if err != nil {
+		return nil, err
+	}
+	var current, managed []string
+	if md.Cmd != nil {
+		current = splitACL(string(md.Cmd.Xattrs[aclXattr]))
+		managed = splitACL(string(md.Cmd.Xattrs[managedACLXattr]))
+	}
+
+	acl := slices.DeleteFunc(current, func(e string) bool { return slices.Contains(managed, e) })
+	acl = append(acl, entries...)
+	set := map[string]string{
+		aclXattr:        strings.Join(acl, ","),
+		managedACLXattr: strings.Join(entries, ","),
+	}
+	if err := client.SetXattrs(ctx, root, b.Path, set, nil); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func splitACL(s string) []string {
+	var entries []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// policyStatement is a statement of a bucket policy. The principals,
+// actions and resources can be a string or a list of strings.
+type policyStatement struct {
+	Effect       string `json:"Effect"`
+	Principal    any    `json:"Principal"`
+	NotPrincipal any    `json:"NotPrincipal"`
+	Action       any    `json:"Action"`
+	NotAction    any    `json:"NotAction"`
+	Resource     any    `json:"Resource"`
+	NotResource  any    `json:"NotResource"`
+	Condition    any    `json:"Condition"`
+}
+
+// policyACL translates the statements of the policy of the bucket
+// granting access to the whole bucket into EOS ACL entries. The
+// statements that cannot be expressed, like the conditional ones,
+// the ones restricted to a prefix or granting the accounts without
+// an identity on EOS, are skipped with a warning. The ACL cannot
+// restrict the access it grants, so the policies with a denial
+// overlapping a grant are refused.
+func policyACL(ctx context.Context, bucket string, policy json.RawMessage, resolver *principalResolver) ([]string, []string, error) {
+	var doc struct {
+		Statement []policyStatement `json:"Statement"`
+	}
+	if err := json.Unmarshal(policy, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	var warnings []string
+	perms := make(map[string]*aclPerm)
+	var principals []string
+	for i, s := range doc.Statement {
+		if s.Effect != "Allow" {
+			continue
+		}
+		if s.Condition != nil {
+			warnings = append(warnings, fmt.Sprintf("statement %d skipped: conditions cannot be expressed as EOS ACL", i))
+			continue
+		}
+		if !wholeBucket(bucket, stringList(s.Resource)) {
+			warnings = append(warnings, fmt.Sprintf("statement %d skipped: not granting the whole bucket", i))
+			continue
+		}
+		var p aclPerm
+		for _, a := range stringList(s.Action) {
+			p.add(a)
+		}
+		if p == (aclPerm{}) {
+			warnings = append(warnings, fmt.Sprintf("statement %d skipped: no action granting data access", i))
+			continue
+		}
+		who, unknown := resolver.principals(ctx, s.Principal)
+		for _, name := range unknown {
+			warnings = append(warnings, fmt.Sprintf("statement %d: %s skipped: no identity on EOS", i, name))
+		}
+		for _, w := range who {
+			if _, ok := perms[w]; !ok {
+				perms[w] = &aclPerm{}
+				principals = append(principals, w)
+			}
+			perms[w].merge(p)
+		}
+	}
+
+	for i, s := range doc.Statement {
+		if s.Effect != "Deny" || !concernsBucket(bucket, s) {
+			continue
+		}
+		var d aclPerm
+		if s.NotAction != nil {
+			d.add("*")
+		}
+		for _, a := range stringList(s.Action) {
+			d.add(a)
+		}
+		denied := []string{"z"}
+		if s.NotPrincipal == nil {
+			var unknown []string
+			denied, unknown = resolver.principals(ctx, s.Principal)
+			// the unknown accounts are among the ones granted to anyone
+			if len(unknown) > 0 {
+				denied = append(denied, "")
+			}
+		}
+		for _, w := range principals {
+			if !d.overlaps(*perms[w]) {
+				continue
+			}
+			if slices.ContainsFunc(denied, func(p string) bool { return p == "z" || w == "z" || p == w }) {
+				return nil, nil, fmt.Errorf("statement %d denies the access granted to %s, which cannot be expressed as EOS ACL", i, w)
+			}
+		}
+	}
+
+	entries := make([]string, 0, len(principals))
+	for _, w := range principals {
+		entries = append(entries, w+":"+perms[w].String())
+	}
+	return entries, warnings, nil
+}
+
+// aclPerm is the access granted by the actions of a statement.
+type aclPerm struct {
+	read, write, delete bool
+}
+
+func (p *aclPerm) add(action string) {
+	a := strings.ToLower(action)
+	switch {
+	case a == "*" || a == "s3:*":
+		p.read, p.write, p.delete = true, true, true
+	case strings.HasPrefix(a, "s3:get"), strings.HasPrefix(a, "s3:list"), strings.HasPrefix(a, "s3:head"):
+		p.read = true
+	case strings.HasPrefix(a, "s3:delete"):
+		p.write, p.delete = true, true
+	case strings.HasPrefix(a, "s3:put"), strings.HasSuffix(a, "multipartupload"):
+		p.write = true
+	}
+}
+
+func (p aclPerm) overlaps(o aclPerm) bool {
+	return (p.read && o.read) || (p.write && o.write) || (p.delete && o.delete)
+}
+
+func (p *aclPerm) merge(o aclPerm) {
+	p.read = p.read || o.read
+	p.write = p.write || o.write
+	p.delete = p.delete || o.delete
+}
+
+// String returns the permission in the EOS ACL syntax. The
+// directories need x to be traversed, and w grants deletion
+// unless !d is set.
+func (p aclPerm) String() string {
+	var s string
+	if p.read {
+		s += "r"
+	}
+	if p.write {
+		s += "w"
+	}
+	s += "x"
+	if p.write && !p.delete {
+		s += "!d"
+	}
+	return s
+}
+
+// principalResolver resolves the accounts of the principals of the
+// policies to the EOS users, through the identity mapper of the
+// gateway. The uid and gid of the accounts, used by the account
+// driver, are the ones of their credential in the meta store.
+type principalResolver struct {
+	mapper eoss3.IdentityMapper
+	creds  meta.CredentialStorer
+}
+
+func newPrincipalResolver(cfg *Config, buckets meta.BucketStorer) (*principalResolver, error) {
+	mapper, err := eoss3.NewIdentityMapper(cfg.Identity)
+	if err != nil {
+		return nil, err
+	}
+	creds, _ := buckets.(meta.CredentialStorer)
+	return &principalResolver{mapper: mapper, creds: creds}, nil
+}
+
+// principals returns the ACL principals of the principal of a
+// statement, z for anyone and u:<uid> for the users, and the
+// accounts without an identity on EOS.
+func (r *principalResolver) principals(ctx context.Context, principal any) ([]string, []string) {
+	if s, ok := principal.(string); ok && s == "*" {
+		return []string{"z"}, nil
+	}
+	m, ok := principal.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	var out, unknown []string
+	for _, p := range stringList(m["AWS"]) {
+		if p == "*" {
+			out = append(out, "z")
+			continue
+		}
+		// arn:aws:iam::<account>:user/<access key>
+		name := p[strings.LastIndexByte(p, '/')+1:]
+		if name == "" {
+			continue
+		}
+		if uid, ok := r.uid(ctx, name); ok {
+			out = append(out, fmt.Sprintf("u:%d", uid))
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return out, unknown
+}
+
+// uid returns the uid the account with the access key operates on
+// EOS as, false if it has none. The root identity is never granted,
+// being the one of the unknown accounts with the account driver.
+func (r *principalResolver) uid(ctx context.Context, access string) (uint64, bool) {
+	acct := auth.Account{Access: access}
+	if r.creds != nil {
+		if c, err := r.creds.GetCredential(ctx, access); err == nil {
+			acct.UserID, acct.GroupID = int(c.Uid), int(c.Gid)
+		}
+	}
+	id, err := r.mapper.MapIdentity(ctx, acct)
+	if err != nil || id.Uid == 0 {
+		return 0, false
+	}
+	return id.Uid, true
+}
+
+// wholeBucket tells if the resources include all the objects of the bucket.
+func wholeBucket(bucket string, resources []string) bool {
+	return slices.ContainsFunc(resources, func(r string) bool {
+		return r == "*" || r == "arn:aws:s3:::*" || r == "arn:aws:s3:::"+bucket+"/*"
+	})
+}
+
+// concernsBucket tells if the resources of the statement may include
+// objects of the bucket, the wildcards in the bucket names included.
+func concernsBucket(bucket string, s policyStatement) bool {
+	if s.NotResource != nil {
+		return true
+	}
+	return slices.ContainsFunc(stringList(s.Resource), func(r string) bool {
+		if r == "*" {
+			return true
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(r, "arn:aws:s3:::"), "/")
+		return name == bucket || strings.ContainsAny(name, "*?")
+	})
+}
+
+// stringList returns v, a string or a list of strings, as a list.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// syncACLIfEnabled syncs the ACL of the bucket when sync_acl is set.
+func syncACLIfEnabled(ctx context.Context, cfg *Config, buckets meta.BucketStorer, name string) error {
+	if !cfg.SyncACL || globalFlags.DryRun {
+		return nil
+	}
+	b, err := buckets.GetBucket(ctx, name)
+	if err != nil {
+		return err
+	}
+	client, err := newEOSClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if _, err := syncBucketACL(ctx, cfg, buckets, client, b, false); err != nil {
+		return fmt.Errorf("error syncing the acl of %s: %w", name, err)
+	}
+	return nil
+}
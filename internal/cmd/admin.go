@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const defaultAdminRegion = "us-east-1"
+
+// adminAccount is the account managed through the admin API of the gateway.
+type adminAccount struct {
+	XMLName xml.Name `xml:"Account"`
+	Access  string   `xml:"Access"`
+	Secret  string   `xml:"Secret"`
+	Role    string   `xml:"Role"`
+	UserID  int      `xml:"UserID"`
+	GroupID int      `xml:"GroupID"`
+}
+
+// adminClient calls the admin API of the gateway,
+// authenticating as the root account.
+type adminClient struct {
+	endpoint string
+	access   string
+	secret   string
+	region   string
+	client   *http.Client
+}
+
+func newAdminClient(cfg *Config) (*adminClient, error) {
+	if cfg.Endpoint == "" || cfg.RootAccess == "" || cfg.RootSecret == "" {
+		return nil, errors.New("endpoint, root_access and root_secret are required to manage the gateway accounts")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = defaultAdminRegion
+	}
+	return &adminClient{
+		endpoint: strings.TrimRight(cfg.Endpoint, "/"),
+		access:   cfg.RootAccess,
+		secret:   cfg.RootSecret,
+		region:   region,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (c *adminClient) createUser(ctx context.Context, acc adminAccount) error {
+	body, err := xml.Marshal(acc)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "/create-user", body)
+}
+
+func (c *adminClient) deleteUser(ctx context.Context, access string) error {
+	return c.do(ctx, "/delete-user?access="+url.QueryEscape(access), nil)
+}
+
+func (c *adminClient) do(ctx context.Context, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	creds := aws.Credentials{AccessKeyID: c.access, SecretAccessKey: c.secret}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, payload, "s3", c.region, time.Now()); err != nil {
+		return fmt.Errorf("error signing the request: %w", err)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		msg, _ := io.ReadAll(res.Body)
+		var apiErr struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(msg, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("%s: %s", apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("admin api returned %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var applyFlags = struct {
+	File  string // Manifest with the desired buckets
+	Prune bool   // Unregister the buckets not in the manifest
+}{}
+
+// manifest is the declarative list of the buckets.
+type manifest struct {
+	Buckets []manifestBucket `json:"buckets"`
+}
+
+type manifestBucket struct {
+	Name    string          `json:"name"`
+	Path    string          `json:"path"`
+	Owner   string          `json:"owner"`
+	RunAs   string          `json:"run_as,omitempty"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Quota   *manifestQuota  `json:"quota,omitempty"`
+	Policy  json.RawMessage `json:"policy,omitempty"`
+}
+
+type manifestQuota struct {
+	Bytes   string `json:"bytes,omitempty"`
+	Objects string `json:"objects,omitempty"`
+}
+
+// applyChange is a change done (or to be done) by apply.
+type applyChange struct {
+	Action string `json:"action"`
+	Bucket string `json:"bucket"`
+	Detail string `json:"detail,omitempty"`
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Reconcile the meta store with a manifest of buckets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := readManifest(applyFlags.File)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		ctx := cmd.Context()
+		changes := []applyChange{}
+		record := func(action, bucket, detail string) {
+			changes = append(changes, applyChange{Action: action, Bucket: bucket, Detail: detail})
+		}
+
+		desired := make(map[string]struct{}, len(m.Buckets))
+		for _, mb := range m.Buckets {
+			desired[mb.Name] = struct{}{}
+			if err := applyBucket(ctx, buckets, client, mb, globalFlags.DryRun, record); err != nil {
+				_ = printChanges(changes)
+				return fmt.Errorf("error applying bucket %s: %w", mb.Name, err)
+			}
+			if cfg.SyncACL && !globalFlags.DryRun {
+				b, err := buckets.GetBucket(ctx, mb.Name)
+				if err == nil {
+					_, err = syncBucketACL(ctx, cfg, buckets, client, b, false)
+				}
+				if err != nil {
+					_ = printChanges(changes)
+					return fmt.Errorf("error syncing the acl of %s: %w", mb.Name, err)
+				}
+			}
+		}
+
+		if applyFlags.Prune {
+			existing, err := buckets.ListBuckets(ctx)
+			if err != nil {
+				return err
+			}
+			for _, b := range existing {
+				if _, ok := desired[b.Name]; ok {
+					continue
+				}
+				record("delete", b.Name, "unregistered, data on EOS is kept")
+				if globalFlags.DryRun {
+					continue
+				}
+				if err := unregisterBucket(ctx, buckets, b); err != nil {
+					_ = printChanges(changes)
+					return fmt.Errorf("error deleting bucket %s: %w", b.Name, err)
+				}
+			}
+		}
+
+		return printChanges(changes)
+	},
+}
+
+func printChanges(changes []applyChange) error {
+	return printOutput(changes, outputTable, func(w io.Writer) {
+		prefix := ""
+		if globalFlags.DryRun {
+			prefix = "(dry run) "
+		}
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s%s\t%s\t%s\n", prefix, c.Action, c.Bucket, c.Detail)
+		}
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "Nothing to do")
+		}
+	})
+}
+
+func readManifest(file string) (*manifest, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	seen := make(map[string]struct{}, len(m.Buckets))
+	for _, b := range m.Buckets {
+		if b.Name == "" || b.Path == "" || b.Owner == "" {
+			return nil, errors.New("invalid manifest: name, path and owner are required for every bucket")
+		}
+		if !meta.IsValidBucketName(b.Name) {
+			return nil, fmt.Errorf("invalid manifest: %q is not a valid bucket name", b.Name)
+		}
+		for _, a := range b.Aliases {
+			if !meta.IsValidBucketName(a) {
+				return nil, fmt.Errorf("invalid manifest: alias %q of bucket %s is not a valid bucket name", a, b.Name)
+			}
+		}
+		if _, ok := seen[b.Name]; ok {
+			return nil, fmt.Errorf("invalid manifest: bucket %s defined twice", b.Name)
+		}
+		seen[b.Name] = struct{}{}
+	}
+	return &m, nil
+}
+
+// applyBucket creates or updates the bucket to match the manifest.
+func applyBucket(ctx context.Context, buckets meta.BucketStorer, client *eos.Client, mb manifestBucket, dryRun bool, record func(action, bucket, detail string)) error {
+	owner, err := lookupIdentity(mb.Owner)
+	if err != nil {
+		return err
+	}
+
+	var runAs *meta.Identity
+	if mb.RunAs != "" {
+		if runAs, err = lookupIdentity(mb.RunAs); err != nil {
+			return err
+		}
+	}
+
+	var quota *meta.Quota
+	if mb.Quota != nil {
+		quota = &meta.Quota{}
+		if mb.Quota.Bytes != "" {
+			if quota.MaxBytes, err = parseSize(mb.Quota.Bytes, 1024); err != nil {
+				return fmt.Errorf("invalid quota bytes: %w", err)
+			}
+		}
+		if mb.Quota.Objects != "" {
+			if quota.MaxObjects, err = parseSize(mb.Quota.Objects, 1000); err != nil {
+				return fmt.Errorf("invalid quota objects: %w", err)
+			}
+		}
+		if quota.MaxBytes == 0 && quota.MaxObjects == 0 {
+			quota = nil
+		}
+	}
+
+	var policy json.RawMessage
+	if len(mb.Policy) > 0 {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, mb.Policy); err != nil {
+			return fmt.Errorf("invalid policy: %w", err)
+		}
+		policy = buf.Bytes()
+	}
+
+	b, err := buckets.GetBucket(ctx, mb.Name)
+	switch {
+	case errors.Is(err, meta.ErrNoSuchBucket):
+		record("create", mb.Name, mb.Path)
+		if !dryRun {
+			b = meta.Bucket{
+				Name:      mb.Name,
+				Path:      mb.Path,
+				CreatedAt: time.Now(),
+				Owner:     owner,
+				RunAs:     runAs,
+				Quota:     quota,
+				Policy:    policy,
+			}
+			if err := createBucket(ctx, buckets, client, b); err != nil {
+				return err
+			}
+		}
+	case err != nil:
+		return err
+	case b.Name != mb.Name:
+		return fmt.Errorf("%s is an alias of bucket %s", mb.Name, b.Name)
+	default:
+		var diffs []string
+		if b.Path != mb.Path {
+			diffs = append(diffs, fmt.Sprintf("path %s -> %s", b.Path, mb.Path))
+		}
+		if !equalIdentity(b.Owner, owner) {
+			diffs = append(diffs, fmt.Sprintf("owner %s -> %s", formatIdentity(b.Owner), formatIdentity(owner)))
+		}
+		if !equalIdentity(b.RunAs, runAs) {
+			diffs = append(diffs, fmt.Sprintf("run_as %s -> %s", formatIdentity(b.RunAs), formatIdentity(runAs)))
+		}
+		if !equalQuota(b.Quota, quota) {
+			diffs = append(diffs, "quota")
+		}
+		if !bytes.Equal(compactJSON(b.Policy), policy) {
+			diffs = append(diffs, "policy")
+		}
+
+		if len(diffs) > 0 {
+			record("update", mb.Name, strings.Join(diffs, ", "))
+			if !dryRun {
+				oldOwner := b.Owner
+				b.Path, b.Owner, b.RunAs, b.Quota, b.Policy = mb.Path, owner, runAs, quota, policy
+				if _, err := buckets.UpdateBucket(ctx, b); err != nil {
+					return err
+				}
+				if oldOwner == nil || oldOwner.Uid != owner.Uid {
+					if oldOwner != nil {
+						if err := buckets.UnassignBucket(ctx, b.Name, int(oldOwner.Uid)); err != nil {
+							return err
+						}
+					}
+					if err := buckets.AssignBucket(ctx, b.Name, int(owner.Uid)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// aliases
+	for _, a := range mb.Aliases {
+		if slices.Contains(b.Aliases, a) {
+			continue
+		}
+		record("add-alias", mb.Name, a)
+		if !dryRun {
+			if err := buckets.AddAlias(ctx, mb.Name, a); err != nil {
+				return err
+			}
+		}
+	}
+	for _, a := range b.Aliases {
+		if slices.Contains(mb.Aliases, a) {
+			continue
+		}
+		record("remove-alias", mb.Name, a)
+		if !dryRun {
+			if err := buckets.RemoveAlias(ctx, a); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createBucket registers the bucket, assigning it to the owner,
+// and creates its directory on EOS.
+func createBucket(ctx context.Context, buckets meta.BucketStorer, client *eos.Client, b meta.Bucket) error {
+	if err := buckets.CreateBucket(ctx, b); err != nil {
+		return err
+	}
+
+	uid := int(b.Owner.Uid)
+	if err := buckets.AssignBucket(ctx, b.Name, uid); err != nil {
+		_ = buckets.DeleteBucket(ctx, b.Name)
+		return err
+	}
+
+	auth := eos.Auth{Uid: b.Owner.Uid, Gid: b.Owner.Gid}
+	if b.RunAs != nil {
+		auth = eos.Auth{Uid: b.RunAs.Uid, Gid: b.RunAs.Gid}
+	}
+	if err := client.Mkdir(ctx, auth, b.Path, 0755); err != nil {
+		_ = buckets.UnassignBucket(ctx, b.Name, uid)
+		_ = buckets.DeleteBucket(ctx, b.Name)
+		return err
+	}
+	return nil
+}
+
+// unregisterBucket removes the bucket from the meta store,
+// together with its assignments and aliases.
+func unregisterBucket(ctx context.Context, buckets meta.BucketStorer, b meta.Bucket) error {
+	uids, err := buckets.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		if buckets.IsAssigned(ctx, b.Name, uid) {
+			if err := buckets.UnassignBucket(ctx, b.Name, uid); err != nil {
+				return err
+			}
+		}
+	}
+	for _, a := range b.Aliases {
+		if err := buckets.RemoveAlias(ctx, a); err != nil && !errors.Is(err, meta.ErrNoSuchAlias) {
+			return err
+		}
+	}
+	return buckets.DeleteBucket(ctx, b.Name)
+}
+
+func equalIdentity(a, b *meta.Identity) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalQuota(a, b *meta.Quota) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func compactJSON(data json.RawMessage) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var backupFlags = struct {
+	Output string // File where the backup is written, - for stdout
+}{}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Write a backup of the meta store",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		if backupFlags.Output == "-" {
+			return meta.Export(cmd.Context(), buckets, os.Stdout)
+		}
+
+		// write on a temporary file first, to not leave
+		// a truncated backup in case of errors
+		tmp := backupFlags.Output + ".tmp"
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if err := meta.Export(cmd.Context(), buckets, f); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return os.Rename(tmp, backupFlags.Output)
+	},
+}
+
+var restoreFlags = struct {
+	Input string // File containing the backup, - for stdin
+	Merge bool   // Skip the buckets already existing
+}{}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a backup of the meta store",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		var r io.Reader = os.Stdin
+		if restoreFlags.Input != "-" {
+			f, err := os.Open(restoreFlags.Input)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		return meta.Import(cmd.Context(), buckets, r, meta.ImportOptions{
+			Merge: restoreFlags.Merge,
+			Skipped: func(name string) {
+				fmt.Fprintf(os.Stderr, "Skipping existing bucket %s\n", name)
+			},
+		})
+	},
+}
@@ -0,0 +1,460 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/eoss3"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+	"github.com/versity/versitygw/auth"
+	"github.com/versity/versitygw/s3err"
+	"github.com/versity/versitygw/s3response"
+)
+
+var benchFlags = struct {
+	Path        string        // EOS directory where the objects are written
+	Duration    time.Duration // Duration of the run
+	Concurrency int           // Number of concurrent clients
+	Size        string        // Size of the objects
+	Objects     int           // Number of distinct objects
+	Mix         string        // Weights of the operations
+	Keep        bool          // Keep the objects at the end
+	Backend     bool          // Drive the gateway backend instead of the EOS client
+	FakeEOS     bool          // Run against an in-memory fake of EOS
+}{}
+
+// benchOps are the operations driven by the benchmark.
+var benchOps = []string{"put", "get", "list", "delete"}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Drive a mix of PUT, GET, LIST and DELETE against EOS or the gateway backend, reporting latencies and throughput",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		weights, err := parseBenchMix(benchFlags.Mix)
+		if err != nil {
+			return err
+		}
+		size, err := parseSize(benchFlags.Size, 1024)
+		if err != nil {
+			return fmt.Errorf("invalid size %q: %w", benchFlags.Size, err)
+		}
+		if benchFlags.Objects < 1 {
+			return errors.New("at least an object is needed")
+		}
+
+		ctx := cmd.Context()
+		auth, err := eosAuth()
+		if err != nil {
+			return err
+		}
+		var client eoss3.EosClient
+		if benchFlags.FakeEOS {
+			client = eos.NewFakeClient()
+		} else {
+			cfg, err := getConfig()
+			if err != nil {
+				return err
+			}
+			c, err := newEOSClient(cfg)
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+			client = c
+		}
+
+		var target benchTarget = &eosBenchTarget{
+			client: client,
+			auth:   auth,
+			dir:    filepath.Join(benchFlags.Path, ".eoss3-bench"),
+		}
+		if benchFlags.Backend {
+			if target, err = newBackendBenchTarget(client, auth, filepath.Join(benchFlags.Path, ".eoss3-bench")); err != nil {
+				return err
+			}
+		}
+
+		b := &bench{
+			target:  target,
+			content: bytes.Repeat([]byte("eoss3"), int(size/5)+1)[:size],
+			objects: benchFlags.Objects,
+			present: make([]atomic.Bool, benchFlags.Objects),
+			weights: weights,
+			stats:   make(map[string]*benchStats),
+		}
+		for _, op := range benchOps {
+			b.stats[op] = &benchStats{}
+		}
+
+		if err := target.setup(ctx); err != nil {
+			return err
+		}
+		defer target.close(context.WithoutCancel(ctx), !benchFlags.Keep)
+		// The objects are written once before the run,
+		// so that the reads do not depend on the writes.
+		for i := range b.objects {
+			if err := b.put(ctx, i); err != nil {
+				return fmt.Errorf("error preparing the objects: %w", err)
+			}
+		}
+
+		start := time.Now()
+		b.run(ctx, benchFlags.Concurrency, benchFlags.Duration)
+		results := b.results(time.Since(start))
+
+		return printOutput(results, outputTable, func(w io.Writer) {
+			fmt.Fprintln(w, "OP\tCOUNT\tERRORS\tOPS/S\tMB/S\tP50\tP90\tP99\tMAX")
+			for _, r := range results {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%.1f\t%s\t%s\t%s\t%s\n", r.Op, r.Count, r.Errors, r.OpsPerSec, r.MBPerSec,
+					r.P50, r.P90, r.P99, r.Max)
+			}
+		})
+	},
+}
+
+// parseBenchMix parses the weights of the operations,
+// in the form put=40,get=40,list=10,delete=10.
+func parseBenchMix(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+	var total int
+	for _, part := range strings.Split(s, ",") {
+		op, w, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || !slices.Contains(benchOps, op) {
+			return nil, fmt.Errorf("invalid mix %q: expected op=weight with op one of %s", part, strings.Join(benchOps, ", "))
+		}
+		n, err := strconv.Atoi(w)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid weight of %s: %q", op, w)
+		}
+		weights[op] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, errors.New("invalid mix: all the weights are zero")
+	}
+	return weights, nil
+}
+
+// bench is a run of the benchmark on the objects of target.
+type bench struct {
+	target  benchTarget
+	content []byte
+	objects int
+	// present tells the objects existing, that is not deleted
+	// by an operation and not yet written again.
+	present []atomic.Bool
+	weights map[string]int
+
+	stats map[string]*benchStats
+}
+
+// benchStats are the outcomes of an operation.
+type benchStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	bytes     int64
+}
+
+func (s *benchStats) record(d time.Duration, n int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.latencies = append(s.latencies, d)
+	s.bytes += n
+}
+
+func (b *bench) key(i int) string {
+	return fmt.Sprintf("obj-%06d", i)
+}
+
+// pick returns an operation at random, following the weights.
+func (b *bench) pick() string {
+	var total int
+	for _, w := range b.weights {
+		total += w
+	}
+	n := rand.IntN(total)
+	for _, op := range benchOps {
+		if n < b.weights[op] {
+			return op
+		}
+		n -= b.weights[op]
+	}
+	return benchOps[0]
+}
+
+// run drives the operations from concurrency clients for d.
+func (b *bench) run(ctx context.Context, concurrency int, d time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for range max(concurrency, 1) {
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				op, i := b.pick(), rand.IntN(b.objects)
+				if op == "delete" && !b.present[i].CompareAndSwap(true, false) {
+					// already deleted
+					continue
+				}
+				start := time.Now()
+				n, err := b.do(ctx, op, i)
+				if ctx.Err() != nil {
+					// interrupted by the end of the run
+					return
+				}
+				b.stats[op].record(time.Since(start), n, err)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// do runs op on the object i, returning the bytes transferred.
+// The get of a missing object, deleted by a previous
+// operation, is not an error.
+func (b *bench) do(ctx context.Context, op string, i int) (int64, error) {
+	switch op {
+	case "put":
+		return int64(len(b.content)), b.put(ctx, i)
+	case "get":
+		return b.target.get(ctx, b.key(i))
+	case "list":
+		return 0, b.target.list(ctx)
+	case "delete":
+		return 0, b.target.delete(ctx, b.key(i))
+	}
+	return 0, fmt.Errorf("unknown operation %s", op)
+}
+
+func (b *bench) put(ctx context.Context, i int) error {
+	err := b.target.put(ctx, b.key(i), b.content)
+	if err == nil {
+		b.present[i].Store(true)
+	}
+	return err
+}
+
+// benchTarget runs the operations of the benchmark on the objects.
+type benchTarget interface {
+	// setup prepares the target before the objects are written.
+	setup(ctx context.Context) error
+	put(ctx context.Context, key string, content []byte) error
+	// get reads the object, returning its size,
+	// 0 without error if it does not exist.
+	get(ctx context.Context, key string) (int64, error)
+	list(ctx context.Context) error
+	delete(ctx context.Context, key string) error
+	// close releases the target, removing the objects if remove.
+	close(ctx context.Context, remove bool)
+}
+
+// eosBenchTarget calls EOS directly, measuring the MGM and the FSTs.
+type eosBenchTarget struct {
+	client eoss3.EosClient
+	auth   eos.Auth
+	dir    string
+}
+
+func (t *eosBenchTarget) setup(ctx context.Context) error {
+	return t.client.Mkdir(ctx, t.auth, t.dir, 0755)
+}
+
+func (t *eosBenchTarget) put(ctx context.Context, key string, content []byte) error {
+	return t.client.Upload(ctx, t.auth, filepath.Join(t.dir, key), bytes.NewReader(content), uint64(len(content)))
+}
+
+func (t *eosBenchTarget) get(ctx context.Context, key string) (int64, error) {
+	r, _, err := t.client.Download(ctx, t.auth, filepath.Join(t.dir, key), nil)
+	if err != nil {
+		if errors.As(err, new(*eos.ErrNoSuchResource)) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer r.Close()
+	return io.Copy(io.Discard, r)
+}
+
+func (t *eosBenchTarget) list(ctx context.Context) error {
+	return t.client.ListDir(ctx, t.auth, t.dir, func(*erpc.MDResponse) {}, nil)
+}
+
+func (t *eosBenchTarget) delete(ctx context.Context, key string) error {
+	return t.client.Remove(ctx, t.auth, filepath.Join(t.dir, key), false)
+}
+
+func (t *eosBenchTarget) close(ctx context.Context, remove bool) {
+	if remove {
+		_ = t.client.Remove(ctx, t.auth, t.dir, true)
+	}
+}
+
+// benchBucket is the name of the bucket of the objects of
+// the benchmark, registered in a store of its own.
+const benchBucket = "eoss3-bench"
+
+// backendBenchTarget calls the S3 methods of the gateway backend,
+// measuring its caches, listings and limits along with EOS. The
+// objects are in a bucket run as the identity of the benchmark.
+type backendBenchTarget struct {
+	eosBenchTarget
+	be    *eoss3.EosBackend
+	store meta.BucketStorer
+	// acct is the account calling the backend
+	acct auth.Account
+}
+
+// newBackendBenchTarget returns a target calling the backend of the
+// gateway config, on EOS or, with the fake client, on client. The
+// bucket is in an in-memory store, the tenants of the config unused.
+func newBackendBenchTarget(client eoss3.EosClient, id eos.Auth, dir string) (*backendBenchTarget, error) {
+	cfg, err := getGatewayConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Tenants = nil
+
+	store, err := meta.NewInMemoryBucketStorer()
+	if err != nil {
+		return nil, err
+	}
+	if _, fake := client.(*eos.FakeClient); !fake {
+		client = nil
+	}
+	be, err := newCLIBackend(cfg, store, client)
+	if err != nil {
+		return nil, err
+	}
+	return &backendBenchTarget{
+		eosBenchTarget: eosBenchTarget{client: client, auth: id, dir: dir},
+		be:             be,
+		store:          store,
+		acct:           auth.Account{Access: benchBucket, UserID: int(id.Uid), GroupID: int(id.Gid)},
+	}, nil
+}
+
+func (t *backendBenchTarget) setup(ctx context.Context) error {
+	if err := t.eosBenchTarget.setup(ctx); err != nil {
+		return err
+	}
+	return t.store.CreateBucket(ctx, meta.Bucket{
+		Name:      benchBucket,
+		Path:      t.dir,
+		CreatedAt: time.Now(),
+		Owner:     &meta.Identity{Uid: t.auth.Uid, Gid: t.auth.Gid},
+		RunAs:     &meta.Identity{Uid: t.auth.Uid, Gid: t.auth.Gid},
+	})
+}
+
+func (t *backendBenchTarget) put(ctx context.Context, key string, content []byte) error {
+	_, err := t.be.PutObject(eoss3.WithAccount(ctx, t.acct), s3response.PutObjectInput{
+		Bucket:        aws.String(benchBucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(content),
+		ContentLength: aws.Int64(int64(len(content))),
+	})
+	return err
+}
+
+func (t *backendBenchTarget) get(ctx context.Context, key string) (int64, error) {
+	out, err := t.be.GetObject(eoss3.WithAccount(ctx, t.acct), &s3.GetObjectInput{
+		Bucket: aws.String(benchBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if apiErr := (s3err.APIError{}); errors.As(err, &apiErr) && apiErr.Code == "NoSuchKey" {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer out.Body.Close()
+	return io.Copy(io.Discard, out.Body)
+}
+
+func (t *backendBenchTarget) list(ctx context.Context) error {
+	_, err := t.be.ListObjectsV2(eoss3.WithAccount(ctx, t.acct), &s3.ListObjectsV2Input{
+		Bucket:    aws.String(benchBucket),
+		Prefix:    aws.String(""),
+		Delimiter: aws.String(""),
+	})
+	return err
+}
+
+func (t *backendBenchTarget) delete(ctx context.Context, key string) error {
+	_, err := t.be.DeleteObject(eoss3.WithAccount(ctx, t.acct), &s3.DeleteObjectInput{
+		Bucket: aws.String(benchBucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (t *backendBenchTarget) close(ctx context.Context, remove bool) {
+	t.be.Shutdown()
+	t.eosBenchTarget.close(ctx, remove)
+}
+
+// benchResult is the summary of an operation of the benchmark.
+type benchResult struct {
+	Op        string  `json:"op"`
+	Count     int     `json:"count"`
+	Errors    int     `json:"errors"`
+	OpsPerSec float64 `json:"ops_per_sec"`
+	MBPerSec  float64 `json:"mb_per_sec"`
+	P50       string  `json:"p50"`
+	P90       string  `json:"p90"`
+	P99       string  `json:"p99"`
+	Max       string  `json:"max"`
+}
+
+func (b *bench) results(elapsed time.Duration) []benchResult {
+	results := []benchResult{}
+	for _, op := range benchOps {
+		if b.weights[op] == 0 {
+			continue
+		}
+		s := b.stats[op]
+		slices.Sort(s.latencies)
+		results = append(results, benchResult{
+			Op:        op,
+			Count:     len(s.latencies),
+			Errors:    s.errors,
+			OpsPerSec: float64(len(s.latencies)) / elapsed.Seconds(),
+			MBPerSec:  float64(s.bytes) / (1 << 20) / elapsed.Seconds(),
+			P50:       percentile(s.latencies, 50).String(),
+			P90:       percentile(s.latencies, 90).String(),
+			P99:       percentile(s.latencies, 99).String(),
+			Max:       percentile(s.latencies, 100).String(),
+		})
+	}
+	return results
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)].Round(time.Microsecond)
+}
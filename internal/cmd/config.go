@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eoss3"
+	"github.com/mitchellh/mapstructure"
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+const (
+	// envPrefix is the prefix of the environment variables
+	// overriding the config fields, e.g. EOSS3_GRPC_URL.
+	// Nested fields are separated by a double underscore,
+	// e.g. EOSS3_BUCKETS__FOLDER.
+	envPrefix = "EOSS3_"
+	// envConfig is the environment variable holding the path of the config file.
+	envConfig = envPrefix + "CONFIG"
+
+	defaultConfigPath = "/etc/eoss3.yaml"
+)
+
+// configPath returns the default path of the config file.
+func configPath() string {
+	if p := os.Getenv(envConfig); p != "" {
+		return p
+	}
+	return defaultConfigPath
+}
+
+func getConfig() (*Config, error) {
+	var cfg Config
+	if err := decodeConfig(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// getGatewayConfig returns the config of the gateway, from the
+// same file, environment and overrides as the one of the CLI.
+func getGatewayConfig() (*eoss3.Config, error) {
+	var cfg eoss3.Config
+	if err := decodeConfig(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// decodeConfig decodes in cfg the config file,
+// overridden by the environment and the flags.
+func decodeConfig(cfg any) error {
+	c, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+
+	// environment variables first, so that flags take precedence
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(k, envPrefix) || k == envConfig {
+			continue
+		}
+		key := strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(k, envPrefix)), "__", ".")
+		if err := setConfigKey(c, key, v); err != nil {
+			return fmt.Errorf("invalid %s: %w", k, err)
+		}
+	}
+	for _, kv := range globalFlags.Set {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid --set %q: expected key=value", kv)
+		}
+		if err := setConfigKey(c, k, v); err != nil {
+			return fmt.Errorf("invalid --set %q: %w", kv, err)
+		}
+	}
+
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		Result:           cfg,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(c)
+}
+
+// readConfigFile decodes the config file. A missing file is
+// tolerated when its path is the default one, allowing to
+// configure the CLI only through environment and flags.
+func readConfigFile() (map[string]any, error) {
+	c := map[string]any{}
+
+	f, err := os.Open(globalFlags.Config)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !rootCmd.PersistentFlags().Changed("config") {
+			return c, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return c, nil
+}
+
+// setConfigKey sets the value of the dotted key in c,
+// creating the intermediate maps if needed.
+func setConfigKey(c map[string]any, key, value string) error {
+	parts := strings.Split(key, ".")
+	for _, p := range parts[:len(parts)-1] {
+		switch next := c[p].(type) {
+		case map[string]any:
+			c = next
+		case nil:
+			m := map[string]any{}
+			c[p] = m
+			c = m
+		default:
+			return fmt.Errorf("%s is not a section", p)
+		}
+	}
+	c[parts[len(parts)-1]] = value
+	return nil
+}
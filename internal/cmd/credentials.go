@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Manage the S3 credentials of the EOS users",
+}
+
+var createCredentialFlags = struct {
+	User    string // User the credential is mapped to
+	Role    string // Role of the account on the gateway
+	Service string // Service account the credential belongs to
+}{}
+
+var createCredentialCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Generate a new access and secret key for a user",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		store, err := credentialStorer(cfg)
+		if err != nil {
+			return err
+		}
+
+		admin, err := newAdminClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		id, err := lookupIdentity(createCredentialFlags.User)
+		if err != nil {
+			return err
+		}
+
+		cred, secret, err := issueCredential(cmd.Context(), store, admin, meta.Credential{
+			Username: createCredentialFlags.User,
+			Uid:      id.Uid,
+			Gid:      id.Gid,
+			Role:     createCredentialFlags.Role,
+			Service:  createCredentialFlags.Service,
+		})
+		if err != nil {
+			return err
+		}
+
+		out := struct {
+			AccessKey string `json:"access_key"`
+			SecretKey string `json:"secret_key"`
+			Username  string `json:"username"`
+			Service   string `json:"service,omitempty"`
+		}{cred.AccessKey, secret, cred.Username, cred.Service}
+		return printOutput(out, outputTable, func(w io.Writer) {
+			fmt.Fprintf(w, "Access key:\t%s\n", cred.AccessKey)
+			fmt.Fprintf(w, "Secret key:\t%s\n", secret)
+			fmt.Fprintln(w, "The secret key is not stored and cannot be shown again")
+		})
+	},
+}
+
+// issueCredential generates a new key for the user of tmpl,
+// creating its account on the gateway, and stores it.
+func issueCredential(ctx context.Context, store meta.CredentialStorer, admin *adminClient, tmpl meta.Credential) (meta.Credential, string, error) {
+	access, secret, err := generateKeys()
+	if err != nil {
+		return meta.Credential{}, "", err
+	}
+	if tmpl.Role == "" {
+		// the keys created before the role was stored
+		tmpl.Role = "user"
+	}
+
+	if err := admin.createUser(ctx, adminAccount{
+		Access:  access,
+		Secret:  secret,
+		Role:    tmpl.Role,
+		UserID:  int(tmpl.Uid),
+		GroupID: int(tmpl.Gid),
+	}); err != nil {
+		return meta.Credential{}, "", fmt.Errorf("error creating the account on the gateway: %w", err)
+	}
+
+	cred := tmpl
+	cred.AccessKey = access
+	cred.SecretHash = meta.HashSecret(secret)
+	cred.CreatedAt = time.Now().UTC()
+	cred.ExpiresAt = nil
+	if err := store.StoreCredential(ctx, cred); err != nil {
+		_ = admin.deleteUser(ctx, access)
+		return meta.Credential{}, "", err
+	}
+	return cred, secret, nil
+}
+
+var listCredentialsFlags = struct {
+	User string // Show only the credentials of the user
+}{}
+
+var listCredentialsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the credentials",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		store, err := credentialStorer(cfg)
+		if err != nil {
+			return err
+		}
+
+		creds, err := store.ListCredentials(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		filtered := make([]meta.Credential, 0, len(creds))
+		for _, c := range creds {
+			if listCredentialsFlags.User == "" || c.Username == listCredentialsFlags.User {
+				filtered = append(filtered, c)
+			}
+		}
+
+		return printOutput(filtered, outputTable, func(w io.Writer) {
+			fmt.Fprintln(w, "ACCESS KEY\tUSER\tUID\tGID\tSERVICE\tCREATED AT\tEXPIRES AT")
+			for _, c := range filtered {
+				expires := "-"
+				if c.ExpiresAt != nil {
+					expires = c.ExpiresAt.Format(time.RFC3339)
+				}
+				service := c.Service
+				if service == "" {
+					service = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", c.AccessKey, c.Username, c.Uid, c.Gid, service, c.CreatedAt.Format(time.RFC3339), expires)
+			}
+		})
+	},
+}
+
+var revokeCredentialCmd = &cobra.Command{
+	Use:     "revoke <access key>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Revoke a credential",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		store, err := credentialStorer(cfg)
+		if err != nil {
+			return err
+		}
+
+		admin, err := newAdminClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		access := strings.TrimSpace(args[0])
+		if _, err := store.GetCredential(cmd.Context(), access); err != nil {
+			return err
+		}
+
+		if err := admin.deleteUser(cmd.Context(), access); err != nil {
+			return fmt.Errorf("error deleting the account on the gateway: %w", err)
+		}
+		return store.DeleteCredential(cmd.Context(), access)
+	},
+}
+
+var rotateCredentialFlags = struct {
+	Grace  time.Duration // Time the replaced key stays valid
+	Due    bool          // Rotate the keys of the service accounts older than MaxAge
+	MaxAge time.Duration // Age of the keys rotated by Due
+}{}
+
+// rotation is a key replaced by a new one.
+type rotation struct {
+	OldAccessKey string    `json:"old_access_key"`
+	AccessKey    string    `json:"access_key"`
+	SecretKey    string    `json:"secret_key"`
+	Username     string    `json:"username"`
+	Service      string    `json:"service,omitempty"`
+	OldExpiresAt time.Time `json:"old_expires_at"`
+}
+
+var rotateCredentialCmd = &cobra.Command{
+	Use:   "rotate [<access key>]",
+	Short: "Replace a key with a new one, the old key staying valid for a grace period",
+	Long: `Replace a key with a new one for the same user, the old key staying valid
+for the grace period, so that the clients can switch to the new key without
+downtime. At most two keys of a service account are active at the same time:
+a key cannot be rotated while another one of its service is in its grace
+period. With --due, the keys of the service accounts older than --max-age are
+rotated, e.g. from a cron job. The expired keys are revoked by "credentials expire".`,
+	PreRunE: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (len(args) == 1) == rotateCredentialFlags.Due {
+			return errors.New("exactly one of <access key> and --due is required")
+		}
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		store, err := credentialStorer(cfg)
+		if err != nil {
+			return err
+		}
+
+		admin, err := newAdminClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		creds, err := store.ListCredentials(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		var due []meta.Credential
+		if rotateCredentialFlags.Due {
+			for _, c := range creds {
+				if c.Service != "" && c.ExpiresAt == nil && now.Sub(c.CreatedAt) >= rotateCredentialFlags.MaxAge {
+					due = append(due, c)
+				}
+			}
+		} else {
+			c, err := store.GetCredential(ctx, strings.TrimSpace(args[0]))
+			if err != nil {
+				return err
+			}
+			due = append(due, c)
+		}
+
+		rotations := []rotation{}
+		for _, c := range due {
+			if err := canRotate(c, creds, now); err != nil {
+				if rotateCredentialFlags.Due {
+					continue
+				}
+				return err
+			}
+			cred, secret, err := issueCredential(ctx, store, admin, c)
+			if err != nil {
+				_ = printRotations(rotations)
+				return fmt.Errorf("error rotating %s: %w", c.AccessKey, err)
+			}
+			expires := now.Add(rotateCredentialFlags.Grace)
+			c.ExpiresAt = &expires
+			if err := store.UpdateCredential(ctx, c); err != nil {
+				_ = printRotations(rotations)
+				return fmt.Errorf("error setting the expiration of %s: %w", c.AccessKey, err)
+			}
+			rotations = append(rotations, rotation{
+				OldAccessKey: c.AccessKey,
+				AccessKey:    cred.AccessKey,
+				SecretKey:    secret,
+				Username:     cred.Username,
+				Service:      cred.Service,
+				OldExpiresAt: expires,
+			})
+		}
+		return printRotations(rotations)
+	},
+}
+
+// canRotate tells if the key c can be rotated: it must not be already
+// replaced, and no other key of its service can be in its grace period.
+func canRotate(c meta.Credential, creds []meta.Credential, now time.Time) error {
+	if c.ExpiresAt != nil {
+		return fmt.Errorf("key %s already rotated, expiring at %s", c.AccessKey, c.ExpiresAt.Format(time.RFC3339))
+	}
+	if c.Service == "" {
+		return nil
+	}
+	for _, o := range creds {
+		if o.Service == c.Service && o.AccessKey != c.AccessKey && o.ExpiresAt != nil && o.ExpiresAt.After(now) {
+			return fmt.Errorf("service %s has the key %s in its grace period until %s", c.Service, o.AccessKey, o.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func printRotations(rotations []rotation) error {
+	return printOutput(rotations, outputTable, func(w io.Writer) {
+		fmt.Fprintln(w, "OLD ACCESS KEY\tEXPIRES AT\tACCESS KEY\tSECRET KEY\tUSER\tSERVICE")
+		for _, r := range rotations {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.OldAccessKey, r.OldExpiresAt.Format(time.RFC3339), r.AccessKey, r.SecretKey, r.Username, r.Service)
+		}
+		if len(rotations) == 0 {
+			fmt.Fprintln(w, "Nothing to rotate")
+		}
+	})
+}
+
+var expireCredentialsCmd = &cobra.Command{
+	Use:   "expire",
+	Short: "Revoke the keys whose grace period after a rotation is over",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		store, err := credentialStorer(cfg)
+		if err != nil {
+			return err
+		}
+
+		admin, err := newAdminClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		creds, err := store.ListCredentials(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		revoked := []string{}
+		for _, c := range creds {
+			if c.ExpiresAt == nil || c.ExpiresAt.After(now) {
+				continue
+			}
+			if err := admin.deleteUser(ctx, c.AccessKey); err != nil {
+				return fmt.Errorf("error deleting the account %s on the gateway: %w", c.AccessKey, err)
+			}
+			if err := store.DeleteCredential(ctx, c.AccessKey); err != nil {
+				return err
+			}
+			revoked = append(revoked, c.AccessKey)
+		}
+		return printOutput(revoked, outputTable, func(w io.Writer) {
+			for _, k := range revoked {
+				fmt.Fprintf(w, "revoked\t%s\n", k)
+			}
+		})
+	},
+}
+
+func credentialStorer(cfg *Config) (meta.CredentialStorer, error) {
+	buckets, err := meta.New(cfg.Buckets)
+	if err != nil {
+		return nil, err
+	}
+	store, ok := buckets.(meta.CredentialStorer)
+	if !ok {
+		return nil, errors.New("meta driver does not support credentials")
+	}
+	return store, nil
+}
+
+const accessKeyAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// generateKeys returns a new random access and secret key,
+// following the format of the AWS ones.
+func generateKeys() (string, string, error) {
+	b := make([]byte, 20+30)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	access := make([]byte, 20)
+	for i := range access {
+		access[i] = accessKeyAlphabet[int(b[i])%len(accessKeyAlphabet)]
+	}
+	secret := base64.RawStdEncoding.EncodeToString(b[20:])
+	return string(access), strings.NewReplacer("+", "A", "/", "B").Replace(secret), nil
+}
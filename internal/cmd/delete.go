@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var deleteBucketFlags = struct {
+	Rmdir bool // Remove also the (empty) directory on EOS
+}{}
+
+var deleteBucketCmd = &cobra.Command{
+	Use:     "delete-bucket <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Unregister a bucket, removing its assignments and aliases. The data on EOS is kept",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+		if err != nil {
+			return err
+		}
+
+		// the directory is removed as the identity of the bucket,
+		// checked before unregistering it
+		var auth eos.Auth
+		if deleteBucketFlags.Rmdir {
+			if auth, err = bucketAuth(b); err != nil {
+				return err
+			}
+		}
+
+		if globalFlags.DryRun {
+			for _, a := range b.Aliases {
+				printDryRun("meta: remove alias %s", a)
+			}
+			printDryRun("meta: unassign bucket %s from its users", b.Name)
+			printDryRun("meta: delete bucket record %s", b.Name)
+			if deleteBucketFlags.Rmdir {
+				printDryRun("eos: rmdir %s as %d:%d", b.Path, auth.Uid, auth.Gid)
+			}
+			return nil
+		}
+
+		if err := unregisterBucket(cmd.Context(), buckets, b); err != nil {
+			return err
+		}
+
+		if deleteBucketFlags.Rmdir {
+			client, err := newEOSClient(cfg)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			if err := client.Rmdir(cmd.Context(), auth, b.Path); err != nil {
+				return fmt.Errorf("bucket unregistered, but error removing %s: %w", b.Path, err)
+			}
+		}
+		return nil
+	},
+}
+
+// bucketAuth returns the identity used to operate on the bucket:
+// the run-as one if set, otherwise the one of the owner. Buckets
+// with neither are refused, rather than operated on as root.
+func bucketAuth(b meta.Bucket) (eos.Auth, error) {
+	switch {
+	case b.RunAs != nil:
+		return eos.Auth{Uid: b.RunAs.Uid, Gid: b.RunAs.Gid}, nil
+	case b.Owner != nil:
+		return eos.Auth{Uid: b.Owner.Uid, Gid: b.Owner.Gid}, nil
+	}
+	return eos.Auth{}, fmt.Errorf("bucket %s has neither owner nor run-as identity", b.Name)
+}
@@ -0,0 +1,9 @@
+package cmd
+
+import "fmt"
+
+// printDryRun reports an operation that would be executed
+// if the command was not running in dry-run mode.
+func printDryRun(format string, a ...any) {
+	fmt.Printf("(dry run) "+format+"\n", a...)
+}
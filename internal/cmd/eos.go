@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/eoss3"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var eosFlags = struct {
+	As        string   // User running the operations
+	Recursive bool     // Recurse into the directories
+	NoRecycle bool     // Bypass the recycle bin when removing
+	Remove    []string // Extended attributes to remove
+}{}
+
+var eosCmd = &cobra.Command{
+	Use:   "eos",
+	Short: "Run raw operations on EOS, bypassing the S3 layer",
+}
+
+// eosEntry is a file or directory on EOS.
+type eosEntry struct {
+	Path   string            `json:"path"`
+	Type   string            `json:"type"`
+	Uid    uint64            `json:"uid"`
+	Gid    uint64            `json:"gid"`
+	Mode   uint32            `json:"mode,omitempty"`
+	Size   uint64            `json:"size"`
+	Mtime  time.Time         `json:"mtime"`
+	Etag   string            `json:"etag,omitempty"`
+	Xattrs map[string]string `json:"xattrs,omitempty"`
+}
+
+func newEOSEntry(m *erpc.MDResponse) eosEntry {
+	var e eosEntry
+	var xattrs map[string][]byte
+	switch {
+	case m.Cmd != nil:
+		e = eosEntry{
+			Path:  string(m.Cmd.Path),
+			Type:  "dir",
+			Uid:   m.Cmd.Uid,
+			Gid:   m.Cmd.Gid,
+			Mode:  m.Cmd.Mode,
+			Size:  uint64(max(m.Cmd.TreeSize, 0)),
+			Mtime: protoTime(m.Cmd.Mtime),
+			Etag:  m.Cmd.Etag,
+		}
+		xattrs = m.Cmd.Xattrs
+	case m.Fmd != nil:
+		e = eosEntry{
+			Path:  string(m.Fmd.Path),
+			Type:  "file",
+			Uid:   m.Fmd.Uid,
+			Gid:   m.Fmd.Gid,
+			Size:  m.Fmd.Size,
+			Mtime: protoTime(m.Fmd.Mtime),
+			Etag:  m.Fmd.Etag,
+		}
+		xattrs = m.Fmd.Xattrs
+	}
+	if len(xattrs) > 0 {
+		e.Xattrs = make(map[string]string, len(xattrs))
+		for k, v := range xattrs {
+			e.Xattrs[k] = string(v)
+		}
+	}
+	return e
+}
+
+// eosAuth returns the identity set with --as, defaulting to daemon.
+func eosAuth() (eos.Auth, error) {
+	if eosFlags.As == "" {
+		return daemonEOSAuth()
+	}
+	id, err := lookupIdentity(eosFlags.As)
+	if err != nil {
+		return eos.Auth{}, err
+	}
+	return eos.Auth{Uid: id.Uid, Gid: id.Gid}, nil
+}
+
+// newCLIBackend returns the backend of the gateway config on store,
+// calling client if not nil, otherwise the EOS instance of the config.
+// Its servers, import job and operation log are disabled, so that it
+// can run along with the gateway.
+func newCLIBackend(cfg *eoss3.Config, store meta.BucketStorer, client eoss3.EosClient) (*eoss3.EosBackend, error) {
+	cfg.Health.Address, cfg.Debug.Address, cfg.Admin.Address = "", "", ""
+	cfg.Import, cfg.OpLog = nil, nil
+	if client != nil {
+		return eoss3.NewWithClient(cfg, store, client)
+	}
+	return eoss3.New(cfg, store)
+}
+
+// runEOS runs f with a client connected to EOS and the identity set with --as.
+func runEOS(f func(client *eos.Client, auth eos.Auth) error) error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+
+	auth, err := eosAuth()
+	if err != nil {
+		return err
+	}
+
+	client, err := newEOSClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return f(client, auth)
+}
+
+var eosStatCmd = &cobra.Command{
+	Use:     "stat <path>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Stat a file or directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runEOS(func(client *eos.Client, auth eos.Auth) error {
+			m, err := client.Stat(cmd.Context(), auth, args[0])
+			if err != nil {
+				return err
+			}
+			if m.Cmd == nil && m.Fmd == nil {
+				return &eos.ErrNoSuchResource{Path: args[0]}
+			}
+
+			e := newEOSEntry(m)
+			return printOutput(e, outputTable, func(w io.Writer) {
+				fmt.Fprintf(w, "Path:\t%s\n", e.Path)
+				fmt.Fprintf(w, "Type:\t%s\n", e.Type)
+				fmt.Fprintf(w, "Owner:\t%d:%d\n", e.Uid, e.Gid)
+				if e.Mode != 0 {
+					fmt.Fprintf(w, "Mode:\t%o\n", e.Mode)
+				}
+				fmt.Fprintf(w, "Size:\t%d\n", e.Size)
+				fmt.Fprintf(w, "Mtime:\t%s\n", formatTime(e.Mtime))
+				fmt.Fprintf(w, "Etag:\t%s\n", e.Etag)
+				for _, k := range slices.Sorted(maps.Keys(e.Xattrs)) {
+					fmt.Fprintf(w, "Xattr:\t%s=%s\n", k, e.Xattrs[k])
+				}
+			})
+		})
+	},
+}
+
+var eosLsCmd = &cobra.Command{
+	Use:     "ls <path>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "List a directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runEOS(func(client *eos.Client, auth eos.Auth) error {
+			entries := []eosEntry{}
+			if err := client.ListDir(cmd.Context(), auth, args[0], func(m *erpc.MDResponse) {
+				entries = append(entries, newEOSEntry(m))
+			}, &eos.ListDirFilters{Recursive: eosFlags.Recursive}); err != nil {
+				return err
+			}
+
+			return printOutput(entries, outputTable, func(w io.Writer) {
+				for _, e := range entries {
+					fmt.Fprintf(w, "%s\t%d:%d\t%d\t%s\t%s\n", e.Type, e.Uid, e.Gid, e.Size, formatTime(e.Mtime), e.Path)
+				}
+			})
+		})
+	},
+}
+
+var eosRmCmd = &cobra.Command{
+	Use:     "rm <path>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Remove a file or directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runEOS(func(client *eos.Client, auth eos.Auth) error {
+			if globalFlags.DryRun {
+				printDryRun("eos: rm %s as %d:%d (recursive=%t, recycle=%t)", args[0], auth.Uid, auth.Gid, eosFlags.Recursive, !eosFlags.NoRecycle)
+				return nil
+			}
+
+			remove := client.Remove
+			if eosFlags.NoRecycle {
+				remove = client.RemovePermanently
+			}
+			return remove(cmd.Context(), auth, args[0], eosFlags.Recursive)
+		})
+	},
+}
+
+var eosXattrCmd = &cobra.Command{
+	Use:     "xattr <path> [<key>=<value>...]",
+	PreRunE: cobra.MinimumNArgs(1),
+	Short:   "Show, set or remove the extended attributes of a file or directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		set, err := parseKeyValues(args[1:])
+		if err != nil {
+			return err
+		}
+
+		return runEOS(func(client *eos.Client, auth eos.Auth) error {
+			if len(set) > 0 || len(eosFlags.Remove) > 0 {
+				if globalFlags.DryRun {
+					for _, k := range slices.Sorted(maps.Keys(set)) {
+						printDryRun("eos: set xattr %s=%s on %s as %d:%d", k, set[k], args[0], auth.Uid, auth.Gid)
+					}
+					for _, k := range eosFlags.Remove {
+						printDryRun("eos: remove xattr %s from %s as %d:%d", k, args[0], auth.Uid, auth.Gid)
+					}
+					return nil
+				}
+				return client.SetXattrs(cmd.Context(), auth, args[0], set, eosFlags.Remove)
+			}
+
+			m, err := client.Stat(cmd.Context(), auth, args[0])
+			if err != nil {
+				return err
+			}
+			xattrs := newEOSEntry(m).Xattrs
+			if xattrs == nil {
+				xattrs = map[string]string{}
+			}
+			return printOutput(xattrs, outputTable, func(w io.Writer) {
+				for _, k := range slices.Sorted(maps.Keys(xattrs)) {
+					fmt.Fprintf(w, "%s=%s\n", k, xattrs[k])
+				}
+			})
+		})
+	},
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var fsckFlags = struct {
+	Repair bool   // Fix the discrepancies found
+	Root   string // EOS directory scanned for directories not registered as bucket
+}{}
+
+// fsckProblem is a discrepancy between the meta store and EOS.
+type fsckProblem struct {
+	Kind     string `json:"kind"`
+	Bucket   string `json:"bucket,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired"`
+	Err      error  `json:"-"`
+	// Error is the error got during the repair, if any.
+	Error string `json:"error,omitempty"`
+}
+
+func (p fsckProblem) String() string {
+	s := p.Kind
+	if p.Bucket != "" {
+		s += fmt.Sprintf(" bucket=%s", p.Bucket)
+	}
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	if p.Err != nil {
+		s += fmt.Sprintf(" (repair failed: %v)", p.Err)
+	}
+	if p.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check the consistency between the meta store and EOS",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		daemon, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		repair := fsckFlags.Repair
+
+		list, err := buckets.ListBuckets(ctx)
+		if err != nil {
+			return err
+		}
+
+		problems := []fsckProblem{}
+		registered := make(map[string]struct{}, len(list))
+		for _, b := range list {
+			registered[trimTrailingSlash(b.Path)] = struct{}{}
+			problems = append(problems, checkBucketOnEOS(ctx, buckets, client, daemon, b, repair)...)
+		}
+
+		dangling, err := checkAssignments(ctx, buckets, repair)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, dangling...)
+
+		if fsckFlags.Root != "" {
+			unregistered, err := checkUnregistered(ctx, buckets, client, daemon, fsckFlags.Root, registered, repair)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, unregistered...)
+		}
+
+		for i, p := range problems {
+			if p.Err != nil {
+				problems[i].Error = p.Err.Error()
+			}
+		}
+		if err := printOutput(problems, outputTable, func(w io.Writer) {
+			for _, p := range problems {
+				fmt.Fprintln(w, p)
+			}
+		}); err != nil {
+			return err
+		}
+
+		for _, p := range problems {
+			if !p.Repaired {
+				return fmt.Errorf("found %d problems", len(problems))
+			}
+		}
+		return nil
+	},
+}
+
+// checkBucketOnEOS verifies that the directory of the bucket
+// exists on EOS and it is owned by the owner of the bucket, if
+// assigned. Missing directories are recreated and the owner
+// recorded in the meta store is aligned to the one on EOS.
+func checkBucketOnEOS(ctx context.Context, buckets meta.BucketStorer, client *eos.Client, daemon eos.Auth, b meta.Bucket, repair bool) []fsckProblem {
+	stat, err := client.Stat(ctx, daemon, b.Path)
+	if err != nil {
+		p := fsckProblem{Kind: "missing directory", Bucket: b.Name, Detail: fmt.Sprintf("%s: %v", b.Path, err)}
+		if repair {
+			if b.Owner == nil {
+				p.Err = fmt.Errorf("bucket has no owner")
+			} else if p.Err = client.Mkdir(ctx, eos.Auth{Uid: b.Owner.Uid, Gid: b.Owner.Gid}, b.Path, 0755); p.Err == nil {
+				p.Repaired = true
+			}
+		}
+		return []fsckProblem{p}
+	}
+
+	if stat.Type != erpc.TYPE_CONTAINER || stat.Cmd == nil {
+		return []fsckProblem{{Kind: "not a directory", Bucket: b.Name, Detail: b.Path}}
+	}
+
+	// buckets without owner are unassigned, not mismatching
+	if b.Owner != nil && (b.Owner.Uid != stat.Cmd.Uid || b.Owner.Gid != stat.Cmd.Gid) {
+		p := fsckProblem{Kind: "ownership mismatch", Bucket: b.Name, Detail: fmt.Sprintf("meta=%s eos=%d:%d", formatIdentity(b.Owner), stat.Cmd.Uid, stat.Cmd.Gid)}
+		if repair {
+			b.Owner = &meta.Identity{Uid: stat.Cmd.Uid, Gid: stat.Cmd.Gid}
+			if _, p.Err = buckets.UpdateBucket(ctx, b); p.Err == nil {
+				p.Repaired = true
+			}
+		}
+		return []fsckProblem{p}
+	}
+	return nil
+}
+
+// checkAssignments looks for users assigned to buckets not existing.
+func checkAssignments(ctx context.Context, buckets meta.BucketStorer, repair bool) ([]fsckProblem, error) {
+	uids, err := buckets.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []fsckProblem
+	for _, uid := range uids {
+		assigned, err := buckets.ListBucketsByUser(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range assigned {
+			if _, err := buckets.GetBucket(ctx, name); err == nil {
+				continue
+			}
+			p := fsckProblem{Kind: "dangling assignment", Bucket: name, Detail: fmt.Sprintf("uid=%d", uid)}
+			if repair {
+				if p.Err = buckets.UnassignBucket(ctx, name, uid); p.Err == nil {
+					p.Repaired = true
+				}
+			}
+			problems = append(problems, p)
+		}
+	}
+	return problems, nil
+}
+
+// checkUnregistered looks for directories under root not registered
+// as bucket. They are registered assigning them to the directory owner.
+func checkUnregistered(ctx context.Context, buckets meta.BucketStorer, client *eos.Client, daemon eos.Auth, root string, registered map[string]struct{}, repair bool) ([]fsckProblem, error) {
+	var dirs []*erpc.ContainerMdProto
+	if err := client.ListDir(ctx, daemon, root, func(md *erpc.MDResponse) {
+		if md.Type != erpc.TYPE_CONTAINER || md.Cmd == nil {
+			return
+		}
+		dirs = append(dirs, md.Cmd)
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	var problems []fsckProblem
+	for _, d := range dirs {
+		path := trimTrailingSlash(string(d.Path))
+		if _, ok := registered[path]; ok {
+			continue
+		}
+
+		name := string(d.Name)
+		p := fsckProblem{Kind: "unregistered directory", Bucket: name, Detail: path}
+		if repair {
+			if !meta.IsValidBucketName(name) {
+				p.Err = fmt.Errorf("%q is not a valid bucket name", name)
+			} else if p.Err = registerDirectory(ctx, buckets, name, path, d); p.Err == nil {
+				p.Repaired = true
+			}
+		}
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+func registerDirectory(ctx context.Context, buckets meta.BucketStorer, name, path string, d *erpc.ContainerMdProto) error {
+	bucket := meta.Bucket{
+		Name:      name,
+		Path:      path,
+		CreatedAt: time.Unix(int64(d.Ctime.GetSec()), int64(d.Ctime.GetNSec())),
+		Owner:     &meta.Identity{Uid: d.Uid, Gid: d.Gid},
+	}
+	if err := buckets.CreateBucket(ctx, bucket); err != nil {
+		return err
+	}
+	if err := buckets.AssignBucket(ctx, name, int(d.Uid)); err != nil {
+		_ = buckets.DeleteBucket(ctx, name)
+		return err
+	}
+	return nil
+}
+
+func formatIdentity(id *meta.Identity) string {
+	if id == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%d:%d", id.Uid, id.Gid)
+}
+
+func trimTrailingSlash(p string) string {
+	for len(p) > 1 && p[len(p)-1] == '/' {
+		p = p[:len(p)-1]
+	}
+	return p
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var healthFlags = struct {
+	ScratchPath string        // EOS directory where the test file is written
+	User        string        // User used to probe EOS
+	Timeout     time.Duration // Timeout of the whole check
+}{}
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check end to end the meta store and EOS, exiting with non zero code on failure",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(cmd.Context(), healthFlags.Timeout)
+		defer cancel()
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		auth, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+		if healthFlags.User != "" {
+			id, err := lookupIdentity(healthFlags.User)
+			if err != nil {
+				return err
+			}
+			auth = eos.Auth{Uid: id.Uid, Gid: id.Gid}
+		}
+
+		var failed bool
+		results := []healthResult{}
+		check := func(name string, f func() error) {
+			start := time.Now()
+			r := healthResult{Name: name, OK: true}
+			if err := f(); err != nil {
+				failed = true
+				r.OK, r.Error = false, err.Error()
+			}
+			r.Duration = time.Since(start).Round(time.Millisecond).String()
+			results = append(results, r)
+		}
+
+		check("meta", func() error {
+			buckets, err := meta.New(cfg.Buckets)
+			if err != nil {
+				return err
+			}
+			_, err = buckets.ListBuckets(ctx)
+			return err
+		})
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		check("eos-stat", func() error {
+			_, err := client.Stat(ctx, auth, healthFlags.ScratchPath)
+			return err
+		})
+
+		probe := filepath.Join(healthFlags.ScratchPath, ".eoss3-health."+uuid.NewString())
+		content := []byte("eoss3 health check " + time.Now().UTC().Format(time.RFC3339))
+
+		check("upload", func() error {
+			return client.Upload(ctx, auth, probe, bytes.NewReader(content), uint64(len(content)))
+		})
+
+		check("download", func() error {
+			r, _, err := client.Download(ctx, auth, probe, nil)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, content) {
+				return errors.New("downloaded content differs from the uploaded one")
+			}
+			return nil
+		})
+
+		check("cleanup", func() error {
+			return client.Remove(ctx, auth, probe, false)
+		})
+
+		if err := printOutput(results, outputTable, func(w io.Writer) {
+			for _, r := range results {
+				if r.OK {
+					fmt.Fprintf(w, "OK\t%s\t%s\n", r.Name, r.Duration)
+				} else {
+					fmt.Fprintf(w, "FAIL\t%s\t%s\n", r.Name, r.Error)
+				}
+			}
+		}); err != nil {
+			return err
+		}
+
+		if failed {
+			return errors.New("health check failed")
+		}
+		return nil
+	},
+}
+
+// healthResult is the outcome of a single check.
+type healthResult struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
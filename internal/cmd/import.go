@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var importBucketFlags = struct {
+	Owner string // Username owner of the bucket
+	Name  string // Name of the bucket
+	Path  string // Path on EOS of the existing directory
+}{}
+
+var importBucketCmd = &cobra.Command{
+	Use:   "import-bucket",
+	Short: "Register an existing EOS directory as S3 bucket",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.TrimSpace(importBucketFlags.Name)
+		if !meta.IsValidBucketName(name) {
+			return fmt.Errorf("%q is not a valid bucket name", name)
+		}
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		path := strings.TrimSpace(importBucketFlags.Path)
+
+		daemon, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+
+		stat, err := client.Stat(cmd.Context(), daemon, path)
+		if err != nil {
+			return fmt.Errorf("error statting %s: %w", path, err)
+		}
+		if stat.Cmd == nil {
+			return fmt.Errorf("%s does not exist or is not a directory", path)
+		}
+
+		// the owner of the directory is the owner of the bucket, if not specified
+		owner := &meta.Identity{Uid: stat.Cmd.Uid, Gid: stat.Cmd.Gid}
+		if importBucketFlags.Owner != "" {
+			owner, err = lookupIdentity(importBucketFlags.Owner)
+			if err != nil {
+				return err
+			}
+		}
+
+		bucket := meta.Bucket{
+			Name:      name,
+			Path:      path,
+			CreatedAt: time.Now(),
+			Owner:     owner,
+		}
+		if err := buckets.CreateBucket(cmd.Context(), bucket); err != nil {
+			return err
+		}
+
+		if err := buckets.AssignBucket(cmd.Context(), bucket.Name, int(owner.Uid)); err != nil {
+			_ = buckets.DeleteBucket(cmd.Context(), bucket.Name)
+			return err
+		}
+		return nil
+	},
+}
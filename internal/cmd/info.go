@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+// bucketInfo is the meta record of a bucket
+// together with the live status on EOS.
+type bucketInfo struct {
+	Bucket meta.Bucket `json:"bucket"`
+	EOS    eosDirInfo  `json:"eos"`
+}
+
+type eosDirInfo struct {
+	Exists      bool        `json:"exists"`
+	IsDirectory bool        `json:"is_directory"`
+	Uid         uint64      `json:"uid"`
+	Gid         uint64      `json:"gid"`
+	Mode        string      `json:"mode,omitempty"`
+	Size        int64       `json:"size"`
+	Files       uint64      `json:"files"`
+	Containers  uint64      `json:"containers"`
+	Quota       []quotaInfo `json:"quota,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+type quotaInfo struct {
+	Node      string  `json:"node"`
+	Type      string  `json:"type"`
+	Name      string  `json:"name"`
+	UsedBytes uint64  `json:"used_bytes"`
+	MaxBytes  uint64  `json:"max_bytes"`
+	UsedFiles uint64  `json:"used_files"`
+	MaxFiles  uint64  `json:"max_files"`
+	UsedPerc  float32 `json:"used_bytes_percentage"`
+	Status    string  `json:"status"`
+}
+
+var bucketInfoCmd = &cobra.Command{
+	Use:     "bucket-info <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Get the info of a bucket together with its status on EOS",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+
+		b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+		if err != nil {
+			return err
+		}
+
+		daemon, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+
+		info := bucketInfo{Bucket: b}
+
+		stat, err := client.Stat(cmd.Context(), daemon, b.Path)
+		if err != nil {
+			info.EOS.Error = err.Error()
+			return printBucketInfo(info)
+		}
+
+		info.EOS.Exists = true
+		if stat.Cmd == nil {
+			info.EOS.Error = fmt.Sprintf("%s is not a directory", b.Path)
+			return printBucketInfo(info)
+		}
+
+		info.EOS.IsDirectory = true
+		info.EOS.Uid = stat.Cmd.Uid
+		info.EOS.Gid = stat.Cmd.Gid
+		info.EOS.Mode = fmt.Sprintf("%o", stat.Cmd.Mode&0o7777)
+		info.EOS.Size = stat.Cmd.TreeSize
+		info.EOS.Files = stat.Cmd.Files
+		info.EOS.Containers = stat.Cmd.Containers
+
+		// the quota is the one of the owner of the directory
+		owner := eos.Auth{Uid: stat.Cmd.Uid, Gid: stat.Cmd.Gid}
+		quota, err := client.GetQuota(cmd.Context(), owner, b.Path)
+		if err != nil {
+			info.EOS.Error = fmt.Sprintf("error getting quota: %v", err)
+		}
+		for _, q := range quota {
+			info.EOS.Quota = append(info.EOS.Quota, quotaInfo{
+				Node:      string(q.Path),
+				Type:      q.Type.String(),
+				Name:      q.Name,
+				UsedBytes: q.Usedbytes,
+				MaxBytes:  q.Maxbytes,
+				UsedFiles: q.Usedfiles,
+				MaxFiles:  q.Maxfiles,
+				UsedPerc:  q.Percentageusedbytes,
+				Status:    q.Statusbytes,
+			})
+		}
+
+		return printBucketInfo(info)
+	},
+}
+
+func printBucketInfo(info bucketInfo) error {
+	return printOutput(info, outputJSON, func(w io.Writer) {
+		printBucketTable(w, info.Bucket)
+		fmt.Fprintf(w, "EOS exists:\t%t\n", info.EOS.Exists)
+		if info.EOS.IsDirectory {
+			fmt.Fprintf(w, "EOS owner:\t%d:%d\n", info.EOS.Uid, info.EOS.Gid)
+			fmt.Fprintf(w, "EOS mode:\t%s\n", info.EOS.Mode)
+			fmt.Fprintf(w, "EOS size:\t%d\n", info.EOS.Size)
+			fmt.Fprintf(w, "EOS files:\t%d\n", info.EOS.Files)
+			fmt.Fprintf(w, "EOS containers:\t%d\n", info.EOS.Containers)
+		}
+		for _, q := range info.EOS.Quota {
+			fmt.Fprintf(w, "EOS quota:\t%s %s %s bytes=%d/%d files=%d/%d %s\n", q.Node, q.Type, q.Name, q.UsedBytes, q.MaxBytes, q.UsedFiles, q.MaxFiles, q.Status)
+		}
+		if info.EOS.Error != "" {
+			fmt.Fprintf(w, "EOS error:\t%s\n", info.EOS.Error)
+		}
+	})
+}
+
+// printBucketTable writes the bucket as a list of key value pairs.
+func printBucketTable(w io.Writer, b meta.Bucket) {
+	fmt.Fprintf(w, "Name:\t%s\n", b.Name)
+	fmt.Fprintf(w, "Path:\t%s\n", b.Path)
+	fmt.Fprintf(w, "Created at:\t%s\n", b.CreatedAt.Format(time.RFC3339))
+	if b.Owner != nil {
+		fmt.Fprintf(w, "Owner:\t%d:%d\n", b.Owner.Uid, b.Owner.Gid)
+	}
+	if b.RunAs != nil {
+		fmt.Fprintf(w, "Run as:\t%d:%d\n", b.RunAs.Uid, b.RunAs.Gid)
+	}
+	if len(b.Aliases) > 0 {
+		fmt.Fprintf(w, "Aliases:\t%s\n", strings.Join(b.Aliases, ", "))
+	}
+	if b.Quota != nil {
+		fmt.Fprintf(w, "Quota:\tbytes=%d objects=%d\n", b.Quota.MaxBytes, b.Quota.MaxObjects)
+	}
+	if len(b.Policy) > 0 {
+		fmt.Fprintf(w, "Policy:\tset\n")
+	}
+	if len(b.Networks) > 0 {
+		fmt.Fprintf(w, "Networks:\t%s\n", strings.Join(b.Networks, ", "))
+	}
+	if len(b.WriteNetworks) > 0 {
+		fmt.Fprintf(w, "Write networks:\t%s\n", strings.Join(b.WriteNetworks, ", "))
+	}
+	if len(b.VOs) > 0 {
+		fmt.Fprintf(w, "VOs:\t%s\n", strings.Join(b.VOs, ", "))
+	}
+	for _, k := range slices.Sorted(maps.Keys(b.Tags)) {
+		fmt.Fprintf(w, "Tag:\t%s=%s\n", k, b.Tags[k])
+	}
+}
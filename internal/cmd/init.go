@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+var initFlags = struct {
+	Force bool // Overwrite an existing config file
+}{}
+
+// initConfig is the config written by the init wizard.
+type initConfig struct {
+	Endpoint   string            `yaml:"endpoint,omitempty"`
+	GrpcURL    string            `yaml:"grpc_url"`
+	HttpURL    string            `yaml:"http_url"`
+	AuthKey    string            `yaml:"authkey"`
+	Insecure   bool              `yaml:"insecure"`
+	RootAccess string            `yaml:"root_access,omitempty"`
+	RootSecret string            `yaml:"root_secret,omitempty"`
+	Buckets    map[string]string `yaml:"buckets"`
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively create the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := globalFlags.Config
+		if _, err := os.Stat(path); err == nil && !initFlags.Force {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+		}
+
+		p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+		var c initConfig
+		c.GrpcURL = p.ask("EOS MGM gRPC address (host:port)", "localhost:50051")
+		c.HttpURL = p.ask("EOS MGM HTTP URL", "https://localhost:8444")
+		c.AuthKey = p.ask("EOS authkey", "")
+		c.Insecure = p.askBool("Disable TLS towards the MGM gRPC", false)
+
+		driver := p.askChoice("Meta store driver", "local", "local", "memory")
+		c.Buckets = map[string]string{"driver": driver}
+		if driver == "local" {
+			c.Buckets["folder"] = p.ask("Folder of the meta store", "/var/lib/eoss3")
+		}
+
+		c.Endpoint = p.ask("S3 endpoint of the gateway", "http://localhost:7070")
+		c.RootAccess = p.ask("Root access key", "admin")
+		c.RootSecret = p.ask("Root secret key (empty to generate one)", "")
+		if c.RootSecret == "" {
+			secret, err := randomSecret()
+			if err != nil {
+				return err
+			}
+			c.RootSecret = secret
+			fmt.Fprintf(os.Stdout, "Generated root secret key: %s\n", secret)
+		}
+		if p.err != nil {
+			return p.err
+		}
+
+		if c.AuthKey == "" {
+			return errors.New("the authkey is required")
+		}
+
+		if p.askBool("Test the connectivity now", true) {
+			if err := testInitConfig(cmd.Context(), &c); err != nil {
+				fmt.Fprintf(os.Stdout, "Connectivity test failed: %v\n", err)
+				if !p.askBool("Write the config anyway", false) {
+					return errors.New("aborted")
+				}
+			} else {
+				fmt.Fprintln(os.Stdout, "Connectivity test succeeded")
+			}
+		}
+		if p.err != nil {
+			return p.err
+		}
+
+		data, err := yaml.Marshal(c)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		// the file contains secrets
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Config written to %s\n", path)
+		return nil
+	},
+}
+
+// testInitConfig checks that the MGM is reachable
+// and the meta store can be opened.
+func testInitConfig(ctx context.Context, c *initConfig) error {
+	client, err := newEOSClient(&Config{
+		GrpcURL:  c.GrpcURL,
+		HttpURL:  c.HttpURL,
+		AuthKey:  c.AuthKey,
+		Insecure: c.Insecure,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := client.Ping(ctx); err != nil {
+		return fmt.Errorf("ping of %s: %w", c.GrpcURL, err)
+	}
+
+	buckets := make(map[string]any, len(c.Buckets))
+	for k, v := range c.Buckets {
+		buckets[k] = v
+	}
+	if _, err := meta.New(buckets); err != nil {
+		return fmt.Errorf("meta store: %w", err)
+	}
+	return nil
+}
+
+func randomSecret() (string, error) {
+	b := make([]byte, 30)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// prompter asks questions on out reading the answers from in.
+// The first error got is kept in err, and all the following
+// questions get the default answer.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	err error
+}
+
+func (p *prompter) ask(question, def string) string {
+	if p.err != nil {
+		return def
+	}
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		p.err = err
+		return def
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+func (p *prompter) askBool(question string, def bool) bool {
+	defAnswer := "no"
+	if def {
+		defAnswer = "yes"
+	}
+	for {
+		answer := p.ask(question+" (yes/no)", defAnswer)
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		if v, err := strconv.ParseBool(answer); err == nil {
+			return v
+		}
+		if p.err != nil {
+			return def
+		}
+		fmt.Fprintln(p.out, "Please answer yes or no")
+	}
+}
+
+func (p *prompter) askChoice(question, def string, choices ...string) string {
+	for {
+		answer := p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(choices, "/")), def)
+		for _, c := range choices {
+			if answer == c {
+				return c
+			}
+		}
+		if p.err != nil {
+			return def
+		}
+		fmt.Fprintf(p.out, "Please choose one of %s\n", strings.Join(choices, ", "))
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var migrateMetaFlags = struct {
+	From string // Location of the source store
+	To   string // Location of the destination store
+
+	FromKeyFile string // Key file of the encrypted source store
+	ToKeyFile   string // Key file of the encrypted destination store
+}{}
+
+var migrateMetaCmd = &cobra.Command{
+	Use:   "migrate-meta",
+	Short: "Copy the content of a meta store into another one",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var srcCfg map[string]any
+		if migrateMetaFlags.From != "" {
+			var err error
+			if srcCfg, err = meta.ParseLocation(migrateMetaFlags.From, meta.EncryptionConfig{KeyFile: migrateMetaFlags.FromKeyFile}); err != nil {
+				return err
+			}
+		} else {
+			cfg, err := getConfig()
+			if err != nil {
+				return err
+			}
+			srcCfg = cfg.Buckets
+		}
+
+		dstCfg, err := meta.ParseLocation(migrateMetaFlags.To, meta.EncryptionConfig{KeyFile: migrateMetaFlags.ToKeyFile})
+		if err != nil {
+			return err
+		}
+
+		src, err := meta.New(srcCfg)
+		if err != nil {
+			return err
+		}
+		dst, err := meta.New(dstCfg)
+		if err != nil {
+			return err
+		}
+
+		if globalFlags.DryRun {
+			fmt.Println("Dry run: nothing will be written")
+		}
+
+		return meta.Migrate(cmd.Context(), src, dst, meta.MigrateOptions{
+			DryRun: globalFlags.DryRun,
+			Progress: func(done, total int, item string) {
+				fmt.Printf("[%d/%d] %s\n", done, total, item)
+			},
+		})
+	},
+}
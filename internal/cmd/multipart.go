@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var cleanupMultipartFlags = struct {
+	OlderThan time.Duration // Minimum age of the uploads to abort
+	Bucket    string        // Only clean up the uploads of the bucket
+}{}
+
+// staleUpload is an incomplete multipart upload found by cleanup-multipart.
+type staleUpload struct {
+	meta.MultipartUpload
+	Folder  string `json:"folder"`
+	Aborted bool   `json:"aborted"`
+	Error   string `json:"error,omitempty"`
+}
+
+var cleanupMultipartCmd = &cobra.Command{
+	Use:   "cleanup-multipart",
+	Short: "Abort the incomplete multipart uploads older than a given age, removing their staging directories on EOS",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		var list []meta.Bucket
+		if cleanupMultipartFlags.Bucket != "" {
+			b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(cleanupMultipartFlags.Bucket))
+			if err != nil {
+				return err
+			}
+			list = []meta.Bucket{b}
+		} else if list, err = buckets.ListBuckets(cmd.Context()); err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		nobody, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+
+		cutoff := time.Now().Add(-cleanupMultipartFlags.OlderThan)
+		stale := []staleUpload{}
+		failed := 0
+		for _, b := range list {
+			uploads, err := buckets.ListMultipartUploads(cmd.Context(), b.Name)
+			if err != nil {
+				return err
+			}
+			for _, u := range uploads {
+				if !u.Initiated.Before(cutoff) {
+					continue
+				}
+				s := staleUpload{MultipartUpload: u, Folder: eos.MultipartFolder(b.Path, u.UploadId)}
+				if globalFlags.DryRun {
+					printDryRun("eos: rm -r %s", s.Folder)
+					printDryRun("meta: delete upload %s of bucket %s", u.UploadId, b.Name)
+				} else if err := abortUpload(cmd.Context(), client, nobody, buckets, s); err != nil {
+					s.Error = err.Error()
+					failed++
+				} else {
+					s.Aborted = true
+				}
+				stale = append(stale, s)
+			}
+		}
+
+		if err := printOutput(stale, outputTable, func(w io.Writer) {
+			fmt.Fprintln(w, "BUCKET\tUPLOAD\tINITIATOR\tINITIATED\tABORTED\tERROR")
+			for _, s := range stale {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%t\t%s\n", s.Bucket, s.UploadId, s.Initiator, formatTime(s.Initiated), s.Aborted, s.Error)
+			}
+		}); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to abort %d uploads", failed)
+		}
+		return nil
+	},
+}
+
+// abortUpload removes the staging folder of the upload, as its owner,
+// and then the upload record and its staged metadata. A missing folder
+// is not an error.
+func abortUpload(ctx context.Context, client *eos.Client, nobody eos.Auth, buckets meta.BucketStorer, s staleUpload) error {
+	stat, err := client.Stat(ctx, nobody, s.Folder)
+	var notFound *eos.ErrNoSuchResource
+	switch {
+	case errors.As(err, &notFound) || (err == nil && stat.Cmd == nil):
+		// already removed
+	case err != nil:
+		return err
+	default:
+		owner := eos.Auth{Uid: stat.Cmd.Uid, Gid: stat.Cmd.Gid}
+		if err := client.Remove(ctx, owner, s.Folder, true); err != nil {
+			return fmt.Errorf("error removing %s: %w", s.Folder, err)
+		}
+	}
+	if err := buckets.DeleteMultipartUpload(ctx, s.Bucket, s.UploadId); err != nil {
+		return err
+	}
+	_ = buckets.DeleteObjectMetadata(ctx, s.Bucket, meta.UploadMetadataKey(s.UploadId), "")
+	return nil
+}
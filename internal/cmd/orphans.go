@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var listOrphansFlags = struct {
+	Import bool // Register the directories not in the meta store
+	Delete bool // Unregister the buckets without directory
+}{}
+
+// orphan is a directory without bucket, or a bucket without directory.
+type orphan struct {
+	Kind   string `json:"kind"`
+	Bucket string `json:"bucket"`
+	Path   string `json:"path"`
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+const (
+	orphanDirectory = "directory"
+	orphanBucket    = "bucket"
+)
+
+var listOrphansCmd = &cobra.Command{
+	Use:   "list-orphans",
+	Short: "List the EOS directories under the default paths without bucket, and the buckets without directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		daemon, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		list, err := buckets.ListBuckets(ctx)
+		if err != nil {
+			return err
+		}
+		registered := make(map[string]struct{}, len(list))
+		for _, b := range list {
+			registered[trimTrailingSlash(b.Path)] = struct{}{}
+		}
+
+		orphans := []orphan{}
+
+		// buckets pointing to non existing directories
+		for _, b := range list {
+			if _, err := client.Stat(ctx, daemon, b.Path); err == nil {
+				continue
+			} else if e := (&eos.ErrNoSuchResource{}); !errors.As(err, &e) {
+				return fmt.Errorf("error statting %s: %w", b.Path, err)
+			}
+			o := orphan{Kind: orphanBucket, Bucket: b.Name, Path: b.Path}
+			if listOrphansFlags.Delete {
+				o.Action = "deleted"
+				if err := unregisterBucket(ctx, buckets, b); err != nil {
+					o.Action, o.Error = "", err.Error()
+				}
+			}
+			orphans = append(orphans, o)
+		}
+
+		// directories without bucket
+		parents, err := defaultParentPaths(ctx, buckets, cfg.DefaultBucketPath)
+		if err != nil {
+			return err
+		}
+		for _, parent := range parents {
+			var dirs []*erpc.ContainerMdProto
+			if err := client.ListDir(ctx, daemon, parent, func(md *erpc.MDResponse) {
+				if md.Type == erpc.TYPE_CONTAINER && md.Cmd != nil {
+					dirs = append(dirs, md.Cmd)
+				}
+			}, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing %s: %v\n", parent, err)
+				continue
+			}
+
+			for _, d := range dirs {
+				path := trimTrailingSlash(string(d.Path))
+				name := string(d.Name)
+				if _, ok := registered[path]; ok || !meta.IsValidBucketName(name) {
+					continue
+				}
+				o := orphan{Kind: orphanDirectory, Bucket: name, Path: path}
+				if listOrphansFlags.Import {
+					o.Action = "imported"
+					if err := registerDirectory(ctx, buckets, name, path, d); err != nil {
+						o.Action, o.Error = "", err.Error()
+					} else {
+						registered[path] = struct{}{}
+					}
+				}
+				orphans = append(orphans, o)
+			}
+		}
+
+		return printOutput(orphans, outputTable, func(w io.Writer) {
+			fmt.Fprintln(w, "KIND\tBUCKET\tPATH\tACTION")
+			for _, o := range orphans {
+				action := o.Action
+				if o.Error != "" {
+					action = "error: " + o.Error
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", o.Kind, o.Bucket, o.Path, action)
+			}
+		})
+	},
+}
+
+// defaultParentPaths returns the directories where the buckets
+// of the users are created by default.
+func defaultParentPaths(ctx context.Context, buckets meta.BucketStorer, global string) ([]string, error) {
+	uids, err := buckets.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	var parents []string
+	add := func(tmpl string, auth eos.Auth) {
+		parent, err := eos.BucketParentPath(tmpl, auth)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping default path %s: %v\n", tmpl, err)
+			return
+		}
+		if _, ok := seen[parent]; !ok {
+			seen[parent] = struct{}{}
+			parents = append(parents, parent)
+		}
+	}
+
+	for _, uid := range uids {
+		tmpl, err := buckets.GetDefaultBucketPath(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl == "" {
+			tmpl = global
+		}
+		if tmpl == "" {
+			continue
+		}
+
+		auth := eos.Auth{Uid: uint64(uid)}
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			if _, gid, err := getUidGid(u); err == nil {
+				auth.Gid = gid
+			}
+		}
+		add(tmpl, auth)
+	}
+
+	// a global template not depending on the user
+	if global != "" && !strings.ContainsAny(strings.NewReplacer("{bucket}", "").Replace(global), "{}") {
+		add(global, eos.Auth{})
+	}
+	return parents, nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+)
+
+// printOutput writes v on stdout in the format selected with --output,
+// or in def if not set. The json and yaml formats are rendered from
+// the json tags of v, while the table one is delegated to table.
+func printOutput(v any, def string, table func(w io.Writer)) error {
+	format := globalFlags.Output
+	if format == "" {
+		format = def
+	}
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// validateOutput checks the format set with --output.
+func validateOutput() error {
+	switch globalFlags.Output {
+	case "", outputJSON, outputYAML, outputTable:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q: must be one of json, yaml, table", globalFlags.Output)
+}
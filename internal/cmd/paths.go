@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os/user"
+	"slices"
+	"strconv"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+// userPaths holds the default paths of a user.
+type userPaths struct {
+	Uid      int               `json:"uid"`
+	Username string            `json:"username,omitempty"`
+	Default  string            `json:"default,omitempty"`
+	Named    map[string]string `json:"named,omitempty"`
+}
+
+var listDefaultPathsCmd = &cobra.Command{
+	Use:   "list-default-paths",
+	Short: "List the default EOS paths of all the users",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		uids, err := buckets.ListUsers(cmd.Context())
+		if err != nil {
+			return err
+		}
+		slices.Sort(uids)
+
+		list := []userPaths{}
+		for _, uid := range uids {
+			p := userPaths{Uid: uid}
+			if p.Default, err = buckets.GetDefaultBucketPath(cmd.Context(), uid); err != nil {
+				return err
+			}
+			if p.Named, err = buckets.ListDefaultBucketPaths(cmd.Context(), uid); err != nil {
+				return err
+			}
+			if p.Default == "" && len(p.Named) == 0 {
+				continue
+			}
+			if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+				p.Username = u.Username
+			}
+			list = append(list, p)
+		}
+
+		return printOutput(list, outputTable, func(w io.Writer) {
+			fmt.Fprintln(w, "UID\tUSER\tNAME\tPATH")
+			for _, p := range list {
+				if p.Default != "" {
+					fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", p.Uid, p.Username, "-", p.Default)
+				}
+				for _, name := range slices.Sorted(maps.Keys(p.Named)) {
+					fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", p.Uid, p.Username, name, p.Named[name])
+				}
+			}
+		})
+	},
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var setPolicyFlags = struct {
+	File string // File containing the policy, - for stdin
+}{}
+
+var setPolicyCmd = &cobra.Command{
+	Use:     "set-policy <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Set the policy of a bucket, overriding the one generated from the assignments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := readPolicy(setPolicyFlags.File)
+		if err != nil {
+			return err
+		}
+
+		return updatePolicy(cmd, strings.TrimSpace(args[0]), policy)
+	},
+}
+
+var getPolicyCmd = &cobra.Command{
+	Use:     "get-policy <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Get the policy set on a bucket",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+		if err != nil {
+			return err
+		}
+		if len(b.Policy) == 0 {
+			return fmt.Errorf("bucket %s has no policy set", b.Name)
+		}
+
+		var policy any
+		if err := json.Unmarshal(b.Policy, &policy); err != nil {
+			return err
+		}
+		return printOutput(policy, outputJSON, func(w io.Writer) {
+			fmt.Fprintln(w, string(b.Policy))
+		})
+	},
+}
+
+var deletePolicyCmd = &cobra.Command{
+	Use:     "delete-policy <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Delete the policy set on a bucket",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updatePolicy(cmd, strings.TrimSpace(args[0]), nil)
+	},
+}
+
+// readPolicy reads and validates the policy from file.
+func readPolicy(file string) (json.RawMessage, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Statement []json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if len(doc.Statement) == 0 {
+		return nil, errors.New("invalid policy: no statements")
+	}
+	return json.RawMessage(data), nil
+}
+
+func updatePolicy(cmd *cobra.Command, name string, policy json.RawMessage) error {
+	cfg, err := getConfig()
+	if err != nil {
+		return err
+	}
+
+	buckets, err := meta.New(cfg.Buckets)
+	if err != nil {
+		return err
+	}
+
+	b, err := buckets.GetBucket(cmd.Context(), name)
+	if err != nil {
+		return err
+	}
+
+	b.Policy = policy
+	if _, err := buckets.UpdateBucket(cmd.Context(), b); err != nil {
+		return err
+	}
+	return syncACLIfEnabled(cmd.Context(), cfg, buckets, b.Name)
+}
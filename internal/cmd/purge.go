@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var purgeBucketFlags = struct {
+	Parallel int  // Number of concurrent removals
+	Recycle  bool // Move the content in the recycle bin
+}{}
+
+var purgeBucketCmd = &cobra.Command{
+	Use:     "purge-bucket <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Erase the content of the bucket",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		bucketName := strings.TrimSpace(args[0])
+
+		b, err := buckets.GetBucket(cmd.Context(), bucketName)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		nobody, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+
+		stat, err := client.Stat(cmd.Context(), nobody, b.Path)
+		if err != nil {
+			return fmt.Errorf("Error statting %s: %w", b.Path, err)
+		}
+
+		if stat.Cmd == nil {
+			return fmt.Errorf("%s does not exist or is not a directory", b.Path)
+		}
+
+		owner := eos.Auth{Uid: stat.Cmd.Uid, Gid: stat.Cmd.Gid}
+
+		var files, dirs []string
+		var size uint64
+		sizes := make(map[string]uint64)
+		if err := client.ListDir(cmd.Context(), nobody, b.Path, func(m *erpc.MDResponse) {
+			if m.Cmd != nil {
+				dirs = append(dirs, string(m.Cmd.Path))
+			} else if m.Fmd != nil {
+				files = append(files, string(m.Fmd.Path))
+				sizes[string(m.Fmd.Path)] = m.Fmd.Size
+				size += m.Fmd.Size
+			}
+		}, &eos.ListDirFilters{Recursive: true}); err != nil {
+			return err
+		}
+
+		summary := purgeSummary{
+			Bucket:      b.Name,
+			DryRun:      globalFlags.DryRun,
+			Files:       len(files),
+			Bytes:       size,
+			Directories: len(dirs),
+		}
+
+		if globalFlags.DryRun {
+			summary.Paths = append(files, dirs...)
+			return printOutput(summary, outputTable, func(w io.Writer) {
+				for _, p := range summary.Paths {
+					fmt.Fprintln(w, p)
+				}
+				fmt.Fprintf(w, "Would remove %d files (%d bytes) and %d directories\n", len(files), size, len(dirs))
+			})
+		}
+
+		remove := client.Remove
+		if !purgeBucketFlags.Recycle {
+			remove = client.RemovePermanently
+		}
+
+		// files first, in parallel, then the directories
+		// starting from the deepest ones
+		var removedBytes atomic.Uint64
+		removedFiles, failed := runParallel(cmd.Context(), files, purgeBucketFlags.Parallel, func(ctx context.Context, path string) error {
+			if err := remove(ctx, owner, path, false); err != nil {
+				return fmt.Errorf("error removing %s: %w", path, err)
+			}
+			removedBytes.Add(sizes[path])
+			return nil
+		})
+
+		// the directories at the same depth are independent
+		// and are removed in parallel, the deepest first
+		levels := make(map[int][]string)
+		for _, d := range dirs {
+			depth := strings.Count(d, "/")
+			levels[depth] = append(levels[depth], d)
+		}
+		var removedDirs int
+		for _, depth := range slices.Backward(slices.Sorted(maps.Keys(levels))) {
+			removed, failedDirs := runParallel(cmd.Context(), levels[depth], purgeBucketFlags.Parallel, func(ctx context.Context, path string) error {
+				if err := remove(ctx, owner, path, true); err != nil {
+					return fmt.Errorf("error removing %s: %w", path, err)
+				}
+				return nil
+			})
+			removedDirs += removed
+			failed += failedDirs
+		}
+
+		// only the removed entries are reported
+		summary.Files = removedFiles
+		summary.Bytes = removedBytes.Load()
+		summary.Directories = removedDirs
+		summary.Errors = failed
+		if err := printOutput(summary, outputTable, func(w io.Writer) {
+			fmt.Fprintf(w, "Removed %d files (%d bytes) and %d directories, %d errors\n", summary.Files, summary.Bytes, summary.Directories, failed)
+		}); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to remove %d entries", failed)
+		}
+		return nil
+	},
+}
+
+// purgeSummary is the outcome of a purge.
+type purgeSummary struct {
+	Bucket      string   `json:"bucket"`
+	DryRun      bool     `json:"dry_run"`
+	Files       int      `json:"files"`
+	Bytes       uint64   `json:"bytes"`
+	Directories int      `json:"directories"`
+	Errors      int      `json:"errors"`
+	Paths       []string `json:"paths,omitempty"`
+}
+
+// runParallel runs f on all the items using at most parallel
+// concurrent workers, reporting the progress and the errors
+// on stderr. It returns the number of succeeded and failed items.
+func runParallel(ctx context.Context, items []string, parallel int, f func(context.Context, string) error) (int, int) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var done, succeeded, failed atomic.Int64
+	ch := make(chan string)
+	var wg sync.WaitGroup
+	for range parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range ch {
+				if err := f(ctx, item); err != nil {
+					fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+					failed.Add(1)
+				} else {
+					succeeded.Add(1)
+				}
+				fmt.Fprintf(os.Stderr, "\r%d/%d", done.Add(1), len(items))
+			}
+		}()
+	}
+
+	for _, item := range items {
+		ch <- item
+	}
+	close(ch)
+	wg.Wait()
+
+	if len(items) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	return int(succeeded.Load()), int(failed.Load())
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var setQuotaFlags = struct {
+	Bytes    string // Maximum size of the bucket
+	Objects  string // Maximum number of objects of the bucket
+	EosQuota bool   // Set also a quota node on EOS
+}{}
+
+var setQuotaCmd = &cobra.Command{
+	Use:     "set-quota <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Set the limits of a bucket. A zero limit removes it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("bytes") && !cmd.Flags().Changed("objects") {
+			return errors.New("at least one of --bytes and --objects is required")
+		}
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+		if err != nil {
+			return err
+		}
+
+		quota := meta.Quota{}
+		if b.Quota != nil {
+			quota = *b.Quota
+		}
+		if cmd.Flags().Changed("bytes") {
+			if quota.MaxBytes, err = parseSize(setQuotaFlags.Bytes, 1024); err != nil {
+				return fmt.Errorf("invalid --bytes: %w", err)
+			}
+		}
+		if cmd.Flags().Changed("objects") {
+			if quota.MaxObjects, err = parseSize(setQuotaFlags.Objects, 1000); err != nil {
+				return fmt.Errorf("invalid --objects: %w", err)
+			}
+		}
+
+		if setQuotaFlags.EosQuota {
+			if b.Owner == nil {
+				return errors.New("bucket has no owner, cannot set the EOS quota")
+			}
+			client, err := newEOSClient(cfg)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			root := eos.Auth{Uid: 0, Gid: 0}
+			owner := eos.Auth{Uid: b.Owner.Uid, Gid: b.Owner.Gid}
+			if err := client.SetQuota(cmd.Context(), root, b.Path, owner, quota.MaxBytes, quota.MaxObjects); err != nil {
+				return fmt.Errorf("error setting EOS quota on %s: %w", b.Path, err)
+			}
+		}
+
+		b.Quota = &quota
+		if quota.MaxBytes == 0 && quota.MaxObjects == 0 {
+			b.Quota = nil
+		}
+		_, err = buckets.UpdateBucket(cmd.Context(), b)
+		return err
+	},
+}
+
+// parseSize parses a number with an optional unit suffix
+// (K, M, G, T, P), using base as multiplier between units.
+// A trailing "B" and the binary forms (e.g. "Ki") are accepted.
+func parseSize(s string, base uint64) (uint64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	if strings.HasSuffix(s, "I") {
+		s = strings.TrimSuffix(s, "I")
+		base = 1024
+	}
+
+	mult := uint64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGTP", s[n-1]); i >= 0 {
+			for range i + 1 {
+				mult *= base
+			}
+			s = s[:n-1]
+		}
+	}
+
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * mult, nil
+}
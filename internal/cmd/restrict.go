@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var setRestrictionsFlags = struct {
+	Networks      []string // CIDRs of the clients allowed
+	WriteNetworks []string // CIDRs of the clients allowed to write
+	VOs           []string // Virtual organizations allowed
+}{}
+
+var setRestrictionsCmd = &cobra.Command{
+	Use:     "set-restrictions <bucket>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Restrict the access to a bucket to some networks and virtual organizations. An empty list removes the restriction",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		if !flags.Changed("network") && !flags.Changed("write-network") && !flags.Changed("vo") {
+			return errors.New("at least one of --network, --write-network and --vo is required")
+		}
+		if err := validateCIDRs(setRestrictionsFlags.Networks); err != nil {
+			return err
+		}
+		if err := validateCIDRs(setRestrictionsFlags.WriteNetworks); err != nil {
+			return err
+		}
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+		if err != nil {
+			return err
+		}
+
+		if flags.Changed("network") {
+			b.Networks = setRestrictionsFlags.Networks
+		}
+		if flags.Changed("write-network") {
+			b.WriteNetworks = setRestrictionsFlags.WriteNetworks
+		}
+		if flags.Changed("vo") {
+			b.VOs = setRestrictionsFlags.VOs
+		}
+		_, err = buckets.UpdateBucket(cmd.Context(), b)
+		return err
+	},
+}
+
+// validateCIDRs checks that the CIDRs, or single addresses, are valid.
+func validateCIDRs(cidrs []string) error {
+	for _, c := range cidrs {
+		var err error
+		if strings.Contains(c, "/") {
+			_, err = netip.ParsePrefix(c)
+		} else {
+			_, err = netip.ParseAddr(c)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid network %q", c)
+		}
+	}
+	return nil
+}
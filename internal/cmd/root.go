@@ -1,48 +1,216 @@
 package cmd
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
 	"strconv"
 	"strings"
 	"time"
 
-	go_eosgrpc "github.com/cern-eos/go-eosgrpc"
 	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/eoss3"
 	"github.com/gmgigi96/eoss3/meta"
-	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
-	yaml "sigs.k8s.io/yaml/goyaml.v3"
 )
 
 var globalFlags = struct {
-	Config string // Path of the config file to use
+	Config string   // Path of the config file to use
+	Output string   // Format of the output
+	Set    []string // Config fields overrides, in the form key=value
+	DryRun bool     // Only print the operations that would be executed
 }{}
 
 var rootCmd = &cobra.Command{
 	Use:   "eoss3",
 	Short: "A brief description of your application",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutput(); err != nil {
+			return err
+		}
+
+		// record who is running the command in the audit log
+		actor := "cli"
+		if u, err := user.Current(); err == nil {
+			actor += ":" + u.Username
+		}
+		cmd.SetContext(meta.WithActor(cmd.Context(), actor))
+		return nil
+	},
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&globalFlags.Config, "config", "c", "/etc/eoss3.yaml", "Path of the config file to use")
+	rootCmd.PersistentFlags().StringVarP(&globalFlags.Config, "config", "c", configPath(), "Path of the config file to use. Can be set with "+envConfig)
+	rootCmd.PersistentFlags().BoolVar(&globalFlags.DryRun, "dry-run", false, "Only print the EOS and meta operations that would be executed, without performing them")
+	rootCmd.PersistentFlags().StringArrayVar(&globalFlags.Set, "set", nil, "Override a config field, e.g. --set grpc_url=host:50051 or --set buckets.driver=memory. Fields can also be set with "+envPrefix+"<FIELD> environment variables, e.g. "+envPrefix+"BUCKETS__FOLDER")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.Output, "output", "", "Output format: json, yaml or table. Defaults to the one of the command")
 
 	rootCmd.AddCommand(createBucketCmd)
 	createBucketCmd.Flags().StringVarP(&createBucketFlags.Owner, "owner", "o", "", "User id of the owner of the bucket")
 	createBucketCmd.Flags().StringVarP(&createBucketFlags.Name, "name", "n", "", "Name of the new bucket")
 	createBucketCmd.Flags().StringVarP(&createBucketFlags.Path, "path", "p", "", "Path on EOS where the bucket is located")
+	createBucketCmd.Flags().StringVar(&createBucketFlags.RunAs, "run-as", "", "User, or uid:gid, used for all the operations on the bucket in place of the requester")
 
-	rootCmd.MarkFlagRequired("config")
 	createBucketCmd.MarkFlagRequired("owner")
 	createBucketCmd.MarkFlagRequired("name")
 	createBucketCmd.MarkFlagRequired("path")
 
+	rootCmd.AddCommand(importBucketCmd)
+	importBucketCmd.Flags().StringVarP(&importBucketFlags.Owner, "owner", "o", "", "User id of the owner of the bucket. Defaults to the owner of the directory")
+	importBucketCmd.Flags().StringVarP(&importBucketFlags.Name, "name", "n", "", "Name of the new bucket")
+	importBucketCmd.Flags().StringVarP(&importBucketFlags.Path, "path", "p", "", "Path on EOS of the existing directory")
+	importBucketCmd.MarkFlagRequired("name")
+	importBucketCmd.MarkFlagRequired("path")
+
 	rootCmd.AddCommand(setDefaultPathCmd)
+	setDefaultPathCmd.Flags().StringVar(&defaultPathFlags.Name, "name", "", "Name of the path, selectable at bucket creation with the eoss3:path tag. An empty path removes it")
 	rootCmd.AddCommand(getDefaultPathCmd)
+	getDefaultPathCmd.Flags().StringVar(&defaultPathFlags.Name, "name", "", "Name of the path")
+	rootCmd.AddCommand(listDefaultPathsCmd)
 	rootCmd.AddCommand(getBucketCmd)
+	rootCmd.AddCommand(bucketInfoCmd)
+	rootCmd.AddCommand(deleteBucketCmd)
+	deleteBucketCmd.Flags().BoolVar(&deleteBucketFlags.Rmdir, "rmdir", false, "Remove also the directory on EOS, if empty")
 	rootCmd.AddCommand(purgeBucketCmd)
+	purgeBucketCmd.Flags().IntVarP(&purgeBucketFlags.Parallel, "parallel", "p", 8, "Number of concurrent removals")
+	purgeBucketCmd.Flags().BoolVar(&purgeBucketFlags.Recycle, "recycle", true, "Move the content in the EOS recycle bin, so that it can be recovered")
+	rootCmd.AddCommand(setRunAsCmd)
+
+	rootCmd.AddCommand(addAliasCmd)
+	rootCmd.AddCommand(removeAliasCmd)
+
+	rootCmd.AddCommand(auditLogCmd)
+	auditLogCmd.Flags().StringVarP(&auditLogFlags.Bucket, "bucket", "b", "", "Show only the records of the bucket")
+	auditLogCmd.Flags().StringVarP(&auditLogFlags.User, "user", "u", "", "Show only the records involving the user")
+	auditLogCmd.Flags().StringVar(&auditLogFlags.Actor, "actor", "", "Show only the records of the actor")
+	auditLogCmd.Flags().DurationVar(&auditLogFlags.Since, "since", 0, "Show only the records newer than the duration")
+
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVarP(&watchFlags.Bucket, "bucket", "b", "", "Show only the operations on the bucket")
+	watchCmd.Flags().StringVarP(&watchFlags.User, "user", "u", "", "Show only the operations involving the user")
+	watchCmd.Flags().StringVar(&watchFlags.Actor, "actor", "", "Show only the operations of the actor (access key or cli:<user>)")
+	watchCmd.Flags().DurationVar(&watchFlags.Since, "since", 0, "Show also the operations done in the last duration before starting")
+	watchCmd.Flags().DurationVar(&watchFlags.Interval, "interval", 2*time.Second, "How often the log is polled")
+
+	rootCmd.AddCommand(healthCmd)
+	healthCmd.Flags().StringVar(&healthFlags.ScratchPath, "scratch-path", "", "EOS directory where a test file is written and read back")
+	healthCmd.Flags().StringVarP(&healthFlags.User, "user", "u", "", "User used to probe EOS. Defaults to daemon")
+	healthCmd.Flags().DurationVar(&healthFlags.Timeout, "timeout", 30*time.Second, "Timeout of the whole check")
+	healthCmd.MarkFlagRequired("scratch-path")
+
+	rootCmd.AddCommand(migrateMetaCmd)
+	migrateMetaCmd.Flags().StringVar(&migrateMetaFlags.From, "from", "", "Location of the source store (e.g. local:/var/lib/eoss3). Defaults to the configured one")
+	migrateMetaCmd.Flags().StringVar(&migrateMetaFlags.To, "to", "", "Location of the destination store (e.g. local:/var/lib/eoss3-new)")
+	migrateMetaCmd.Flags().StringVar(&migrateMetaFlags.FromKeyFile, "from-key-file", "", "Key file of the source store, if encrypted")
+	migrateMetaCmd.Flags().StringVar(&migrateMetaFlags.ToKeyFile, "to-key-file", "", "Key file of the destination store, to encrypt it")
+	migrateMetaCmd.MarkFlagRequired("to")
+
+	rootCmd.AddCommand(verifyMetaCmd)
+	verifyMetaCmd.Flags().BoolVar(&verifyMetaFlags.Repair, "repair", false, "Repair the problems found")
+
+	rootCmd.AddCommand(setQuotaCmd)
+	setQuotaCmd.Flags().StringVar(&setQuotaFlags.Bytes, "bytes", "", "Maximum size of the bucket (e.g. 500G, 1TB, 2TiB)")
+	setQuotaCmd.Flags().StringVar(&setQuotaFlags.Objects, "objects", "", "Maximum number of objects of the bucket (e.g. 1M)")
+	setQuotaCmd.Flags().BoolVar(&setQuotaFlags.EosQuota, "eos-quota", false, "Set also a quota node on EOS at the bucket path for the owner")
+
+	rootCmd.AddCommand(setPolicyCmd)
+	setPolicyCmd.Flags().StringVarP(&setPolicyFlags.File, "file", "f", "", "File containing the JSON policy, - to read from stdin")
+	setPolicyCmd.MarkFlagRequired("file")
+	rootCmd.AddCommand(getPolicyCmd)
+	rootCmd.AddCommand(deletePolicyCmd)
+	rootCmd.AddCommand(syncACLCmd)
+	rootCmd.AddCommand(setRestrictionsCmd)
+	setRestrictionsCmd.Flags().StringSliceVar(&setRestrictionsFlags.Networks, "network", nil, "CIDRs of the clients allowed to access the bucket")
+	setRestrictionsCmd.Flags().StringSliceVar(&setRestrictionsFlags.WriteNetworks, "write-network", nil, "CIDRs of the clients allowed to write in the bucket")
+	setRestrictionsCmd.Flags().StringSliceVar(&setRestrictionsFlags.VOs, "vo", nil, "Virtual organizations whose accounts are allowed to access the bucket")
+
+	rootCmd.AddCommand(fsckCmd)
+	fsckCmd.Flags().BoolVar(&fsckFlags.Repair, "repair", false, "Repair the discrepancies found")
+	fsckCmd.Flags().StringVar(&fsckFlags.Root, "root", "", "EOS directory scanned for directories not registered as bucket")
+
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVarP(&applyFlags.File, "file", "f", "", "Manifest with the desired buckets, - to read from stdin")
+	applyCmd.Flags().BoolVar(&applyFlags.Prune, "prune", false, "Unregister the buckets not in the manifest. The data on EOS is kept")
+	applyCmd.MarkFlagRequired("file")
+
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringVarP(&backupFlags.Output, "out", "o", "", "File where the backup is written, - for stdout")
+	backupCmd.MarkFlagRequired("out")
+
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVarP(&restoreFlags.Input, "in", "i", "", "File containing the backup, - for stdin")
+	restoreCmd.Flags().BoolVar(&restoreFlags.Merge, "merge", false, "Skip the buckets already existing in place of failing")
+	restoreCmd.MarkFlagRequired("in")
+
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().BoolVar(&versionFlags.Remote, "remote", false, "Probe also the EOS MGM")
+
+	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().BoolVar(&initFlags.Force, "force", false, "Overwrite the config file if existing")
+
+	rootCmd.AddCommand(listOrphansCmd)
+	listOrphansCmd.Flags().BoolVar(&listOrphansFlags.Import, "import", false, "Register the directories without bucket, assigning them to the directory owner")
+	listOrphansCmd.Flags().BoolVar(&listOrphansFlags.Delete, "delete", false, "Unregister the buckets whose directory does not exist")
+
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().BoolVar(&statsFlags.CSV, "csv", false, "Write the stats as CSV, ignoring --output")
+
+	rootCmd.AddCommand(credentialsCmd)
+	credentialsCmd.AddCommand(createCredentialCmd)
+	createCredentialCmd.Flags().StringVarP(&createCredentialFlags.User, "user", "u", "", "User the credential is mapped to")
+	createCredentialCmd.Flags().StringVar(&createCredentialFlags.Role, "role", "user", "Role of the account on the gateway (user, userplus, admin)")
+	createCredentialCmd.Flags().StringVar(&createCredentialFlags.Service, "service", "", "Service account the credential belongs to, for the non-human users")
+	createCredentialCmd.MarkFlagRequired("user")
+	credentialsCmd.AddCommand(listCredentialsCmd)
+	listCredentialsCmd.Flags().StringVarP(&listCredentialsFlags.User, "user", "u", "", "Show only the credentials of the user")
+	credentialsCmd.AddCommand(revokeCredentialCmd)
+	credentialsCmd.AddCommand(rotateCredentialCmd)
+	rotateCredentialCmd.Flags().DurationVar(&rotateCredentialFlags.Grace, "grace", 24*time.Hour, "Time the replaced key stays valid")
+	rotateCredentialCmd.Flags().BoolVar(&rotateCredentialFlags.Due, "due", false, "Rotate the keys of the service accounts older than --max-age")
+	rotateCredentialCmd.Flags().DurationVar(&rotateCredentialFlags.MaxAge, "max-age", 90*24*time.Hour, "Age of the keys rotated with --due")
+	credentialsCmd.AddCommand(expireCredentialsCmd)
+
+	rootCmd.AddCommand(cleanupMultipartCmd)
+	cleanupMultipartCmd.Flags().DurationVar(&cleanupMultipartFlags.OlderThan, "older-than", 7*24*time.Hour, "Minimum age of the uploads to abort")
+	cleanupMultipartCmd.Flags().StringVarP(&cleanupMultipartFlags.Bucket, "bucket", "b", "", "Only clean up the uploads of the bucket. Defaults to all the buckets")
+
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().IntVarP(&syncFlags.Parallel, "parallel", "p", 8, "Number of concurrent transfers")
+	syncCmd.Flags().StringVar(&syncFlags.Access, "access-key", "", "Access key of the account the buckets are accessed as, with its EOS identity. Defaults to the owner of each bucket")
+	rootCmd.AddCommand(cpCmd)
+	cpCmd.Flags().IntVarP(&syncFlags.Parallel, "parallel", "p", 8, "Number of concurrent transfers")
+	cpCmd.Flags().StringVar(&syncFlags.Access, "access-key", "", "Access key of the account the buckets are accessed as, with its EOS identity. Defaults to the owner of each bucket")
+
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.Flags().StringVar(&benchFlags.Path, "path", "", "EOS directory where the objects are written, in a .eoss3-bench subdirectory")
+	benchCmd.Flags().StringVar(&eosFlags.As, "as", "", "User running the operations. Defaults to daemon")
+	benchCmd.Flags().DurationVarP(&benchFlags.Duration, "duration", "d", 30*time.Second, "Duration of the run")
+	benchCmd.Flags().IntVarP(&benchFlags.Concurrency, "concurrency", "p", 8, "Number of concurrent clients")
+	benchCmd.Flags().StringVar(&benchFlags.Size, "size", "1MiB", "Size of the objects (e.g. 4K, 1MiB)")
+	benchCmd.Flags().IntVar(&benchFlags.Objects, "objects", 100, "Number of distinct objects")
+	benchCmd.Flags().StringVar(&benchFlags.Mix, "mix", "put=40,get=40,list=10,delete=10", "Weights of the operations")
+	benchCmd.Flags().BoolVar(&benchFlags.Keep, "keep", false, "Keep the objects at the end of the run")
+	benchCmd.Flags().BoolVar(&benchFlags.Backend, "backend", false, "Call the S3 methods of the gateway backend, configured by the gateway config, instead of the EOS client")
+	benchCmd.Flags().BoolVar(&benchFlags.FakeEOS, "fake-eos", false, "Run against an in-memory fake of EOS instead of the configured instance, e.g. to benchmark the backend alone")
+	benchCmd.MarkFlagRequired("path")
+
+	rootCmd.AddCommand(eosCmd)
+	eosCmd.PersistentFlags().StringVar(&eosFlags.As, "as", "", "User running the operations. Defaults to daemon")
+	eosCmd.AddCommand(eosStatCmd)
+	eosCmd.AddCommand(eosLsCmd)
+	eosLsCmd.Flags().BoolVarP(&eosFlags.Recursive, "recursive", "r", false, "List the directory recursively")
+	eosCmd.AddCommand(eosRmCmd)
+	eosRmCmd.Flags().BoolVarP(&eosFlags.Recursive, "recursive", "r", false, "Remove the directory recursively")
+	eosRmCmd.Flags().BoolVar(&eosFlags.NoRecycle, "no-recycle", false, "Remove bypassing the recycle bin")
+	eosCmd.AddCommand(eosXattrCmd)
+	eosXattrCmd.Flags().StringSliceVar(&eosFlags.Remove, "remove", nil, "Attributes to remove")
+
+	rootCmd.AddCommand(tagBucketCmd)
+	tagBucketCmd.Flags().StringSliceVar(&tagBucketFlags.Remove, "remove", nil, "Tags to remove")
+	rootCmd.AddCommand(setAttrCmd)
+	setAttrCmd.Flags().StringSliceVar(&setAttrFlags.Remove, "remove", nil, "Attributes to remove")
 }
 
 type Config struct {
@@ -53,6 +221,16 @@ type Config struct {
 	GrpcURL    string         `mapstructure:"grpc_url"`
 	HttpURL    string         `mapstructure:"http_url"`
 	AuthKey    string         `mapstructure:"authkey"`
+	Insecure   bool           `mapstructure:"insecure"`
+	Region     string         `mapstructure:"region"`
+
+	DefaultBucketPath string `mapstructure:"default_bucket_path"`
+	// SyncACL materializes the grants of the buckets as EOS ACLs
+	// when their policies are changed.
+	SyncACL bool `mapstructure:"sync_acl"`
+	// Identity is the mapping of the accounts of the gateway,
+	// resolving the principals of the policies to the EOS users.
+	Identity eoss3.IdentityConfig `mapstructure:"identity"`
 }
 
 func Execute() {
@@ -66,25 +244,16 @@ var createBucketFlags = struct {
 	Owner string // Username owner of the bucket
 	Name  string // Name of the bucket
 	Path  string // Path on EOS where the bucket is located
+	RunAs string // Username, or uid:gid, used for all the operations on the bucket
 }{}
 
-func getConfig() (*Config, error) {
-	f, err := os.Open(globalFlags.Config)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	var c map[string]any
-	if err := yaml.NewDecoder(f).Decode(&c); err != nil {
-		return nil, err
-	}
-
-	var cfg Config
-	if err := mapstructure.Decode(c, &cfg); err != nil {
-		return nil, err
-	}
-	return &cfg, nil
+func newEOSClient(cfg *Config) (*eos.Client, error) {
+	return eos.NewClient(eos.Config{
+		GrpcURL:  cfg.GrpcURL,
+		HttpURL:  cfg.HttpURL,
+		AuthKey:  cfg.AuthKey,
+		Insecure: cfg.Insecure,
+	})
 }
 
 func getUidGid(user *user.User) (uint64, uint64, error) {
@@ -101,6 +270,32 @@ func getUidGid(user *user.User) (uint64, uint64, error) {
 	return uid, gid, nil
 }
 
+// lookupIdentity returns the identity of the local user, or the
+// one given as uid:gid, e.g. for the service accounts not in NSS.
+func lookupIdentity(username string) (*meta.Identity, error) {
+	if uid, gid, ok := strings.Cut(username, ":"); ok {
+		u, err := strconv.ParseUint(uid, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %q", uid)
+		}
+		g, err := strconv.ParseUint(gid, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid %q", gid)
+		}
+		return &meta.Identity{Uid: u, Gid: g}, nil
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, gid, err := getUidGid(u)
+	if err != nil {
+		return nil, err
+	}
+	return &meta.Identity{Uid: uid, Gid: gid}, nil
+}
+
 var createBucketCmd = &cobra.Command{
 	Use:   "create-bucket",
 	Short: "Create an S3 bucket",
@@ -115,15 +310,6 @@ var createBucketCmd = &cobra.Command{
 			return err
 		}
 
-		client, err := eos.NewClient(eos.Config{
-			GrpcURL: cfg.GrpcURL,
-			HttpURL: cfg.HttpURL,
-			AuthKey: cfg.AuthKey,
-		})
-		if err != nil {
-			return err
-		}
-
 		owner, err := user.Lookup(createBucketFlags.Owner)
 		if err != nil {
 			return err
@@ -138,26 +324,35 @@ var createBucketCmd = &cobra.Command{
 			Name:      createBucketFlags.Name,
 			Path:      createBucketFlags.Path,
 			CreatedAt: time.Now(),
-		}
-		if err := buckets.CreateBucket(bucket); err != nil {
-			return err
+			Owner:     &meta.Identity{Uid: uid, Gid: gid},
 		}
 
-		if err := buckets.AssignBucket(createBucketFlags.Name, int(uid)); err != nil {
-			_ = buckets.DeleteBucket(bucket.Name)
-			return err
+		if createBucketFlags.RunAs != "" {
+			runAs, err := lookupIdentity(createBucketFlags.RunAs)
+			if err != nil {
+				return err
+			}
+			bucket.RunAs = runAs
 		}
 
-		auth := eos.Auth{
-			Uid: uid,
-			Gid: gid,
+		if globalFlags.DryRun {
+			auth := bucket.Owner
+			if bucket.RunAs != nil {
+				auth = bucket.RunAs
+			}
+			printDryRun("meta: create bucket record %s (path %s, owner %d:%d)", bucket.Name, bucket.Path, uid, gid)
+			printDryRun("meta: assign bucket %s to uid %d", bucket.Name, uid)
+			printDryRun("eos: mkdir %s as %d:%d", bucket.Path, auth.Uid, auth.Gid)
+			return nil
 		}
-		if err := client.Mkdir(cmd.Context(), auth, bucket.Path, 0755); err != nil {
-			_ = buckets.UnassignBucket(bucket.Name, int(uid))
-			_ = buckets.DeleteBucket(bucket.Name)
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
 			return err
 		}
-		return nil
+		defer client.Close()
+
+		return createBucket(cmd.Context(), buckets, client, bucket)
 	},
 }
 
@@ -178,12 +373,14 @@ var getBucketCmd = &cobra.Command{
 
 		bucketName := strings.TrimSpace(args[0])
 
-		b, err := buckets.GetBucket(bucketName)
+		b, err := buckets.GetBucket(cmd.Context(), bucketName)
 		if err != nil {
 			return err
 		}
 
-		return json.NewEncoder(os.Stdout).Encode(b)
+		return printOutput(b, outputJSON, func(w io.Writer) {
+			printBucketTable(w, b)
+		})
 	},
 }
 
@@ -204,24 +401,24 @@ func daemonEOSAuth() (eos.Auth, error) {
 	}, nil
 }
 
-var purgeBucketCmd = &cobra.Command{
-	Use:     "purge-bucket <bucket>",
-	PreRunE: cobra.ExactArgs(1),
-	Short:   "Erase the content of the bucket",
+var defaultPathFlags = struct {
+	Name string // Name of the default path
+}{}
+
+var setDefaultPathCmd = &cobra.Command{
+	Use:     "set-default-path <user> <path>",
+	PreRunE: cobra.ExactArgs(2),
+	Short:   "Set the default EOS path where to create the buckets",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := getConfig()
 		if err != nil {
 			return err
 		}
 
-		buckets, err := meta.New(cfg.Buckets)
-		if err != nil {
-			return err
-		}
-
-		bucketName := strings.TrimSpace(args[0])
+		username := strings.TrimSpace(args[0])
+		path := strings.TrimSpace(args[1])
 
-		b, err := buckets.GetBucket(bucketName)
+		buckets, err := meta.New(cfg.Buckets)
 		if err != nil {
 			return err
 		}
@@ -235,110 +432,240 @@ var purgeBucketCmd = &cobra.Command{
 			return err
 		}
 
-		nobody, err := daemonEOSAuth()
+		// check that the path on EOS exists
+		owner, err := user.Lookup(username)
 		if err != nil {
 			return err
 		}
 
-		stat, err := client.Stat(cmd.Context(), nobody, b.Path)
+		uid, gid, err := getUidGid(owner)
 		if err != nil {
-			return fmt.Errorf("Error statting %s: %w", b.Path, err)
+			return err
 		}
 
-		if stat.Cmd == nil {
-			return fmt.Errorf("%s does not exist or is not a directory", b.Path)
+		// templated paths are resolved only at bucket creation,
+		// while an empty path removes the setting
+		if path != "" && !strings.ContainsRune(path, '{') {
+			auth := eos.Auth{
+				Uid: uid,
+				Gid: gid,
+			}
+			if _, err := client.Stat(cmd.Context(), auth, path); err != nil {
+				return err
+			}
 		}
 
-		owner := eos.Auth{Uid: stat.Cmd.Uid, Gid: stat.Cmd.Gid}
+		if defaultPathFlags.Name != "" {
+			return buckets.StoreNamedDefaultBucketPath(cmd.Context(), int(uid), defaultPathFlags.Name, path)
+		}
+		return buckets.StoreDefaultBucketPath(cmd.Context(), int(uid), path)
+	},
+}
 
-		if err := client.ListDir(cmd.Context(), nobody, b.Path, func(m *go_eosgrpc.MDResponse) {
-			var path string
-			if m.Cmd != nil {
-				path = string(m.Cmd.Path)
-			} else {
-				path = string(m.Fmd.Path)
-			}
+var getDefaultPathCmd = &cobra.Command{
+	Use:     "get-default-path <user>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Get the default EOS path where to create the buckets for the user",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		username := strings.TrimSpace(args[0])
+
+		// check that the path on EOS exists
+		owner, err := user.Lookup(username)
+		if err != nil {
+			return err
+		}
+
+		uid, _, err := getUidGid(owner)
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
 
-			if err := client.Remove(cmd.Context(), owner, path, true); err != nil {
-				fmt.Printf("Error removing %s: %v\n", path, err)
+		var path string
+		if defaultPathFlags.Name != "" {
+			paths, err := buckets.ListDefaultBucketPaths(cmd.Context(), int(uid))
+			if err != nil {
+				return err
 			}
-		}, nil); err != nil {
+			path = paths[defaultPathFlags.Name]
+		} else if path, err = buckets.GetDefaultBucketPath(cmd.Context(), int(uid)); err != nil {
 			return err
 		}
 
-		return nil
+		out := struct {
+			User string `json:"user"`
+			Name string `json:"name,omitempty"`
+			Path string `json:"path"`
+		}{User: owner.Username, Name: defaultPathFlags.Name, Path: path}
+		return printOutput(out, outputTable, func(w io.Writer) {
+			fmt.Fprintln(w, path)
+		})
 	},
 }
 
-var setDefaultPathCmd = &cobra.Command{
-	Use:     "set-default-path <user> <path>",
-	PreRunE: cobra.ExactArgs(2),
-	Short:   "Set the default EOS path where to create the buckets",
+var setRunAsCmd = &cobra.Command{
+	Use:     "set-run-as <bucket> [<user>]",
+	PreRunE: cobra.RangeArgs(1, 2),
+	Short:   "Set the user, or uid:gid, used for all the operations on the bucket. Without user the override is removed",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := getConfig()
 		if err != nil {
 			return err
 		}
 
-		username := strings.TrimSpace(args[0])
-		path := strings.TrimSpace(args[1])
-
 		buckets, err := meta.New(cfg.Buckets)
 		if err != nil {
 			return err
 		}
 
-		client, err := eos.NewClient(eos.Config{
-			GrpcURL: cfg.GrpcURL,
-			HttpURL: cfg.HttpURL,
-			AuthKey: cfg.AuthKey,
-		})
+		bucketName := strings.TrimSpace(args[0])
+
+		b, err := buckets.GetBucket(cmd.Context(), bucketName)
 		if err != nil {
 			return err
 		}
 
-		// check that the path on EOS exists
-		owner, err := user.Lookup(username)
+		b.RunAs = nil
+		if len(args) == 2 {
+			runAs, err := lookupIdentity(strings.TrimSpace(args[1]))
+			if err != nil {
+				return err
+			}
+			b.RunAs = runAs
+		}
+
+		_, err = buckets.UpdateBucket(cmd.Context(), b)
+		return err
+	},
+}
+
+var verifyMetaFlags = struct {
+	Repair bool // Repair the problems found
+}{}
+
+var verifyMetaCmd = &cobra.Command{
+	Use:   "verify-meta",
+	Short: "Verify the integrity of the meta store",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
 		if err != nil {
 			return err
 		}
 
-		uid, gid, err := getUidGid(owner)
+		buckets, err := meta.New(cfg.Buckets)
 		if err != nil {
 			return err
 		}
 
-		auth := eos.Auth{
-			Uid: uid,
-			Gid: gid,
+		v, ok := buckets.(meta.Verifier)
+		if !ok {
+			return errors.New("meta driver does not support verification")
 		}
-		if _, err := client.Stat(cmd.Context(), auth, path); err != nil {
+
+		problems, err := v.Verify(cmd.Context(), verifyMetaFlags.Repair)
+		if err != nil {
 			return err
 		}
 
-		return buckets.StoreDefaultBucketPath(int(uid), path)
+		out := make([]problemOutput, 0, len(problems))
+		for _, p := range problems {
+			o := problemOutput{Kind: p.Kind.String(), Bucket: p.Bucket, Repaired: p.Repaired}
+			if p.Kind == meta.DanglingAssignment || p.Kind == meta.CorruptedUserMetadata {
+				o.Uid = Ptr(p.Uid)
+			}
+			if p.Err != nil {
+				o.Error = p.Err.Error()
+			}
+			out = append(out, o)
+		}
+		if err := printOutput(out, outputTable, func(w io.Writer) {
+			for _, p := range problems {
+				fmt.Fprintln(w, p)
+			}
+		}); err != nil {
+			return err
+		}
+
+		for _, p := range problems {
+			if !p.Repaired {
+				return fmt.Errorf("found %d problems", len(problems))
+			}
+		}
+		return nil
 	},
 }
 
-var getDefaultPathCmd = &cobra.Command{
-	Use:     "get-default-path <user>",
-	PreRunE: cobra.ExactArgs(1),
-	Short:   "Get the default EOS path where to create the buckets for the user",
+// problemOutput is the structured output of a problem of the meta store.
+type problemOutput struct {
+	Kind     string `json:"kind"`
+	Bucket   string `json:"bucket,omitempty"`
+	Uid      *int   `json:"uid,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+var addAliasCmd = &cobra.Command{
+	Use:     "add-alias <bucket> <alias>",
+	PreRunE: cobra.ExactArgs(2),
+	Short:   "Add an alternative name for the bucket",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := getConfig()
 		if err != nil {
 			return err
 		}
 
-		username := strings.TrimSpace(args[0])
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
 
-		// check that the path on EOS exists
-		owner, err := user.Lookup(username)
+		bucketName := strings.TrimSpace(args[0])
+		alias := strings.TrimSpace(args[1])
+
+		return buckets.AddAlias(cmd.Context(), bucketName, alias)
+	},
+}
+
+var removeAliasCmd = &cobra.Command{
+	Use:     "remove-alias <alias>",
+	PreRunE: cobra.ExactArgs(1),
+	Short:   "Remove an alternative name of a bucket",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
 		if err != nil {
 			return err
 		}
 
-		uid, _, err := getUidGid(owner)
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		return buckets.RemoveAlias(cmd.Context(), strings.TrimSpace(args[0]))
+	},
+}
+
+var auditLogFlags = struct {
+	Bucket string        // Show only the records of the bucket
+	User   string        // Show only the records involving the user
+	Actor  string        // Show only the records of the actor
+	Since  time.Duration // Show only the records newer than the duration
+}{}
+
+var auditLogCmd = &cobra.Command{
+	Use:   "audit-log",
+	Short: "Show the log of the changes to the meta store",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
 		if err != nil {
 			return err
 		}
@@ -348,12 +675,61 @@ var getDefaultPathCmd = &cobra.Command{
 			return err
 		}
 
-		path, err := buckets.GetDefaultBucketPath(int(uid))
+		filter, err := newAuditFilter(auditLogFlags.Bucket, auditLogFlags.User, auditLogFlags.Actor, auditLogFlags.Since)
 		if err != nil {
 			return err
 		}
 
-		fmt.Println(path)
-		return nil
+		records, err := buckets.ListAuditRecords(cmd.Context(), filter)
+		if err != nil {
+			return err
+		}
+		if records == nil {
+			records = []meta.AuditRecord{}
+		}
+
+		return printOutput(records, outputJSON, func(w io.Writer) {
+			fmt.Fprintln(w, "TIME\tACTOR\tACTION\tBUCKET\tUID\tDETAILS")
+			for _, r := range records {
+				printAuditRecord(w, r)
+			}
+		})
 	},
 }
+
+// newAuditFilter returns the filter selecting the records of the bucket,
+// involving the user, done by the actor and newer than since.
+// Empty values match all the records.
+func newAuditFilter(bucket, username, actor string, since time.Duration) (meta.AuditFilter, error) {
+	filter := meta.AuditFilter{
+		Bucket: bucket,
+		Actor:  actor,
+	}
+	if since > 0 {
+		filter.Since = time.Now().Add(-since)
+	}
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			return meta.AuditFilter{}, err
+		}
+		uid, _, err := getUidGid(u)
+		if err != nil {
+			return meta.AuditFilter{}, err
+		}
+		filter.Uid = Ptr(int(uid))
+	}
+	return filter, nil
+}
+
+func printAuditRecord(w io.Writer, r meta.AuditRecord) {
+	uid := "-"
+	if r.Uid != nil {
+		uid = fmt.Sprint(*r.Uid)
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Format(time.RFC3339), r.Actor, r.Action, r.Bucket, uid, r.Details)
+}
+
+func Ptr[T any](v T) *T {
+	return &v
+}
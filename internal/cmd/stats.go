@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	erpc "github.com/cern-eos/go-eosgrpc"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var statsFlags = struct {
+	CSV bool // Write the stats as CSV
+}{}
+
+// bucketStats is the usage of a bucket.
+type bucketStats struct {
+	Bucket       string    `json:"bucket"`
+	Path         string    `json:"path"`
+	Objects      uint64    `json:"objects"`
+	Bytes        int64     `json:"bytes"`
+	LastActivity time.Time `json:"last_activity,omitzero"`
+	MaxBytes     uint64    `json:"max_bytes,omitempty"`
+	MaxObjects   uint64    `json:"max_objects,omitempty"`
+	// BytesUsage and ObjectsUsage are the percentages
+	// of the quota used, if a quota is set.
+	BytesUsage   float64 `json:"bytes_usage,omitempty"`
+	ObjectsUsage float64 `json:"objects_usage,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+var statsCmd = &cobra.Command{
+	Use:     "stats [<bucket>]",
+	PreRunE: cobra.MaximumNArgs(1),
+	Short:   "Report the usage of all the buckets or of a single one",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		daemon, err := daemonEOSAuth()
+		if err != nil {
+			return err
+		}
+
+		var list []meta.Bucket
+		if len(args) == 1 {
+			b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+			if err != nil {
+				return err
+			}
+			list = []meta.Bucket{b}
+		} else if list, err = buckets.ListBuckets(cmd.Context()); err != nil {
+			return err
+		}
+
+		stats := make([]bucketStats, 0, len(list))
+		for _, b := range list {
+			stats = append(stats, getBucketStats(cmd.Context(), client, daemon, b))
+		}
+
+		if statsFlags.CSV {
+			return writeStatsCSV(os.Stdout, stats)
+		}
+		return printOutput(stats, outputTable, func(w io.Writer) {
+			fmt.Fprintln(w, "BUCKET\tOBJECTS\tBYTES\tLAST ACTIVITY\tQUOTA BYTES\tQUOTA OBJECTS")
+			for _, s := range stats {
+				if s.Error != "" {
+					fmt.Fprintf(w, "%s\terror: %s\n", s.Bucket, s.Error)
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", s.Bucket, s.Objects, s.Bytes, formatTime(s.LastActivity),
+					formatUsage(s.MaxBytes, s.BytesUsage), formatUsage(s.MaxObjects, s.ObjectsUsage))
+			}
+		})
+	},
+}
+
+// getBucketStats collects the usage of the bucket. The number of objects
+// is taken from the EOS quota node of the bucket, if any, otherwise
+// the bucket is listed recursively.
+func getBucketStats(ctx context.Context, client *eos.Client, auth eos.Auth, b meta.Bucket) bucketStats {
+	s := bucketStats{Bucket: b.Name, Path: b.Path}
+	if b.Quota != nil {
+		s.MaxBytes, s.MaxObjects = b.Quota.MaxBytes, b.Quota.MaxObjects
+	}
+
+	stat, err := client.Stat(ctx, auth, b.Path)
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+	if stat.Type != erpc.TYPE_CONTAINER || stat.Cmd == nil {
+		s.Error = "not a directory"
+		return s
+	}
+	s.Bytes = stat.Cmd.TreeSize
+	s.LastActivity = protoTime(stat.Cmd.Stime)
+	if mtime := protoTime(stat.Cmd.Mtime); mtime.After(s.LastActivity) {
+		s.LastActivity = mtime
+	}
+
+	objects, ok := quotaNodeFiles(ctx, client, eos.Auth{Uid: stat.Cmd.Uid, Gid: stat.Cmd.Gid}, b.Path)
+	if !ok {
+		if err := client.ListDir(ctx, auth, b.Path, func(md *erpc.MDResponse) {
+			if md.Fmd == nil {
+				return
+			}
+			path := string(md.Fmd.Path)
+			if eos.IsVersionFolder(path) || eos.IsAtomicFile(path) || eos.IsMultipartFolder(path) {
+				return
+			}
+			objects++
+		}, &eos.ListDirFilters{Recursive: true}); err != nil {
+			s.Error = err.Error()
+			return s
+		}
+	}
+	s.Objects = objects
+
+	if s.MaxBytes > 0 {
+		s.BytesUsage = 100 * float64(s.Bytes) / float64(s.MaxBytes)
+	}
+	if s.MaxObjects > 0 {
+		s.ObjectsUsage = 100 * float64(s.Objects) / float64(s.MaxObjects)
+	}
+	return s
+}
+
+// quotaNodeFiles returns the number of files accounted
+// in the quota node rooted at path, if existing.
+func quotaNodeFiles(ctx context.Context, client *eos.Client, auth eos.Auth, path string) (uint64, bool) {
+	nodes, err := client.GetQuota(ctx, auth, path)
+	if err != nil {
+		return 0, false
+	}
+	for _, n := range nodes {
+		if trimTrailingSlash(string(n.Path)) == trimTrailingSlash(path) {
+			return n.Usedfiles, true
+		}
+	}
+	return 0, false
+}
+
+func writeStatsCSV(w io.Writer, stats []bucketStats) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"bucket", "path", "objects", "bytes", "last_activity", "max_bytes", "max_objects", "bytes_usage", "objects_usage", "error"})
+	for _, s := range stats {
+		_ = cw.Write([]string{
+			s.Bucket,
+			s.Path,
+			strconv.FormatUint(s.Objects, 10),
+			strconv.FormatInt(s.Bytes, 10),
+			formatTime(s.LastActivity),
+			strconv.FormatUint(s.MaxBytes, 10),
+			strconv.FormatUint(s.MaxObjects, 10),
+			strconv.FormatFloat(s.BytesUsage, 'f', 2, 64),
+			strconv.FormatFloat(s.ObjectsUsage, 'f', 2, 64),
+			s.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func protoTime(t *erpc.Time) time.Time {
+	if t == nil || (t.Sec == 0 && t.NSec == 0) {
+		return time.Time{}
+	}
+	return time.Unix(int64(t.Sec), int64(t.NSec))
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatUsage(limit uint64, usage float64) string {
+	if limit == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%% of %d", usage, limit)
+}
@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/eoss3"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+	"github.com/versity/versitygw/auth"
+	"github.com/versity/versitygw/s3response"
+)
+
+const s3Scheme = "s3://"
+
+var syncFlags = struct {
+	Parallel int    // Number of concurrent transfers
+	Access   string // Access key of the account accessing the buckets
+}{}
+
+var syncCmd = &cobra.Command{
+	Use:     "sync <src> <dst>",
+	PreRunE: cobra.ExactArgs(2),
+	Short:   "Copy the objects missing or differing in size from src to dst. Each of them is either s3://<bucket>[/<prefix>] or a local directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return transfer(cmd.Context(), args[0], args[1], false)
+	},
+}
+
+var cpCmd = &cobra.Command{
+	Use:     "cp <src> <dst>",
+	PreRunE: cobra.ExactArgs(2),
+	Short:   "Copy all the objects from src to dst. Each of them is either s3://<bucket>[/<prefix>] or a local directory",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return transfer(cmd.Context(), args[0], args[1], true)
+	},
+}
+
+// transferEndpoint is the source or the destination of a transfer.
+type transferEndpoint interface {
+	// list returns the size of the objects, by key.
+	list(ctx context.Context) (map[string]uint64, error)
+	open(ctx context.Context, key string) (io.ReadCloser, error)
+	write(ctx context.Context, key string, r io.Reader, size uint64) error
+	String() string
+}
+
+// transfer copies the objects from src to dst. Unless overwrite,
+// the objects existing in dst with the same size are skipped.
+func transfer(ctx context.Context, srcArg, dstArg string, overwrite bool) error {
+	var client *s3Client
+	if strings.HasPrefix(srcArg, s3Scheme) || strings.HasPrefix(dstArg, s3Scheme) {
+		var err error
+		if client, err = newS3Client(); err != nil {
+			return err
+		}
+		defer client.be.Shutdown()
+	}
+
+	src, err := newTransferEndpoint(ctx, client, srcArg)
+	if err != nil {
+		return err
+	}
+	dst, err := newTransferEndpoint(ctx, client, dstArg)
+	if err != nil {
+		return err
+	}
+
+	srcObjects, err := src.list(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing %s: %w", src, err)
+	}
+	dstObjects, err := dst.list(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing %s: %w", dst, err)
+	}
+
+	var keys []string
+	var size uint64
+	for k, s := range srcObjects {
+		if ds, ok := dstObjects[k]; ok && ds == s && !overwrite {
+			continue
+		}
+		keys = append(keys, k)
+		size += s
+	}
+	slices.Sort(keys)
+
+	if globalFlags.DryRun {
+		for _, k := range keys {
+			printDryRun("copy %s from %s to %s", k, src, dst)
+		}
+		return nil
+	}
+
+	copied, failed := runParallel(ctx, keys, syncFlags.Parallel, func(ctx context.Context, key string) error {
+		r, err := src.open(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", key, err)
+		}
+		defer r.Close()
+		if err := dst.write(ctx, key, r, srcObjects[key]); err != nil {
+			return fmt.Errorf("error writing %s: %w", key, err)
+		}
+		return nil
+	})
+
+	fmt.Printf("Copied %d objects (%d bytes), %d skipped, %d errors\n", copied, size, len(srcObjects)-len(keys), failed)
+	if failed > 0 {
+		return fmt.Errorf("failed to copy %d objects", failed)
+	}
+	return nil
+}
+
+// s3Client accesses the buckets through the backend of the gateway,
+// with the identities, the checks and the filters of the requests.
+type s3Client struct {
+	be      *eoss3.EosBackend
+	buckets meta.BucketStorer
+	creds   meta.CredentialStorer
+}
+
+func newS3Client() (*s3Client, error) {
+	cfg, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+	gwCfg, err := getGatewayConfig()
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := meta.New(cfg.Buckets)
+	if err != nil {
+		return nil, err
+	}
+	be, err := newCLIBackend(gwCfg, buckets, nil)
+	if err != nil {
+		return nil, err
+	}
+	creds, _ := buckets.(meta.CredentialStorer)
+	return &s3Client{be: be, buckets: buckets, creds: creds}, nil
+}
+
+// account returns the account accessing the bucket: the one of
+// --access-key if set, otherwise one with the identity of the owner.
+// The backend operates with the run-as identity of the bucket if set.
+func (c *s3Client) account(ctx context.Context, b meta.Bucket) (auth.Account, error) {
+	if syncFlags.Access != "" {
+		acct := auth.Account{Access: syncFlags.Access}
+		if c.creds != nil {
+			if cred, err := c.creds.GetCredential(ctx, syncFlags.Access); err == nil {
+				acct.UserID, acct.GroupID = int(cred.Uid), int(cred.Gid)
+			}
+		}
+		return acct, nil
+	}
+	switch {
+	case b.Owner != nil:
+		return auth.Account{Access: "cli", UserID: int(b.Owner.Uid), GroupID: int(b.Owner.Gid)}, nil
+	case b.RunAs != nil:
+		return auth.Account{Access: "cli"}, nil
+	}
+	return auth.Account{}, fmt.Errorf("bucket %s has no owner: set the account with --access-key", b.Name)
+}
+
+func newTransferEndpoint(ctx context.Context, client *s3Client, arg string) (transferEndpoint, error) {
+	if !strings.HasPrefix(arg, s3Scheme) {
+		return localEndpoint{dir: arg}, nil
+	}
+
+	name, prefix, _ := strings.Cut(strings.TrimPrefix(arg, s3Scheme), "/")
+	b, err := client.buckets.GetBucket(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("bucket %s: %w", name, err)
+	}
+	acct, err := client.account(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	return bucketEndpoint{
+		be:     client.be,
+		acct:   acct,
+		bucket: name,
+		prefix: prefix,
+		name:   arg,
+	}, nil
+}
+
+// bucketEndpoint is a bucket, or a prefix of it, accessed
+// through the backend by the account acct.
+type bucketEndpoint struct {
+	be     *eoss3.EosBackend
+	acct   auth.Account
+	bucket string
+	prefix string
+	name   string
+}
+
+func (e bucketEndpoint) list(ctx context.Context) (map[string]uint64, error) {
+	ctx = eoss3.WithAccount(ctx, e.acct)
+	objects := make(map[string]uint64)
+	var token *string
+	for {
+		res, err := e.be.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(e.bucket),
+			Prefix:            aws.String(e.prefix),
+			Delimiter:         aws.String(""),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range res.Contents {
+			key := strings.TrimPrefix(aws.ToString(o.Key), e.prefix)
+			if key == "" || strings.HasSuffix(key, "/") {
+				// the folders
+				continue
+			}
+			objects[key] = uint64(aws.ToInt64(o.Size))
+		}
+		if !aws.ToBool(res.IsTruncated) {
+			return objects, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+func (e bucketEndpoint) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := e.be.GetObject(eoss3.WithAccount(ctx, e.acct), &s3.GetObjectInput{
+		Bucket: aws.String(e.bucket),
+		Key:    aws.String(e.prefix + key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (e bucketEndpoint) write(ctx context.Context, key string, r io.Reader, size uint64) error {
+	_, err := e.be.PutObject(eoss3.WithAccount(ctx, e.acct), s3response.PutObjectInput{
+		Bucket:        aws.String(e.bucket),
+		Key:           aws.String(e.prefix + key),
+		Body:          r,
+		ContentLength: aws.Int64(int64(size)),
+	})
+	return err
+}
+
+func (e bucketEndpoint) String() string { return e.name }
+
+// localEndpoint is a directory on the local filesystem.
+type localEndpoint struct {
+	dir string
+}
+
+func (l localEndpoint) list(ctx context.Context) (map[string]uint64, error) {
+	objects := make(map[string]uint64)
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		objects[filepath.ToSlash(rel)] = uint64(info.Size())
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return objects, nil
+	}
+	return objects, err
+}
+
+func (l localEndpoint) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(l.dir, filepath.FromSlash(key)))
+}
+
+func (l localEndpoint) write(ctx context.Context, key string, r io.Reader, size uint64) error {
+	p := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := eos.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (l localEndpoint) String() string { return l.dir }
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gmgigi96/eoss3/eos"
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+)
+
+var tagBucketFlags = struct {
+	Remove []string // Tags to remove
+}{}
+
+var tagBucketCmd = &cobra.Command{
+	Use:     "tag-bucket <bucket> [<key>=<value>...]",
+	PreRunE: cobra.MinimumNArgs(1),
+	Short:   "Set or remove tags of a bucket",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		set, err := parseKeyValues(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(set) == 0 && len(tagBucketFlags.Remove) == 0 {
+			return fmt.Errorf("no tags to set or remove")
+		}
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+		if err != nil {
+			return err
+		}
+
+		if b.Tags == nil {
+			b.Tags = make(map[string]string, len(set))
+		}
+		for k, v := range set {
+			b.Tags[k] = v
+		}
+		for _, k := range tagBucketFlags.Remove {
+			delete(b.Tags, k)
+		}
+
+		_, err = buckets.UpdateBucket(cmd.Context(), b)
+		return err
+	},
+}
+
+var setAttrFlags = struct {
+	Remove []string // Attributes to remove
+}{}
+
+var setAttrCmd = &cobra.Command{
+	Use:     "set-attr <bucket> [<key>=<value>...]",
+	PreRunE: cobra.MinimumNArgs(1),
+	Short:   "Set or remove extended attributes of the bucket directory on EOS (e.g. sys.forced.layout=replica)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		set, err := parseKeyValues(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(set) == 0 && len(setAttrFlags.Remove) == 0 {
+			return fmt.Errorf("no attributes to set or remove")
+		}
+
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		b, err := buckets.GetBucket(cmd.Context(), strings.TrimSpace(args[0]))
+		if err != nil {
+			return err
+		}
+
+		client, err := newEOSClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		// sys.* attributes can only be changed by root
+		root := eos.Auth{Uid: 0, Gid: 0}
+		if err := client.SetXattrs(cmd.Context(), root, b.Path, set, setAttrFlags.Remove); err != nil {
+			return fmt.Errorf("error setting attributes on %s: %w", b.Path, err)
+		}
+		return nil
+	},
+}
+
+// parseKeyValues parses a list of key=value pairs.
+func parseKeyValues(args []string) (map[string]string, error) {
+	m := make(map[string]string, len(args))
+	for _, a := range args {
+		k, v, ok := strings.Cut(a, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid %q: expected key=value", a)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
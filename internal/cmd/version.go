@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// version is the version of the build, set at build time with
+// -ldflags "-X github.com/gmgigi96/eoss3/internal/cmd.version=<version>".
+// If not set, the module version is used.
+var version string
+
+var versionFlags = struct {
+	Remote bool // Probe also the EOS MGM
+}{}
+
+type versionInfo struct {
+	Version   string      `json:"version"`
+	Commit    string      `json:"commit,omitempty"`
+	BuildTime string      `json:"build_time,omitempty"`
+	GoVersion string      `json:"go_version"`
+	Platform  string      `json:"platform"`
+	Remote    *remoteInfo `json:"remote,omitempty"`
+}
+
+// remoteInfo is what is known of the EOS MGM.
+// The gRPC interface does not expose the version of the MGM,
+// so only its namespace status is reported.
+type remoteInfo struct {
+	GrpcURL     string `json:"grpc_url"`
+	Reachable   bool   `json:"reachable"`
+	PingLatency string `json:"ping_latency,omitempty"`
+	State       string `json:"namespace_state,omitempty"`
+	Files       uint64 `json:"files,omitempty"`
+	Containers  uint64 `json:"containers,omitempty"`
+	BootTime    string `json:"boot_time,omitempty"`
+	Uptime      string `json:"uptime,omitempty"`
+	NsStat      bool   `json:"ns_stat_supported"`
+	Error       string `json:"error,omitempty"`
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version of the gateway and optionally of EOS",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := versionInfo{
+			Version:   version,
+			GoVersion: runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		}
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			if info.Version == "" {
+				info.Version = bi.Main.Version
+			}
+			for _, s := range bi.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					info.Commit = s.Value
+				case "vcs.time":
+					info.BuildTime = s.Value
+				}
+			}
+		}
+		if info.Version == "" {
+			info.Version = "(devel)"
+		}
+
+		if versionFlags.Remote {
+			remote, err := probeRemote(cmd.Context())
+			if err != nil {
+				return err
+			}
+			info.Remote = remote
+		}
+
+		return printOutput(info, outputTable, func(w io.Writer) {
+			fmt.Fprintf(w, "Version:\t%s\n", info.Version)
+			if info.Commit != "" {
+				fmt.Fprintf(w, "Commit:\t%s\n", info.Commit)
+			}
+			if info.BuildTime != "" {
+				fmt.Fprintf(w, "Build time:\t%s\n", info.BuildTime)
+			}
+			fmt.Fprintf(w, "Go version:\t%s\n", info.GoVersion)
+			fmt.Fprintf(w, "Platform:\t%s\n", info.Platform)
+			if r := info.Remote; r != nil {
+				fmt.Fprintf(w, "EOS MGM:\t%s\n", r.GrpcURL)
+				fmt.Fprintf(w, "  Reachable:\t%t\n", r.Reachable)
+				if r.Reachable {
+					fmt.Fprintf(w, "  Ping latency:\t%s\n", r.PingLatency)
+				}
+				if r.NsStat {
+					fmt.Fprintf(w, "  Namespace:\t%s (%d files, %d containers)\n", r.State, r.Files, r.Containers)
+					fmt.Fprintf(w, "  Boot time:\t%s\n", r.BootTime)
+					fmt.Fprintf(w, "  Uptime:\t%s\n", r.Uptime)
+				}
+				if r.Error != "" {
+					fmt.Fprintf(w, "  Error:\t%s\n", r.Error)
+				}
+			}
+		})
+	},
+}
+
+// probeRemote collects the information exposed by the MGM.
+func probeRemote(ctx context.Context) (*remoteInfo, error) {
+	cfg, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newEOSClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	r := &remoteInfo{GrpcURL: cfg.GrpcURL}
+	latency, err := client.Ping(ctx)
+	if err != nil {
+		r.Error = err.Error()
+		return r, nil
+	}
+	r.Reachable = true
+	r.PingLatency = latency.Round(time.Microsecond).String()
+
+	stat, err := client.NsStat(ctx)
+	if err != nil {
+		r.Error = fmt.Sprintf("ns stat: %v", err)
+		return r, nil
+	}
+	r.NsStat = true
+	r.State = stat.State
+	r.Files = stat.Nfiles
+	r.Containers = stat.Ncontainers
+	r.BootTime = time.Unix(int64(stat.BootTime), 0).UTC().Format(time.RFC3339)
+	r.Uptime = (time.Duration(stat.Uptime) * time.Second).String()
+	return r, nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gmgigi96/eoss3/meta"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var watchFlags = struct {
+	Bucket   string        // Show only the operations on the bucket
+	User     string        // Show only the operations involving the user
+	Actor    string        // Show only the operations of the actor
+	Since    time.Duration // Show also the operations done before starting
+	Interval time.Duration // How often the log is polled
+}{}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Stream the operations recorded in the audit log, until interrupted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := getConfig()
+		if err != nil {
+			return err
+		}
+
+		buckets, err := meta.New(cfg.Buckets)
+		if err != nil {
+			return err
+		}
+
+		filter, err := newAuditFilter(watchFlags.Bucket, watchFlags.User, watchFlags.Actor, watchFlags.Since)
+		if err != nil {
+			return err
+		}
+		if filter.Since.IsZero() {
+			filter.Since = time.Now()
+		}
+
+		interval := watchFlags.Interval
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		// the records are printed as soon as they are read,
+		// so the table is not aligned across the polls
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		if globalFlags.Output == "" || globalFlags.Output == outputTable {
+			fmt.Fprintln(w, "TIME\tACTOR\tACTION\tBUCKET\tUID\tDETAILS")
+			w.Flush()
+		}
+
+		var last time.Time
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			records, err := buckets.ListAuditRecords(ctx, filter)
+			if err != nil && ctx.Err() == nil {
+				return err
+			}
+
+			// the filter includes the records at the time of the last
+			// one already printed, skip them
+			prev := last
+			for _, r := range records {
+				if !prev.IsZero() && !r.Time.After(prev) {
+					continue
+				}
+				if err := printWatchRecord(w, r); err != nil {
+					return err
+				}
+				last = r.Time
+			}
+			if !last.IsZero() {
+				filter.Since = last
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// printWatchRecord writes r in the format selected with --output:
+// one JSON object per line, a YAML document or a table row.
+func printWatchRecord(w *tabwriter.Writer, r meta.AuditRecord) error {
+	switch globalFlags.Output {
+	case outputJSON:
+		return json.NewEncoder(os.Stdout).Encode(r)
+	case outputYAML:
+		data, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(os.Stdout, "---\n%s", data)
+		return err
+	}
+	printAuditRecord(w, r)
+	return w.Flush()
+}
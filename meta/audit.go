@@ -0,0 +1,101 @@
+package meta
+
+import (
+	"context"
+	"time"
+)
+
+// Action is a mutation of the meta store recorded in the audit log.
+type Action string
+
+const (
+	ActionCreateBucket   Action = "create-bucket"
+	ActionUpdateBucket   Action = "update-bucket"
+	ActionDeleteBucket   Action = "delete-bucket"
+	ActionAddAlias       Action = "add-alias"
+	ActionRemoveAlias    Action = "remove-alias"
+	ActionAssignBucket   Action = "assign-bucket"
+	ActionUnassignBucket Action = "unassign-bucket"
+	ActionSetDefaultPath Action = "set-default-path"
+
+	ActionCreateCredential Action = "create-credential"
+	ActionRevokeCredential Action = "revoke-credential"
+	ActionUpdateCredential Action = "update-credential"
+)
+
+// AuditRecord is an entry of the audit log of the meta store.
+type AuditRecord struct {
+	// Time is when the mutation happened.
+	Time time.Time `json:"time"`
+	// Actor is who did the mutation.
+	Actor string `json:"actor"`
+	// Action is the mutation done.
+	Action Action `json:"action"`
+	// Bucket is the bucket involved, if any.
+	Bucket string `json:"bucket,omitempty"`
+	// Uid is the user involved, if any.
+	Uid *int `json:"uid,omitempty"`
+	// Details holds additional information about the mutation.
+	Details string `json:"details,omitempty"`
+}
+
+// AuditFilter selects the records returned from the audit log.
+// Zero values match all the records.
+type AuditFilter struct {
+	Since  time.Time
+	Actor  string
+	Bucket string
+	Uid    *int
+}
+
+// Match returns true if the record is selected by the filter.
+func (f AuditFilter) Match(r AuditRecord) bool {
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if f.Actor != "" && r.Actor != f.Actor {
+		return false
+	}
+	if f.Bucket != "" && r.Bucket != f.Bucket {
+		return false
+	}
+	if f.Uid != nil && (r.Uid == nil || *r.Uid != *f.Uid) {
+		return false
+	}
+	return true
+}
+
+type actorKey struct{}
+
+// WithActor returns a context recording actor as
+// responsible of the mutations done with it.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return "<unknown>"
+}
+
+func newAuditRecord(ctx context.Context, action Action, bucket string) AuditRecord {
+	return AuditRecord{
+		Time:   time.Now().UTC(),
+		Actor:  ActorFromContext(ctx),
+		Action: action,
+		Bucket: bucket,
+	}
+}
+
+func (r AuditRecord) withUid(uid int) AuditRecord {
+	r.Uid = &uid
+	return r
+}
+
+func (r AuditRecord) withDetails(details string) AuditRecord {
+	r.Details = details
+	return r
+}
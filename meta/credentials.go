@@ -0,0 +1,263 @@
+package meta
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Credential is an S3 access key mapped to an EOS user.
+// The secret is not stored, only its hash.
+type Credential struct {
+	// AccessKey is the S3 access key id.
+	AccessKey string `json:"access_key"`
+	// SecretHash is the hex encoded SHA-256 of the secret key.
+	SecretHash string `json:"secret_hash"`
+	// Username is the EOS user the key is mapped to.
+	Username string `json:"username"`
+	// Uid and Gid are the identity of the user.
+	Uid uint64 `json:"uid"`
+	Gid uint64 `json:"gid"`
+	// CreatedAt is when the key was generated.
+	CreatedAt time.Time `json:"created_at"`
+	// Role is the role of the account on the gateway.
+	Role string `json:"role,omitempty"`
+	// Service is the name of the service account the key belongs
+	// to, for the non-human users like the automated pipelines.
+	// Empty for the keys of the users.
+	Service string `json:"service,omitempty"`
+	// ExpiresAt is when the key is revoked, being replaced by
+	// a rotation. Nil if the key does not expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// HashSecret returns the hash of the secret stored in a Credential.
+func HashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// CredentialStorer is implemented by the drivers able
+// to store the S3 credentials of the users.
+type CredentialStorer interface {
+	// StoreCredential stores a new credential.
+	StoreCredential(ctx context.Context, c Credential) error
+	// GetCredential returns the credential with the access key.
+	GetCredential(ctx context.Context, accessKey string) (Credential, error)
+	// ListCredentials returns all the credentials, sorted by access key.
+	ListCredentials(ctx context.Context) ([]Credential, error)
+	// UpdateCredential replaces the existing credential
+	// with the same access key.
+	UpdateCredential(ctx context.Context, c Credential) error
+	// DeleteCredential removes the credential with the access key.
+	DeleteCredential(ctx context.Context, accessKey string) error
+}
+
+var (
+	ErrCredentialAlreadyExisting = errors.New("credential already existing")
+	ErrNoSuchCredential          = errors.New("no such credential")
+)
+
+const credentialsFolder = "credentials"
+
+func (s *LocalBucketStorer) credentialFile(accessKey string) string {
+	return filepath.Join(s.base, credentialsFolder, accessKey)
+}
+
+func validAccessKey(accessKey string) bool {
+	return accessKey != "" && !strings.ContainsAny(accessKey, "/\\") && accessKey != "." && accessKey != ".."
+}
+
+func (s *LocalBucketStorer) StoreCredential(ctx context.Context, c Credential) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionCreateCredential, "").withUid(int(c.Uid)).withDetails(c.AccessKey))
+	}()
+
+	if !validAccessKey(c.AccessKey) {
+		return errors.New("invalid access key")
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := s.credentialFile(c.AccessKey)
+	if _, err := os.Stat(path); err == nil {
+		return ErrCredentialAlreadyExisting
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(path, data, 0600)
+}
+
+func (s *LocalBucketStorer) UpdateCredential(ctx context.Context, c Credential) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionUpdateCredential, "").withUid(int(c.Uid)).withDetails(c.AccessKey))
+	}()
+
+	if !validAccessKey(c.AccessKey) {
+		return ErrNoSuchCredential
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := s.credentialFile(c.AccessKey)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNoSuchCredential
+		}
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.writeFile(path, data, 0600)
+}
+
+func (s *LocalBucketStorer) GetCredential(ctx context.Context, accessKey string) (Credential, error) {
+	if !validAccessKey(accessKey) {
+		return Credential{}, ErrNoSuchCredential
+	}
+
+	data, err := s.readFile(s.credentialFile(accessKey))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Credential{}, ErrNoSuchCredential
+		}
+		return Credential{}, err
+	}
+
+	var c Credential
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Credential{}, err
+	}
+	return c, nil
+}
+
+func (s *LocalBucketStorer) ListCredentials(ctx context.Context) ([]Credential, error) {
+	entries, err := os.ReadDir(filepath.Join(s.base, credentialsFolder))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	creds := make([]Credential, 0, len(entries))
+	for _, e := range entries {
+		c, err := s.GetCredential(ctx, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	return creds, nil
+}
+
+func (s *LocalBucketStorer) DeleteCredential(ctx context.Context, accessKey string) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionRevokeCredential, "").withDetails(accessKey))
+	}()
+
+	if !validAccessKey(accessKey) {
+		return ErrNoSuchCredential
+	}
+	if err := os.Remove(s.credentialFile(accessKey)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNoSuchCredential
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *InMemoryBucketStorer) StoreCredential(ctx context.Context, c Credential) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionCreateCredential, "").withUid(int(c.Uid)).withDetails(c.AccessKey))
+	}()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.credentials[c.AccessKey]; ok {
+		return ErrCredentialAlreadyExisting
+	}
+	s.credentials[c.AccessKey] = c
+	return nil
+}
+
+func (s *InMemoryBucketStorer) UpdateCredential(ctx context.Context, c Credential) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionUpdateCredential, "").withUid(int(c.Uid)).withDetails(c.AccessKey))
+	}()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.credentials[c.AccessKey]; !ok {
+		return ErrNoSuchCredential
+	}
+	s.credentials[c.AccessKey] = c
+	return nil
+}
+
+func (s *InMemoryBucketStorer) GetCredential(ctx context.Context, accessKey string) (Credential, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	c, ok := s.credentials[accessKey]
+	if !ok {
+		return Credential{}, ErrNoSuchCredential
+	}
+	return c, nil
+}
+
+func (s *InMemoryBucketStorer) ListCredentials(ctx context.Context) ([]Credential, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	creds := make([]Credential, 0, len(s.credentials))
+	for _, c := range s.credentials {
+		creds = append(creds, c)
+	}
+	slices.SortFunc(creds, func(a, b Credential) int {
+		return strings.Compare(a.AccessKey, b.AccessKey)
+	})
+	return creds, nil
+}
+
+func (s *InMemoryBucketStorer) DeleteCredential(ctx context.Context, accessKey string) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionRevokeCredential, "").withDetails(accessKey))
+	}()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.credentials[accessKey]; !ok {
+		return ErrNoSuchCredential
+	}
+	delete(s.credentials, accessKey)
+	return nil
+}
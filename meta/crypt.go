@@ -0,0 +1,134 @@
+package meta
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// encryptedMagic prefixes the records encrypted by the local driver.
+// Records without it are in plain text: they are refused once a key
+// is configured, unless the store is being migrated to encryption.
+var encryptedMagic = []byte("eoss3:aesgcm:")
+
+// EncryptionConfig configures the encryption at rest of the records.
+// The key is a base64 encoded 256 bits AES key.
+type EncryptionConfig struct {
+	// KeyFile is the path of a file containing the key.
+	KeyFile string `mapstructure:"key_file"`
+	// KeyEnv is the name of an environment variable containing the key.
+	KeyEnv string `mapstructure:"key_env"`
+	// AllowPlaintext accepts the records in plain text, to enable the
+	// encryption on an existing store. They are encrypted when rewritten.
+	AllowPlaintext bool `mapstructure:"allow_plaintext"`
+}
+
+// loadKey returns the key configured, nil if the encryption is disabled.
+func (c *EncryptionConfig) loadKey() ([]byte, error) {
+	var encoded string
+	switch {
+	case c.KeyFile != "":
+		data, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading encryption key: %w", err)
+		}
+		encoded = string(data)
+	case c.KeyEnv != "":
+		v, ok := os.LookupEnv(c.KeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s not set", c.KeyEnv)
+		}
+		encoded = v
+	default:
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes long")
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordName returns the name of the record at path, relative to the
+// folder of the store. It is authenticated with the encrypted records,
+// so that they cannot be swapped between files.
+func (s *LocalBucketStorer) recordName(path string) string {
+	if rel, err := filepath.Rel(s.base, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// seal encrypts data, the record name, if the encryption is enabled.
+func (s *LocalBucketStorer) seal(name string, data []byte) ([]byte, error) {
+	if s.aead == nil {
+		return data, nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(encryptedMagic)+len(nonce)+len(data)+s.aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, nonce...)
+	return s.aead.Seal(out, nonce, data, []byte(name)), nil
+}
+
+// unseal decrypts data, the record name, if encrypted.
+func (s *LocalBucketStorer) unseal(name string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		if s.aead != nil && !s.allowPlaintext {
+			return nil, fmt.Errorf("record %s is not encrypted", name)
+		}
+		return data, nil
+	}
+	if s.aead == nil {
+		return nil, errors.New("record is encrypted but no encryption key is configured")
+	}
+
+	data = data[len(encryptedMagic):]
+	if len(data) < s.aead.NonceSize() {
+		return nil, errors.New("encrypted record too short")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, []byte(name))
+}
+
+// readFile reads and decrypts the record at path.
+func (s *LocalBucketStorer) readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.unseal(s.recordName(path), data)
+}
+
+// writeFile encrypts and writes the record at path.
+func (s *LocalBucketStorer) writeFile(path string, data []byte, perm os.FileMode) error {
+	data, err := s.seal(s.recordName(path), data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
@@ -0,0 +1,117 @@
+package meta
+
+import (
+	"context"
+	"hash/maphash"
+	"strconv"
+	"sync/atomic"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// dedupStorer wraps a BucketStorer sharing a single lookup
+// among the concurrent GetBucket calls of the same bucket.
+// The lookups started after a write to the bucket do not
+// share the ones started before it, as they might miss it.
+type dedupStorer struct {
+	BucketStorer
+	buckets singleflight.Group
+	gens    *nameGenerations
+}
+
+// nameGenerationSlots is the number of counters
+// the generations of the names are spread over.
+const nameGenerationSlots = 256
+
+// nameGenerations counts the writes to the buckets by name. The names
+// share a fixed number of counters: a write to a bucket may change the
+// generation of unrelated ones, that is only a missed sharing of a
+// lookup. The writes whose names are not all known, as the aliases of
+// a deleted bucket, change the generation of every name.
+type nameGenerations struct {
+	seed  maphash.Seed
+	all   atomic.Uint64
+	names [nameGenerationSlots]atomic.Uint64
+}
+
+func (g *nameGenerations) slot(name string) *atomic.Uint64 {
+	return &g.names[maphash.String(g.seed, name)%nameGenerationSlots]
+}
+
+// of returns the current generation of name.
+func (g *nameGenerations) of(name string) uint64 {
+	return g.all.Load() + g.slot(name).Load()
+}
+
+// bump changes the generation of the names.
+func (g *nameGenerations) bump(names ...string) {
+	for _, name := range names {
+		g.slot(name).Add(1)
+	}
+}
+
+// bumpAll changes the generation of every name.
+func (g *nameGenerations) bumpAll() {
+	g.all.Add(1)
+}
+
+// NewDedupStorer returns a BucketStorer deduplicating the
+// concurrent lookups of the same bucket done to s, so that
+// a burst of requests to a bucket reads it only once.
+func NewDedupStorer(s BucketStorer) BucketStorer {
+	return &dedupStorer{
+		BucketStorer: s,
+		gens:         &nameGenerations{seed: maphash.MakeSeed()},
+	}
+}
+
+// Ping forwards the call to the wrapped storer, if it is a Pinger.
+func (d *dedupStorer) Ping(ctx context.Context) error {
+	if p, ok := d.BucketStorer.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (d *dedupStorer) GetBucket(ctx context.Context, name string) (Bucket, error) {
+	// The lookup is not canceled with the call that
+	// started it, as the others wait for it.
+	key := strconv.FormatUint(d.gens.of(name), 10) + ":" + name
+	ch := d.buckets.DoChan(key, func() (any, error) {
+		return d.BucketStorer.GetBucket(context.WithoutCancel(ctx), name)
+	})
+	select {
+	case r := <-ch:
+		return r.Val.(Bucket), r.Err
+	case <-ctx.Done():
+		return Bucket{}, ctx.Err()
+	}
+}
+
+// The generations are changed once the writes are done, so that
+// the lookups started meanwhile are not shared after them.
+
+func (d *dedupStorer) CreateBucket(ctx context.Context, bucket Bucket) error {
+	defer d.gens.bump(bucket.Name)
+	return d.BucketStorer.CreateBucket(ctx, bucket)
+}
+
+func (d *dedupStorer) UpdateBucket(ctx context.Context, bucket Bucket) (uint64, error) {
+	defer d.gens.bump(append([]string{bucket.Name}, bucket.Aliases...)...)
+	return d.BucketStorer.UpdateBucket(ctx, bucket)
+}
+
+func (d *dedupStorer) DeleteBucket(ctx context.Context, name string) error {
+	defer d.gens.bumpAll()
+	return d.BucketStorer.DeleteBucket(ctx, name)
+}
+
+func (d *dedupStorer) AddAlias(ctx context.Context, name, alias string) error {
+	defer d.gens.bumpAll()
+	return d.BucketStorer.AddAlias(ctx, name, alias)
+}
+
+func (d *dedupStorer) RemoveAlias(ctx context.Context, alias string) error {
+	defer d.gens.bumpAll()
+	return d.BucketStorer.RemoveAlias(ctx, alias)
+}
@@ -0,0 +1,75 @@
+package meta
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingStorer holds the first GetBucket after reading the bucket,
+// until released, as a lookup in flight while a write lands.
+type blockingStorer struct {
+	BucketStorer
+	blocked  atomic.Bool
+	read     chan struct{}
+	released chan struct{}
+}
+
+func (s *blockingStorer) GetBucket(ctx context.Context, name string) (Bucket, error) {
+	b, err := s.BucketStorer.GetBucket(ctx, name)
+	if s.blocked.CompareAndSwap(false, true) {
+		close(s.read)
+		<-s.released
+	}
+	return b, err
+}
+
+func TestDedupStorerLookupAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	mem, err := NewInMemoryBucketStorer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.CreateBucket(ctx, Bucket{Name: "bucket", Path: "/eos/old"}); err != nil {
+		t.Fatal(err)
+	}
+	s := &blockingStorer{BucketStorer: mem, read: make(chan struct{}), released: make(chan struct{})}
+	d := NewDedupStorer(s)
+
+	inFlight := make(chan Bucket)
+	go func() {
+		b, _ := d.GetBucket(ctx, "bucket")
+		inFlight <- b
+	}()
+	<-s.read
+
+	b, err := mem.GetBucket(ctx, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Path = "/eos/new"
+	if _, err := d.UpdateBucket(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// the lookup after the write must not join the one in flight
+	after := make(chan Bucket)
+	go func() {
+		b, _ := d.GetBucket(ctx, "bucket")
+		after <- b
+	}()
+	select {
+	case b := <-after:
+		if b.Path != "/eos/new" {
+			t.Errorf("got path %q after the write, want %q", b.Path, "/eos/new")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lookup after the write joined the one in flight")
+	}
+
+	close(s.released)
+	if b := <-inFlight; b.Path != "/eos/old" {
+		t.Errorf("got path %q in flight, want %q", b.Path, "/eos/old")
+	}
+}
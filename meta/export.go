@@ -0,0 +1,167 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Dump is the serialized content of a meta store.
+type Dump struct {
+	Buckets []Bucket   `json:"buckets"`
+	Users   []UserDump `json:"users"`
+}
+
+// UserDump holds the buckets assigned to a user
+// and their default settings.
+type UserDump struct {
+	Uid               int      `json:"uid"`
+	Buckets           []string `json:"buckets,omitempty"`
+	DefaultBucketPath string   `json:"default_bucket_path,omitempty"`
+	// NamedBucketPaths are the named default paths of the user.
+	NamedBucketPaths map[string]string `json:"named_bucket_paths,omitempty"`
+}
+
+// Export writes to w the JSON representation of all the buckets,
+// the user assignments and the user defaults stored in s.
+func Export(ctx context.Context, s BucketStorer, w io.Writer) error {
+	buckets, err := s.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(buckets, func(a, b Bucket) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	uids, err := s.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	slices.Sort(uids)
+
+	dump := Dump{
+		Buckets: buckets,
+		Users:   make([]UserDump, 0, len(uids)),
+	}
+	for _, uid := range uids {
+		assigned, err := s.ListBucketsByUser(ctx, uid)
+		if err != nil {
+			return err
+		}
+		slices.Sort(assigned)
+
+		path, err := s.GetDefaultBucketPath(ctx, uid)
+		if err != nil {
+			return err
+		}
+
+		named, err := s.ListDefaultBucketPaths(ctx, uid)
+		if err != nil {
+			return err
+		}
+
+		if len(assigned) == 0 && path == "" && len(named) == 0 {
+			continue
+		}
+		dump.Users = append(dump.Users, UserDump{
+			Uid:               uid,
+			Buckets:           assigned,
+			DefaultBucketPath: path,
+			NamedBucketPaths:  named,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// ImportOptions tunes the behavior of Import.
+type ImportOptions struct {
+	// Merge skips the buckets already present in the store,
+	// together with their assignments, in place of failing.
+	// The existing user defaults are not overwritten.
+	Merge bool
+	// Skipped, if set, is called for every bucket skipped.
+	Skipped func(name string)
+}
+
+// Import reads from r a dump generated by Export and stores
+// its content in s. Unless merging, it fails if any of the
+// buckets is already present in s.
+func Import(ctx context.Context, s BucketStorer, r io.Reader, opts ImportOptions) error {
+	var dump Dump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return err
+	}
+
+	skipped := make(map[string]struct{})
+	for _, b := range dump.Buckets {
+		if _, err := s.GetBucket(ctx, b.Name); err == nil {
+			if !opts.Merge {
+				return ErrBucketAlreadyExisting
+			}
+			skipped[b.Name] = struct{}{}
+			if opts.Skipped != nil {
+				opts.Skipped(b.Name)
+			}
+		} else if !errors.Is(err, ErrNoSuchBucket) {
+			return err
+		}
+	}
+
+	for _, b := range dump.Buckets {
+		if _, ok := skipped[b.Name]; ok {
+			continue
+		}
+		if err := s.CreateBucket(ctx, b); err != nil {
+			return err
+		}
+		for _, alias := range b.Aliases {
+			if err := s.AddAlias(ctx, b.Name, alias); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, u := range dump.Users {
+		for _, name := range u.Buckets {
+			if _, ok := skipped[name]; ok {
+				continue
+			}
+			if s.IsAssigned(ctx, name, u.Uid) {
+				continue
+			}
+			if err := s.AssignBucket(ctx, name, u.Uid); err != nil {
+				return err
+			}
+		}
+		if u.DefaultBucketPath != "" {
+			if path, err := s.GetDefaultBucketPath(ctx, u.Uid); !opts.Merge || err != nil || path == "" {
+				if err := s.StoreDefaultBucketPath(ctx, u.Uid, u.DefaultBucketPath); err != nil {
+					return err
+				}
+			}
+		}
+
+		var existing map[string]string
+		if opts.Merge && len(u.NamedBucketPaths) > 0 {
+			var err error
+			if existing, err = s.ListDefaultBucketPaths(ctx, u.Uid); err != nil {
+				return err
+			}
+		}
+		for name, path := range u.NamedBucketPaths {
+			if _, ok := existing[name]; ok {
+				continue
+			}
+			if err := s.StoreNamedDefaultBucketPath(ctx, u.Uid, name, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
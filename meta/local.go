@@ -1,40 +1,94 @@
 package meta
 
 import (
+	"bufio"
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
 )
 
 type LocalBucketStorer struct {
-	base string
+	base         string
+	pollInterval time.Duration
+	aead         cipher.AEAD
+	// allowPlaintext accepts the records not encrypted
+	// while a key is configured, to migrate the store.
+	allowPlaintext bool
+	log            *slog.Logger
 }
 
 type Config struct {
 	Folder string `mapstructure:"folder"`
+	// PollInterval is how often the folder is scanned to notify
+	// the watchers about changes. If not set, nothing is notified.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Encryption configures the encryption of the records.
+	// If no key is provided, the records are stored in plain text.
+	Encryption EncryptionConfig `mapstructure:"encryption"`
 }
 
 const (
 	bucketsFolder = "buckets"
 	usersFolder   = "users"
 	uploadsFolder = "uploads"
+	objectsFolder = "objects"
+	aliasesFolder = "aliases"
 	metadataFile  = ".metadata"
+	lockFile      = ".lock"
+	auditFile     = "audit.log"
 )
 
 type UserMetadata struct {
-	DefaultBucketPath string `json:"default_bucket_path"`
+	DefaultBucketPath string            `json:"default_bucket_path"`
+	NamedBucketPaths  map[string]string `json:"named_bucket_paths,omitempty"`
 }
 
 func NewLocalBucketStorerFromConfig(m map[string]any) (*LocalBucketStorer, error) {
 	var cfg Config
-	if err := mapstructure.Decode(m, &cfg); err != nil {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &cfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(m); err != nil {
 		return nil, err
 	}
-	return NewLocalBucketStorer(cfg.Folder)
+
+	s, err := NewLocalBucketStorer(cfg.Folder)
+	if err != nil {
+		return nil, err
+	}
+	s.pollInterval = cfg.PollInterval
+
+	key, err := cfg.Encryption.loadKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if s.aead, err = newGCM(key); err != nil {
+			return nil, err
+		}
+	}
+	s.allowPlaintext = cfg.Encryption.AllowPlaintext
+	return s, nil
 }
 
 func NewLocalBucketStorer(folder string) (*LocalBucketStorer, error) {
@@ -48,16 +102,36 @@ func NewLocalBucketStorer(folder string) (*LocalBucketStorer, error) {
 
 	s := &LocalBucketStorer{
 		base: folder,
+		log:  slog.New(slog.DiscardHandler),
 	}
 	s.init()
 
 	return s, nil
 }
 
+func (s *LocalBucketStorer) SetLogger(l *slog.Logger) {
+	s.log = l
+}
+
 func (s *LocalBucketStorer) init() {
 	_ = os.MkdirAll(s.bucketFolder(""), 0700)
 	_ = os.MkdirAll(s.userFolder(0), 0700)
 	_ = os.MkdirAll(s.uploadsFolder(""), 0700)
+	_ = os.MkdirAll(s.objectsFolder(""), 0700)
+	_ = os.MkdirAll(s.aliasFile(""), 0700)
+}
+
+// Ping checks the folder of the buckets can be read.
+func (s *LocalBucketStorer) Ping(_ context.Context) error {
+	f, err := os.Open(s.bucketFolder(""))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
 }
 
 func (s *LocalBucketStorer) bucketFolder(name string) string {
@@ -76,21 +150,105 @@ func (s *LocalBucketStorer) uploadsFolder(bucket string) string {
 	return filepath.Join(s.base, uploadsFolder, bucket)
 }
 
-func (s *LocalBucketStorer) CreateBucket(bucket Bucket) error {
-	if _, err := s.GetBucket(bucket.Name); err == nil {
+func (s *LocalBucketStorer) aliasFile(alias string) string {
+	return filepath.Join(s.base, aliasesFolder, alias)
+}
+
+func (s *LocalBucketStorer) objectsFolder(bucket string) string {
+	return filepath.Join(s.base, objectsFolder, bucket)
+}
+
+// objectFile returns the file holding the metadata of the object.
+// The key is hashed as it can contain characters not allowed in
+// file names or be longer than the file name limit.
+func (s *LocalBucketStorer) objectFile(bucket, key, versionId string) string {
+	h := sha256.Sum256([]byte(key + "\x00" + versionId))
+	return filepath.Join(s.objectsFolder(bucket), hex.EncodeToString(h[:]))
+}
+
+func (s *LocalBucketStorer) CreateBucket(ctx context.Context, bucket Bucket) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionCreateBucket, bucket.Name)) }()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := s.GetBucket(ctx, bucket.Name); err == nil {
 		return ErrBucketAlreadyExisting
 	}
 
+	bucket.Aliases = nil
+	bucket.Revision = 1
+	return s.writeBucket(bucket)
+}
+
+// writeBucket atomically replaces the record of the bucket,
+// so that concurrent readers never see a partial record.
+func (s *LocalBucketStorer) writeBucket(bucket Bucket) error {
 	data, err := json.Marshal(bucket)
 	if err != nil {
 		return err
 	}
+	data, err = s.seal(s.recordName(s.bucketFolder(bucket.Name)), data)
+	if err != nil {
+		return err
+	}
 
-	return os.WriteFile(s.bucketFolder(bucket.Name), data, 0600)
+	tmp, err := os.CreateTemp(s.base, ".bucket-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.bucketFolder(bucket.Name))
+}
+
+// lock takes an exclusive lock on the bucket records, shared
+// with all the processes using the same folder. The returned
+// function releases the lock.
+func (s *LocalBucketStorer) lock() (func(), error) {
+	f, err := os.OpenFile(filepath.Join(s.base, lockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func (s *LocalBucketStorer) GetBucket(ctx context.Context, name string) (Bucket, error) {
+	bucket, err := s.readBucket(name)
+	if !errors.Is(err, ErrNoSuchBucket) {
+		return bucket, err
+	}
+
+	// the name might be an alias of another bucket
+	target, err := s.readFile(s.aliasFile(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Bucket{}, ErrNoSuchBucket
+		}
+		return Bucket{}, err
+	}
+	return s.readBucket(string(target))
 }
 
-func (s *LocalBucketStorer) GetBucket(name string) (Bucket, error) {
-	data, err := os.ReadFile(s.bucketFolder(name))
+func (s *LocalBucketStorer) readBucket(name string) (Bucket, error) {
+	data, err := s.readFile(s.bucketFolder(name))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return Bucket{}, ErrNoSuchBucket
@@ -105,12 +263,133 @@ func (s *LocalBucketStorer) GetBucket(name string) (Bucket, error) {
 	return bucket, nil
 }
 
-func (s *LocalBucketStorer) DeleteBucket(name string) error {
-	_ = os.Remove(s.bucketFolder(name))
+func (s *LocalBucketStorer) UpdateBucket(ctx context.Context, bucket Bucket) (_ uint64, err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionUpdateBucket, bucket.Name)) }()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	stored, err := s.readBucket(bucket.Name)
+	if err != nil {
+		return 0, err
+	}
+	if stored.Revision != bucket.Revision {
+		return 0, ErrRevisionMismatch
+	}
+
+	bucket.Revision++
+	if err := s.writeBucket(bucket); err != nil {
+		return 0, err
+	}
+	return bucket.Revision, nil
+}
+
+func (s *LocalBucketStorer) DeleteBucket(ctx context.Context, name string) (err error) {
+	// deleting a missing bucket is not a mutation to audit
+	deleted := false
+	defer func() {
+		if deleted {
+			s.audit(ctx, err, newAuditRecord(ctx, ActionDeleteBucket, name))
+		}
+	}()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if bucket, err := s.readBucket(name); err == nil {
+		for _, alias := range bucket.Aliases {
+			_ = os.Remove(s.aliasFile(alias))
+		}
+	}
+	if err := os.Remove(s.bucketFolder(name)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	deleted = true
 	return nil
 }
 
-func (s *LocalBucketStorer) ListBuckets() ([]Bucket, error) {
+func (s *LocalBucketStorer) AddAlias(ctx context.Context, name, alias string) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionAddAlias, name).withDetails(alias)) }()
+
+	if !IsValidBucketName(alias) {
+		return ErrInvalidAlias
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := s.GetBucket(ctx, alias); err == nil {
+		return ErrBucketAlreadyExisting
+	}
+
+	bucket, err := s.GetBucket(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeFile(s.aliasFile(alias), []byte(bucket.Name), 0600); err != nil {
+		return err
+	}
+
+	bucket.Aliases = append(bucket.Aliases, alias)
+	bucket.Revision++
+	if err := s.writeBucket(bucket); err != nil {
+		_ = os.Remove(s.aliasFile(alias))
+		return err
+	}
+	return nil
+}
+
+func (s *LocalBucketStorer) RemoveAlias(ctx context.Context, alias string) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionRemoveAlias, "").withDetails(alias)) }()
+
+	// an invalid name was never added, and must not
+	// be joined to the folder of the aliases
+	if !IsValidBucketName(alias) {
+		return ErrNoSuchAlias
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	target, err := s.readFile(s.aliasFile(alias))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoSuchAlias
+		}
+		return err
+	}
+	if err := os.Remove(s.aliasFile(alias)); err != nil {
+		return err
+	}
+
+	bucket, err := s.readBucket(string(target))
+	if err != nil {
+		return nil
+	}
+	bucket.Aliases = slices.DeleteFunc(bucket.Aliases, func(a string) bool {
+		return a == alias
+	})
+	bucket.Revision++
+	return s.writeBucket(bucket)
+}
+
+func (s *LocalBucketStorer) ListBuckets(ctx context.Context) ([]Bucket, error) {
 	entries, err := os.ReadDir(s.bucketFolder(""))
 	if err != nil {
 		return nil, err
@@ -119,7 +398,7 @@ func (s *LocalBucketStorer) ListBuckets() ([]Bucket, error) {
 	buckets := make([]Bucket, 0, len(entries))
 	for _, e := range entries {
 		var bucket Bucket
-		data, err := os.ReadFile(s.bucketFolder(e.Name()))
+		data, err := s.readFile(s.bucketFolder(e.Name()))
 		if err != nil {
 			return nil, err
 		}
@@ -131,7 +410,40 @@ func (s *LocalBucketStorer) ListBuckets() ([]Bucket, error) {
 	return buckets, nil
 }
 
-func (s *LocalBucketStorer) AssignBucket(name string, uid int) error {
+func (s *LocalBucketStorer) ListBucketsPage(ctx context.Context, q BucketsQuery) (BucketsPage, error) {
+	// the entries are sorted by name,
+	// that is the name of the bucket
+	entries, err := os.ReadDir(s.bucketFolder(""))
+	if err != nil {
+		return BucketsPage{}, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	selected, truncated := q.SelectPage(names)
+	page := BucketsPage{
+		Buckets:   make([]Bucket, 0, len(selected)),
+		Truncated: truncated,
+	}
+	for _, name := range selected {
+		bucket, err := s.readBucket(name)
+		if errors.Is(err, ErrNoSuchBucket) {
+			// deleted in the meantime
+			continue
+		}
+		if err != nil {
+			return BucketsPage{}, err
+		}
+		page.Buckets = append(page.Buckets, bucket)
+	}
+	return page, nil
+}
+
+func (s *LocalBucketStorer) AssignBucket(ctx context.Context, name string, uid int) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionAssignBucket, name).withUid(uid)) }()
+
 	userpath := s.userFolder(uid)
 	if err := os.MkdirAll(userpath, 0700); err != nil {
 		return err
@@ -146,14 +458,14 @@ func (s *LocalBucketStorer) AssignBucket(name string, uid int) error {
 	return nil
 }
 
-func (s *LocalBucketStorer) IsAssigned(name string, uid int) bool {
+func (s *LocalBucketStorer) IsAssigned(ctx context.Context, name string, uid int) bool {
 	userpath := s.userFolder(uid)
 
 	_, err := os.Stat(filepath.Join(userpath, name))
 	return !os.IsNotExist(err)
 }
 
-func (s *LocalBucketStorer) ListBucketsByUser(uid int) ([]string, error) {
+func (s *LocalBucketStorer) ListBucketsByUser(ctx context.Context, uid int) ([]string, error) {
 	userpath := s.userFolder(uid)
 
 	entries, err := os.ReadDir(userpath)
@@ -175,19 +487,41 @@ func (s *LocalBucketStorer) ListBucketsByUser(uid int) ([]string, error) {
 	return buckets, nil
 }
 
-func (s *LocalBucketStorer) UnassignBucket(name string, uid int) error {
+func (s *LocalBucketStorer) UnassignBucket(ctx context.Context, name string, uid int) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionUnassignBucket, name).withUid(uid)) }()
+
 	userpath := s.userFolder(uid)
 	_ = os.Remove(filepath.Join(userpath, name))
 	return nil
 }
 
+func (s *LocalBucketStorer) ListUsers(ctx context.Context) ([]int, error) {
+	entries, err := os.ReadDir(s.userFolder(0))
+	if err != nil {
+		return nil, err
+	}
+
+	uids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		uid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
 func (s *LocalBucketStorer) metadataFile(uid int) string {
 	return filepath.Join(s.userFolder(uid), metadataFile)
 }
 
 func (s *LocalBucketStorer) getUserMetadata(uid int) (*UserMetadata, error) {
 	metapath := s.metadataFile(uid)
-	data, err := os.ReadFile(metapath)
+	data, err := s.readFile(metapath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &UserMetadata{}, nil
@@ -207,10 +541,13 @@ func (s *LocalBucketStorer) storeUserMetadata(uid int, meta *UserMetadata) error
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.metadataFile(uid), data, 0644)
+	if err := os.MkdirAll(s.userFolder(uid), 0700); err != nil {
+		return err
+	}
+	return s.writeFile(s.metadataFile(uid), data, 0644)
 }
 
-func (s *LocalBucketStorer) GetDefaultBucketPath(uid int) (string, error) {
+func (s *LocalBucketStorer) GetDefaultBucketPath(ctx context.Context, uid int) (string, error) {
 	meta, err := s.getUserMetadata(uid)
 	if err != nil {
 		return "", err
@@ -218,7 +555,11 @@ func (s *LocalBucketStorer) GetDefaultBucketPath(uid int) (string, error) {
 	return meta.DefaultBucketPath, nil
 }
 
-func (s *LocalBucketStorer) StoreDefaultBucketPath(uid int, path string) error {
+func (s *LocalBucketStorer) StoreDefaultBucketPath(ctx context.Context, uid int, path string) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionSetDefaultPath, "").withUid(uid).withDetails(path))
+	}()
+
 	meta, err := s.getUserMetadata(uid)
 	if err != nil {
 		return err
@@ -227,7 +568,41 @@ func (s *LocalBucketStorer) StoreDefaultBucketPath(uid int, path string) error {
 	return s.storeUserMetadata(uid, meta)
 }
 
-func (s *LocalBucketStorer) StoreMultipartUpload(bucket string, initiator int, uploadId string, initiated time.Time) error {
+func (s *LocalBucketStorer) ListDefaultBucketPaths(ctx context.Context, uid int) (map[string]string, error) {
+	meta, err := s.getUserMetadata(uid)
+	if err != nil {
+		return nil, err
+	}
+	return maps.Clone(meta.NamedBucketPaths), nil
+}
+
+func (s *LocalBucketStorer) StoreNamedDefaultBucketPath(ctx context.Context, uid int, name, path string) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionSetDefaultPath, "").withUid(uid).withDetails(name+"="+path))
+	}()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	meta, err := s.getUserMetadata(uid)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		delete(meta.NamedBucketPaths, name)
+	} else {
+		if meta.NamedBucketPaths == nil {
+			meta.NamedBucketPaths = make(map[string]string)
+		}
+		meta.NamedBucketPaths[name] = path
+	}
+	return s.storeUserMetadata(uid, meta)
+}
+
+func (s *LocalBucketStorer) StoreMultipartUpload(ctx context.Context, bucket string, initiator int, uploadId string, initiated time.Time) error {
 	uploadsPath := s.uploadsFolder(bucket)
 	if err := os.MkdirAll(uploadsPath, 0700); err != nil {
 		return err
@@ -244,15 +619,15 @@ func (s *LocalBucketStorer) StoreMultipartUpload(bucket string, initiator int, u
 		return err
 	}
 
-	return os.WriteFile(filepath.Join(uploadsPath, uploadId), data, 0600)
+	return s.writeFile(filepath.Join(uploadsPath, uploadId), data, 0600)
 }
 
-func (s *LocalBucketStorer) DeleteMultipartUpload(bucket, uploadId string) error {
+func (s *LocalBucketStorer) DeleteMultipartUpload(ctx context.Context, bucket, uploadId string) error {
 	_ = os.Remove(filepath.Join(s.uploadsFolder(bucket), uploadId))
 	return nil
 }
 
-func (s *LocalBucketStorer) ListMultipartUploads(bucket string) ([]MultipartUpload, error) {
+func (s *LocalBucketStorer) ListMultipartUploads(ctx context.Context, bucket string) ([]MultipartUpload, error) {
 	uploadsPath := s.uploadsFolder(bucket)
 
 	entries, err := os.ReadDir(uploadsPath)
@@ -266,7 +641,7 @@ func (s *LocalBucketStorer) ListMultipartUploads(bucket string) ([]MultipartUplo
 	var uploads []MultipartUpload
 	for _, e := range entries {
 		var upload MultipartUpload
-		data, err := os.ReadFile(filepath.Join(uploadsPath, e.Name()))
+		data, err := s.readFile(filepath.Join(uploadsPath, e.Name()))
 		if err != nil {
 			return nil, err
 		}
@@ -277,3 +652,154 @@ func (s *LocalBucketStorer) ListMultipartUploads(bucket string) ([]MultipartUplo
 	}
 	return uploads, nil
 }
+
+func (s *LocalBucketStorer) Watch(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event)
+	go pollBuckets(ctx, s.ListBuckets, s.pollInterval, ch, s.log)
+	return ch, nil
+}
+
+func (s *LocalBucketStorer) StoreObjectMetadata(ctx context.Context, md ObjectMetadata) error {
+	if err := os.MkdirAll(s.objectsFolder(md.Bucket), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+
+	return s.writeFile(s.objectFile(md.Bucket, md.Key, md.VersionId), data, 0600)
+}
+
+func (s *LocalBucketStorer) GetObjectMetadata(ctx context.Context, bucket, key, versionId string) (ObjectMetadata, error) {
+	data, err := s.readFile(s.objectFile(bucket, key, versionId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ObjectMetadata{}, ErrNoSuchObjectMetadata
+		}
+		return ObjectMetadata{}, err
+	}
+
+	var md ObjectMetadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return ObjectMetadata{}, err
+	}
+	return md, nil
+}
+
+func (s *LocalBucketStorer) DeleteObjectMetadata(ctx context.Context, bucket, key, versionId string) error {
+	_ = os.Remove(s.objectFile(bucket, key, versionId))
+	return nil
+}
+
+func (s *LocalBucketStorer) ListObjectMetadata(ctx context.Context, bucket string) ([]ObjectMetadata, error) {
+	entries, err := os.ReadDir(s.objectsFolder(bucket))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ObjectMetadata{}, nil
+		}
+		return nil, err
+	}
+
+	objects := make([]ObjectMetadata, 0, len(entries))
+	for _, e := range entries {
+		data, err := s.readFile(filepath.Join(s.objectsFolder(bucket), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var md ObjectMetadata
+		if err := json.Unmarshal(data, &md); err != nil {
+			return nil, err
+		}
+		objects = append(objects, md)
+	}
+	return objects, nil
+}
+
+// audit appends the record to the audit log if the mutation succeeded.
+func (s *LocalBucketStorer) audit(ctx context.Context, err error, r AuditRecord) {
+	if err != nil {
+		return
+	}
+	if err := s.appendAuditRecord(r); err != nil {
+		s.log.Error("error writing audit record", "action", r.Action, "bucket", r.Bucket, "error", err)
+	}
+}
+
+func (s *LocalBucketStorer) appendAuditRecord(r AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if s.aead != nil {
+		sealed, err := s.seal(auditFile, data)
+		if err != nil {
+			return err
+		}
+		data = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.base, auditFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *LocalBucketStorer) ImportAuditRecords(ctx context.Context, records []AuditRecord) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, r := range records {
+		if err := s.appendAuditRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalBucketStorer) ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	f, err := os.Open(filepath.Join(s.base, auditFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditRecord{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []AuditRecord{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		sealed := line
+		if line[0] != '{' {
+			// encrypted record
+			if sealed, err = base64.StdEncoding.DecodeString(string(line)); err != nil {
+				return nil, err
+			}
+		}
+		if line, err = s.unseal(auditFile, sealed); err != nil {
+			return nil, err
+		}
+
+		var r AuditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, err
+		}
+		if filter.Match(r) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
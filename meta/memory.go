@@ -1,48 +1,70 @@
 package meta
 
 import (
+	"context"
+	"maps"
 	"slices"
 	"sync"
 	"time"
 )
 
 type InMemoryBucketStorer struct {
-	m       sync.RWMutex
-	buckets map[string]Bucket            // name -> bucket
-	users   map[int][]string             // uid -> list of bucket name
-	paths   map[int]string               // map holding for each user (uid) their default bucket path
-	uploads map[string][]MultipartUpload // bucket -> upload info
+	m        sync.RWMutex
+	buckets  map[string]Bucket            // name -> bucket
+	aliases  map[string]string            // alias -> bucket name
+	users    map[int][]string             // uid -> list of bucket name
+	paths    map[int]string               // map holding for each user (uid) their default bucket path
+	named    map[int]map[string]string    // uid -> name -> named default bucket path
+	uploads  map[string][]MultipartUpload // bucket -> upload info
+	objects  map[objectId]ObjectMetadata  // object -> overflow metadata
+	auditLog []AuditRecord                // log of the mutations
+
+	credentials map[string]Credential // access key -> credential
+
+	wm       sync.Mutex
+	watchers map[chan Event]struct{}
 }
 
 func NewInMemoryBucketStorer() (*InMemoryBucketStorer, error) {
 	return &InMemoryBucketStorer{
-		buckets: make(map[string]Bucket),
-		users:   make(map[int][]string),
-		paths:   make(map[int]string),
-		uploads: make(map[string][]MultipartUpload),
+		buckets:  make(map[string]Bucket),
+		aliases:  make(map[string]string),
+		users:    make(map[int][]string),
+		paths:    make(map[int]string),
+		named:    make(map[int]map[string]string),
+		uploads:  make(map[string][]MultipartUpload),
+		objects:  make(map[objectId]ObjectMetadata),
+		watchers: make(map[chan Event]struct{}),
+
+		credentials: make(map[string]Credential),
 	}, nil
 }
 
-func (s *InMemoryBucketStorer) CreateBucket(bucket Bucket) error {
-	s.m.RLock()
-	_, ok := s.buckets[bucket.Name]
-	s.m.RUnlock()
+func (s *InMemoryBucketStorer) CreateBucket(ctx context.Context, bucket Bucket) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionCreateBucket, bucket.Name)) }()
 
-	if ok {
+	s.m.Lock()
+	if s.existsLocked(bucket.Name) {
+		s.m.Unlock()
 		return ErrBucketAlreadyExisting
 	}
-
-	s.m.Lock()
+	bucket.Aliases = nil
+	bucket.Revision = 1
 	s.buckets[bucket.Name] = bucket
 	s.m.Unlock()
 
+	s.notify(Event{Type: BucketCreated, Bucket: bucket})
 	return nil
 }
 
-func (s *InMemoryBucketStorer) GetBucket(name string) (Bucket, error) {
+func (s *InMemoryBucketStorer) GetBucket(ctx context.Context, name string) (Bucket, error) {
 	s.m.RLock()
 	defer s.m.RUnlock()
 
+	if target, ok := s.aliases[name]; ok {
+		name = target
+	}
+
 	m, ok := s.buckets[name]
 	if !ok {
 		return Bucket{}, ErrNoSuchBucket
@@ -50,15 +72,105 @@ func (s *InMemoryBucketStorer) GetBucket(name string) (Bucket, error) {
 	return m, nil
 }
 
-func (s *InMemoryBucketStorer) DeleteBucket(name string) error {
+// existsLocked returns true if name is used by a bucket or an alias.
+// Must be called with the lock held.
+func (s *InMemoryBucketStorer) existsLocked(name string) bool {
+	_, isBucket := s.buckets[name]
+	_, isAlias := s.aliases[name]
+	return isBucket || isAlias
+}
+
+func (s *InMemoryBucketStorer) UpdateBucket(ctx context.Context, bucket Bucket) (_ uint64, err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionUpdateBucket, bucket.Name)) }()
+
 	s.m.Lock()
-	defer s.m.Unlock()
+	stored, ok := s.buckets[bucket.Name]
+	if !ok {
+		s.m.Unlock()
+		return 0, ErrNoSuchBucket
+	}
+	if stored.Revision != bucket.Revision {
+		s.m.Unlock()
+		return 0, ErrRevisionMismatch
+	}
+	bucket.Revision++
+	s.buckets[bucket.Name] = bucket
+	s.m.Unlock()
+
+	s.notify(Event{Type: BucketUpdated, Bucket: bucket})
+	return bucket.Revision, nil
+}
 
+func (s *InMemoryBucketStorer) DeleteBucket(ctx context.Context, name string) (err error) {
+	s.m.Lock()
+	bucket, ok := s.buckets[name]
+	for _, alias := range bucket.Aliases {
+		delete(s.aliases, alias)
+	}
 	delete(s.buckets, name)
+	s.m.Unlock()
+
+	// deleting a missing bucket is not a mutation to audit
+	if ok {
+		s.audit(ctx, nil, newAuditRecord(ctx, ActionDeleteBucket, name))
+		s.notify(Event{Type: BucketDeleted, Bucket: bucket})
+	}
+	return nil
+}
+
+func (s *InMemoryBucketStorer) AddAlias(ctx context.Context, name, alias string) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionAddAlias, name).withDetails(alias)) }()
+
+	if !IsValidBucketName(alias) {
+		return ErrInvalidAlias
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.existsLocked(alias) {
+		return ErrBucketAlreadyExisting
+	}
+	if target, ok := s.aliases[name]; ok {
+		name = target
+	}
+	bucket, ok := s.buckets[name]
+	if !ok {
+		return ErrNoSuchBucket
+	}
+
+	s.aliases[alias] = name
+	bucket.Aliases = append(slices.Clone(bucket.Aliases), alias)
+	bucket.Revision++
+	s.buckets[name] = bucket
+	s.notify(Event{Type: BucketUpdated, Bucket: bucket})
+	return nil
+}
+
+func (s *InMemoryBucketStorer) RemoveAlias(ctx context.Context, alias string) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionRemoveAlias, "").withDetails(alias)) }()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	name, ok := s.aliases[alias]
+	if !ok {
+		return ErrNoSuchAlias
+	}
+	delete(s.aliases, alias)
+
+	if bucket, ok := s.buckets[name]; ok {
+		bucket.Aliases = slices.DeleteFunc(slices.Clone(bucket.Aliases), func(a string) bool {
+			return a == alias
+		})
+		bucket.Revision++
+		s.buckets[name] = bucket
+		s.notify(Event{Type: BucketUpdated, Bucket: bucket})
+	}
 	return nil
 }
 
-func (s *InMemoryBucketStorer) ListBuckets() ([]Bucket, error) {
+func (s *InMemoryBucketStorer) ListBuckets(ctx context.Context) ([]Bucket, error) {
 	s.m.RLock()
 	defer s.m.RUnlock()
 
@@ -69,7 +181,25 @@ func (s *InMemoryBucketStorer) ListBuckets() ([]Bucket, error) {
 	return list, nil
 }
 
-func (s *InMemoryBucketStorer) AssignBucket(name string, uid int) error {
+func (s *InMemoryBucketStorer) ListBucketsPage(ctx context.Context, q BucketsQuery) (BucketsPage, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	names := slices.Sorted(maps.Keys(s.buckets))
+	selected, truncated := q.SelectPage(names)
+	page := BucketsPage{
+		Buckets:   make([]Bucket, 0, len(selected)),
+		Truncated: truncated,
+	}
+	for _, name := range selected {
+		page.Buckets = append(page.Buckets, s.buckets[name])
+	}
+	return page, nil
+}
+
+func (s *InMemoryBucketStorer) AssignBucket(ctx context.Context, name string, uid int) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionAssignBucket, name).withUid(uid)) }()
+
 	s.m.Lock()
 	defer s.m.Unlock()
 
@@ -77,7 +207,7 @@ func (s *InMemoryBucketStorer) AssignBucket(name string, uid int) error {
 	return nil
 }
 
-func (s *InMemoryBucketStorer) IsAssigned(name string, uid int) bool {
+func (s *InMemoryBucketStorer) IsAssigned(ctx context.Context, name string, uid int) bool {
 	s.m.RLock()
 	defer s.m.RUnlock()
 
@@ -85,17 +215,16 @@ func (s *InMemoryBucketStorer) IsAssigned(name string, uid int) bool {
 	return slices.Contains(buckets, name)
 }
 
-func (s *InMemoryBucketStorer) ListBucketsByUser(uid int) ([]string, error) {
+func (s *InMemoryBucketStorer) ListBucketsByUser(ctx context.Context, uid int) ([]string, error) {
 	s.m.RLock()
 	defer s.m.RUnlock()
 
-	buckets := s.users[uid]
-	list := make([]string, 0, len(buckets))
-	copy(list, buckets)
-	return list, nil
+	return slices.Clone(s.users[uid]), nil
 }
 
-func (s *InMemoryBucketStorer) UnassignBucket(name string, uid int) error {
+func (s *InMemoryBucketStorer) UnassignBucket(ctx context.Context, name string, uid int) (err error) {
+	defer func() { s.audit(ctx, err, newAuditRecord(ctx, ActionUnassignBucket, name).withUid(uid)) }()
+
 	s.m.Lock()
 	defer s.m.Unlock()
 
@@ -106,14 +235,41 @@ func (s *InMemoryBucketStorer) UnassignBucket(name string, uid int) error {
 	return nil
 }
 
-func (s *InMemoryBucketStorer) GetDefaultBucketPath(uid int) (string, error) {
+func (s *InMemoryBucketStorer) ListUsers(ctx context.Context) ([]int, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	uids := make([]int, 0, len(s.users))
+	for uid := range s.users {
+		uids = append(uids, uid)
+	}
+	for uid := range s.paths {
+		if _, ok := s.users[uid]; !ok {
+			uids = append(uids, uid)
+		}
+	}
+	for uid := range s.named {
+		_, hasBuckets := s.users[uid]
+		_, hasPath := s.paths[uid]
+		if !hasBuckets && !hasPath {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+func (s *InMemoryBucketStorer) GetDefaultBucketPath(ctx context.Context, uid int) (string, error) {
 	s.m.RLock()
 	defer s.m.RUnlock()
 
 	return s.paths[uid], nil
 }
 
-func (s *InMemoryBucketStorer) StoreDefaultBucketPath(uid int, path string) error {
+func (s *InMemoryBucketStorer) StoreDefaultBucketPath(ctx context.Context, uid int, path string) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionSetDefaultPath, "").withUid(uid).withDetails(path))
+	}()
+
 	s.m.Lock()
 	defer s.m.Unlock()
 
@@ -121,7 +277,36 @@ func (s *InMemoryBucketStorer) StoreDefaultBucketPath(uid int, path string) erro
 	return nil
 }
 
-func (s *InMemoryBucketStorer) StoreMultipartUpload(bucket string, initiator int, uploadId string, initiated time.Time) error {
+func (s *InMemoryBucketStorer) ListDefaultBucketPaths(ctx context.Context, uid int) (map[string]string, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return maps.Clone(s.named[uid]), nil
+}
+
+func (s *InMemoryBucketStorer) StoreNamedDefaultBucketPath(ctx context.Context, uid int, name, path string) (err error) {
+	defer func() {
+		s.audit(ctx, err, newAuditRecord(ctx, ActionSetDefaultPath, "").withUid(uid).withDetails(name+"="+path))
+	}()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if path == "" {
+		delete(s.named[uid], name)
+		if len(s.named[uid]) == 0 {
+			delete(s.named, uid)
+		}
+		return nil
+	}
+	if s.named[uid] == nil {
+		s.named[uid] = make(map[string]string)
+	}
+	s.named[uid][name] = path
+	return nil
+}
+
+func (s *InMemoryBucketStorer) StoreMultipartUpload(ctx context.Context, bucket string, initiator int, uploadId string, initiated time.Time) error {
 	s.m.Lock()
 	defer s.m.Unlock()
 
@@ -134,7 +319,7 @@ func (s *InMemoryBucketStorer) StoreMultipartUpload(bucket string, initiator int
 	return nil
 }
 
-func (s *InMemoryBucketStorer) DeleteMultipartUpload(bucket, uploadId string) error {
+func (s *InMemoryBucketStorer) DeleteMultipartUpload(ctx context.Context, bucket, uploadId string) error {
 	s.m.Lock()
 	defer s.m.Unlock()
 
@@ -144,9 +329,120 @@ func (s *InMemoryBucketStorer) DeleteMultipartUpload(bucket, uploadId string) er
 	return nil
 }
 
-func (s *InMemoryBucketStorer) ListMultipartUploads(bucket string) ([]MultipartUpload, error) {
+func (s *InMemoryBucketStorer) ListMultipartUploads(ctx context.Context, bucket string) ([]MultipartUpload, error) {
 	s.m.RLock()
 	defer s.m.RUnlock()
 
 	return s.uploads[bucket], nil
 }
+
+type objectId struct {
+	bucket, key, versionId string
+}
+
+func (s *InMemoryBucketStorer) StoreObjectMetadata(ctx context.Context, md ObjectMetadata) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.objects[objectId{md.Bucket, md.Key, md.VersionId}] = md
+	return nil
+}
+
+func (s *InMemoryBucketStorer) GetObjectMetadata(ctx context.Context, bucket, key, versionId string) (ObjectMetadata, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	md, ok := s.objects[objectId{bucket, key, versionId}]
+	if !ok {
+		return ObjectMetadata{}, ErrNoSuchObjectMetadata
+	}
+	return md, nil
+}
+
+func (s *InMemoryBucketStorer) DeleteObjectMetadata(ctx context.Context, bucket, key, versionId string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.objects, objectId{bucket, key, versionId})
+	return nil
+}
+
+func (s *InMemoryBucketStorer) ListObjectMetadata(ctx context.Context, bucket string) ([]ObjectMetadata, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	objects := []ObjectMetadata{}
+	for id, md := range s.objects {
+		if id.bucket == bucket {
+			objects = append(objects, md)
+		}
+	}
+	return objects, nil
+}
+
+// audit appends the record to the audit log if the mutation succeeded.
+func (s *InMemoryBucketStorer) audit(ctx context.Context, err error, r AuditRecord) {
+	if err != nil {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.auditLog = append(s.auditLog, r)
+}
+
+func (s *InMemoryBucketStorer) ImportAuditRecords(ctx context.Context, records []AuditRecord) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.auditLog = append(s.auditLog, records...)
+	return nil
+}
+
+func (s *InMemoryBucketStorer) ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	records := []AuditRecord{}
+	for _, r := range s.auditLog {
+		if filter.Match(r) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// watcherBuffer is the number of events buffered for each watcher.
+// Events are dropped for watchers not keeping up.
+const watcherBuffer = 64
+
+func (s *InMemoryBucketStorer) Watch(ctx context.Context) (<-chan Event, error) {
+	ch := make(chan Event, watcherBuffer)
+
+	s.wm.Lock()
+	s.watchers[ch] = struct{}{}
+	s.wm.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.wm.Lock()
+		delete(s.watchers, ch)
+		close(ch)
+		s.wm.Unlock()
+	}()
+
+	return ch, nil
+}
+
+func (s *InMemoryBucketStorer) notify(ev Event) {
+	s.wm.Lock()
+	defer s.wm.Unlock()
+
+	for ch := range s.watchers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
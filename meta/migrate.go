@@ -0,0 +1,261 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MigrateOptions configures the migration between two meta stores.
+type MigrateOptions struct {
+	// DryRun only reports what would be migrated.
+	DryRun bool
+	// Progress, if set, is called after each migrated item,
+	// with the number of items done and the total.
+	Progress func(done, total int, item string)
+}
+
+// AuditImporter is implemented by the stores whose audit
+// log can be extended with the records of another store.
+type AuditImporter interface {
+	// ImportAuditRecords appends the records to the audit log as they are.
+	ImportAuditRecords(ctx context.Context, records []AuditRecord) error
+}
+
+// ObjectMetadataLister is implemented by the stores
+// listing the metadata of the objects they hold.
+type ObjectMetadataLister interface {
+	// ListObjectMetadata returns the metadata of the objects of the bucket.
+	ListObjectMetadata(ctx context.Context, bucket string) ([]ObjectMetadata, error)
+}
+
+// Migrate copies the buckets, the metadata of their objects, the user
+// assignments and defaults, the pending multipart uploads, the
+// credentials and the audit log from src to dst. Buckets and
+// credentials already existing in dst are skipped, as are the audit
+// records already in its log. It refuses to run if src or dst
+// cannot list or store any of them.
+func Migrate(ctx context.Context, src, dst BucketStorer, opts MigrateOptions) error {
+	buckets, err := src.ListBuckets(ctx)
+	if err != nil {
+		return err
+	}
+
+	uids, err := src.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	records, err := src.ListAuditRecords(ctx, AuditFilter{})
+	if err != nil {
+		return err
+	}
+	importer, ok := dst.(AuditImporter)
+	if !ok && len(records) > 0 {
+		return errors.New("the destination store cannot import the audit log")
+	}
+	lister, ok := src.(ObjectMetadataLister)
+	if !ok {
+		return errors.New("the source store cannot list the metadata of the objects")
+	}
+	var creds []Credential
+	if cs, ok := src.(CredentialStorer); ok {
+		if creds, err = cs.ListCredentials(ctx); err != nil {
+			return err
+		}
+	}
+	dstCreds, ok := dst.(CredentialStorer)
+	if !ok && len(creds) > 0 {
+		return errors.New("the destination store cannot store the credentials")
+	}
+
+	total := 1 + len(buckets) + len(uids) + len(creds)
+	done := 0
+	progress := func(item string) {
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, total, item)
+		}
+	}
+
+	// the records of the source come first, the ones of
+	// the mutations done by the migration being newer
+	n, err := importAuditRecords(ctx, importer, dst, records, opts.DryRun)
+	if err != nil {
+		return err
+	}
+	progress(fmt.Sprintf("audit log: %d records", n))
+
+	for _, b := range buckets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, err := dst.GetBucket(ctx, b.Name); err == nil {
+			progress(fmt.Sprintf("bucket %s: already existing, skipped", b.Name))
+			continue
+		} else if !errors.Is(err, ErrNoSuchBucket) {
+			return err
+		}
+
+		uploads, err := src.ListMultipartUploads(ctx, b.Name)
+		if err != nil {
+			return err
+		}
+		objects, err := lister.ListObjectMetadata(ctx, b.Name)
+		if err != nil {
+			return err
+		}
+
+		if !opts.DryRun {
+			if err := dst.CreateBucket(ctx, b); err != nil {
+				return fmt.Errorf("error creating bucket %s: %w", b.Name, err)
+			}
+			for _, alias := range b.Aliases {
+				if err := dst.AddAlias(ctx, b.Name, alias); err != nil {
+					return fmt.Errorf("error adding alias %s to bucket %s: %w", alias, b.Name, err)
+				}
+			}
+			for _, u := range uploads {
+				if err := dst.StoreMultipartUpload(ctx, u.Bucket, u.Initiator, u.UploadId, u.Initiated); err != nil {
+					return fmt.Errorf("error storing upload %s: %w", u.UploadId, err)
+				}
+			}
+			for _, md := range objects {
+				if err := dst.StoreObjectMetadata(ctx, md); err != nil {
+					return fmt.Errorf("error storing metadata of %s/%s: %w", b.Name, md.Key, err)
+				}
+			}
+		}
+
+		item := fmt.Sprintf("bucket %s", b.Name)
+		if len(b.Aliases) > 0 {
+			item += fmt.Sprintf(" (aliases %s)", strings.Join(b.Aliases, ","))
+		}
+		if len(uploads) > 0 {
+			item += fmt.Sprintf(" with %d uploads", len(uploads))
+		}
+		if len(objects) > 0 {
+			item += fmt.Sprintf(", metadata of %d objects", len(objects))
+		}
+		progress(item)
+	}
+
+	for _, uid := range uids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		assigned, err := src.ListBucketsByUser(ctx, uid)
+		if err != nil {
+			return err
+		}
+		path, err := src.GetDefaultBucketPath(ctx, uid)
+		if err != nil {
+			return err
+		}
+		named, err := src.ListDefaultBucketPaths(ctx, uid)
+		if err != nil {
+			return err
+		}
+
+		if !opts.DryRun {
+			for _, name := range assigned {
+				if dst.IsAssigned(ctx, name, uid) {
+					continue
+				}
+				if err := dst.AssignBucket(ctx, name, uid); err != nil {
+					return fmt.Errorf("error assigning bucket %s to %d: %w", name, uid, err)
+				}
+			}
+			if path != "" {
+				if err := dst.StoreDefaultBucketPath(ctx, uid, path); err != nil {
+					return fmt.Errorf("error storing default path of %d: %w", uid, err)
+				}
+			}
+			for name, p := range named {
+				if err := dst.StoreNamedDefaultBucketPath(ctx, uid, name, p); err != nil {
+					return fmt.Errorf("error storing default path %s of %d: %w", name, uid, err)
+				}
+			}
+		}
+		progress(fmt.Sprintf("user %d: %d buckets assigned", uid, len(assigned)))
+	}
+
+	for _, c := range creds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, err := dstCreds.GetCredential(ctx, c.AccessKey); err == nil {
+			progress(fmt.Sprintf("credential %s: already existing, skipped", c.AccessKey))
+			continue
+		} else if !errors.Is(err, ErrNoSuchCredential) {
+			return err
+		}
+		if !opts.DryRun {
+			if err := dstCreds.StoreCredential(ctx, c); err != nil {
+				return fmt.Errorf("error storing credential %s: %w", c.AccessKey, err)
+			}
+		}
+		progress(fmt.Sprintf("credential %s of %d", c.AccessKey, c.Uid))
+	}
+
+	return nil
+}
+
+// importAuditRecords appends to the audit log of dst the records
+// not already in it, returning their number.
+func importAuditRecords(ctx context.Context, importer AuditImporter, dst BucketStorer, records []AuditRecord, dryRun bool) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	existing, err := dst.ListAuditRecords(ctx, AuditFilter{})
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, r := range existing {
+		data, _ := json.Marshal(r)
+		seen[string(data)] = true
+	}
+	var missing []AuditRecord
+	for _, r := range records {
+		if data, _ := json.Marshal(r); !seen[string(data)] {
+			missing = append(missing, r)
+		}
+	}
+	if dryRun || len(missing) == 0 {
+		return len(missing), nil
+	}
+	if err := importer.ImportAuditRecords(ctx, missing); err != nil {
+		return 0, fmt.Errorf("error importing the audit log: %w", err)
+	}
+	return len(missing), nil
+}
+
+// ParseLocation returns the configuration of the store at the location,
+// in the form <driver>[:<argument>]. Supported locations are:
+//   - memory
+//   - local:<folder>
+//
+// The local store is encrypted with enc, if set.
+func ParseLocation(location string, enc EncryptionConfig) (map[string]any, error) {
+	driver, arg, _ := strings.Cut(location, ":")
+	switch driver {
+	case "memory":
+		return map[string]any{"driver": "memory"}, nil
+	case "local":
+		if arg == "" {
+			return nil, errors.New("missing folder of the local driver")
+		}
+		cfg := map[string]any{"driver": "local", "folder": arg}
+		if enc != (EncryptionConfig{}) {
+			cfg["encryption"] = map[string]any{"key_file": enc.KeyFile, "key_env": enc.KeyEnv, "allow_plaintext": enc.AllowPlaintext}
+		}
+		return cfg, nil
+	}
+	return nil, fmt.Errorf("unsupported meta driver %q", driver)
+}
@@ -0,0 +1,46 @@
+package meta
+
+import (
+	"slices"
+	"strings"
+)
+
+// BucketsQuery selects a page of the buckets, sorted by name.
+type BucketsQuery struct {
+	// Prefix selects the buckets whose name starts with it.
+	Prefix string
+	// StartAfter is the name after which the page starts.
+	StartAfter string
+	// Max is the maximum number of buckets in the page.
+	// If zero, all the buckets are returned.
+	Max int
+}
+
+// BucketsPage is a page of the buckets, sorted by name.
+type BucketsPage struct {
+	Buckets []Bucket
+	// Truncated is true if more buckets
+	// match the query after the page.
+	Truncated bool
+}
+
+// SelectPage returns the names in the page among the sorted names,
+// and whether more names match the query after the page.
+func (q BucketsQuery) SelectPage(names []string) ([]string, bool) {
+	i, _ := slices.BinarySearch(names, max(q.StartAfter, q.Prefix))
+	var page []string
+	for _, name := range names[i:] {
+		if name == q.StartAfter {
+			continue
+		}
+		if !strings.HasPrefix(name, q.Prefix) {
+			// past the names with the prefix
+			break
+		}
+		if q.Max > 0 && len(page) == q.Max {
+			return page, true
+		}
+		page = append(page, name)
+	}
+	return page, false
+}
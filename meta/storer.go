@@ -1,10 +1,21 @@
 package meta
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
+	"regexp"
 	"time"
 )
 
+var bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// IsValidBucketName returns true if the name can be used as S3 bucket.
+func IsValidBucketName(name string) bool {
+	return bucketNameRegex.MatchString(name)
+}
+
 // Mapping holds the information for mapping a bucket
 // with the real path on EOS.
 type Bucket struct {
@@ -16,6 +27,52 @@ type Bucket struct {
 	// Might be different from the actualt ctime of
 	// the corresponding folder in EOS.
 	CreatedAt time.Time `json:"created_at"`
+	// Owner is the identity owning the bucket folder on EOS.
+	// Nil if unknown.
+	Owner *Identity `json:"owner,omitempty"`
+	// RunAs is the identity used for all the operations on
+	// the bucket in place of the one of the requester.
+	// Used for service buckets, e.g. shared project accounts.
+	RunAs *Identity `json:"run_as,omitempty"`
+	// Policy is the bucket policy set by the administrators, if any.
+	// When empty, the policy is generated from the assignments.
+	Policy json.RawMessage `json:"policy,omitempty"`
+	// Quota holds the limits of the bucket, if any.
+	Quota *Quota `json:"quota,omitempty"`
+	// Networks are the CIDRs of the clients allowed to access
+	// the bucket. If empty, all the clients are allowed.
+	Networks []string `json:"networks,omitempty"`
+	// WriteNetworks are the CIDRs of the clients allowed to write
+	// in the bucket, among the ones allowed by Networks.
+	// If empty, all the allowed clients can write.
+	WriteNetworks []string `json:"write_networks,omitempty"`
+	// VOs are the virtual organizations whose accounts are allowed
+	// to access the bucket. If empty, all the accounts are allowed.
+	VOs []string `json:"vos,omitempty"`
+	// Tags are the S3 tags of the bucket.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Aliases are other names resolving to this bucket.
+	// They are managed with AddAlias and RemoveAlias.
+	Aliases []string `json:"aliases,omitempty"`
+	// Revision is incremented at every update of the bucket.
+	// An update is refused if the revision of the given bucket
+	// is different from the stored one, meaning that someone
+	// else updated the bucket in the meantime.
+	Revision uint64 `json:"revision"`
+}
+
+// Quota holds the limits of a bucket. Zero means unlimited.
+type Quota struct {
+	// MaxBytes is the maximum size of the bucket.
+	MaxBytes uint64 `json:"max_bytes,omitempty"`
+	// MaxObjects is the maximum number of objects in the bucket.
+	MaxObjects uint64 `json:"max_objects,omitempty"`
+}
+
+// Identity is a user on EOS.
+type Identity struct {
+	Uid uint64 `json:"uid"`
+	Gid uint64 `json:"gid"`
 }
 
 type MultipartUpload struct {
@@ -25,30 +82,100 @@ type MultipartUpload struct {
 	Initiated time.Time `json:"initiated"`
 }
 
+// UploadMetadataKey returns the key of the ObjectMetadata staged with
+// the multipart upload. With its leading slash it is not a valid object
+// key, so that it never addresses the metadata of an object.
+func UploadMetadataKey(uploadId string) string {
+	return "/uploads/" + uploadId
+}
+
+// ObjectMetadata holds the metadata of an object that cannot
+// be stored as extended attributes on EOS, e.g. because it
+// exceeds the size or count limits of the xattrs.
+type ObjectMetadata struct {
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	VersionId string `json:"version_id,omitempty"`
+	// UserMetadata is the user defined metadata of the object.
+	UserMetadata map[string]string `json:"user_metadata,omitempty"`
+	// Tags is the tag set of the object.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
 type BucketStorer interface {
-	CreateBucket(bucket Bucket) error
-	GetBucket(name string) (Bucket, error)
-	DeleteBucket(name string) error
-	ListBuckets() ([]Bucket, error)
-
-	AssignBucket(name string, uid int) error
-	IsAssigned(name string, uid int) bool
-	ListBucketsByUser(uid int) ([]string, error)
-	UnassignBucket(name string, uid int) error
-
-	GetDefaultBucketPath(uid int) (string, error)
-	StoreDefaultBucketPath(uid int, path string) error
-
-	StoreMultipartUpload(bucket string, initiator int, uploadId string, initiated time.Time) error
-	DeleteMultipartUpload(bucket, uploadId string) error
-	ListMultipartUploads(bucket string) ([]MultipartUpload, error)
+	CreateBucket(ctx context.Context, bucket Bucket) error
+	GetBucket(ctx context.Context, name string) (Bucket, error)
+	// UpdateBucket stores the bucket if its revision matches the stored one,
+	// returning ErrRevisionMismatch otherwise. On success the revision is
+	// incremented and returned.
+	UpdateBucket(ctx context.Context, bucket Bucket) (uint64, error)
+	DeleteBucket(ctx context.Context, name string) error
+	ListBuckets(ctx context.Context) ([]Bucket, error)
+	// ListBucketsPage returns the page of the buckets selected by
+	// the query, without loading the buckets outside of it.
+	ListBucketsPage(ctx context.Context, q BucketsQuery) (BucketsPage, error)
+
+	// AddAlias makes alias resolve to the bucket name in GetBucket.
+	// The alias must be a valid bucket name, ErrInvalidAlias is returned otherwise.
+	AddAlias(ctx context.Context, name, alias string) error
+	RemoveAlias(ctx context.Context, alias string) error
+
+	AssignBucket(ctx context.Context, name string, uid int) error
+	IsAssigned(ctx context.Context, name string, uid int) bool
+	ListBucketsByUser(ctx context.Context, uid int) ([]string, error)
+	UnassignBucket(ctx context.Context, name string, uid int) error
+	// ListUsers returns the uids of the users having
+	// buckets assigned or default settings stored.
+	ListUsers(ctx context.Context) ([]int, error)
+
+	GetDefaultBucketPath(ctx context.Context, uid int) (string, error)
+	StoreDefaultBucketPath(ctx context.Context, uid int, path string) error
+	// ListDefaultBucketPaths returns the named default paths of the user,
+	// selectable at bucket creation in place of the default one.
+	ListDefaultBucketPaths(ctx context.Context, uid int) (map[string]string, error)
+	// StoreNamedDefaultBucketPath sets the named default path of the user.
+	// An empty path removes it.
+	StoreNamedDefaultBucketPath(ctx context.Context, uid int, name, path string) error
+
+	StoreMultipartUpload(ctx context.Context, bucket string, initiator int, uploadId string, initiated time.Time) error
+	DeleteMultipartUpload(ctx context.Context, bucket, uploadId string) error
+	ListMultipartUploads(ctx context.Context, bucket string) ([]MultipartUpload, error)
+
+	StoreObjectMetadata(ctx context.Context, md ObjectMetadata) error
+	GetObjectMetadata(ctx context.Context, bucket, key, versionId string) (ObjectMetadata, error)
+	DeleteObjectMetadata(ctx context.Context, bucket, key, versionId string) error
+
+	// ListAuditRecords returns the records of the audit log
+	// of the mutations matching the filter, oldest first.
+	ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error)
+
+	// Watch returns a channel where the changes to the buckets
+	// are notified. The channel is closed when the context is done.
+	Watch(ctx context.Context) (<-chan Event, error)
 }
 
 var (
 	ErrBucketAlreadyExisting = errors.New("bucket already existing")
 	ErrNoSuchBucket          = errors.New("no such bucket")
+	ErrNoSuchObjectMetadata  = errors.New("no such object metadata")
+	ErrRevisionMismatch      = errors.New("bucket modified concurrently")
+	ErrNoSuchAlias           = errors.New("no such alias")
+	ErrInvalidAlias          = errors.New("alias is not a valid bucket name")
 )
 
+// LoggerSetter is implemented by the drivers reporting
+// the errors of their background jobs through a logger.
+type LoggerSetter interface {
+	SetLogger(l *slog.Logger)
+}
+
+// Pinger is implemented by the drivers whose storage
+// may be unavailable, as a remote or mounted one.
+type Pinger interface {
+	// Ping returns an error if the storage is not available.
+	Ping(ctx context.Context) error
+}
+
 func New(c map[string]any) (BucketStorer, error) {
 	driver, ok := c["driver"]
 	if !ok {
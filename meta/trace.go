@@ -0,0 +1,243 @@
+package meta
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/gmgigi96/eoss3/meta"
+
+// tracedStorer wraps a BucketStorer recording a span for every call.
+type tracedStorer struct {
+	s      BucketStorer
+	tracer trace.Tracer
+	slow   SlowLog
+}
+
+// SlowLog configures the logging of the slow calls to the store.
+type SlowLog struct {
+	// Threshold is the duration above which a call is logged
+	// as a warning. If not set, nothing is logged.
+	Threshold time.Duration
+	Logger    *slog.Logger
+	// RequestStart, if set, returns when the request the call belongs
+	// to started, to report the time spent by the request before the call.
+	RequestStart func(ctx context.Context) (time.Time, bool)
+}
+
+// NewTracedStorer returns a BucketStorer recording in tp
+// a span for every call done to s, and logging the slow
+// ones as configured in slow.
+func NewTracedStorer(s BucketStorer, tp trace.TracerProvider, slow SlowLog) BucketStorer {
+	if slow.Logger == nil {
+		slow.Logger = slog.New(slog.DiscardHandler)
+	}
+	return &tracedStorer{s: s, tracer: tp.Tracer(tracerName), slow: slow}
+}
+
+func (t *tracedStorer) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, "meta."+op, trace.WithAttributes(attrs...))
+	return ctx, &call{Span: span, ctx: ctx, op: op, start: time.Now(), slow: &t.slow}
+}
+
+// call is the span of a call to the store,
+// logging a warning when ended if the call was slow.
+type call struct {
+	trace.Span
+	ctx   context.Context
+	op    string
+	start time.Time
+	slow  *SlowLog
+}
+
+func (c *call) End(opts ...trace.SpanEndOption) {
+	c.Span.End(opts...)
+
+	d := time.Since(c.start)
+	if c.slow.Threshold <= 0 || d < c.slow.Threshold {
+		return
+	}
+	var queued time.Duration
+	if c.slow.RequestStart != nil {
+		if t, ok := c.slow.RequestStart(c.ctx); ok {
+			queued = c.start.Sub(t)
+		}
+	}
+	c.slow.Logger.WarnContext(c.ctx, "slow meta call", "operation", c.op, "duration", d, "queued", queued, "threshold", c.slow.Threshold)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func bucketAttr(name string) attribute.KeyValue { return attribute.String("bucket", name) }
+func uidAttr(uid int) attribute.KeyValue        { return attribute.Int("uid", uid) }
+
+// Ping forwards the call to the wrapped storer, if it is a Pinger.
+func (t *tracedStorer) Ping(ctx context.Context) (err error) {
+	p, ok := t.s.(Pinger)
+	if !ok {
+		return nil
+	}
+	ctx, span := t.start(ctx, "Ping")
+	defer func() { endSpan(span, err) }()
+	return p.Ping(ctx)
+}
+
+func (t *tracedStorer) CreateBucket(ctx context.Context, bucket Bucket) (err error) {
+	ctx, span := t.start(ctx, "CreateBucket", bucketAttr(bucket.Name))
+	defer func() { endSpan(span, err) }()
+	return t.s.CreateBucket(ctx, bucket)
+}
+
+func (t *tracedStorer) GetBucket(ctx context.Context, name string) (_ Bucket, err error) {
+	ctx, span := t.start(ctx, "GetBucket", bucketAttr(name))
+	defer func() { endSpan(span, err) }()
+	return t.s.GetBucket(ctx, name)
+}
+
+func (t *tracedStorer) UpdateBucket(ctx context.Context, bucket Bucket) (_ uint64, err error) {
+	ctx, span := t.start(ctx, "UpdateBucket", bucketAttr(bucket.Name))
+	defer func() { endSpan(span, err) }()
+	return t.s.UpdateBucket(ctx, bucket)
+}
+
+func (t *tracedStorer) DeleteBucket(ctx context.Context, name string) (err error) {
+	ctx, span := t.start(ctx, "DeleteBucket", bucketAttr(name))
+	defer func() { endSpan(span, err) }()
+	return t.s.DeleteBucket(ctx, name)
+}
+
+func (t *tracedStorer) ListBuckets(ctx context.Context) (_ []Bucket, err error) {
+	ctx, span := t.start(ctx, "ListBuckets")
+	defer func() { endSpan(span, err) }()
+	return t.s.ListBuckets(ctx)
+}
+
+func (t *tracedStorer) ListBucketsPage(ctx context.Context, q BucketsQuery) (_ BucketsPage, err error) {
+	ctx, span := t.start(ctx, "ListBucketsPage", attribute.String("prefix", q.Prefix), attribute.Int("max", q.Max))
+	defer func() { endSpan(span, err) }()
+	return t.s.ListBucketsPage(ctx, q)
+}
+
+func (t *tracedStorer) AddAlias(ctx context.Context, name, alias string) (err error) {
+	ctx, span := t.start(ctx, "AddAlias", bucketAttr(name), attribute.String("alias", alias))
+	defer func() { endSpan(span, err) }()
+	return t.s.AddAlias(ctx, name, alias)
+}
+
+func (t *tracedStorer) RemoveAlias(ctx context.Context, alias string) (err error) {
+	ctx, span := t.start(ctx, "RemoveAlias", attribute.String("alias", alias))
+	defer func() { endSpan(span, err) }()
+	return t.s.RemoveAlias(ctx, alias)
+}
+
+func (t *tracedStorer) AssignBucket(ctx context.Context, name string, uid int) (err error) {
+	ctx, span := t.start(ctx, "AssignBucket", bucketAttr(name), uidAttr(uid))
+	defer func() { endSpan(span, err) }()
+	return t.s.AssignBucket(ctx, name, uid)
+}
+
+func (t *tracedStorer) IsAssigned(ctx context.Context, name string, uid int) bool {
+	ctx, span := t.start(ctx, "IsAssigned", bucketAttr(name), uidAttr(uid))
+	defer span.End()
+	return t.s.IsAssigned(ctx, name, uid)
+}
+
+func (t *tracedStorer) ListBucketsByUser(ctx context.Context, uid int) (_ []string, err error) {
+	ctx, span := t.start(ctx, "ListBucketsByUser", uidAttr(uid))
+	defer func() { endSpan(span, err) }()
+	return t.s.ListBucketsByUser(ctx, uid)
+}
+
+func (t *tracedStorer) UnassignBucket(ctx context.Context, name string, uid int) (err error) {
+	ctx, span := t.start(ctx, "UnassignBucket", bucketAttr(name), uidAttr(uid))
+	defer func() { endSpan(span, err) }()
+	return t.s.UnassignBucket(ctx, name, uid)
+}
+
+func (t *tracedStorer) ListUsers(ctx context.Context) (_ []int, err error) {
+	ctx, span := t.start(ctx, "ListUsers")
+	defer func() { endSpan(span, err) }()
+	return t.s.ListUsers(ctx)
+}
+
+func (t *tracedStorer) GetDefaultBucketPath(ctx context.Context, uid int) (_ string, err error) {
+	ctx, span := t.start(ctx, "GetDefaultBucketPath", uidAttr(uid))
+	defer func() { endSpan(span, err) }()
+	return t.s.GetDefaultBucketPath(ctx, uid)
+}
+
+func (t *tracedStorer) StoreDefaultBucketPath(ctx context.Context, uid int, path string) (err error) {
+	ctx, span := t.start(ctx, "StoreDefaultBucketPath", uidAttr(uid))
+	defer func() { endSpan(span, err) }()
+	return t.s.StoreDefaultBucketPath(ctx, uid, path)
+}
+
+func (t *tracedStorer) ListDefaultBucketPaths(ctx context.Context, uid int) (_ map[string]string, err error) {
+	ctx, span := t.start(ctx, "ListDefaultBucketPaths", uidAttr(uid))
+	defer func() { endSpan(span, err) }()
+	return t.s.ListDefaultBucketPaths(ctx, uid)
+}
+
+func (t *tracedStorer) StoreNamedDefaultBucketPath(ctx context.Context, uid int, name, path string) (err error) {
+	ctx, span := t.start(ctx, "StoreNamedDefaultBucketPath", uidAttr(uid), attribute.String("name", name))
+	defer func() { endSpan(span, err) }()
+	return t.s.StoreNamedDefaultBucketPath(ctx, uid, name, path)
+}
+
+func (t *tracedStorer) StoreMultipartUpload(ctx context.Context, bucket string, initiator int, uploadId string, initiated time.Time) (err error) {
+	ctx, span := t.start(ctx, "StoreMultipartUpload", bucketAttr(bucket), attribute.String("upload_id", uploadId))
+	defer func() { endSpan(span, err) }()
+	return t.s.StoreMultipartUpload(ctx, bucket, initiator, uploadId, initiated)
+}
+
+func (t *tracedStorer) DeleteMultipartUpload(ctx context.Context, bucket, uploadId string) (err error) {
+	ctx, span := t.start(ctx, "DeleteMultipartUpload", bucketAttr(bucket), attribute.String("upload_id", uploadId))
+	defer func() { endSpan(span, err) }()
+	return t.s.DeleteMultipartUpload(ctx, bucket, uploadId)
+}
+
+func (t *tracedStorer) ListMultipartUploads(ctx context.Context, bucket string) (_ []MultipartUpload, err error) {
+	ctx, span := t.start(ctx, "ListMultipartUploads", bucketAttr(bucket))
+	defer func() { endSpan(span, err) }()
+	return t.s.ListMultipartUploads(ctx, bucket)
+}
+
+func (t *tracedStorer) StoreObjectMetadata(ctx context.Context, md ObjectMetadata) (err error) {
+	ctx, span := t.start(ctx, "StoreObjectMetadata", bucketAttr(md.Bucket), attribute.String("key", md.Key))
+	defer func() { endSpan(span, err) }()
+	return t.s.StoreObjectMetadata(ctx, md)
+}
+
+func (t *tracedStorer) GetObjectMetadata(ctx context.Context, bucket, key, versionId string) (_ ObjectMetadata, err error) {
+	ctx, span := t.start(ctx, "GetObjectMetadata", bucketAttr(bucket), attribute.String("key", key))
+	defer func() { endSpan(span, err) }()
+	return t.s.GetObjectMetadata(ctx, bucket, key, versionId)
+}
+
+func (t *tracedStorer) DeleteObjectMetadata(ctx context.Context, bucket, key, versionId string) (err error) {
+	ctx, span := t.start(ctx, "DeleteObjectMetadata", bucketAttr(bucket), attribute.String("key", key))
+	defer func() { endSpan(span, err) }()
+	return t.s.DeleteObjectMetadata(ctx, bucket, key, versionId)
+}
+
+func (t *tracedStorer) ListAuditRecords(ctx context.Context, filter AuditFilter) (_ []AuditRecord, err error) {
+	ctx, span := t.start(ctx, "ListAuditRecords")
+	defer func() { endSpan(span, err) }()
+	return t.s.ListAuditRecords(ctx, filter)
+}
+
+func (t *tracedStorer) Watch(ctx context.Context) (<-chan Event, error) {
+	// the watch lasts as long as ctx, not worth a span
+	return t.s.Watch(ctx)
+}
@@ -0,0 +1,186 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ProblemKind is the kind of inconsistency found in the meta store.
+type ProblemKind int
+
+const (
+	// CorruptedBucket is a bucket record that cannot be read or decoded.
+	CorruptedBucket ProblemKind = iota
+	// DanglingAssignment is a user assigned to a bucket that does not exist.
+	DanglingAssignment
+	// CorruptedUserMetadata is a user metadata record that cannot be read or decoded.
+	CorruptedUserMetadata
+	// CorruptedUpload is a multipart upload record that cannot be read or decoded.
+	CorruptedUpload
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case CorruptedBucket:
+		return "corrupted bucket"
+	case DanglingAssignment:
+		return "dangling assignment"
+	case CorruptedUserMetadata:
+		return "corrupted user metadata"
+	case CorruptedUpload:
+		return "corrupted upload"
+	}
+	return "unknown"
+}
+
+// Problem is an inconsistency found in the meta store.
+type Problem struct {
+	Kind ProblemKind
+	// Bucket is the name of the bucket involved, if any.
+	Bucket string
+	// Uid is the user involved, if any.
+	Uid int
+	// Err is the error got reading the record, if any.
+	Err error
+	// Repaired is true if the problem has been fixed.
+	Repaired bool
+}
+
+func (p Problem) String() string {
+	s := p.Kind.String()
+	if p.Bucket != "" {
+		s += fmt.Sprintf(" bucket=%s", p.Bucket)
+	}
+	if p.Kind == DanglingAssignment || p.Kind == CorruptedUserMetadata {
+		s += fmt.Sprintf(" uid=%d", p.Uid)
+	}
+	if p.Err != nil {
+		s += fmt.Sprintf(": %v", p.Err)
+	}
+	if p.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// Verifier is implemented by the drivers able to check
+// the integrity of the stored records.
+type Verifier interface {
+	// Verify returns the inconsistencies found in the store.
+	// If repair is true, the problems are fixed where possible.
+	Verify(ctx context.Context, repair bool) ([]Problem, error)
+}
+
+// lostFoundFolder holds the corrupted records moved away during a repair.
+const lostFoundFolder = "lost+found"
+
+func (s *LocalBucketStorer) Verify(ctx context.Context, repair bool) ([]Problem, error) {
+	var problems []Problem
+
+	entries, err := os.ReadDir(s.bucketFolder(""))
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		path := s.bucketFolder(name)
+		if err := checkRecord(s.readFile, path, func(b *Bucket) error {
+			if b.Name != name {
+				return fmt.Errorf("record name %q does not match file name", b.Name)
+			}
+			return nil
+		}); err != nil {
+			p := Problem{Kind: CorruptedBucket, Bucket: name, Err: err}
+			if repair {
+				p.Repaired = s.moveToLostFound(path, bucketsFolder) == nil
+			}
+			problems = append(problems, p)
+			continue
+		}
+		existing[name] = struct{}{}
+	}
+
+	uids, err := s.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, uid := range uids {
+		if err := checkRecord(s.readFile, s.metadataFile(uid), func(*UserMetadata) error { return nil }); err != nil && !errors.Is(err, os.ErrNotExist) {
+			p := Problem{Kind: CorruptedUserMetadata, Uid: uid, Err: err}
+			if repair {
+				p.Repaired = s.moveToLostFound(s.metadataFile(uid), filepath.Join(usersFolder, strconv.Itoa(uid))) == nil
+			}
+			problems = append(problems, p)
+		}
+
+		assigned, err := s.ListBucketsByUser(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range assigned {
+			if _, ok := existing[name]; ok {
+				continue
+			}
+			p := Problem{Kind: DanglingAssignment, Bucket: name, Uid: uid}
+			if repair {
+				p.Repaired = s.UnassignBucket(ctx, name, uid) == nil
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	uploadBuckets, err := os.ReadDir(s.uploadsFolder(""))
+	if err != nil {
+		return nil, err
+	}
+	for _, ub := range uploadBuckets {
+		uploads, err := os.ReadDir(s.uploadsFolder(ub.Name()))
+		if err != nil {
+			continue
+		}
+		for _, u := range uploads {
+			path := filepath.Join(s.uploadsFolder(ub.Name()), u.Name())
+			if err := checkRecord(s.readFile, path, func(*MultipartUpload) error { return nil }); err != nil {
+				p := Problem{Kind: CorruptedUpload, Bucket: ub.Name(), Err: err}
+				if repair {
+					p.Repaired = s.moveToLostFound(path, filepath.Join(uploadsFolder, ub.Name())) == nil
+				}
+				problems = append(problems, p)
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// checkRecord reads with the read function and decodes the JSON
+// record at path, running the validate function on the decoded value.
+func checkRecord[T any](read func(string) ([]byte, error), path string, validate func(*T) error) error {
+	data, err := read(path)
+	if err != nil {
+		return err
+	}
+
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return validate(&v)
+}
+
+// moveToLostFound moves the file at path in the lost+found
+// folder, keeping it for a later manual inspection.
+func (s *LocalBucketStorer) moveToLostFound(path, rel string) error {
+	dst := filepath.Join(s.base, lostFoundFolder, rel, filepath.Base(path))
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	return os.Rename(path, dst)
+}
@@ -0,0 +1,109 @@
+package meta
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// EventType is the kind of change notified by a watcher.
+type EventType int
+
+const (
+	// BucketCreated is sent when a new bucket is registered.
+	BucketCreated EventType = iota
+	// BucketDeleted is sent when a bucket is removed.
+	BucketDeleted
+	// BucketUpdated is sent when the record of a bucket changes,
+	// e.g. its policy. The assignments are not part of the record.
+	BucketUpdated
+)
+
+func (t EventType) String() string {
+	switch t {
+	case BucketCreated:
+		return "created"
+	case BucketDeleted:
+		return "deleted"
+	case BucketUpdated:
+		return "updated"
+	}
+	return "unknown"
+}
+
+// Event holds a change happened in the meta store.
+type Event struct {
+	Type   EventType
+	Bucket Bucket
+}
+
+// pollBuckets periodically lists the buckets using the list function,
+// sending on ch the differences between two consecutive listings.
+// If interval is not set, the buckets are never listed.
+// It returns when the context is cancelled, closing the channel.
+func pollBuckets(ctx context.Context, list func(context.Context) ([]Bucket, error), interval time.Duration, ch chan<- Event, log *slog.Logger) {
+	defer close(ch)
+
+	// polling is disabled, nothing is notified
+	if interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+
+	known := make(map[string]Bucket)
+	if buckets, err := list(ctx); err == nil {
+		for _, b := range buckets {
+			known[b.Name] = b
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		buckets, err := list(ctx)
+		if err != nil {
+			log.Warn("error listing buckets", "error", err)
+			continue
+		}
+
+		current := make(map[string]Bucket, len(buckets))
+		for _, b := range buckets {
+			current[b.Name] = b
+			old, ok := known[b.Name]
+			switch {
+			case !ok:
+				if !sendEvent(ctx, ch, Event{Type: BucketCreated, Bucket: b}) {
+					return
+				}
+			case old.Revision != b.Revision:
+				if !sendEvent(ctx, ch, Event{Type: BucketUpdated, Bucket: b}) {
+					return
+				}
+			}
+		}
+		for name, b := range known {
+			if _, ok := current[name]; !ok {
+				if !sendEvent(ctx, ch, Event{Type: BucketDeleted, Bucket: b}) {
+					return
+				}
+			}
+		}
+		known = current
+	}
+}
+
+func sendEvent(ctx context.Context, ch chan<- Event, ev Event) bool {
+	select {
+	case ch <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
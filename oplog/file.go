@@ -0,0 +1,42 @@
+package oplog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// fileSink appends the records to a file, one JSON object per line.
+type fileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if path == "" {
+		return nil, errors.New("missing path of the operations log file")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) Write(ctx context.Context, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
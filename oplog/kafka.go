@@ -0,0 +1,46 @@
+package oplog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSink publishes the records, as JSON, on a Kafka topic,
+// using the bucket as message key.
+type kafkaSink struct {
+	w *kafka.Writer
+}
+
+func newKafkaSink(brokers []string, topic string) (*kafkaSink, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("missing kafka brokers")
+	}
+	if topic == "" {
+		return nil, errors.New("missing kafka topic")
+	}
+	return &kafkaSink{
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: 10 * time.Millisecond,
+			RequiredAcks: kafka.RequireAll,
+		},
+	}, nil
+}
+
+func (s *kafkaSink) Write(ctx context.Context, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.w.WriteMessages(ctx, kafka.Message{Key: []byte(r.Bucket), Value: data})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.w.Close()
+}
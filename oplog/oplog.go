@@ -0,0 +1,157 @@
+// Package oplog records the mutating S3 operations, with the
+// identity of the requester, in one or more append-only sinks.
+package oplog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record is an entry of the operations log.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	AccessKey string    `json:"access_key"`
+	Uid       int       `json:"uid"`
+	Operation string    `json:"operation"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key,omitempty"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	// Result is OK, or the S3 error code of the failure.
+	Result string `json:"result"`
+}
+
+// Sink is where the records are written.
+type Sink interface {
+	Write(ctx context.Context, r Record) error
+	Close() error
+}
+
+// SinkConfig configures a sink. Type is one of file, syslog or kafka.
+type SinkConfig struct {
+	Type string `mapstructure:"type"`
+	// Path is the file where the records are appended, for the file sink.
+	Path string `mapstructure:"path"`
+	// Network and Address of the syslog daemon, for the syslog sink.
+	// If not set, the local one is used.
+	Network string `mapstructure:"network"`
+	Address string `mapstructure:"address"`
+	// Tag of the syslog messages. Defaults to eoss3.
+	Tag string `mapstructure:"tag"`
+	// Brokers and Topic where the records are published, for the kafka sink.
+	Brokers []string `mapstructure:"brokers"`
+	Topic   string   `mapstructure:"topic"`
+}
+
+// NewSink returns the sink configured in cfg.
+func NewSink(cfg SinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case "file":
+		return newFileSink(cfg.Path)
+	case "syslog":
+		return newSyslogSink(cfg.Network, cfg.Address, cfg.Tag)
+	case "kafka":
+		return newKafkaSink(cfg.Brokers, cfg.Topic)
+	}
+	return nil, fmt.Errorf("unsupported operations log sink %q", cfg.Type)
+}
+
+// queueSize is the number of records buffered before
+// Log drops them, the sinks not keeping up.
+const queueSize = 1024
+
+// Logger writes the records to the sinks in background,
+// so that slow sinks do not delay the requests.
+type Logger struct {
+	sinks []Sink
+	log   *slog.Logger
+
+	// mu guards the sends on ch against its closing
+	mu      sync.RWMutex
+	closed  bool
+	ch      chan Record
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// New returns a Logger writing to sinks. The errors
+// of the sinks are reported to log.
+func New(sinks []Sink, log *slog.Logger) *Logger {
+	l := &Logger{
+		sinks: sinks,
+		log:   log,
+		ch:    make(chan Record, queueSize),
+		done:  make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Log queues r to be written to the sinks, without blocking: the
+// record is dropped, and counted, if the queue is full or the Logger
+// closed. A nil Logger discards it.
+func (l *Logger) Log(r Record) {
+	if l == nil || len(l.sinks) == 0 {
+		return
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if !l.closed {
+		select {
+		case l.ch <- r:
+			return
+		default:
+		}
+	}
+	// reported once per queue of records dropped
+	if n := l.dropped.Add(1); n%queueSize == 1 {
+		l.log.Warn("operations log records dropped", "operation", r.Operation, "bucket", r.Bucket, "key", r.Key, "dropped", n)
+	}
+}
+
+// Dropped returns the number of records dropped so far.
+func (l *Logger) Dropped() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.dropped.Load()
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for r := range l.ch {
+		for _, s := range l.sinks {
+			if err := s.Write(context.Background(), r); err != nil {
+				l.log.Error("error writing operations log", "operation", r.Operation, "bucket", r.Bucket, "key", r.Key, "error", err)
+			}
+		}
+	}
+}
+
+// Close writes the queued records and closes the sinks.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	l.once.Do(func() {
+		l.mu.Lock()
+		l.closed = true
+		close(l.ch)
+		l.mu.Unlock()
+		<-l.done
+		if n := l.dropped.Load(); n > 0 {
+			l.log.Warn("operations log records dropped", "dropped", n)
+		}
+		for _, s := range l.sinks {
+			errs = append(errs, s.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
@@ -0,0 +1,37 @@
+//go:build !windows && !plan9
+
+package oplog
+
+import (
+	"context"
+	"encoding/json"
+	"log/syslog"
+)
+
+// syslogSink sends the records, as JSON, to a syslog daemon.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(network, address, tag string) (*syslogSink, error) {
+	if tag == "" {
+		tag = "eoss3"
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTHPRIV, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(ctx context.Context, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(data))
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
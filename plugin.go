@@ -28,7 +28,14 @@ func (plugin) New(config string) (backend.Backend, error) {
 	}
 
 	var cfg eoss3.Config
-	if err := mapstructure.Decode(m, &cfg); err != nil {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &cfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(m); err != nil {
 		return nil, err
 	}
 